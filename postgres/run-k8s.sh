@@ -2,6 +2,7 @@
 name="postgres"
 
 kubectl apply -f ../library-configmap.yaml
+kubectl apply -f ../library-secret.yaml
 kubectl apply -f ./$name-k8s-deployment.yaml
 kubectl apply -f ./$name-k8s-service.yaml
 sleep 2
@@ -23,32 +23,36 @@ func StartServer(ctx context.Context, port int, router *gin.Engine) error {
 	addr := ":" + portSrt
 	slog.Info("Starting API server on port.", "port", portSrt)
 
-	mutex.Lock()
-	server = &http.Server{
+	srv := &http.Server{
 		Addr:    addr,
 		Handler: router,
 	}
+	mutex.Lock()
+	server = srv
 	mutex.Unlock()
 
 	// Start the server
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start the server: %v", err)
 	}
 
 	return nil
 }
 
-// ShutdownServer shuts down the API server gracefully.
+// ShutdownServer stops the API server gracefully, waiting for the requests in
+// flight, or forcefully closes their connections once ctx is done.
 func ShutdownServer(ctx context.Context) error {
 	slog.Info("Shutting down API server gracefully...")
 
-	// Attempt to shutdown the server gracefully
 	mutex.Lock()
 	defer mutex.Unlock()
+	if server == nil {
+		return nil
+	}
+
 	if err := server.Shutdown(ctx); err != nil {
-		// If the Shutdown method returns an error, forcefully close the server
-		return fmt.Errorf("failed to start the server: %v", err)
-		//server.Close()
+		server.Close()
+		return fmt.Errorf("failed to shut down the server gracefully: %v", err)
 	}
 
 	return nil
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"library/api/handlers"
+	"library/auth"
+	"library/repository"
+	"net/http"
+	"time"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey holds the principal of a request in the gin context, for the logs.
+const principalKey = "principal"
+
+// Authenticate attaches the principal of the credentials of every request
+// to its context, answering 401 Unauthorized to invalid credentials. The
+// requests without credentials go on as guests. The context names the
+// client too, whose reads see its writes. A nil authenticator
+// disables authentication: every request is then authenticated as
+// auth.Anonymous.
+func Authenticate(authenticator *auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := auth.Anonymous
+		if authenticator != nil {
+			var ok bool
+			var err error
+			principal, ok, err = authenticator.Authenticate(c.Request)
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				slog.Warn("Rejected the credentials of a request.", "ip", c.ClientIP(), "path", c.Request.URL.Path, "error", err)
+				unauthorized(c, err.Error())
+				return
+			} else if err != nil {
+				slog.Error("Cannot authenticate a request.", "error", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, handlers.ErrorResponse{Error: "Cannot authenticate the request"})
+				return
+			}
+			if !ok {
+				principal = authenticator.Guest()
+			}
+		}
+		c.Set(principalKey, principal)
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Request = c.Request.WithContext(repository.WithClient(c.Request.Context(), rateClient(c)))
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="library"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, handlers.ErrorResponse{Error: message})
+}
+
+// logFormatter formats the request logs as gin does, with their principal.
+func logFormatter(param gin.LogFormatterParams) string {
+	principal := "-"
+	if p, ok := param.Keys[principalKey].(auth.Principal); ok && p.Authenticated() {
+		principal = p.String()
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency.Round(time.Microsecond),
+		param.ClientIP,
+		principal,
+		param.Method,
+		param.Path,
+		param.ErrorMessage,
+	)
+}
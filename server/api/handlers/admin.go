@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"library/auth"
+	"net/http"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@Summary		Applied runtime configuration
+//	@Description	Version of the runtime configuration the server applies, reloaded when its file changes or on SIGHUP
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	config.Applied	"Returns the applied configuration"
+//	@Failure		401	{object}	ErrorResponse	"Authentication required"
+//	@Failure		403	{object}	ErrorResponse	"Only the admin key of the deployment inspects the server"
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Router			/admin/config [get]
+//
+// AdminConfig handles the "GET /admin/config" endpoint to show the applied runtime configuration.
+func (h *Handler) AdminConfig(c *gin.Context) {
+	if !operator(c, "inspects the server") {
+		return
+	}
+	c.JSON(http.StatusOK, h.live.Current())
+}
+
+//	@Summary		Cache statistics
+//	@Description	Hits and misses of the cache of the books, by cached operation
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	repository.CacheStats	"Returns the cache statistics"
+//	@Failure		401	{object}	ErrorResponse			"Authentication required"
+//	@Failure		403	{object}	ErrorResponse			"Only the admin key of the deployment inspects the server"
+//	@Failure		404	{object}	ErrorResponse			"The cache is disabled"
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Router			/admin/cache [get]
+//
+// AdminCache handles the "GET /admin/cache" endpoint to show how well the books are cached.
+func (h *Handler) AdminCache(c *gin.Context) {
+	if !operator(c, "inspects the server") {
+		return
+	}
+	if h.cached == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "The cache is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, h.cached.Stats())
+}
+
+// RateLimitsResetResponse tells how many counters were reset.
+type RateLimitsResetResponse struct {
+	Reset int `json:"reset"`
+}
+
+//	@Summary		Rate limit counters
+//	@Description	Requests left to the clients in the buckets of the groups of routes and requests counted against their daily quotas, as counted by this instance of the server
+//	@Tags			admin
+//	@Produce		json
+//	@Param			client	query		string				false	"Client, such as api_key:3, session:1 or ip:10.0.0.1"
+//	@Success		200		{array}		ratelimit.Counter	"Returns the counters"
+//	@Failure		401		{object}	ErrorResponse		"Authentication required"
+//	@Failure		403		{object}	ErrorResponse		"Only the admin key of the deployment manages the rate limits"
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Router			/admin/ratelimits [get]
+//
+// ListRateLimits handles the "GET /admin/ratelimits" endpoint to inspect the
+// counters of the rate limits, shared by the tenants.
+func (h *Handler) ListRateLimits(c *gin.Context) {
+	uncacheable(c)
+	if !operator(c, "manages the rate limits") {
+		return
+	}
+	c.JSON(http.StatusOK, h.limiter.Counters(c.Query("client")))
+}
+
+//	@Summary		Reset rate limit counters
+//	@Description	Reset the counters of a client and a group of routes, of all of them when not given, which start over with a full bucket and an unused quota
+//	@Tags			admin
+//	@Produce		json
+//	@Param			client	query		string					false	"Client, such as api_key:3, session:1 or ip:10.0.0.1"
+//	@Param			group	query		string					false	"Group of routes, such as search or export"
+//	@Success		200		{object}	RateLimitsResetResponse	"Returns the number of counters reset"
+//	@Failure		401		{object}	ErrorResponse			"Authentication required"
+//	@Failure		403		{object}	ErrorResponse			"Only the admin key of the deployment manages the rate limits"
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Router			/admin/ratelimits [delete]
+//
+// ResetRateLimits handles the "DELETE /admin/ratelimits" endpoint to reset
+// the counters of the rate limits, shared by the tenants.
+func (h *Handler) ResetRateLimits(c *gin.Context) {
+	uncacheable(c)
+	if !operator(c, "manages the rate limits") {
+		return
+	}
+	reset := h.limiter.Reset(c.Query("client"), c.Query("group"))
+	principal, _ := auth.FromContext(c.Request.Context())
+	slog.Info("Reset rate limit counters.", "client", c.Query("client"), "group", c.Query("group"), "counters", reset, "by", principal.String())
+	c.JSON(http.StatusOK, RateLimitsResetResponse{Reset: reset})
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"errors"
+	"library/auth"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// PermissionsResponse describes the caller and what it may do.
+type PermissionsResponse struct {
+	Principal     string            `json:"principal"`
+	Name          string            `json:"name,omitempty"`
+	Authenticated bool              `json:"authenticated"`
+	Roles         []string          `json:"roles"`
+	Permissions   []auth.Permission `json:"permissions"`
+	// Tenant is the slug of the tenant serving the request
+	Tenant string `json:"tenant"`
+}
+
+//	@Summary		Permissions of the caller
+//	@Description	Roles and effective permissions of the caller, as a guest without credentials
+//	@Tags			auth
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Success		200	{object}	PermissionsResponse	"Returns the permissions of the caller"
+//	@Failure		401	{object}	ErrorResponse		"Invalid credentials"
+//	@Router			/auth/permissions [get]
+//
+// Permissions handles the "GET /auth/permissions" endpoint to list what the caller may do.
+func (h *Handler) Permissions(c *gin.Context) {
+	principal, _ := auth.FromContext(c.Request.Context())
+	c.JSON(http.StatusOK, PermissionsResponse{
+		Principal:     principal.String(),
+		Name:          principal.Name,
+		Authenticated: principal.Authenticated(),
+		Roles:         principal.Roles,
+		Permissions:   principal.Permissions(),
+		Tenant:        tenantOf(c).Slug,
+	})
+}
+
+// LoginRequest holds the credentials of a user, as JSON or as the form of
+// the login page.
+type LoginRequest struct {
+	Username string `json:"username" form:"username" binding:"required,max=64"`
+	Password string `json:"password" form:"password" binding:"required,max=72"`
+}
+
+// PasswordRequest changes the password of the user of a session.
+type PasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=12,max=72"`
+}
+
+// ResetRequest sets a password with a reset token.
+type ResetRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=12,max=72"`
+}
+
+// setSessionCookie keeps the session of a browser in a cookie the scripts
+// cannot read, not sent along the requests of other sites but to navigate.
+func setSessionCookie(c *gin.Context, session auth.Session) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	maxAge := int(time.Until(session.ExpiresAt).Seconds())
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.SessionCookie, session.Token, maxAge, "/", "", secure, true)
+}
+
+func clearSessionCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.SessionCookie, "", -1, "/", "", false, true)
+}
+
+// LoginPage handles the "GET /login" page, whose form logs in.
+func (h *Handler) LoginPage(c *gin.Context) {
+	uncacheable(c)
+	c.HTML(http.StatusOK, "login.html", gin.H{"OIDC": h.oidc != nil})
+}
+
+//	@Summary		Log in
+//	@Description	Open a session for a user with its password, returning its token and setting it in a cookie. The form of the login page is redirected to the welcome page.
+//	@Tags			auth
+//	@Accept			json
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Param			credentials	body		LoginRequest	true	"Username and password"
+//	@Success		200			{object}	auth.Session	"Returns the session"
+//	@Failure		400			{object}	ErrorResponse	"Invalid login data"
+//	@Failure		401			{object}	ErrorResponse	"Wrong username or password"
+//	@Failure		423			{object}	ErrorResponse	"Account locked after too many failed logins"
+//	@Failure		500			{object}	ErrorResponse	"Failed to log in"
+//	@Router			/auth/login [post]
+//
+// Login handles the "POST /auth/login" endpoint to open a session.
+func (h *Handler) Login(c *gin.Context) {
+	uncacheable(c)
+	form := c.ContentType() == binding.MIMEPOSTForm
+	fail := func(status int, message string, username string) {
+		if form {
+			c.HTML(status, "login.html", gin.H{"Error": message, "Username": username, "OIDC": h.oidc != nil})
+			return
+		}
+		c.JSON(status, ErrorResponse{Error: message})
+	}
+
+	var request LoginRequest
+	if err := c.ShouldBind(&request); err != nil {
+		fail(http.StatusBadRequest, "Invalid login data. "+err.Error(), request.Username)
+		return
+	}
+	session, err := h.accounts.Login(c.Request.Context(), request.Username, request.Password)
+	var locked *auth.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(locked.Until).Seconds()))))
+		fail(http.StatusLocked, "Account locked after too many failed logins. Try again later.", request.Username)
+		return
+	} else if errors.Is(err, auth.ErrInvalidCredentials) {
+		slog.Warn("Rejected a login.", "user", request.Username, "ip", c.ClientIP())
+		fail(http.StatusUnauthorized, "Wrong username or password", request.Username)
+		return
+	} else if err != nil {
+		slog.Error("Cannot log a user in.", "user", request.Username, "error", err)
+		fail(http.StatusInternalServerError, "Failed to log in", request.Username)
+		return
+	}
+
+	slog.Info("Logged a user in.", "user", session.User.Username, "ip", c.ClientIP())
+	setSessionCookie(c, session)
+	if form {
+		c.Redirect(http.StatusSeeOther, "/")
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+//	@Summary		Log out
+//	@Description	Close the session of the caller and clear its cookie. The forms are redirected to the welcome page.
+//	@Tags			auth
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	MessageResponse	"Returns a success message"
+//	@Failure		401	{object}	ErrorResponse	"No session, or an expired one"
+//	@Failure		500	{object}	ErrorResponse	"Failed to log out"
+//	@Router			/auth/logout [post]
+//
+// Logout handles the "POST /auth/logout" endpoint to close a session.
+func (h *Handler) Logout(c *gin.Context) {
+	uncacheable(c)
+	token := auth.SessionToken(c.Request)
+	clearSessionCookie(c)
+	var err error
+	if token != "" {
+		err = h.accounts.Logout(c.Request.Context(), token)
+	}
+	if c.ContentType() == binding.MIMEPOSTForm {
+		c.Redirect(http.StatusSeeOther, "/")
+		return
+	}
+	if token == "" || errors.Is(err, auth.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "No session to log out of"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log out. " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Logged out"})
+}
+
+//	@Summary		Refresh a session
+//	@Description	Replace the session of the caller by a new one, lasting the session TTL from now
+//	@Tags			auth
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	auth.Session	"Returns the new session"
+//	@Failure		401	{object}	ErrorResponse	"No session, or an expired one"
+//	@Failure		500	{object}	ErrorResponse	"Failed to refresh the session"
+//	@Router			/auth/refresh [post]
+//
+// Refresh handles the "POST /auth/refresh" endpoint to renew a session.
+func (h *Handler) Refresh(c *gin.Context) {
+	uncacheable(c)
+	token := auth.SessionToken(c.Request)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "No session to refresh"})
+		return
+	}
+	session, err := h.accounts.Refresh(c.Request.Context(), token)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to refresh the session. " + err.Error()})
+		return
+	}
+	setSessionCookie(c, session)
+	c.JSON(http.StatusOK, session)
+}
+
+//	@Summary		Change the password
+//	@Description	Change the password of the user of the session, closing its other sessions
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			password	body		PasswordRequest	true	"Current and new passwords"
+//	@Success		200			{object}	MessageResponse	"Returns a success message"
+//	@Failure		400			{object}	ErrorResponse	"Invalid JSON data"
+//	@Failure		401			{object}	ErrorResponse	"No session, or a wrong current password"
+//	@Failure		500			{object}	ErrorResponse	"Failed to change the password"
+//	@Router			/auth/password [post]
+//
+// ChangePassword handles the "POST /auth/password" endpoint to change the
+// password of the user of a session.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	uncacheable(c)
+	token := auth.SessionToken(c.Request)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Log in to change your password"})
+		return
+	}
+	var request PasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON data. " + err.Error()})
+		return
+	}
+	err := h.accounts.ChangePassword(c.Request.Context(), token, request.CurrentPassword, request.NewPassword)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change the password. " + err.Error()})
+		return
+	}
+	principal, _ := auth.FromContext(c.Request.Context())
+	slog.Info("Changed the password of a user.", "user", principal.Name)
+	c.JSON(http.StatusOK, MessageResponse{Message: "Password changed"})
+}
+
+//	@Summary		Reset a password
+//	@Description	Set the password of a user with a reset token issued by an admin, unlocking the account and closing its sessions
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			reset	body		ResetRequest	true	"Reset token and new password"
+//	@Success		200		{object}	MessageResponse	"Returns a success message"
+//	@Failure		400		{object}	ErrorResponse	"Invalid JSON data"
+//	@Failure		401		{object}	ErrorResponse	"Unknown or expired reset token"
+//	@Failure		500		{object}	ErrorResponse	"Failed to reset the password"
+//	@Router			/auth/reset [post]
+//
+// ResetPassword handles the "POST /auth/reset" endpoint to set a password
+// with a reset token.
+func (h *Handler) ResetPassword(c *gin.Context) {
+	uncacheable(c)
+	var request ResetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON data. " + err.Error()})
+		return
+	}
+	err := h.accounts.ResetPassword(c.Request.Context(), request.Token, request.NewPassword)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset the password. " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Password reset"})
+}
+
+// flowCookie keeps the state of a login with the OpenID provider until its
+// callback, for as long as the user may take to log in there.
+const (
+	flowCookie = "library_oidc"
+	flowMaxAge = 10 * 60
+)
+
+//	@Summary		Log in with the identity provider
+//	@Description	Redirect the browser to the OpenID provider to log in, by the authorization code flow with PKCE
+//	@Tags			auth
+//	@Success		302	"Redirects to the OpenID provider"
+//	@Failure		404	{object}	ErrorResponse	"No OpenID provider is configured"
+//	@Failure		500	{object}	ErrorResponse	"Failed to start the login"
+//	@Router			/auth/oidc/login [get]
+//
+// OIDCLogin handles the "GET /auth/oidc/login" endpoint to start a login
+// with the OpenID provider.
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	uncacheable(c)
+	if h.oidc == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No identity provider is configured"})
+		return
+	}
+	flow, url, err := h.oidc.Start()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start the login. " + err.Error()})
+		return
+	}
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(flowCookie, flow.Encode(), flowMaxAge, "/auth/oidc", "", secure, true)
+	c.Redirect(http.StatusFound, url)
+}
+
+//	@Summary		Finish a login with the identity provider
+//	@Description	Exchange the authorization code the OpenID provider redirected the browser with for a session, set in a cookie, and redirect to the welcome page
+//	@Tags			auth
+//	@Param			code	query	string	true	"Authorization code"
+//	@Param			state	query	string	true	"State of the login"
+//	@Success		303		"Redirects to the welcome page"
+//	@Failure		401		"The provider refused the login, shown on the login page"
+//	@Failure		404		{object}	ErrorResponse	"No OpenID provider is configured"
+//	@Failure		500		"Failed to log in, shown on the login page"
+//	@Router			/auth/oidc/callback [get]
+//
+// OIDCCallback handles the "GET /auth/oidc/callback" endpoint the OpenID
+// provider redirects to, to finish a login.
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	uncacheable(c)
+	if h.oidc == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No identity provider is configured"})
+		return
+	}
+	fail := func(status int, message string) {
+		c.HTML(status, "login.html", gin.H{"Error": message, "OIDC": true})
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(flowCookie, "", -1, "/auth/oidc", "", false, true)
+	if reason := c.Query("error"); reason != "" {
+		slog.Warn("The identity provider refused a login.", "error", reason, "description", c.Query("error_description"), "ip", c.ClientIP())
+		fail(http.StatusUnauthorized, "The identity provider refused the login: "+reason)
+		return
+	}
+	value, err := c.Cookie(flowCookie)
+	if err != nil {
+		fail(http.StatusBadRequest, "The login expired or started in another browser. Try again.")
+		return
+	}
+	flow, err := auth.DecodeFlow(value)
+	if err != nil {
+		fail(http.StatusBadRequest, "The login expired or started in another browser. Try again.")
+		return
+	}
+
+	session, err := h.oidc.Finish(c.Request.Context(), flow, c.Query("state"), c.Query("code"), tenantOf(c).Slug)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		slog.Warn("Rejected a login with the identity provider.", "error", err, "ip", c.ClientIP())
+		fail(http.StatusUnauthorized, "The identity provider did not vouch for the login. Try again.")
+		return
+	} else if err != nil {
+		slog.Error("Cannot log a user in with the identity provider.", "error", err)
+		fail(http.StatusInternalServerError, "Failed to log in with the identity provider")
+		return
+	}
+
+	slog.Info("Logged a user in with the identity provider.", "user", session.User.Username, "ip", c.ClientIP())
+	setSessionCookie(c, session)
+	c.Redirect(http.StatusSeeOther, "/")
+}
@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"errors"
+	"library/auth"
+	"library/config"
+	"library/health"
 	"library/models"
+	"library/ratelimit"
+	"library/repository"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"gorm.io/gorm"
 )
 
 var validate *validator.Validate
@@ -17,6 +22,55 @@ func init() {
 	validate = validator.New()
 }
 
+// Handler serves the endpoints from the books of a repository, with the
+// limits of the live configuration, reports the health of the server and
+// manages the API keys of its clients.
+type Handler struct {
+	books    repository.BookRepository
+	keys     repository.KeyRepository
+	accounts *auth.Accounts
+	tenants  repository.TenantRepository
+	// oidc logs the users in with an OpenID provider, nil without one
+	oidc *auth.OIDC
+	// limiter counts the requests of the clients against their rate limits
+	limiter *ratelimit.Limiter
+	live    *config.Live
+	health  *health.Health
+	// oai configures the OAI-PMH provider
+	oai config.OAIConfig
+	// cached is the repository when it caches the books, nil otherwise
+	cached *repository.Cached
+}
+
+// New returns a Handler serving the books of the repository, and managing
+// the API keys of the key repository, the users of the accounts, who may log
+// in with the OpenID provider oidc unless nil, the tenants of the tenant
+// repository and the counters of the rate limiter, and harvested by the
+// OAI-PMH provider oai configures.
+func New(books repository.BookRepository, keys repository.KeyRepository, accounts *auth.Accounts, tenants repository.TenantRepository, oidc *auth.OIDC, limiter *ratelimit.Limiter, live *config.Live, health *health.Health, oai config.OAIConfig) *Handler {
+	cached, _ := books.(*repository.Cached)
+	return &Handler{books: books, keys: keys, accounts: accounts, tenants: tenants, oidc: oidc, limiter: limiter, live: live, health: health, oai: oai, cached: cached}
+}
+
+// cacheable lets the client reuse a response for the cache max age of the
+// live configuration, or asks it to revalidate it. The books depend on the
+// tenant and the credentials of the request, so the response stays private
+// to the client and the shared caches never store it.
+func (h *Handler) cacheable(c *gin.Context) {
+	maxAge := h.live.Runtime().CacheMaxAge
+	if maxAge < time.Second {
+		c.Header("Cache-Control", "private, no-cache")
+		return
+	}
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+}
+
+// uncacheable keeps the clients and proxies from storing the response of a
+// write.
+func uncacheable(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+}
+
 //	@Summary		Add a new book
 //	@Description	Add a new book to the library
 //	@Tags			books
@@ -26,10 +80,14 @@ func init() {
 //	@Success		201		{object}	models.Book		"Returns the newly created book"
 //	@Failure		400		{object}	ErrorResponse	"Invalid JSON data or validation error"
 //	@Failure		500		{object}	ErrorResponse	"Failed to create book"
+//	@Failure		401	{object}	ErrorResponse	"Authentication required"
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
 //	@Router			/books [post]
 //
 // AddBook handles the "POST /books" endpoint to create a new book.
-func AddBook(c *gin.Context) {
+func (h *Handler) AddBook(c *gin.Context) {
+	uncacheable(c)
 	// Bind the JSON request body to a Book struct
 	var newBook models.Book
 	if err := c.ShouldBindJSON(&newBook); err != nil {
@@ -42,9 +100,8 @@ func AddBook(c *gin.Context) {
 		return
 	}
 
-	// Create a new record in the database
-	db := c.MustGet("db").(*gorm.DB)
-	err := db.Create(&newBook).Error
+	// Create a new record in the repository
+	err := h.books.Create(c.Request.Context(), &newBook)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create book" + err.Error()})
 		return
@@ -54,9 +111,9 @@ func AddBook(c *gin.Context) {
 }
 
 //	@Summary		Get a book by ID
-//	@Description	Retrieve a book by its ID
+//	@Description	Retrieve a book by its ID, as JSON, a MARCXML record or a BibTeX, RIS or CSL-JSON reference
 //	@Tags			books
-//	@Produce		json
+//	@Produce		json,application/marc+xml,application/x-bibtex,application/x-research-info-systems,application/vnd.citationstyles.csl+json
 //	@Param			id	path		int				true	"Book ID"
 //	@Success		200	{object}	models.Book		"Returns the requested book"
 //	@Failure		400	{object}	ErrorResponse	"Invalid book ID"
@@ -65,7 +122,7 @@ func AddBook(c *gin.Context) {
 //	@Router			/books/{id} [get]
 //
 // GetBook handles the "GET /books/:id" endpoint to retrieve a specific book by its ID.
-func GetBook(c *gin.Context) {
+func (h *Handler) GetBook(c *gin.Context) {
 	bookIDParam := c.Param("id")
 
 	bookID, err := strconv.Atoi(bookIDParam)
@@ -81,37 +138,33 @@ func GetBook(c *gin.Context) {
 		return
 	}
 
-	var book models.Book
-	db := c.MustGet("db").(*gorm.DB)
-	result := db.First(&book, bookID)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + result.Error.Error()})
+	book, err := h.books.Get(c.Request.Context(), uint(bookID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + err.Error()})
 		return
-	} else if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch book" + result.Error.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch book" + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, book)
+	h.cacheable(c)
+	renderBook(c, http.StatusOK, book)
 }
 
 // @Summary		List books
-// @Description	Retrieve a list of all books
+// @Description	Retrieve a list of all books, as JSON or as BibTeX, RIS or CSL-JSON references
 // @Tags		books
-// @Produce		json
+// @Produce		json,application/x-bibtex,application/x-research-info-systems,application/vnd.citationstyles.csl+json
 // @Success		200	{array}		models.Book		"Returns the list of books"
 // @Failure		500	{object}	ErrorResponse	"Failed to retrieve books"
 // @Router		/books [get]
-func ListBooks(c *gin.Context) {
-	var books []models.Book
-	db := c.MustGet("db").(*gorm.DB)
-	result := db.Find(&books)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve books" + result.Error.Error()})
+func (h *Handler) ListBooks(c *gin.Context) {
+	books, err := h.books.List(c.Request.Context(), repository.ListOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve books" + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, books)
+	renderBooks(c, http.StatusOK, books)
 }
 
 // @Summary		Update a book
@@ -125,8 +178,12 @@ func ListBooks(c *gin.Context) {
 // @Failure		400		{object}	ErrorResponse	"Invalid JSON data or validation error"
 // @Failure		404		{object}	ErrorResponse	"Book not found"
 // @Failure		500		{object}	ErrorResponse	"Failed to update book"
+// @Failure		401	{object}	ErrorResponse	"Authentication required"
+// @Security		ApiKeyAuth
+// @Security		BearerAuth
 // @Router			/books/{id} [put]
-func UpdateBook(c *gin.Context) {
+func (h *Handler) UpdateBook(c *gin.Context) {
+	uncacheable(c)
 	var book models.Book
 	if err := c.ShouldBindJSON(&book); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON data. " + err.Error()})
@@ -140,30 +197,16 @@ func UpdateBook(c *gin.Context) {
 		return
 	}
 
-	var existingBook models.Book
-	db := c.MustGet("db").(*gorm.DB)
-	result := db.First(&existingBook, book.ID)
-
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + result.Error.Error()})
+	err = h.books.Update(c.Request.Context(), &book)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + err.Error()})
 		return
-	}
-
-	existingBook.Title = book.Title
-	existingBook.Author = book.Author
-	existingBook.Published = book.Published
-	existingBook.Edition = book.Edition
-	existingBook.Description = book.Description
-	existingBook.GenreName = book.GenreName
-
-	result = db.Save(&existingBook)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update book" + result.Error.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update book" + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, existingBook)
+	c.JSON(http.StatusOK, book)
 }
 
 // @Summary		Patch a book
@@ -177,26 +220,29 @@ func UpdateBook(c *gin.Context) {
 // @Failure		400		{object}	ErrorResponse	"Invalid JSON data or validation error"
 // @Failure		404		{object}	ErrorResponse	"Book not found"
 // @Failure		500		{object}	ErrorResponse	"Failed to update book"
+// @Failure		401	{object}	ErrorResponse	"Authentication required"
+// @Security		ApiKeyAuth
+// @Security		BearerAuth
 // @Router		/books/{id} [patch]
-func PatchBook(c *gin.Context) {
+func (h *Handler) PatchBook(c *gin.Context) {
+	uncacheable(c)
 	var updates map[string]interface{}
 	if err := c.ShouldBindJSON(&updates); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON data. " + err.Error()})
 		return
 	}
 
-	var existingBook models.Book
-	db := c.MustGet("db").(*gorm.DB)
-	result := db.First(&existingBook, c.Param("id"))
-
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + result.Error.Error()})
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + err.Error()})
 		return
 	}
 
-	result = db.Model(&existingBook).Updates(updates)
-
-	if result.Error != nil {
+	existingBook, err := h.books.Patch(c.Request.Context(), uint(bookID), updates)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update book"})
 		return
 	}
@@ -213,8 +259,12 @@ func PatchBook(c *gin.Context) {
 // @Failure		400	{object}	ErrorResponse	"Invalid book ID"
 // @Failure		404	{object}	ErrorResponse	"Book not found"
 // @Failure		500	{object}	ErrorResponse	"Failed to delete book"
+// @Failure		401	{object}	ErrorResponse	"Authentication required"
+// @Security		ApiKeyAuth
+// @Security		BearerAuth
 // @Router		/books/{id} [delete]
-func DeleteBook(c *gin.Context) {
+func (h *Handler) DeleteBook(c *gin.Context) {
+	uncacheable(c)
 	// Get the book ID from the URL parameter
 	bookIDStr := c.Param("id")
 	bookID, err := strconv.Atoi(bookIDStr)
@@ -223,17 +273,11 @@ func DeleteBook(c *gin.Context) {
 		return
 	}
 
-	var existingBook models.Book
-	db := c.MustGet("db").(*gorm.DB)
-	result := db.First(&existingBook, bookID)
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + result.Error.Error()})
+	err = h.books.Delete(c.Request.Context(), uint(bookID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + err.Error()})
 		return
-	}
-
-	result = db.Delete(&existingBook)
-
-	if result.Error != nil {
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete book"})
 		return
 	}
@@ -242,9 +286,10 @@ func DeleteBook(c *gin.Context) {
 }
 
 //	@Summary		Search for books
-//	@Description	Search for books based on various criteria
+//	@Description	Search for books based on various criteria, as JSON or as BibTeX, RIS or CSL-JSON references
 //	@Tags			books
-//	@Produce		json
+//	@Produce		json,application/x-bibtex,application/x-research-info-systems,application/vnd.citationstyles.csl+json
+//	@Param			q			query		string			false	"Free text matching the title or the author"
 //	@Param			title		query		string			false	"Title of the book"
 //	@Param			author		query		string			false	"Author of the book"
 //	@Param			from		query		string			false	"Published date range start (YYYY-MM-DD)"
@@ -256,51 +301,19 @@ func DeleteBook(c *gin.Context) {
 //	@Router			/books/search [get]
 //
 // SearchBooks handles the "GET /books/search" endpoint to search for books.
-func SearchBooks(c *gin.Context) {
-	// Define a struct for query parameters and add validation tags
-	type SearchParams struct {
-		Title       string `form:"title"`
-		Author      string `form:"author"`
-		From        string `form:"from" validate:"omitempty,datetime=2006-01-02"`
-		To          string `form:"to" validate:"omitempty,datetime=2006-01-02"`
-		Description string `form:"description"`
-		Genre       string `form:"genre"`
-	}
-
-	var params SearchParams
-
-	// Bind query parameters to the struct and validate
-	if err := c.ShouldBindQuery(&params); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters. " + err.Error()})
-		return
-	}
-
-	// Validate the struct
-	if err := validate.Struct(params); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: getValidationErrors(err)})
+func (h *Handler) SearchBooks(c *gin.Context) {
+	params, ok := bindSearchParams(c)
+	if !ok {
 		return
 	}
 
-	// Build the search query
-	db := c.MustGet("db").(*gorm.DB)
-	query := buildSearchQuery(db, map[string]string{
-		"title":       params.Title,
-		"author":      params.Author,
-		"from":        params.From,
-		"to":          params.To,
-		"description": params.Description,
-		"genre":       params.Genre,
-	})
-
-	var books []models.Book
-	result := query.Find(&books)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch books" + result.Error.Error()})
+	books, err := h.books.Search(c.Request.Context(), params.Filter(), repository.ListOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch books" + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, books)
+	renderBooks(c, http.StatusOK, books)
 }
 
 // @Summary		Count books
@@ -310,41 +323,68 @@ func SearchBooks(c *gin.Context) {
 // @Success		200	{integer}	int64			"Returns the total count of books"
 // @Failure		500	{object}	ErrorResponse	"Failed to retrieve books count"
 // @Router		/books/count [get]
-func CountBooks(c *gin.Context) {
-	var count int64
-	db := c.MustGet("db").(*gorm.DB)
-	result := db.Model(&models.Book{}).Count(&count)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve books count" + result.Error.Error()})
+func (h *Handler) CountBooks(c *gin.Context) {
+	count, err := h.books.Count(c.Request.Context(), repository.Filter{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve books count" + err.Error()})
 		return
 	}
+	h.cacheable(c)
 	c.JSON(http.StatusOK, count)
 }
 
-// buildSearchQuery constructs a GORM query based on provided parameters.
-func buildSearchQuery(db *gorm.DB, params map[string]string) *gorm.DB {
-	query := db
-	for key, value := range params {
-		switch key {
-		case "author":
-			query = query.Where("author LIKE ?", "%"+value+"%")
-		case "genre":
-			query = query.Where("genre_name LIKE ?", "%"+value+"%")
-		case "title":
-			query = query.Where("title LIKE ?", "%"+value+"%")
-		case "from":
-			// Assuming "from" is the parameter for the start of the date range
-			if value != "" {
-				query = query.Where("published >= ?", value)
-			}
-		case "to":
-			// Assuming "to" is the parameter for the end of the date range
-			if value != "" {
-				query = query.Where("published <= ?", value)
-			}
-		case "description":
-			query = query.Where("description LIKE ?", "%"+value+"%")
-		}
+// SearchParams defines the query parameters of a book search and their validation.
+type SearchParams struct {
+	Query       string `form:"q"`
+	Title       string `form:"title"`
+	Author      string `form:"author"`
+	From        string `form:"from" validate:"omitempty,datetime=2006-01-02"`
+	To          string `form:"to" validate:"omitempty,datetime=2006-01-02"`
+	Description string `form:"description"`
+	Genre       string `form:"genre"`
+}
+
+func (p SearchParams) toMap() map[string]string {
+	return map[string]string{
+		"q":           p.Query,
+		"title":       p.Title,
+		"author":      p.Author,
+		"from":        p.From,
+		"to":          p.To,
+		"description": p.Description,
+		"genre":       p.Genre,
+	}
+}
+
+// Filter returns the repository filter matching the parameters.
+func (p SearchParams) Filter() repository.Filter {
+	return repository.Filter{
+		Query:       p.Query,
+		Title:       p.Title,
+		Author:      p.Author,
+		From:        p.From,
+		To:          p.To,
+		Description: p.Description,
+		Genre:       p.Genre,
+	}
+}
+
+// bindSearchParams binds and validates the search query parameters, replying
+// with 400 Bad Request when they are invalid.
+func bindSearchParams(c *gin.Context) (SearchParams, bool) {
+	var params SearchParams
+
+	// Bind query parameters to the struct and validate
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query parameters. " + err.Error()})
+		return params, false
+	}
+
+	// Validate the struct
+	if err := validate.Struct(params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: getValidationErrors(err)})
+		return params, false
 	}
-	return query
+
+	return params, true
 }
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"library/citation"
+	"library/repository"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@Summary		Cite a book
+//	@Description	Render a formatted citation of a book in the APA, MLA or Chicago style
+//	@Tags			books
+//	@Produce		json,plain
+//	@Param			id		path		int					true	"Book ID"
+//	@Param			style	query		string				false	"Citation style: apa (default), mla or chicago"
+//	@Success		200		{object}	CitationResponse	"Returns the formatted citation"
+//	@Failure		400		{object}	ErrorResponse		"Invalid book ID or unknown style"
+//	@Failure		404		{object}	ErrorResponse		"Book not found"
+//	@Failure		500		{object}	ErrorResponse		"Failed to fetch book"
+//	@Router			/books/{id}/cite [get]
+//
+// CiteBook handles the "GET /books/:id/cite" endpoint to render a citation of a book.
+func (h *Handler) CiteBook(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid book ID" + err.Error()})
+		return
+	}
+
+	style, err := citation.ParseStyle(c.DefaultQuery("style", string(citation.APA)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unknown citation style " + c.Query("style")})
+		return
+	}
+
+	book, err := h.books.Get(c.Request.Context(), uint(bookID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found" + err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch book" + err.Error()})
+		return
+	}
+
+	formatted, err := citation.Format(book, style)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to format citation" + err.Error()})
+		return
+	}
+
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEPlain) == gin.MIMEPlain {
+		c.String(http.StatusOK, formatted)
+		return
+	}
+	c.JSON(http.StatusOK, CitationResponse{Style: string(style), Citation: formatted})
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"library/feeds"
+	"library/models"
+	"library/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	feedSize    = 20
+	feedMaxSize = 100
+	feedMaxAge  = 5 * time.Minute
+)
+
+//	@Summary		New arrivals Atom feed
+//	@Description	Atom feed of the books most recently added to the catalogue. Supports conditional GET.
+//	@Tags			feeds
+//	@Produce		application/atom+xml
+//	@Param			genre	query		string			false	"Genre of the books"
+//	@Param			author	query		string			false	"Author of the books"
+//	@Param			limit	query		int				false	"Number of entries"
+//	@Success		200		{string}	string			"Returns the feed"
+//	@Success		304		{string}	string			"The feed did not change"
+//	@Failure		500		{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/feeds/new.atom [get]
+//
+// NewArrivalsAtom handles the "GET /feeds/new.atom" endpoint.
+func (h *Handler) NewArrivalsAtom(c *gin.Context) {
+	h.newArrivals(c, "application/atom+xml", func(channel feeds.Channel, books []models.Book, updated time.Time) any {
+		return channel.Atom(books, updated)
+	})
+}
+
+//	@Summary		New arrivals RSS feed
+//	@Description	RSS feed of the books most recently added to the catalogue. Supports conditional GET.
+//	@Tags			feeds
+//	@Produce		application/rss+xml
+//	@Param			genre	query		string			false	"Genre of the books"
+//	@Param			author	query		string			false	"Author of the books"
+//	@Param			limit	query		int				false	"Number of items"
+//	@Success		200		{string}	string			"Returns the feed"
+//	@Success		304		{string}	string			"The feed did not change"
+//	@Failure		500		{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/feeds/new.rss [get]
+//
+// NewArrivalsRSS handles the "GET /feeds/new.rss" endpoint.
+func (h *Handler) NewArrivalsRSS(c *gin.Context) {
+	h.newArrivals(c, "application/rss+xml", func(channel feeds.Channel, books []models.Book, updated time.Time) any {
+		return channel.RSS(books, updated)
+	})
+}
+
+// newArrivals lists the newest books matching the genre and author filters,
+// answering 304 Not Modified when the catalogue did not change since the
+// client's last poll.
+func (h *Handler) newArrivals(c *gin.Context, contentType string, render func(feeds.Channel, []models.Book, time.Time) any) {
+	// Any change to the catalogue, deletions included, may change the feed
+	lastModified, err := latestUpdate(c.Request.Context(), h.books)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the feed" + err.Error()})
+		return
+	}
+	etag := feedETag(c.Request.URL.Path, c.Request.URL.RawQuery, lastModified)
+	if notModified(c, etag, lastModified) {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = feedSize
+	}
+	if limit > feedMaxSize {
+		limit = feedMaxSize
+	}
+
+	filter := repository.Filter{Genre: c.Query("genre"), Author: c.Query("author")}
+	books, err := h.books.Search(c.Request.Context(), filter, repository.ListOptions{Order: repository.OrderByNewest, Limit: limit})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the feed" + err.Error()})
+		return
+	}
+
+	origin := requestOrigin(c)
+	channel := feeds.Channel{
+		ID:          "urn:library:feeds:new",
+		Title:       "Library: new arrivals",
+		Description: "Books recently added to the library catalogue",
+		Link:        origin + "/api/v1/books",
+		Self:        origin + c.Request.URL.RequestURI(),
+		BookURL: func(id uint) string {
+			return origin + "/api/v1/books/" + strconv.FormatUint(uint64(id), 10)
+		},
+	}
+	updated := feeds.Updated(books, lastModified)
+
+	writeXML(c, contentType, render(channel, books, updated))
+}
+
+// notModified sets the validators of a response and reports whether the
+// request's conditional headers match them, in which case it answers 304.
+// The feeds list the books of the tenant of the request, so only the client
+// may keep them.
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(feedMaxAge.Seconds())))
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 9110)
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				c.Status(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+
+	if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		if !lastModified.Truncate(time.Second).After(since) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// feedETag derives a weak entity tag from the request and the last change of the catalogue.
+func feedETag(path, query string, lastModified time.Time) string {
+	hash := sha1.Sum([]byte(path + "?" + query + "@" + strconv.FormatInt(lastModified.UnixNano(), 10)))
+	return `W/"` + hex.EncodeToString(hash[:8]) + `"`
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"library/auth"
+	"library/gql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	graphqlMaxDepth      = 8
+	graphqlMaxComplexity = 5000
+)
+
+var graphqlServer *gql.Server
+
+func init() {
+	var err error
+	graphqlServer, err = gql.NewServer(graphqlMaxDepth, graphqlMaxComplexity)
+	if err != nil {
+		panic("invalid GraphQL schema: " + err.Error())
+	}
+}
+
+//	@Summary		GraphQL endpoint
+//	@Description	Query and change the books with GraphQL. Queries may be sent with GET or POST, mutations only with POST by a client with their permission.
+//	@Tags			graphql
+//	@Accept			json,application/graphql
+//	@Produce		json
+//	@Param			query			query		string			false	"GraphQL document, for GET requests"
+//	@Param			operationName	query		string			false	"Operation to run, for GET requests"
+//	@Param			variables		query		string			false	"JSON encoded variables, for GET requests"
+//	@Success		200				{object}	object			"Returns the data and the errors of the operation"
+//	@Failure		400				{object}	ErrorResponse	"Invalid request, or operation rejected before it ran"
+//	@Router			/graphql [post]
+//
+// GraphQL handles the "GET /graphql" and "POST /graphql" endpoints.
+func (h *Handler) GraphQL(c *gin.Context) {
+	request, err := bindGraphQLRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid GraphQL request. " + err.Error()})
+		return
+	}
+
+	result, executed := graphqlServer.Do(c.Request.Context(), h.books, request, authorizeMutation(c))
+
+	// Errors raised while executing are reported along with the data
+	status := http.StatusOK
+	if !executed {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, result)
+}
+
+// graphqlMutations are the permissions the GraphQL mutations require.
+var graphqlMutations = map[string]auth.Permission{
+	"addBook":    auth.PermBooksWrite,
+	"updateBook": auth.PermBooksWrite,
+	"patchBook":  auth.PermBooksWrite,
+	"deleteBook": auth.PermBooksDelete,
+}
+
+// authorizeMutation tells why a mutation of a request may not run, as they
+// must be sent with POST by a principal with their permission, or returns nil.
+func authorizeMutation(c *gin.Context) func(mutation string) error {
+	return func(mutation string) error {
+		if c.Request.Method != http.MethodPost {
+			return errors.New("Mutations must be sent with POST")
+		}
+		permission, ok := graphqlMutations[mutation]
+		if !ok {
+			return fmt.Errorf("No policy authorizes the %s mutation", mutation)
+		}
+		return auth.Check(c.Request.Context(), permission)
+	}
+}
+
+func bindGraphQLRequest(c *gin.Context) (gql.Request, error) {
+	var request gql.Request
+
+	if c.Request.Method == http.MethodGet {
+		request.Query = c.Query("query")
+		request.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return request, err
+			}
+		}
+	} else if strings.HasPrefix(c.ContentType(), "application/graphql") {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return request, err
+		}
+		request.Query = string(body)
+	} else if err := c.ShouldBindJSON(&request); err != nil {
+		return request, err
+	}
+
+	if strings.TrimSpace(request.Query) == "" {
+		return request, errors.New("the query is missing")
+	}
+	return request, nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@Summary		Readiness check
+//	@Description	Check whether the server accepts new requests: its dependencies are up, with their latency, and it is not shutting down. The errors and details of the dependencies are shown with verbose.
+//	@Tags			info
+//	@Produce		json
+//	@Param			verbose	query		bool			false	"Show the errors and details of the dependencies"
+//	@Success		200		{object}	health.Report	"The server is ready, possibly degraded"
+//	@Failure		503		{object}	health.Report	"A dependency is down, or the server is draining before shutting down"
+//	@Router			/readyz [get]
+//
+// Readiness handles the "GET /readyz" endpoint, which Kubernetes probes to route requests to the server.
+func (h *Handler) Readiness(c *gin.Context) {
+	report := h.health.Check(c.Request.Context())
+	if !verbose(c) {
+		report = report.Brief()
+	}
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// verbose reports whether the query asks for details, as "?verbose" or
+// "?verbose=true".
+func verbose(c *gin.Context) bool {
+	value, ok := c.GetQuery("verbose")
+	if !ok {
+		return false
+	}
+	if value == "" {
+		return true
+	}
+	v, _ := strconv.ParseBool(value)
+	return v
+}
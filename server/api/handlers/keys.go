@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"library/auth"
+	"library/models"
+	"library/repository"
+	"net/http"
+	"strconv"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyRequest describes an API key to create.
+type KeyRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+	// Role is patron, librarian or admin
+	Role string `json:"role" binding:"required,oneof=patron librarian admin"`
+}
+
+// CreatedKey is a new API key, the only time the key itself is shown.
+type CreatedKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+//	@Summary		List the API keys
+//	@Description	List the API keys, revoked ones included, without the keys themselves
+//	@Tags			admin
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Success		200	{array}		models.APIKey	"Returns the API keys"
+//	@Failure		401	{object}	ErrorResponse	"Authentication required"
+//	@Failure		403	{object}	ForbiddenResponse	"The keys:manage permission is required"
+//	@Failure		500	{object}	ErrorResponse	"Failed to list the API keys"
+//	@Router			/admin/keys [get]
+//
+// ListKeys handles the "GET /admin/keys" endpoint to list the API keys.
+func (h *Handler) ListKeys(c *gin.Context) {
+	keys, err := h.keys.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list the API keys. " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+//	@Summary		Create an API key
+//	@Description	Create an API key, returned once: only its hash is stored
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Param			key	body		KeyRequest		true	"Name and role of the key"
+//	@Success		201	{object}	CreatedKey		"Returns the new key"
+//	@Failure		400	{object}	ErrorResponse	"Invalid JSON data"
+//	@Failure		401	{object}	ErrorResponse	"Authentication required"
+//	@Failure		403	{object}	ForbiddenResponse	"The keys:manage permission is required"
+//	@Failure		500	{object}	ErrorResponse	"Failed to create the API key"
+//	@Router			/admin/keys [post]
+//
+// CreateKey handles the "POST /admin/keys" endpoint to create an API key.
+func (h *Handler) CreateKey(c *gin.Context) {
+	uncacheable(c)
+	var request KeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON data. " + err.Error()})
+		return
+	}
+
+	key, hash, err := auth.NewKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create the API key. " + err.Error()})
+		return
+	}
+	apiKey := models.APIKey{Name: request.Name, Role: request.Role, Hash: hash, Hint: auth.Hint(key)}
+	if err := h.keys.Create(c.Request.Context(), &apiKey); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create the API key. " + err.Error()})
+		return
+	}
+
+	principal, _ := auth.FromContext(c.Request.Context())
+	slog.Info("Created an API key.", "id", apiKey.ID, "name", apiKey.Name, "role", apiKey.Role, "by", principal.String())
+	c.JSON(http.StatusCreated, CreatedKey{APIKey: apiKey, Key: key})
+}
+
+//	@Summary		Revoke an API key
+//	@Description	Revoke an API key, which authenticates nobody from then on
+//	@Tags			admin
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Param			id	path		int				true	"API key ID"
+//	@Success		200	{object}	MessageResponse	"Returns a success message"
+//	@Failure		400	{object}	ErrorResponse	"Invalid API key ID"
+//	@Failure		401	{object}	ErrorResponse	"Authentication required"
+//	@Failure		403	{object}	ForbiddenResponse	"The keys:manage permission is required"
+//	@Failure		404	{object}	ErrorResponse	"API key not found or already revoked"
+//	@Failure		500	{object}	ErrorResponse	"Failed to revoke the API key"
+//	@Router			/admin/keys/{id} [delete]
+//
+// RevokeKey handles the "DELETE /admin/keys/:id" endpoint to revoke an API key.
+func (h *Handler) RevokeKey(c *gin.Context) {
+	uncacheable(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid API key ID. " + err.Error()})
+		return
+	}
+
+	err = h.keys.Revoke(c.Request.Context(), uint(id))
+	if errors.Is(err, repository.ErrKeyNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "API key not found or already revoked"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke the API key. " + err.Error()})
+		return
+	}
+
+	principal, _ := auth.FromContext(c.Request.Context())
+	slog.Info("Revoked an API key.", "id", id, "by", principal.String())
+	c.JSON(http.StatusOK, MessageResponse{Message: "API key revoked"})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"library/marc"
+	"library/models"
+	"library/repository"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MIMEMARC    = "application/marc"
+	MIMEMARCXML = "application/marc+xml"
+)
+
+// maxMARCImport bounds the size of the MARC records imported at once.
+const maxMARCImport = 32 << 20
+
+//	@Summary		Import MARC records
+//	@Description	Import books from binary MARC21 (ISO 2709) or MARCXML records
+//	@Tags			books
+//	@Accept			application/marc,application/marc+xml
+//	@Produce		json
+//	@Success		201	{array}		models.Book		"Returns the imported books"
+//	@Failure		400	{object}	ErrorResponse	"Invalid MARC data or validation error"
+//	@Failure		413	{object}	ErrorResponse	"MARC records too large"
+//	@Failure		415	{object}	ErrorResponse	"Unsupported content type"
+//	@Failure		500	{object}	ErrorResponse	"Failed to import books"
+//	@Failure		401	{object}	ErrorResponse	"Authentication required"
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Router			/books/import/marc [post]
+//
+// ImportMARC handles the "POST /books/import/marc" endpoint to create books from MARC records.
+func (h *Handler) ImportMARC(c *gin.Context) {
+	mediaType, _, err := mime.ParseMediaType(c.ContentType())
+	if err != nil {
+		mediaType = c.ContentType()
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxMARCImport)
+	var records []marc.Record
+	switch mediaType {
+	case MIMEMARC:
+		records, err = marc.ReadAll(body)
+	case MIMEMARCXML, gin.MIMEXML, gin.MIMEXML2:
+		records, err = marc.ReadXML(body)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Error: "Unsupported content type " + mediaType})
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("MARC records larger than %d bytes", tooLarge.Limit)})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid MARC data. " + err.Error()})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No MARC records found"})
+		return
+	}
+
+	books := make([]models.Book, len(records))
+	created := make([]*models.Book, len(records))
+	for index, record := range records {
+		books[index] = marc.ToBook(record)
+		if err := validate.Struct(books[index]); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Record %d: %s", index+1, getValidationErrors(err))})
+			return
+		}
+		created[index] = &books[index]
+	}
+
+	// Import all the records or none of them
+	if err := h.books.Create(c.Request.Context(), created...); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to import books" + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, books)
+}
+
+//	@Summary		Export MARC records
+//	@Description	Export all books as MARCXML (default) or binary MARC21 (ISO 2709)
+//	@Tags			books
+//	@Produce		application/marc+xml,application/marc
+//	@Param			format	query		string			false	"Output format: marcxml or iso2709"
+//	@Success		200		{string}	string			"Returns the MARC records"
+//	@Failure		400		{object}	ErrorResponse	"Unknown format"
+//	@Failure		500		{object}	ErrorResponse	"Failed to export books"
+//	@Router			/books/export/marc [get]
+//
+// ExportMARC handles the "GET /books/export/marc" endpoint to download the catalogue as MARC records.
+func (h *Handler) ExportMARC(c *gin.Context) {
+	var format string
+	switch c.Query("format") {
+	case "":
+		format = c.NegotiateFormat(MIMEMARCXML, MIMEMARC)
+		if format == "" {
+			format = MIMEMARCXML
+		}
+	case "marcxml", "xml":
+		format = MIMEMARCXML
+	case "iso2709", "marc", "mrc":
+		format = MIMEMARC
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unknown format " + c.Query("format")})
+		return
+	}
+
+	books, err := h.books.List(c.Request.Context(), repository.ListOptions{Order: repository.OrderByID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve books" + err.Error()})
+		return
+	}
+
+	records := make([]marc.Record, 0, len(books))
+	for _, book := range books {
+		records = append(records, marc.FromBook(book))
+	}
+
+	var buffer bytes.Buffer
+	filename := "books.xml"
+	if format == MIMEMARC {
+		filename = "books.mrc"
+		err = marc.WriteAll(&buffer, records)
+	} else {
+		err = marc.WriteXML(&buffer, records)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export books" + err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, format, buffer.Bytes())
+}
+
+// renderMARCXML writes a single book as a MARCXML record.
+func renderMARCXML(c *gin.Context, status int, book models.Book) {
+	var buffer bytes.Buffer
+	if err := marc.WriteXMLRecord(&buffer, marc.FromBook(book)); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to encode book" + err.Error()})
+		return
+	}
+	c.Data(status, MIMEMARCXML, buffer.Bytes())
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"library/models"
+	"library/oai"
+	"library/repository"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	oaiRepositoryName       = "Library"
+	oaiRepositoryIdentifier = "library"
+)
+
+//	@Summary		OAI-PMH provider
+//	@Description	Harvest the catalogue metadata as Dublin Core with the OAI-PMH 2.0 protocol
+//	@Tags			harvesting
+//	@Produce		xml
+//	@Param			verb			query		string	true	"Identify, ListMetadataFormats, ListSets, ListIdentifiers, ListRecords or GetRecord"
+//	@Param			metadataPrefix	query		string	false	"Metadata format, only oai_dc is supported"
+//	@Param			identifier		query		string	false	"Item identifier, e.g. oai:library:42"
+//	@Param			from			query		string	false	"Lower bound of the datestamp"
+//	@Param			until			query		string	false	"Upper bound of the datestamp"
+//	@Param			set				query		string	false	"Set (genre) specification"
+//	@Param			resumptionToken	query		string	false	"Token continuing an incomplete list"
+//	@Success		200				{string}	string	"Returns the OAI-PMH response, including protocol errors"
+//	@Failure		500				{object}	ErrorResponse	"Failed to query the catalogue"
+//	@Router			/oai [get]
+//
+// OAIPMH handles the "GET /oai" and "POST /oai" endpoints of the OAI-PMH provider.
+func (h *Handler) OAIPMH(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request arguments. " + err.Error()})
+		return
+	}
+
+	provider := oai.Provider{
+		RepositoryName:       oaiRepositoryName,
+		RepositoryIdentifier: oaiRepositoryIdentifier,
+		AdminEmail:           h.oai.AdminEmail,
+		Catalogue:            repositoryCatalogue{books: h.books},
+	}
+
+	response, err := provider.Handle(c.Request.Context(), requestBaseURL(c), c.Request.Form)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query the catalogue" + err.Error()})
+		return
+	}
+
+	data, err := xml.MarshalIndent(response, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to encode the response" + err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+// requestBaseURL rebuilds the absolute URL of the current endpoint.
+func requestBaseURL(c *gin.Context) string {
+	return requestOrigin(c) + c.Request.URL.Path
+}
+
+// requestOrigin returns the scheme and host the client used to reach the server.
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := c.GetHeader("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// repositoryCatalogue serves harvests from the repository, deleted books included.
+type repositoryCatalogue struct {
+	books repository.BookRepository
+}
+
+func (r repositoryCatalogue) EarliestDatestamp(ctx context.Context) (time.Time, error) {
+	books, err := r.books.Search(ctx, repository.Filter{Deleted: true}, repository.ListOptions{Order: repository.OrderByChanged, Limit: 1})
+	if err != nil || len(books) == 0 {
+		return time.Time{}, err
+	}
+	return oai.Datestamp(books[0]), nil
+}
+
+func (r repositoryCatalogue) Genres(ctx context.Context) ([]string, error) {
+	groups, err := r.books.Groups(ctx, repository.FieldGenre, repository.Filter{Deleted: true})
+	genres := make([]string, 0, len(groups))
+	for _, group := range groups {
+		genres = append(genres, group.Name)
+	}
+	return genres, err
+}
+
+func (r repositoryCatalogue) Book(ctx context.Context, id uint) (models.Book, error) {
+	books, err := r.books.Search(ctx, repository.Filter{IDs: []uint{id}, Deleted: true}, repository.ListOptions{})
+	if err != nil {
+		return models.Book{}, err
+	}
+	if len(books) == 0 {
+		return models.Book{}, oai.ErrNotFound
+	}
+	return books[0], nil
+}
+
+func (r repositoryCatalogue) Books(ctx context.Context, query oai.Query) ([]models.Book, int64, error) {
+	filter := repository.Filter{ChangedFrom: query.From, ChangedUntil: query.Until, Deleted: true}
+	if query.Genre != "" {
+		filter.Genres = []string{query.Genre}
+	}
+
+	total, err := r.books.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter.AfterID = query.AfterID
+	books, err := r.books.Search(ctx, filter, repository.ListOptions{Order: repository.OrderByID, Limit: query.Limit})
+	return books, total, err
+}
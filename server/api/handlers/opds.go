@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"library/opds"
+	"library/repository"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	opdsTitle    = "Library"
+	opdsV2Prefix = "/opds/v2"
+)
+
+//	@Summary		OPDS catalogue root
+//	@Description	Navigation feed linking to the newest books, genres and authors. Paths under /opds/v2 serve OPDS 2.0 JSON.
+//	@Tags			opds
+//	@Produce		application/atom+xml,application/opds+json
+//	@Success		200	{string}	string			"Returns the navigation feed"
+//	@Failure		500	{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/opds [get]
+//
+// OPDSRoot handles the "GET /opds" endpoint, the start of the OPDS catalogue.
+func (h *Handler) OPDSRoot(c *gin.Context) {
+	updated, err := latestUpdate(c.Request.Context(), h.books)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the feed" + err.Error()})
+		return
+	}
+
+	renderOPDS(c, opds.Page{
+		ID:      "urn:library:opds",
+		Title:   opdsTitle + " catalogue",
+		Updated: updated,
+		Kind:    opds.Navigation,
+		Navigation: []opds.NavigationItem{
+			{Title: "New arrivals", Href: "/new", Kind: opds.Acquisition},
+			{Title: "By genre", Href: "/genres", Kind: opds.Navigation},
+			{Title: "By author", Href: "/authors", Kind: opds.Navigation},
+		},
+	})
+}
+
+//	@Summary		OPDS newest books
+//	@Description	Acquisition feed of the books most recently added to the catalogue
+//	@Tags			opds
+//	@Produce		application/atom+xml,application/opds+json
+//	@Param			page	query		int				false	"Page number"
+//	@Param			limit	query		int				false	"Page size"
+//	@Success		200		{string}	string			"Returns the acquisition feed"
+//	@Failure		500		{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/opds/new [get]
+//
+// OPDSNew handles the "GET /opds/new" endpoint listing the newest books.
+func (h *Handler) OPDSNew(c *gin.Context) {
+	h.acquisitionFeed(c, repository.Filter{}, repository.OrderByNewest, opds.Page{
+		ID:    "urn:library:opds:new",
+		Title: "New arrivals",
+		Href:  "/new",
+	})
+}
+
+//	@Summary		OPDS genres
+//	@Description	Navigation feed of the genres of the catalogue
+//	@Tags			opds
+//	@Produce		application/atom+xml,application/opds+json
+//	@Success		200	{string}	string			"Returns the navigation feed"
+//	@Failure		500	{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/opds/genres [get]
+//
+// OPDSGenres handles the "GET /opds/genres" endpoint listing the genres.
+func (h *Handler) OPDSGenres(c *gin.Context) {
+	h.navigationFeed(c, repository.FieldGenre, "/genres", opds.Page{ID: "urn:library:opds:genres", Title: "By genre", Href: "/genres"})
+}
+
+//	@Summary		OPDS books of a genre
+//	@Description	Acquisition feed of the books of a genre
+//	@Tags			opds
+//	@Produce		application/atom+xml,application/opds+json
+//	@Param			genre	path		string			true	"Genre name"
+//	@Param			page	query		int				false	"Page number"
+//	@Success		200		{string}	string			"Returns the acquisition feed"
+//	@Failure		500		{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/opds/genres/{genre} [get]
+//
+// OPDSGenre handles the "GET /opds/genres/*genre" endpoint listing the books
+// of a genre, whose name may hold slashes.
+func (h *Handler) OPDSGenre(c *gin.Context) {
+	genre := strings.TrimPrefix(c.Param("genre"), "/")
+	h.acquisitionFeed(c, repository.Filter{Genres: []string{genre}}, repository.OrderByTitle, opds.Page{
+		ID:    "urn:library:opds:genres:" + url.PathEscape(genre),
+		Title: genre,
+		Href:  "/genres/" + url.PathEscape(genre),
+	})
+}
+
+//	@Summary		OPDS authors
+//	@Description	Navigation feed of the authors of the catalogue
+//	@Tags			opds
+//	@Produce		application/atom+xml,application/opds+json
+//	@Success		200	{string}	string			"Returns the navigation feed"
+//	@Failure		500	{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/opds/authors [get]
+//
+// OPDSAuthors handles the "GET /opds/authors" endpoint listing the authors.
+func (h *Handler) OPDSAuthors(c *gin.Context) {
+	h.navigationFeed(c, repository.FieldAuthor, "/authors", opds.Page{ID: "urn:library:opds:authors", Title: "By author", Href: "/authors"})
+}
+
+//	@Summary		OPDS books of an author
+//	@Description	Acquisition feed of the books of an author
+//	@Tags			opds
+//	@Produce		application/atom+xml,application/opds+json
+//	@Param			author	path		string			true	"Author name"
+//	@Param			page	query		int				false	"Page number"
+//	@Success		200		{string}	string			"Returns the acquisition feed"
+//	@Failure		500		{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/opds/authors/{author} [get]
+//
+// OPDSAuthor handles the "GET /opds/authors/*author" endpoint listing the
+// books of an author, whose name may hold slashes.
+func (h *Handler) OPDSAuthor(c *gin.Context) {
+	author := strings.TrimPrefix(c.Param("author"), "/")
+	h.acquisitionFeed(c, repository.Filter{Authors: []string{author}}, repository.OrderByPublished, opds.Page{
+		ID:    "urn:library:opds:authors:" + url.PathEscape(author),
+		Title: author,
+		Href:  "/authors/" + url.PathEscape(author),
+	})
+}
+
+//	@Summary		OPDS search
+//	@Description	Acquisition feed of the books matching a search, accepting the same parameters as /books/search
+//	@Tags			opds
+//	@Produce		application/atom+xml,application/opds+json
+//	@Param			q		query		string			false	"Free text matching the title or the author"
+//	@Param			page	query		int				false	"Page number"
+//	@Success		200		{string}	string			"Returns the acquisition feed"
+//	@Failure		400		{object}	ErrorResponse	"Invalid query parameters"
+//	@Failure		500		{object}	ErrorResponse	"Failed to build the feed"
+//	@Router			/opds/search [get]
+//
+// OPDSSearch handles the "GET /opds/search" endpoint, the OpenSearch target of the catalogue.
+func (h *Handler) OPDSSearch(c *gin.Context) {
+	params, ok := bindSearchParams(c)
+	if !ok {
+		return
+	}
+
+	query := url.Values{}
+	for key, value := range params.toMap() {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	h.acquisitionFeed(c, params.Filter(), repository.OrderByTitle, opds.Page{
+		ID:    "urn:library:opds:search?" + query.Encode(),
+		Title: "Search results",
+		Href:  "/search?" + query.Encode(),
+	})
+}
+
+//	@Summary		OPDS OpenSearch description
+//	@Description	OpenSearch description document of the catalogue search
+//	@Tags			opds
+//	@Produce		application/opensearchdescription+xml
+//	@Success		200	{string}	string	"Returns the OpenSearch description"
+//	@Router			/opds/opensearch.xml [get]
+//
+// OPDSOpenSearch handles the "GET /opds/opensearch.xml" endpoint.
+func OPDSOpenSearch(c *gin.Context) {
+	writeXML(c, opds.MIMEOpenSearch, opdsCatalog(c).OpenSearch(requestOrigin(c)+"/api/v1/books/search"))
+}
+
+// acquisitionFeed renders a page of the books matching filter.
+func (h *Handler) acquisitionFeed(c *gin.Context, filter repository.Filter, order repository.Order, page opds.Page) {
+	page.Kind = opds.Acquisition
+	page.Number, page.PerPage = h.pagination(c)
+	if c.Query("limit") != "" {
+		// Keep the page size in the pagination links
+		separator := "?"
+		if strings.Contains(page.Href, "?") {
+			separator = "&"
+		}
+		page.Href += separator + "limit=" + strconv.Itoa(page.PerPage)
+	}
+
+	var err error
+	page.Total, err = h.books.Count(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the feed" + err.Error()})
+		return
+	}
+
+	options := repository.ListOptions{Order: order, Limit: page.PerPage, Offset: (page.Number - 1) * page.PerPage}
+	page.Books, err = h.books.Search(c.Request.Context(), filter, options)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the feed" + err.Error()})
+		return
+	}
+
+	for _, book := range page.Books {
+		if book.UpdatedAt.After(page.Updated) {
+			page.Updated = book.UpdatedAt
+		}
+	}
+
+	renderOPDS(c, page)
+}
+
+// navigationFeed renders a page linking to the books grouped by field.
+func (h *Handler) navigationFeed(c *gin.Context, field repository.Field, href string, page opds.Page) {
+	page.Kind = opds.Navigation
+
+	groups, err := h.books.Groups(c.Request.Context(), field, repository.Filter{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the feed" + err.Error()})
+		return
+	}
+
+	page.Updated, err = latestUpdate(c.Request.Context(), h.books)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the feed" + err.Error()})
+		return
+	}
+
+	for _, group := range groups {
+		page.Navigation = append(page.Navigation, opds.NavigationItem{
+			Title: group.Name,
+			Href:  href + "/" + url.PathEscape(group.Name),
+			Kind:  opds.Acquisition,
+			Count: group.Count,
+		})
+	}
+
+	renderOPDS(c, page)
+}
+
+// renderOPDS writes a page as OPDS 2.0 under /opds/v2 or when the client
+// asks for it, and as OPDS 1.2 otherwise.
+func renderOPDS(c *gin.Context, page opds.Page) {
+	catalog := opdsCatalog(c)
+	if strings.HasPrefix(c.FullPath(), opdsV2Prefix) || c.NegotiateFormat(gin.MIMEXML, opds.MIMEOPDS2) == opds.MIMEOPDS2 {
+		c.Header("Content-Type", opds.MIMEOPDS2)
+		c.JSON(http.StatusOK, catalog.JSON(page))
+		return
+	}
+
+	mime := opds.MIMENavigation
+	if page.Kind == opds.Acquisition {
+		mime = opds.MIMEAcquisition
+	}
+	writeXML(c, mime, catalog.Atom(page))
+}
+
+func writeXML(c *gin.Context, contentType string, v any) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to encode the feed" + err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType+";charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+func opdsCatalog(c *gin.Context) opds.Catalog {
+	origin := requestOrigin(c)
+	return opds.Catalog{
+		Title: opdsTitle,
+		Root:  origin + "/opds",
+		BookURL: func(id uint) string {
+			return origin + "/api/v1/books/" + strconv.FormatUint(uint64(id), 10)
+		},
+	}
+}
+
+// maxOffset bounds the offset of the pages, which the databases take as a
+// 32-bit integer.
+const maxOffset = math.MaxInt32
+
+// pagination reads the 1-based page number and the page size from the
+// query, bounded by the runtime configuration and so that the offset of the
+// page does not overflow.
+func (h *Handler) pagination(c *gin.Context) (int, int) {
+	runtime := h.live.Runtime()
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = runtime.PageSize
+	}
+	if limit > runtime.MaxPageSize {
+		limit = runtime.MaxPageSize
+	}
+	if page-1 > maxOffset/limit {
+		page = maxOffset/limit + 1
+	}
+	return page, limit
+}
+
+// latestUpdate returns the time the catalogue last changed.
+func latestUpdate(ctx context.Context, books repository.BookRepository) (time.Time, error) {
+	latest, err := books.Search(ctx, repository.Filter{Deleted: true}, repository.ListOptions{Order: repository.OrderByLastChanged, Limit: 1})
+	if err != nil || len(latest) == 0 {
+		return time.Time{}, err
+	}
+	return repository.Changed(latest[0]), nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"library/citation"
+	"library/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MIMEBibTeX  = "application/x-bibtex"
+	MIMERIS     = "application/x-research-info-systems"
+	MIMECSLJSON = "application/vnd.citationstyles.csl+json"
+)
+
+// bookFormats lists the representations offered for a list of books, JSON first
+// so that it stays the default when the client sends no Accept header.
+var bookFormats = []string{gin.MIMEJSON, MIMEBibTeX, MIMERIS, MIMECSLJSON}
+
+// renderBook writes a single book in the format negotiated from the Accept header.
+func renderBook(c *gin.Context, status int, book models.Book) {
+	switch c.NegotiateFormat(append(bookFormats, MIMEMARCXML)...) {
+	case MIMEMARCXML:
+		renderMARCXML(c, status, book)
+	case MIMEBibTeX, MIMERIS, MIMECSLJSON:
+		renderBooks(c, status, []models.Book{book})
+	default:
+		c.JSON(status, book)
+	}
+}
+
+// renderBooks writes a list of books in the format negotiated from the Accept header.
+func renderBooks(c *gin.Context, status int, books []models.Book) {
+	format := c.NegotiateFormat(bookFormats...)
+
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case MIMEBibTeX:
+		err = citation.WriteBibTeX(&buffer, books)
+	case MIMERIS:
+		err = citation.WriteRIS(&buffer, books)
+	case MIMECSLJSON:
+		err = json.NewEncoder(&buffer).Encode(citation.CSL(books))
+	default:
+		c.JSON(status, books)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to encode books" + err.Error()})
+		return
+	}
+	c.Data(status, format+"; charset=utf-8", buffer.Bytes())
+}
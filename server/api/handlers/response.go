@@ -1,6 +1,9 @@
 package handlers
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"library/auth"
+)
 
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -12,6 +15,14 @@ func (e ErrorResponse) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// ForbiddenResponse tells which permission a principal lacks for a request.
+type ForbiddenResponse struct {
+	Error      string          `json:"error"`
+	Principal  string          `json:"principal"`
+	Roles      []string        `json:"roles"`
+	Permission auth.Permission `json:"permission"`
+}
+
 type MessageResponse struct {
 	Message string `json:"message"`
 }
@@ -31,3 +42,15 @@ func (s StatusResponse) MarshalJSON() ([]byte, error) {
 		"status": s.Status,
 	})
 }
+
+type CitationResponse struct {
+	Style    string `json:"style"`
+	Citation string `json:"citation"`
+}
+
+func (c CitationResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"style":    c.Style,
+		"citation": c.Citation,
+	})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"library/auth"
+	"library/models"
+	"library/repository"
+	"net/http"
+	"regexp"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantKey holds the tenant of a request in the gin context, as resolved by
+// the tenant middleware.
+const TenantKey = "tenant"
+
+// slugPattern matches the slugs of the tenants, fit to be subdomains.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// TenantSettings configure a tenant.
+type TenantSettings struct {
+	Name string `json:"name" binding:"required,max=255"`
+	// LoanDays is how many days the books are lent for, 14 if not given
+	LoanDays int `json:"loan_days" binding:"omitempty,min=1,max=365"`
+	// Tagline, Color and LogoURL brand the welcome page
+	Tagline string `json:"tagline" binding:"max=255"`
+	Color   string `json:"color" binding:"omitempty,hexcolor,max=7"`
+	LogoURL string `json:"logo_url" binding:"omitempty,url,max=2048"`
+}
+
+// apply sets the settings of a tenant.
+func (s TenantSettings) apply(tenant *models.Tenant) {
+	tenant.Name = s.Name
+	tenant.LoanDays = s.LoanDays
+	if tenant.LoanDays == 0 {
+		tenant.LoanDays = models.DefaultLoanDays
+	}
+	tenant.Tagline = s.Tagline
+	tenant.Color = s.Color
+	tenant.LogoURL = s.LogoURL
+}
+
+// TenantRequest describes a tenant to create.
+type TenantRequest struct {
+	// Slug names the tenant in the subdomain or header of its requests:
+	// lowercase letters, digits and hyphens
+	Slug string `json:"slug" binding:"required,max=63"`
+	TenantSettings
+}
+
+// tenantOf returns the tenant of a request.
+func tenantOf(c *gin.Context) models.Tenant {
+	tenant, _ := c.Get(TenantKey)
+	t, _ := tenant.(models.Tenant)
+	return t
+}
+
+// operator answers 403 Forbidden unless the principal of a request operates
+// the deployment, and reports whether it does: the principals of a tenant
+// may not manage the others, nor the server they share. The action tells
+// what only the operator does.
+func operator(c *gin.Context, action string) bool {
+	principal, _ := auth.FromContext(c.Request.Context())
+	if principal.Operator() {
+		return true
+	}
+	c.JSON(http.StatusForbidden, ErrorResponse{Error: "Forbidden: only the admin key of the deployment " + action})
+	return false
+}
+
+//	@Summary		Current tenant
+//	@Description	Settings of the library serving the request, named by its subdomain, its X-Tenant header or the credentials
+//	@Tags			info
+//	@Produce		json
+//	@Success		200	{object}	models.Tenant	"Returns the tenant"
+//	@Failure		404	{object}	ErrorResponse	"Unknown tenant"
+//	@Router			/tenant [get]
+//
+// CurrentTenant handles the "GET /tenant" endpoint to show the settings of
+// the tenant of the request.
+func (h *Handler) CurrentTenant(c *gin.Context) {
+	c.JSON(http.StatusOK, tenantOf(c))
+}
+
+//	@Summary		List the tenants
+//	@Description	List the libraries the deployment hosts, for the admin key of the deployment
+//	@Tags			admin
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Success		200	{array}		models.Tenant	"Returns the tenants"
+//	@Failure		401	{object}	ErrorResponse	"Authentication required"
+//	@Failure		403	{object}	ErrorResponse	"Only the admin key of the deployment manages the tenants"
+//	@Failure		500	{object}	ErrorResponse	"Failed to list the tenants"
+//	@Router			/admin/tenants [get]
+//
+// ListTenants handles the "GET /admin/tenants" endpoint to list the tenants.
+func (h *Handler) ListTenants(c *gin.Context) {
+	uncacheable(c)
+	if !operator(c, "manages the tenants") {
+		return
+	}
+	tenants, err := h.tenants.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list the tenants. " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tenants)
+}
+
+//	@Summary		Provision a tenant
+//	@Description	Create a library hosted by the deployment, with its own books, API keys and users, for the admin key of the deployment
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Param			tenant	body		TenantRequest	true	"Slug and settings of the tenant"
+//	@Success		201		{object}	models.Tenant	"Returns the new tenant"
+//	@Failure		400		{object}	ErrorResponse	"Invalid JSON data or slug"
+//	@Failure		401		{object}	ErrorResponse	"Authentication required"
+//	@Failure		403		{object}	ErrorResponse	"Only the admin key of the deployment manages the tenants"
+//	@Failure		409		{object}	ErrorResponse	"Tenant slug already taken"
+//	@Failure		500		{object}	ErrorResponse	"Failed to create the tenant"
+//	@Router			/admin/tenants [post]
+//
+// CreateTenant handles the "POST /admin/tenants" endpoint to provision a tenant.
+func (h *Handler) CreateTenant(c *gin.Context) {
+	uncacheable(c)
+	if !operator(c, "manages the tenants") {
+		return
+	}
+	var request TenantRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON data. " + err.Error()})
+		return
+	}
+	if !slugPattern.MatchString(request.Slug) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid slug " + request.Slug + ", expected lowercase letters, digits and hyphens"})
+		return
+	}
+
+	tenant := models.Tenant{Slug: request.Slug}
+	request.apply(&tenant)
+	err := h.tenants.Create(c.Request.Context(), &tenant)
+	if errors.Is(err, repository.ErrTenantExists) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Tenant slug already taken"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create the tenant. " + err.Error()})
+		return
+	}
+
+	principal, _ := auth.FromContext(c.Request.Context())
+	slog.Info("Provisioned a tenant.", "id", tenant.ID, "slug", tenant.Slug, "by", principal.String())
+	c.JSON(http.StatusCreated, tenant)
+}
+
+//	@Summary		Configure a tenant
+//	@Description	Replace the settings of a tenant, such as its loan period and the branding of its welcome page, for the admin key of the deployment
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Param			slug		path		string			true	"Tenant slug"
+//	@Param			settings	body		TenantSettings	true	"Settings of the tenant"
+//	@Success		200			{object}	models.Tenant	"Returns the updated tenant"
+//	@Failure		400			{object}	ErrorResponse	"Invalid JSON data"
+//	@Failure		401			{object}	ErrorResponse	"Authentication required"
+//	@Failure		403			{object}	ErrorResponse	"Only the admin key of the deployment manages the tenants"
+//	@Failure		404			{object}	ErrorResponse	"Tenant not found"
+//	@Failure		500			{object}	ErrorResponse	"Failed to update the tenant"
+//	@Router			/admin/tenants/{slug} [put]
+//
+// UpdateTenant handles the "PUT /admin/tenants/:slug" endpoint to configure a tenant.
+func (h *Handler) UpdateTenant(c *gin.Context) {
+	uncacheable(c)
+	if !operator(c, "manages the tenants") {
+		return
+	}
+	var settings TenantSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON data. " + err.Error()})
+		return
+	}
+
+	tenant, err := h.tenants.FindBySlug(c.Request.Context(), c.Param("slug"))
+	if err == nil {
+		settings.apply(&tenant)
+		err = h.tenants.Update(c.Request.Context(), &tenant)
+	}
+	if errors.Is(err, repository.ErrTenantNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Tenant not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update the tenant. " + err.Error()})
+		return
+	}
+
+	principal, _ := auth.FromContext(c.Request.Context())
+	slog.Info("Configured a tenant.", "id", tenant.ID, "slug", tenant.Slug, "by", principal.String())
+	c.JSON(http.StatusOK, tenant)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"library/auth"
+	"library/repository"
+	"net/http"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserRequest describes a user to create.
+type UserRequest struct {
+	Username string `json:"username" binding:"required,max=64"`
+	Password string `json:"password" binding:"required,min=12,max=72"`
+	// Role is patron, librarian or admin
+	Role string `json:"role" binding:"required,oneof=patron librarian admin"`
+}
+
+// ResetResponse is a token resetting the password of a user, the only time
+// it is shown.
+type ResetResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+//	@Summary		List the users
+//	@Description	List the users logging in with a password, without their passwords
+//	@Tags			admin
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Success		200	{array}		models.User			"Returns the users"
+//	@Failure		401	{object}	ErrorResponse		"Authentication required"
+//	@Failure		403	{object}	ForbiddenResponse	"The users:manage permission is required"
+//	@Failure		500	{object}	ErrorResponse		"Failed to list the users"
+//	@Router			/admin/users [get]
+//
+// ListUsers handles the "GET /admin/users" endpoint to list the users.
+func (h *Handler) ListUsers(c *gin.Context) {
+	users, err := h.accounts.ListUsers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list the users. " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+//	@Summary		Create a user
+//	@Description	Create a user logging in with a password, of at least 12 characters
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Param			user	body		UserRequest			true	"Username, password and role of the user"
+//	@Success		201		{object}	models.User			"Returns the new user"
+//	@Failure		400		{object}	ErrorResponse		"Invalid JSON data"
+//	@Failure		401		{object}	ErrorResponse		"Authentication required"
+//	@Failure		403		{object}	ForbiddenResponse	"The users:manage permission is required"
+//	@Failure		409		{object}	ErrorResponse		"Username already taken"
+//	@Failure		500		{object}	ErrorResponse		"Failed to create the user"
+//	@Router			/admin/users [post]
+//
+// CreateUser handles the "POST /admin/users" endpoint to create a user.
+func (h *Handler) CreateUser(c *gin.Context) {
+	uncacheable(c)
+	var request UserRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON data. " + err.Error()})
+		return
+	}
+
+	user, err := h.accounts.CreateUser(c.Request.Context(), request.Username, request.Password, request.Role)
+	if errors.Is(err, repository.ErrUserExists) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Username already taken"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create the user. " + err.Error()})
+		return
+	}
+
+	principal, _ := auth.FromContext(c.Request.Context())
+	slog.Info("Created a user.", "id", user.ID, "user", user.Username, "role", user.Role, "by", principal.String())
+	c.JSON(http.StatusCreated, user)
+}
+
+//	@Summary		Issue a password reset token
+//	@Description	Issue a token resetting the password of a user once, returned once, replacing the previous one
+//	@Tags			admin
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Security		BearerAuth
+//	@Param			id	path		int					true	"User ID"
+//	@Success		201	{object}	ResetResponse		"Returns the reset token"
+//	@Failure		400	{object}	ErrorResponse		"Invalid user ID"
+//	@Failure		401	{object}	ErrorResponse		"Authentication required"
+//	@Failure		403	{object}	ForbiddenResponse	"The users:manage permission is required"
+//	@Failure		404	{object}	ErrorResponse		"User not found"
+//	@Failure		500	{object}	ErrorResponse		"Failed to issue the reset token"
+//	@Router			/admin/users/{id}/reset [post]
+//
+// IssueReset handles the "POST /admin/users/:id/reset" endpoint to issue a
+// password reset token, for the admin to hand to the user.
+func (h *Handler) IssueReset(c *gin.Context) {
+	uncacheable(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID. " + err.Error()})
+		return
+	}
+
+	token, expires, err := h.accounts.IssueReset(c.Request.Context(), uint(id))
+	if errors.Is(err, repository.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to issue the reset token. " + err.Error()})
+		return
+	}
+
+	principal, _ := auth.FromContext(c.Request.Context())
+	slog.Info("Issued a password reset token.", "id", id, "by", principal.String())
+	c.JSON(http.StatusCreated, ResetResponse{Token: token, ExpiresAt: expires})
+}
@@ -1,13 +1,131 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"library/config"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"log/slog"
+
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func DBMiddleware(db *gorm.DB) gin.HandlerFunc {
+// corsMethods are the methods the browsers of the allowed origins may use.
+const corsMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+
+// CORS lets the browsers of the origins of the live configuration call the API.
+func CORS(live *config.Live) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Header("Vary", "Origin")
+		origins := live.Runtime().CORSOrigins
+		if !slices.Contains(origins, "*") && !slices.Contains(origins, origin) {
+			// Without the header, the browser refuses the response
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if isPreflight(c) {
+			c.Header("Access-Control-Allow-Methods", corsMethods)
+			if headers := c.GetHeader("Access-Control-Request-Headers"); headers != "" {
+				c.Header("Access-Control-Allow-Headers", headers)
+			}
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// QueryTimeout bounds the queries of every request to the live query
+// timeout: the handlers query the database with the context of the request,
+// which is canceled once the timeout expires or the client goes away.
+func QueryTimeout(live *config.Live) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := live.Runtime().QueryTimeout
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			slog.Warn("A request exceeded the query timeout.", "method", c.Request.Method, "path", c.Request.URL.Path, "timeout", timeout)
+		}
+	}
+}
+
+// isPreflight reports whether a request asks for the CORS permissions.
+func isPreflight(c *gin.Context) bool {
+	return c.Request.Method == http.MethodOptions && strings.TrimSpace(c.GetHeader("Access-Control-Request-Method")) != ""
+}
+
+// ForwardedProto drops the X-Forwarded-Proto header of the requests not sent
+// by one of the trusted proxies, as gin ignores their X-Forwarded-For: the
+// handlers may then trust it for the scheme of their links and cookies.
+func ForwardedProto(proxies []string) gin.HandlerFunc {
+	trusted := trustedNetworks(proxies)
 	return func(c *gin.Context) {
-		c.Set("db", db)
+		if c.GetHeader("X-Forwarded-Proto") != "" && !trustedPeer(c.Request.RemoteAddr, trusted) {
+			c.Request.Header.Del("X-Forwarded-Proto")
+		}
 		c.Next()
 	}
 }
+
+// trustedNetworks parses the IPs and CIDR ranges of the trusted proxies,
+// trusting none if one is invalid, as the router does.
+func trustedNetworks(proxies []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// trustedPeer reports whether the address of the peer of a request belongs
+// to one of the trusted networks.
+func trustedPeer(address string, trusted []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
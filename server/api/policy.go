@@ -0,0 +1,135 @@
+package api
+
+import (
+	"library/api/handlers"
+	"library/auth"
+	"net/http"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Route is a route of the router, by method and path as registered.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Policy maps every route of the router to the permission it requires,
+// auth.Public for none. The routes missing from it are forbidden to all.
+var Policy = map[Route]auth.Permission{
+	// Information, health and documentation
+	{http.MethodGet, "/"}:                    auth.Public,
+	{http.MethodGet, "/health"}:              auth.Public,
+	{http.MethodGet, "/api/"}:                auth.Public,
+	{http.MethodGet, "/api/v1/"}:             auth.Public,
+	{http.MethodGet, "/livez"}:               auth.Public,
+	{http.MethodGet, "/readyz"}:              auth.Public,
+	{http.MethodGet, "/openapi/*filepath"}:   auth.Public,
+	{http.MethodHead, "/openapi/*filepath"}:  auth.Public,
+	{http.MethodGet, "/graphiql/*filepath"}:  auth.Public,
+	{http.MethodHead, "/graphiql/*filepath"}: auth.Public,
+	{http.MethodGet, "/auth/permissions"}:    auth.Public,
+	{http.MethodGet, "/tenant"}:              auth.Public,
+
+	// Sessions, checked by their handlers
+	{http.MethodGet, "/login"}:              auth.Public,
+	{http.MethodPost, "/auth/login"}:        auth.Public,
+	{http.MethodPost, "/auth/logout"}:       auth.Public,
+	{http.MethodPost, "/auth/refresh"}:      auth.Public,
+	{http.MethodPost, "/auth/password"}:     auth.Public,
+	{http.MethodPost, "/auth/reset"}:        auth.Public,
+	{http.MethodGet, "/auth/oidc/login"}:    auth.Public,
+	{http.MethodGet, "/auth/oidc/callback"}: auth.Public,
+
+	// Books
+	{http.MethodGet, "/api/v1/books"}:              auth.PermBooksRead,
+	{http.MethodGet, "/api/v1/books/:id"}:          auth.PermBooksRead,
+	{http.MethodGet, "/api/v1/books/:id/cite"}:     auth.PermBooksRead,
+	{http.MethodGet, "/api/v1/books/search"}:       auth.PermBooksRead,
+	{http.MethodGet, "/api/v1/books/count"}:        auth.PermBooksRead,
+	{http.MethodGet, "/api/v1/books/export/marc"}:  auth.PermBooksRead,
+	{http.MethodPost, "/api/v1/books"}:             auth.PermBooksWrite,
+	{http.MethodPut, "/api/v1/books/:id"}:          auth.PermBooksWrite,
+	{http.MethodPatch, "/api/v1/books/:id"}:        auth.PermBooksWrite,
+	{http.MethodPost, "/api/v1/books/import/marc"}: auth.PermBooksWrite,
+	{http.MethodDelete, "/api/v1/books/:id"}:       auth.PermBooksDelete,
+
+	// GraphQL, whose mutations are authorized by the handler
+	{http.MethodGet, "/graphql"}:  auth.PermBooksRead,
+	{http.MethodPost, "/graphql"}: auth.PermBooksRead,
+
+	// Harvesting, catalogues and feeds
+	{http.MethodGet, "/oai"}:                     auth.PermBooksRead,
+	{http.MethodPost, "/oai"}:                    auth.PermBooksRead,
+	{http.MethodGet, "/opds"}:                    auth.PermBooksRead,
+	{http.MethodGet, "/opds/new"}:                auth.PermBooksRead,
+	{http.MethodGet, "/opds/genres"}:             auth.PermBooksRead,
+	{http.MethodGet, "/opds/genres/*genre"}:      auth.PermBooksRead,
+	{http.MethodGet, "/opds/authors"}:            auth.PermBooksRead,
+	{http.MethodGet, "/opds/authors/*author"}:    auth.PermBooksRead,
+	{http.MethodGet, "/opds/search"}:             auth.PermBooksRead,
+	{http.MethodGet, "/opds/v2"}:                 auth.PermBooksRead,
+	{http.MethodGet, "/opds/v2/new"}:             auth.PermBooksRead,
+	{http.MethodGet, "/opds/v2/genres"}:          auth.PermBooksRead,
+	{http.MethodGet, "/opds/v2/genres/*genre"}:   auth.PermBooksRead,
+	{http.MethodGet, "/opds/v2/authors"}:         auth.PermBooksRead,
+	{http.MethodGet, "/opds/v2/authors/*author"}: auth.PermBooksRead,
+	{http.MethodGet, "/opds/v2/search"}:          auth.PermBooksRead,
+	{http.MethodGet, "/opds/opensearch.xml"}:     auth.PermBooksRead,
+	{http.MethodGet, "/feeds/new.atom"}:          auth.PermBooksRead,
+	{http.MethodGet, "/feeds/new.rss"}:           auth.PermBooksRead,
+
+	// Administration
+	{http.MethodGet, "/admin/config"}:           auth.PermServerInspect,
+	{http.MethodGet, "/admin/cache"}:            auth.PermServerInspect,
+	{http.MethodGet, "/admin/keys"}:             auth.PermKeysManage,
+	{http.MethodPost, "/admin/keys"}:            auth.PermKeysManage,
+	{http.MethodDelete, "/admin/keys/:id"}:      auth.PermKeysManage,
+	{http.MethodGet, "/admin/users"}:            auth.PermUsersManage,
+	{http.MethodPost, "/admin/users"}:           auth.PermUsersManage,
+	{http.MethodPost, "/admin/users/:id/reset"}: auth.PermUsersManage,
+	{http.MethodGet, "/admin/ratelimits"}:       auth.PermServerInspect,
+	{http.MethodDelete, "/admin/ratelimits"}:    auth.PermLimitsManage,
+	{http.MethodGet, "/admin/tenants"}:          auth.PermTenantsManage,
+	{http.MethodPost, "/admin/tenants"}:         auth.PermTenantsManage,
+	{http.MethodPut, "/admin/tenants/:slug"}:    auth.PermTenantsManage,
+}
+
+// Authorize lets the principal of every request use its route if it has
+// the permission the policy requires. Otherwise it answers 401 Unauthorized
+// to the guests, and 403 Forbidden to the others with the permission they
+// lack.
+func Authorize(policy map[Route]auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Unknown routes are not found, whatever the principal
+		if c.FullPath() == "" {
+			c.Next()
+			return
+		}
+		permission, ok := policy[Route{Method: c.Request.Method, Path: c.FullPath()}]
+		if !ok {
+			slog.Error("No policy authorizes a route, it is forbidden.", "method", c.Request.Method, "path", c.FullPath())
+			c.AbortWithStatusJSON(http.StatusForbidden, handlers.ErrorResponse{Error: "No policy authorizes this route"})
+			return
+		}
+
+		err := auth.Check(c.Request.Context(), permission)
+		if err == nil {
+			c.Next()
+			return
+		}
+		principal, _ := auth.FromContext(c.Request.Context())
+		if !principal.Authenticated() {
+			unauthorized(c, err.Error())
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, handlers.ForbiddenResponse{
+			Error:      "Forbidden: " + err.Error(),
+			Principal:  principal.String(),
+			Roles:      principal.Roles,
+			Permission: permission,
+		})
+	}
+}
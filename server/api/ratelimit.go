@@ -0,0 +1,87 @@
+package api
+
+import (
+	"library/api/handlers"
+	"library/auth"
+	"library/config"
+	"library/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRateGroup is the group of the routes missing from RateGroups.
+const DefaultRateGroup = "default"
+
+// RateGroups assigns the expensive routes to the groups of routes whose
+// rate limits and daily quotas the runtime configuration may set apart.
+var RateGroups = map[Route]string{
+	{http.MethodGet, "/api/v1/books/search"}:       "search",
+	{http.MethodGet, "/opds/search"}:               "search",
+	{http.MethodGet, "/opds/v2/search"}:            "search",
+	{http.MethodGet, "/api/v1/books/export/marc"}:  "export",
+	{http.MethodGet, "/oai"}:                       "export",
+	{http.MethodPost, "/oai"}:                      "export",
+	{http.MethodPost, "/api/v1/books/import/marc"}: "import",
+	{http.MethodGet, "/graphql"}:                   "graphql",
+	{http.MethodPost, "/graphql"}:                  "graphql",
+	{http.MethodPost, "/auth/login"}:               "login",
+	{http.MethodPost, "/auth/reset"}:               "login",
+	{http.MethodGet, "/auth/oidc/callback"}:        "login",
+}
+
+// RateLimit limits the requests of every client to each group of routes to
+// the rate of the live configuration for the group, and to its daily quota,
+// answering 429 Too Many Requests beyond them. Every limited response tells
+// the client its limit in the RateLimit headers.
+func RateLimit(live *config.Live, limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runtime := live.Runtime()
+		group, ok := RateGroups[Route{Method: c.Request.Method, Path: c.FullPath()}]
+		if !ok {
+			group = DefaultRateGroup
+		}
+		rate, burst := runtime.Limit(group)
+		limit := ratelimit.Limit{Rate: rate, Burst: burst, Quota: runtime.Quota(group)}
+		if limit.Rate <= 0 && limit.Quota <= 0 {
+			c.Next()
+			return
+		}
+
+		client := rateClient(c)
+		result := limiter.Allow(client, group, limit)
+		if result.Limit > 0 {
+			c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+			c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			c.Header("RateLimit-Reset", seconds(result.Reset))
+		}
+		if !result.Allowed {
+			slog.Debug("Limited the requests of a client.", "client", client, "group", group, "retry_after", result.RetryAfter)
+			c.Header("Retry-After", seconds(result.RetryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, handlers.ErrorResponse{Error: "Too many requests, retry later"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateClient returns the client whose requests are limited together, and
+// whose reads see its writes: the API key, user or token subject of the
+// request, or else its IP.
+func rateClient(c *gin.Context) string {
+	principal, _ := auth.FromContext(c.Request.Context())
+	if principal.Method == auth.MethodNone || !principal.Authenticated() {
+		return "ip:" + c.ClientIP()
+	}
+	return principal.String()
+}
+
+// seconds formats a duration as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -13,7 +13,14 @@
 // @host      localhost:8090
 // @BasePath  /api/v1
 
-// @securityDefinitions.basic  BasicAuth
+// @securityDefinitions.apikey  ApiKeyAuth
+// @in                          header
+// @name                        X-API-Key
+
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+// @description                 An API key or a JWT, as "Bearer <token>"
 
 // @externalDocs.description  OpenAPI
 // @externalDocs.url          https://swagger.io/resources/open-api/
@@ -22,7 +29,12 @@ package api
 
 import (
 	"library/api/handlers"
-	"library/db"
+	"library/auth"
+	"library/config"
+	"library/health"
+	"library/ratelimit"
+	"library/repository"
+	"log/slog"
 	"net/http"
 
 	// swagger embed files
@@ -34,19 +46,83 @@ import (
 
 const htmlFiles = "templates/*"
 
-func SetupRouter(db db.Database, initialPath ...string) *gin.Engine {
-	router := gin.Default()
+// Options are the dependencies of the router besides the books, replaced
+// by defaults when nil.
+type Options struct {
+	// Live is the runtime configuration, the default one if nil
+	Live *config.Live
+	// Health reports the health of the server, without dependencies if nil
+	Health *health.Health
+	// Keys stores the API keys, in memory if nil
+	Keys repository.KeyRepository
+	// Accounts manages the users and their sessions, in memory if nil
+	Accounts *auth.Accounts
+	// OIDC logs the users in with an OpenID provider, unless nil
+	OIDC *auth.OIDC
+	// Tenants stores the libraries the deployment hosts, in memory if nil
+	Tenants repository.TenantRepository
+	// Tenancy tells the tenant of the requests, all served the default
+	// tenant unless enabled
+	Tenancy config.TenancyConfig
+	// OAI configures the OAI-PMH provider, served under /oai if enabled
+	OAI config.OAIConfig
+	// TrustedProxies are the proxies whose X-Forwarded-For and
+	// X-Forwarded-Proto headers tell the IP and scheme of the clients, none
+	// if empty
+	TrustedProxies []string
+	// Limiter counts the requests of the clients against their rate limits,
+	// a new one if nil
+	Limiter *ratelimit.Limiter
+	// Auth authenticates the clients, authorized by the permissions of their
+	// roles; if nil, anyone may do anything
+	Auth *auth.Authenticator
+}
+
+// SetupRouter returns the router of the API serving the books, with the
+// dependencies of the options. Every route it registers must be authorized
+// by the Policy.
+func SetupRouter(books repository.BookRepository, options Options, initialPath ...string) *gin.Engine {
+	if options.Live == nil {
+		options.Live = config.NewLive(config.Default())
+	}
+	if options.Health == nil {
+		options.Health = health.New(config.Default().Server.HealthTimeout)
+	}
+	if options.Keys == nil {
+		options.Keys = repository.NewMemoryKeys()
+	}
+	if options.Accounts == nil {
+		options.Accounts = auth.NewAccounts(repository.NewMemoryUsers(), repository.NewMemorySessions(), auth.AccountOptions{})
+	}
+	if options.Tenants == nil {
+		options.Tenants = repository.NewMemoryTenants()
+	}
+	if options.Limiter == nil {
+		options.Limiter = ratelimit.New()
+	}
+	live, limiter := options.Live, options.Limiter
+	router := gin.New()
+	// gin trusts every proxy by default, letting any client pick its IP
+	if err := router.SetTrustedProxies(options.TrustedProxies); err != nil {
+		slog.Error("Cannot trust the proxies, trusting none.", "proxies", options.TrustedProxies, "error", err)
+		_ = router.SetTrustedProxies(nil)
+	}
+	router.Use(gin.LoggerWithFormatter(logFormatter), gin.Recovery(), ForwardedProto(options.TrustedProxies))
+	router.Use(CORS(live), Authenticate(options.Auth), RateLimit(live, limiter), Authorize(Policy), QueryTimeout(live), Tenant(options.Tenants, options.Tenancy))
 	relativePath := getRelativePath(initialPath...)
 	router.LoadHTMLGlob(relativePath)
 	docs.SwaggerInfo.BasePath = "/api/v1"
-	router.Use(DBMiddleware(db.DB))
+	h := handlers.New(books, options.Keys, options.Accounts, options.Tenants, options.OIDC, limiter, live, options.Health, options.OAI)
 
-	// Welcome page route
+	// Welcome page route, and the settings of the tenant it is branded for
 	router.GET("/", welcomePageHandler)
+	router.GET("/tenant", h.CurrentTenant)
 
-	// Health check route
+	// Health check routes: liveness, whatever the dependencies, then readiness
 	router.GET("/health", healthCheckHandler)
 	router.GET("/api/", healthCheckHandler)
+	router.GET("/livez", healthCheckHandler)
+	router.GET("/readyz", h.Readiness)
 
 	// API routes for version 1
 	v1 := router.Group("/api/v1")
@@ -54,18 +130,77 @@ func SetupRouter(db db.Database, initialPath ...string) *gin.Engine {
 		v1.GET("/", healthCheckHandler)
 
 		// Books routes
-		v1.POST("/books", handlers.AddBook)
-		v1.GET("/books/:id", handlers.GetBook)
-		v1.GET("/books", handlers.ListBooks)
-		v1.PUT("/books/:id", handlers.UpdateBook)
-		v1.PATCH("/books/:id", handlers.PatchBook)
-		v1.DELETE("/books/:id", handlers.DeleteBook)
-		v1.GET("/books/search", handlers.SearchBooks)
-		v1.GET("/books/count", handlers.CountBooks)
+		v1.POST("/books", h.AddBook)
+		v1.GET("/books/:id", h.GetBook)
+		v1.GET("/books/:id/cite", h.CiteBook)
+		v1.GET("/books", h.ListBooks)
+		v1.PUT("/books/:id", h.UpdateBook)
+		v1.PATCH("/books/:id", h.PatchBook)
+		v1.DELETE("/books/:id", h.DeleteBook)
+		v1.GET("/books/search", h.SearchBooks)
+		v1.GET("/books/count", h.CountBooks)
+		v1.POST("/books/import/marc", h.ImportMARC)
+		v1.GET("/books/export/marc", h.ExportMARC)
 	}
 
-	// Serve Swagger UI
+	// OAI-PMH harvesting
+	if options.OAI.Enabled {
+		router.GET("/oai", h.OAIPMH)
+		router.POST("/oai", h.OAIPMH)
+	}
+
+	// OPDS catalogue, as OPDS 1.2 under /opds and OPDS 2.0 under /opds/v2
+	for _, path := range []string{"/opds", "/opds/v2"} {
+		catalog := router.Group(path)
+		catalog.GET("", h.OPDSRoot)
+		catalog.GET("/new", h.OPDSNew)
+		catalog.GET("/genres", h.OPDSGenres)
+		catalog.GET("/genres/*genre", h.OPDSGenre)
+		catalog.GET("/authors", h.OPDSAuthors)
+		catalog.GET("/authors/*author", h.OPDSAuthor)
+		catalog.GET("/search", h.OPDSSearch)
+	}
+	router.GET("/opds/opensearch.xml", handlers.OPDSOpenSearch)
+
+	// Syndication feeds
+	router.GET("/feeds/new.atom", h.NewArrivalsAtom)
+	router.GET("/feeds/new.rss", h.NewArrivalsRSS)
+
+	// Sessions of the users and their passwords, and the permissions of the
+	// caller for the clients to adapt
+	router.GET("/login", h.LoginPage)
+	router.POST("/auth/login", h.Login)
+	router.POST("/auth/logout", h.Logout)
+	router.POST("/auth/refresh", h.Refresh)
+	router.POST("/auth/password", h.ChangePassword)
+	router.POST("/auth/reset", h.ResetPassword)
+	router.GET("/auth/oidc/login", h.OIDCLogin)
+	router.GET("/auth/oidc/callback", h.OIDCCallback)
+	router.GET("/auth/permissions", h.Permissions)
+
+	// Administration
+	admin := router.Group("/admin")
+	admin.GET("/config", h.AdminConfig)
+	admin.GET("/cache", h.AdminCache)
+	admin.GET("/keys", h.ListKeys)
+	admin.POST("/keys", h.CreateKey)
+	admin.DELETE("/keys/:id", h.RevokeKey)
+	admin.GET("/users", h.ListUsers)
+	admin.POST("/users", h.CreateUser)
+	admin.POST("/users/:id/reset", h.IssueReset)
+	admin.GET("/ratelimits", h.ListRateLimits)
+	admin.DELETE("/ratelimits", h.ResetRateLimits)
+	admin.GET("/tenants", h.ListTenants)
+	admin.POST("/tenants", h.CreateTenant)
+	admin.PUT("/tenants/:slug", h.UpdateTenant)
+
+	// GraphQL endpoint
+	router.GET("/graphql", h.GraphQL)
+	router.POST("/graphql", h.GraphQL)
+
+	// Serve Swagger UI and GraphiQL
 	router.Static("/openapi", "openapi")
+	router.Static("/graphiql", "graphiql")
 
 	// Default route for 404 Not Found
 	router.NoRoute(func(c *gin.Context) {
@@ -82,20 +217,27 @@ func SetupRouter(db db.Database, initialPath ...string) *gin.Engine {
 //	@Success		200	{object}	handlers.MessageResponse	"Returns the homepage"
 //	@Router			/ [get]
 //
-// Welcome page handler
+// Welcome page handler, branded for the tenant of the request and naming
+// the user logged in if any
 func welcomePageHandler(c *gin.Context) {
 	// Serve the welcome page HTML file
-	c.HTML(http.StatusOK, "welcome.html", nil)
+	var user string
+	if principal, _ := auth.FromContext(c.Request.Context()); principal.Method == auth.MethodSession {
+		user = principal.Name
+	}
+	tenant, _ := c.Get(handlers.TenantKey)
+	c.HTML(http.StatusOK, "welcome.html", gin.H{"User": user, "Tenant": tenant})
 }
 
-//	@Summary		Health check
-//	@Description	Check the status of the Book Management API
+//	@Summary		Liveness check
+//	@Description	Check that the Book Management API is running, whatever the state of its dependencies
 //	@Tags			info
 //	@Produce		json
 //	@Success		200	{object}	handlers.MessageResponse	"Returns the status message"
+//	@Router			/livez [get]
 //	@Router			/health [get]
 //
-// Health check handler
+// Liveness check handler, which Kubernetes probes to restart the server
 func healthCheckHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, handlers.StatusResponse{
 		Status: "ok",
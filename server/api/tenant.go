@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"library/api/handlers"
+	"library/auth"
+	"library/config"
+	"library/repository"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Untenanted are the routes serving no tenant in particular, which resolve
+// none not to depend on the database, as the health checks.
+var Untenanted = map[Route]bool{
+	{http.MethodGet, "/health"}:              true,
+	{http.MethodGet, "/api/"}:                true,
+	{http.MethodGet, "/api/v1/"}:             true,
+	{http.MethodGet, "/livez"}:               true,
+	{http.MethodGet, "/readyz"}:              true,
+	{http.MethodGet, "/openapi/*filepath"}:   true,
+	{http.MethodHead, "/openapi/*filepath"}:  true,
+	{http.MethodGet, "/graphiql/*filepath"}:  true,
+	{http.MethodHead, "/graphiql/*filepath"}: true,
+}
+
+// Tenant serves every request the tenant it names, by the header of the
+// tenancy settings or else as a subdomain of their domain, or else the
+// tenant of its credentials: that of the tenant claim of its bearer token,
+// of its API key or of its user, or the default tenant. The handlers then
+// only read and write the books, API keys and users of that tenant. It
+// answers 404 Not Found to the requests naming an unknown tenant, and 403
+// Forbidden to those whose credentials belong to another tenant. When
+// tenancy is disabled, every request is served the default tenant.
+func Tenant(tenants repository.TenantRepository, tenancy config.TenancyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Untenanted[Route{Method: c.Request.Method, Path: c.FullPath()}] {
+			c.Next()
+			return
+		}
+		principal, _ := auth.FromContext(c.Request.Context())
+
+		var slug, claim string
+		if tenancy.Enabled {
+			c.Writer.Header().Add("Vary", tenancy.Header)
+			slug, claim = requestedTenant(c.Request, tenancy), tenancy.Claim
+		}
+		tenant, err := auth.ResolveTenant(c.Request.Context(), tenants, principal, slug, claim)
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, handlers.ErrorResponse{Error: "Unknown tenant " + strconv.Quote(tenant.Slug)})
+			return
+		} else if errors.Is(err, auth.ErrOtherTenant) {
+			slog.Warn("Rejected a request to another tenant.", "principal", principal.String(), "tenant", tenant.Slug, "path", c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, handlers.ErrorResponse{Error: "Forbidden: " + err.Error()})
+			return
+		} else if err != nil {
+			slog.Error("Cannot resolve the tenant of a request.", "tenant", slug, "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, handlers.ErrorResponse{Error: "Cannot resolve the tenant of the request"})
+			return
+		}
+
+		c.Set(handlers.TenantKey, tenant)
+		c.Request = c.Request.WithContext(repository.WithTenant(c.Request.Context(), tenant.ID))
+		c.Next()
+	}
+}
+
+// requestedTenant returns the slug of the tenant a request names, by the
+// header of the tenancy settings or as a subdomain of their domain, or "".
+func requestedTenant(r *http.Request, tenancy config.TenancyConfig) string {
+	if slug := strings.TrimSpace(r.Header.Get(tenancy.Header)); slug != "" {
+		return strings.ToLower(slug)
+	}
+	if tenancy.Domain == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	subdomain, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(tenancy.Domain))
+	if !ok || strings.Contains(subdomain, ".") {
+		return ""
+	}
+	return subdomain
+}
@@ -0,0 +1,343 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"library/models"
+	"library/repository"
+
+	"log/slog"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionPrefix starts every session token, to tell them apart from the API
+// keys and the JWTs.
+const SessionPrefix = "ses_"
+
+// ResetPrefix starts every token resetting a password.
+const ResetPrefix = "rst_"
+
+// SessionCookie carries the session token of the browsers, for the HTML pages.
+const SessionCookie = "library_session"
+
+// LockedError is returned when logging in to an account locked after too
+// many failed logins.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return "account locked after too many failed logins, until " + e.Until.UTC().Format(time.RFC3339)
+}
+
+// AccountOptions are the policies of the sessions and passwords of the users.
+type AccountOptions struct {
+	// SessionTTL is how long a session lasts unless refreshed, 12 hours if 0
+	SessionTTL time.Duration
+	// LockoutThreshold is the number of failed logins in a row locking an
+	// account for LockoutDuration, never if 0
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// ResetTTL is how long a reset token is valid, an hour if 0
+	ResetTTL time.Duration
+}
+
+// Session is a session opened for a user, whose token is only known to its
+// client.
+type Session struct {
+	Token     string      `json:"token"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	User      models.User `json:"user"`
+}
+
+// Accounts manages the users logging in with a password or an identity
+// provider and their sessions, stored in the database to be shared by the
+// instances of the server.
+type Accounts struct {
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+	options  AccountOptions
+	// cost is the bcrypt cost of the password hashes
+	cost int
+	// unknown is compared to the passwords of the unknown users, to take as
+	// long as with the known ones
+	unknown []byte
+	now     func() time.Time
+}
+
+// NewAccounts returns the accounts of the users and sessions of the
+// repositories.
+func NewAccounts(users repository.UserRepository, sessions repository.SessionRepository, options AccountOptions) *Accounts {
+	if options.SessionTTL == 0 {
+		options.SessionTTL = 12 * time.Hour
+	}
+	if options.ResetTTL == 0 {
+		options.ResetTTL = time.Hour
+	}
+	a := &Accounts{users: users, sessions: sessions, options: options, cost: bcrypt.DefaultCost, now: time.Now}
+	a.unknown, _ = bcrypt.GenerateFromPassword([]byte("unknown"), a.cost)
+	return a
+}
+
+func (a *Accounts) hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.cost)
+	return string(hash), err
+}
+
+// CreateUser creates a user of a role, or returns repository.ErrUserExists.
+func (a *Accounts) CreateUser(ctx context.Context, username, password, role string) (models.User, error) {
+	if !ValidRole(role) {
+		return models.User{}, fmt.Errorf("unknown role %q", role)
+	}
+	hash, err := a.hashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+	user := models.User{Username: username, PasswordHash: hash, Role: role}
+	if err := a.users.Create(ctx, &user); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// ListUsers returns all the users by ID.
+func (a *Accounts) ListUsers(ctx context.Context) ([]models.User, error) {
+	return a.users.List(ctx)
+}
+
+// Federate opens a session for the user of the subject of an identity
+// provider, created on its first login with the username it goes by there,
+// or the subject if taken, and given the role the provider grants it.
+func (a *Accounts) Federate(ctx context.Context, subject, username, role string) (Session, error) {
+	user, err := a.users.FindBySubject(ctx, subject)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		user = models.User{Username: username, Subject: subject, Role: role}
+		err = a.users.Create(ctx, &user)
+		if errors.Is(err, repository.ErrUserExists) && username != subject {
+			user = models.User{Username: subject, Subject: subject, Role: role}
+			err = a.users.Create(ctx, &user)
+		}
+		if err != nil {
+			return Session{}, fmt.Errorf("cannot create the user: %w", err)
+		}
+		slog.Info("Created a user of the identity provider.", "id", user.ID, "user", user.Username, "role", role)
+	} else if err != nil {
+		return Session{}, fmt.Errorf("cannot find the user: %w", err)
+	} else if user.Role != role {
+		user, err = a.users.Update(ctx, user.ID, func(user *models.User) error {
+			user.Role = role
+			return nil
+		})
+		if err != nil {
+			return Session{}, err
+		}
+	}
+	return a.open(ctx, user)
+}
+
+// Login opens a session for the user of a username if the password is its
+// own. It returns an error wrapping ErrInvalidCredentials otherwise, the same
+// whether the user exists or not, and a LockedError while the account is
+// locked, which the failed logins do once they reach the lockout threshold.
+func (a *Accounts) Login(ctx context.Context, username, password string) (Session, error) {
+	user, err := a.users.FindByUsername(ctx, username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(a.unknown, []byte(password))
+		return Session{}, fmt.Errorf("%w: wrong username or password", ErrInvalidCredentials)
+	} else if err != nil {
+		return Session{}, fmt.Errorf("cannot find the user: %w", err)
+	}
+	if err := a.locked(user); err != nil {
+		return Session{}, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		user, err = a.users.Update(ctx, user.ID, func(user *models.User) error {
+			// Another failed login may have locked the account meanwhile
+			if err := a.locked(*user); err != nil {
+				return err
+			}
+			user.FailedLogins++
+			if a.options.LockoutThreshold > 0 && user.FailedLogins >= a.options.LockoutThreshold {
+				until := a.now().Add(a.options.LockoutDuration).UTC()
+				user.FailedLogins, user.LockedUntil = 0, &until
+			}
+			return nil
+		})
+		if err != nil {
+			return Session{}, err
+		}
+		if err := a.locked(user); err != nil {
+			slog.Warn("Locked an account after too many failed logins.", "user", user.Username, "until", user.LockedUntil)
+			return Session{}, err
+		}
+		return Session{}, fmt.Errorf("%w: wrong username or password", ErrInvalidCredentials)
+	}
+
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		user, err = a.users.Update(ctx, user.ID, func(user *models.User) error {
+			user.FailedLogins, user.LockedUntil = 0, nil
+			return nil
+		})
+		if err != nil {
+			return Session{}, err
+		}
+	}
+	// The expired sessions are only kept until the next login
+	if _, err := a.sessions.DeleteExpired(ctx, a.now()); err != nil {
+		slog.Warn("Cannot delete the expired sessions.", "error", err)
+	}
+	return a.open(ctx, user)
+}
+
+// locked returns a LockedError if the account of the user is locked.
+func (a *Accounts) locked(user models.User) error {
+	if user.LockedUntil != nil && a.now().Before(*user.LockedUntil) {
+		return &LockedError{Until: *user.LockedUntil}
+	}
+	return nil
+}
+
+// open opens a new session for a user.
+func (a *Accounts) open(ctx context.Context, user models.User) (Session, error) {
+	token, hash, err := newToken(SessionPrefix)
+	if err != nil {
+		return Session{}, err
+	}
+	session := models.Session{Hash: hash, UserID: user.ID, ExpiresAt: a.now().Add(a.options.SessionTTL).UTC()}
+	if err := a.sessions.Create(ctx, &session); err != nil {
+		return Session{}, fmt.Errorf("cannot create the session: %w", err)
+	}
+	return Session{Token: token, ExpiresAt: session.ExpiresAt, User: user}, nil
+}
+
+// session returns the user of an unexpired session token, or an error
+// wrapping ErrInvalidCredentials.
+func (a *Accounts) session(ctx context.Context, token string) (models.Session, models.User, error) {
+	session, err := a.sessions.Find(ctx, HashKey(token))
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return session, models.User{}, fmt.Errorf("%w: unknown or expired session", ErrInvalidCredentials)
+	} else if err != nil {
+		return session, models.User{}, fmt.Errorf("cannot find the session: %w", err)
+	}
+	user, err := a.users.Get(ctx, session.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return session, user, fmt.Errorf("%w: unknown user", ErrInvalidCredentials)
+	}
+	return session, user, err
+}
+
+// Authenticate returns the principal of a session token, or an error
+// wrapping ErrInvalidCredentials.
+func (a *Accounts) Authenticate(ctx context.Context, token string) (Principal, error) {
+	_, user, err := a.session(ctx, token)
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Subject: strconv.FormatUint(uint64(user.ID), 10), Name: user.Username, Method: MethodSession, Roles: []string{user.Role}, Tenant: user.TenantID}, nil
+}
+
+// Logout closes the session of a token.
+func (a *Accounts) Logout(ctx context.Context, token string) error {
+	err := a.sessions.Delete(ctx, HashKey(token))
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return fmt.Errorf("%w: unknown or expired session", ErrInvalidCredentials)
+	}
+	return err
+}
+
+// Refresh replaces the session of a token by a new one, lasting the session
+// TTL from now.
+func (a *Accounts) Refresh(ctx context.Context, token string) (Session, error) {
+	_, user, err := a.session(ctx, token)
+	if err != nil {
+		return Session{}, err
+	}
+	session, err := a.open(ctx, user)
+	if err != nil {
+		return Session{}, err
+	}
+	if err := a.sessions.Delete(ctx, HashKey(token)); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		return Session{}, fmt.Errorf("cannot close the refreshed session: %w", err)
+	}
+	return session, nil
+}
+
+// ChangePassword changes the password of the user of a session token, given
+// its current password, and closes the other sessions of the user.
+func (a *Accounts) ChangePassword(ctx context.Context, token, current, password string) error {
+	session, user, err := a.session(ctx, token)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)) != nil {
+		return fmt.Errorf("%w: wrong current password", ErrInvalidCredentials)
+	}
+	return a.setPassword(ctx, user.ID, password, session.Hash)
+}
+
+// IssueReset returns a token resetting the password of a user once, until
+// it expires, replacing the previous one.
+func (a *Accounts) IssueReset(ctx context.Context, id uint) (string, time.Time, error) {
+	token, hash, err := newToken(ResetPrefix)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := a.now().Add(a.options.ResetTTL).UTC()
+	_, err = a.users.Update(ctx, id, func(user *models.User) error {
+		user.ResetHash, user.ResetExpiresAt = hash, &expires
+		return nil
+	})
+	return token, expires, err
+}
+
+// ResetPassword sets the password of the user of a reset token, unlocking
+// its account and closing all its sessions.
+func (a *Accounts) ResetPassword(ctx context.Context, token, password string) error {
+	user, err := a.users.FindByReset(ctx, HashKey(token))
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return fmt.Errorf("%w: unknown or expired reset token", ErrInvalidCredentials)
+	} else if err != nil {
+		return err
+	}
+	return a.setPassword(ctx, user.ID, password, "")
+}
+
+// setPassword sets the password of a user, clearing its reset token and its
+// failed logins, and closes its sessions but that of the hash keep.
+func (a *Accounts) setPassword(ctx context.Context, id uint, password, keep string) error {
+	hash, err := a.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = a.users.Update(ctx, id, func(user *models.User) error {
+		user.PasswordHash = hash
+		user.ResetHash, user.ResetExpiresAt = "", nil
+		user.FailedLogins, user.LockedUntil = 0, nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return a.sessions.DeleteUser(ctx, id, keep)
+}
+
+// SessionToken returns the session token of a request, sent as a bearer
+// token or in the session cookie, or "" if it has none.
+func SessionToken(r *http.Request) string {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") && strings.HasPrefix(strings.TrimSpace(token), SessionPrefix) {
+		return strings.TrimSpace(token)
+	}
+	if cookie, err := r.Cookie(SessionCookie); err == nil && strings.HasPrefix(cookie.Value, SessionPrefix) {
+		return cookie.Value
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"library/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const password = "correct horse battery staple"
+
+// newAccounts returns accounts of in-memory repositories, with a clock the
+// tests move and fast password hashes.
+func newAccounts(t *testing.T) (*Accounts, *time.Time) {
+	accounts := NewAccounts(repository.NewMemoryUsers(), repository.NewMemorySessions(), AccountOptions{
+		SessionTTL:       time.Hour,
+		LockoutThreshold: 3,
+		LockoutDuration:  15 * time.Minute,
+	})
+	accounts.cost = bcrypt.MinCost
+	now := time.Now()
+	accounts.now = func() time.Time { return now }
+	return accounts, &now
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	accounts, now := newAccounts(t)
+	user, err := accounts.CreateUser(ctx, "alice", password, RoleLibrarian)
+	require.NoError(t, err)
+	assert.NotEqual(t, password, user.PasswordHash)
+	_, err = accounts.CreateUser(ctx, "alice", password, RoleLibrarian)
+	assert.ErrorIs(t, err, repository.ErrUserExists)
+	_, err = accounts.CreateUser(ctx, "bob", password, "reader")
+	assert.ErrorContains(t, err, "unknown role")
+
+	session, err := accounts.Login(ctx, "alice", password)
+	require.NoError(t, err)
+	assert.Contains(t, session.Token, SessionPrefix)
+	assert.Equal(t, now.Add(time.Hour).UTC(), session.ExpiresAt)
+	principal, err := accounts.Authenticate(ctx, session.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "session:1", principal.String())
+	assert.Equal(t, "alice", principal.Name)
+	assert.Equal(t, []string{RoleLibrarian}, principal.Roles)
+
+	_, err = accounts.Login(ctx, "alice", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = accounts.Login(ctx, "bob", password)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.EqualError(t, err, "invalid credentials: wrong username or password", "the same as a wrong password")
+
+	// The sessions are closed by logging out
+	require.NoError(t, accounts.Logout(ctx, session.Token))
+	_, err = accounts.Authenticate(ctx, session.Token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.ErrorIs(t, accounts.Logout(ctx, session.Token), ErrInvalidCredentials)
+}
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	accounts, now := newAccounts(t)
+	_, err := accounts.CreateUser(ctx, "alice", password, RoleLibrarian)
+	require.NoError(t, err)
+
+	// A successful login forgets the failed ones
+	_, err = accounts.Login(ctx, "alice", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = accounts.Login(ctx, "alice", password)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = accounts.Login(ctx, "alice", "wrong")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+	_, err = accounts.Login(ctx, "alice", "wrong")
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked, "the third failure locks the account")
+	assert.Equal(t, now.Add(15*time.Minute).UTC(), locked.Until)
+	_, err = accounts.Login(ctx, "alice", password)
+	assert.ErrorAs(t, err, &locked, "even with the right password")
+
+	*now = now.Add(16 * time.Minute)
+	_, err = accounts.Login(ctx, "alice", password)
+	require.NoError(t, err)
+	user, err := accounts.users.FindByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Zero(t, user.FailedLogins)
+	assert.Nil(t, user.LockedUntil)
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	accounts, now := newAccounts(t)
+	_, err := accounts.CreateUser(ctx, "alice", password, RolePatron)
+	require.NoError(t, err)
+	session, err := accounts.Login(ctx, "alice", password)
+	require.NoError(t, err)
+
+	*now = now.Add(30 * time.Minute)
+	refreshed, err := accounts.Refresh(ctx, session.Token)
+	require.NoError(t, err)
+	assert.NotEqual(t, session.Token, refreshed.Token)
+	assert.Equal(t, now.Add(time.Hour).UTC(), refreshed.ExpiresAt)
+	_, err = accounts.Authenticate(ctx, session.Token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "the refreshed session is closed")
+	_, err = accounts.Authenticate(ctx, refreshed.Token)
+	assert.NoError(t, err)
+	_, err = accounts.Refresh(ctx, session.Token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	accounts, _ := newAccounts(t)
+	_, err := accounts.CreateUser(ctx, "alice", password, RolePatron)
+	require.NoError(t, err)
+	first, err := accounts.Login(ctx, "alice", password)
+	require.NoError(t, err)
+	second, err := accounts.Login(ctx, "alice", password)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, accounts.ChangePassword(ctx, first.Token, "wrong", "a new password of Alice"), ErrInvalidCredentials)
+	require.NoError(t, accounts.ChangePassword(ctx, first.Token, password, "a new password of Alice"))
+	_, err = accounts.Authenticate(ctx, first.Token)
+	assert.NoError(t, err, "the session changing the password is kept")
+	_, err = accounts.Authenticate(ctx, second.Token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "the other sessions are closed")
+	_, err = accounts.Login(ctx, "alice", password)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = accounts.Login(ctx, "alice", "a new password of Alice")
+	assert.NoError(t, err)
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	accounts, now := newAccounts(t)
+	user, err := accounts.CreateUser(ctx, "alice", password, RolePatron)
+	require.NoError(t, err)
+	session, err := accounts.Login(ctx, "alice", password)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = accounts.Login(ctx, "alice", "wrong")
+	}
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+
+	// The reset token unlocks the account and closes its sessions, once
+	token, expires, err := accounts.IssueReset(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Contains(t, token, ResetPrefix)
+	assert.Equal(t, now.Add(time.Hour).UTC(), expires)
+	require.NoError(t, accounts.ResetPassword(ctx, token, "a new password of Alice"))
+	_, err = accounts.Authenticate(ctx, session.Token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = accounts.Login(ctx, "alice", "a new password of Alice")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, accounts.ResetPassword(ctx, token, "another password"), ErrInvalidCredentials)
+
+	_, _, err = accounts.IssueReset(ctx, 1000)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestAuthenticateSession(t *testing.T) {
+	ctx := context.Background()
+	accounts, _ := newAccounts(t)
+	_, err := accounts.CreateUser(ctx, "alice", password, RoleAdmin)
+	require.NoError(t, err)
+	session, err := accounts.Login(ctx, "alice", password)
+	require.NoError(t, err)
+	authenticator := New(repository.NewMemoryKeys(), Options{Accounts: accounts})
+
+	testCases := []struct {
+		Description string
+		Bearer      string
+		Cookie      string
+		Principal   string
+		Err         string
+	}{
+		{Description: "Bearer", Bearer: session.Token, Principal: "session:1"},
+		{Description: "Cookie", Cookie: session.Token, Principal: "session:1"},
+		{Description: "Unknown bearer", Bearer: SessionPrefix + "unknown", Err: "unknown or expired session"},
+		{Description: "Unknown cookie", Cookie: SessionPrefix + "unknown"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.Bearer != "" {
+				request.Header.Set("Authorization", "Bearer "+tc.Bearer)
+			}
+			if tc.Cookie != "" {
+				request.AddCookie(&http.Cookie{Name: SessionCookie, Value: tc.Cookie})
+			}
+			principal, ok, err := authenticator.Authenticate(request)
+			if tc.Err != "" {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				assert.ErrorContains(t, err, tc.Err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.Principal != "", ok)
+			if ok {
+				assert.Equal(t, tc.Principal, principal.String())
+				assert.Equal(t, []string{RoleAdmin}, principal.Roles)
+			}
+			assert.Equal(t, tc.Bearer+tc.Cookie, SessionToken(request))
+		})
+	}
+}
@@ -0,0 +1,273 @@
+// Package auth authenticates the clients of the API, by the API keys they
+// were given, by the JWT bearer tokens of an identity provider or by the
+// sessions of the users logging in with a password, carries the resulting
+// principal in the context of their requests, and authorizes them by the
+// permissions of its roles.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"library/models"
+	"library/repository"
+)
+
+// Authentication methods
+const (
+	MethodAPIKey   = "api_key"
+	MethodAdminKey = "admin_key"
+	MethodJWT      = "jwt"
+	MethodSession  = "session"
+	// MethodNone authenticates everyone, when authentication is disabled
+	MethodNone = "none"
+	// MethodGuest is that of the requests without credentials
+	MethodGuest = "guest"
+)
+
+// KeyPrefix starts every API key, to tell them apart from the JWTs.
+const KeyPrefix = "lib_"
+
+// APIKeyHeader carries an API key, as an alternative to a bearer token.
+const APIKeyHeader = "X-API-Key"
+
+// ErrInvalidCredentials is returned for the credentials of a request that
+// authenticate nobody.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is the client of a request, authenticated or a guest.
+type Principal struct {
+	// Subject identifies the principal: the ID of its API key or user, or
+	// the subject of its token
+	Subject string `json:"subject"`
+	// Name describes the principal, as the name of its API key or user
+	Name   string `json:"name,omitempty"`
+	Method string `json:"method"`
+	// Roles grant the permissions of the principal
+	Roles []string `json:"roles"`
+	// Claims are those of the bearer token
+	Claims Claims `json:"-"`
+	// Tenant is the tenant of the API key or user of the principal, whose
+	// requests may not reach the other tenants; 0 for the other principals
+	Tenant uint `json:"-"`
+}
+
+// String identifies the principal in the logs, as "api_key:3".
+func (p Principal) String() string {
+	return p.Method + ":" + p.Subject
+}
+
+// Operator reports whether the principal operates the deployment rather
+// than one of its tenants, as the admin key, or anyone when authentication
+// is disabled.
+func (p Principal) Operator() bool {
+	return p.Method == MethodAdminKey || p.Method == MethodNone
+}
+
+// Authenticated reports whether the principal was authenticated, rather than
+// a guest.
+func (p Principal) Authenticated() bool {
+	return p.Method != "" && p.Method != MethodGuest
+}
+
+// Anonymous is the principal of every request when authentication is
+// disabled, allowed to do anything.
+var Anonymous = Principal{Subject: "anonymous", Method: MethodNone, Roles: []string{RoleAdmin}}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal of a request.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal of the request of a context, and false
+// if it has none.
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// NewKey returns a new random API key, and its hash to store.
+func NewKey() (key string, hash string, err error) {
+	return newToken(KeyPrefix)
+}
+
+// newToken returns a new random token starting with a prefix, and its hash.
+func newToken(prefix string) (token string, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = prefix + base64.RawURLEncoding.EncodeToString(secret)
+	return token, HashKey(token), nil
+}
+
+// HashKey returns the hash of an API key or another token, as stored. The
+// tokens are random enough for a fast hash to be safe, unlike passwords.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Hint returns the start of an API key, to tell it apart without revealing it.
+func Hint(key string) string {
+	return key[:min(len(key), len(KeyPrefix)+6)]
+}
+
+// DefaultRolesClaim is the claim of the tokens listing the roles of their subject.
+const DefaultRolesClaim = "roles"
+
+// Options are the credentials an Authenticator accepts besides the API keys
+// of its repository.
+type Options struct {
+	// Tokens verifies the bearer tokens, none accepted if nil
+	Tokens *Verifier
+	// AdminKey is an API key of the admin role, none if empty
+	AdminKey string
+	// Accounts authenticates the sessions of the users, none accepted if nil
+	Accounts *Accounts
+	// GuestRole is the role of the requests without credentials, none if empty
+	GuestRole string
+	// Roles maps the claims of the tokens to the roles of their subject
+	Roles RoleMapping
+}
+
+// Authenticator authenticates the requests by their API key, checked against
+// a repository and the admin key, by their bearer token or by their session.
+type Authenticator struct {
+	keys    repository.KeyRepository
+	options Options
+	// adminKey is the hash of the admin key, none accepted if empty
+	adminKey string
+}
+
+// New returns an authenticator of the API keys of the repository and of the
+// credentials of the options.
+func New(keys repository.KeyRepository, options Options) *Authenticator {
+	a := &Authenticator{keys: keys, options: options}
+	if options.AdminKey != "" {
+		a.adminKey = HashKey(options.AdminKey)
+	}
+	return a
+}
+
+// Guest returns the principal of the requests without credentials.
+func (a *Authenticator) Guest() Principal {
+	guest := Principal{Subject: "guest", Method: MethodGuest, Roles: []string{}}
+	if a.options.GuestRole != "" {
+		guest.Roles = []string{a.options.GuestRole}
+	}
+	return guest
+}
+
+// Authenticate returns the principal of the credentials of a request, false
+// if it has none, or an error wrapping ErrInvalidCredentials if they are
+// invalid. The API keys are sent in the X-API-Key header or as bearer tokens,
+// and the sessions as bearer tokens or in the session cookie of the browsers,
+// ignored once expired.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, bool, error) {
+	key, authorization := r.Header.Get(APIKeyHeader), r.Header.Get("Authorization")
+	if key == "" && authorization == "" {
+		return a.cookie(r)
+	}
+	return a.Credentials(r.Context(), key, authorization)
+}
+
+// Credentials returns the principal of an API key or else of an
+// Authorization header, as sent by the clients of the API and of the gRPC
+// service, false if both are empty, or an error wrapping
+// ErrInvalidCredentials if they are invalid.
+func (a *Authenticator) Credentials(ctx context.Context, key, authorization string) (Principal, bool, error) {
+	credentials := key
+	if credentials == "" {
+		if authorization == "" {
+			return Principal{}, false, nil
+		}
+		scheme, token, _ := strings.Cut(authorization, " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return Principal{}, false, fmt.Errorf("%w: expected a bearer token", ErrInvalidCredentials)
+		}
+		credentials = strings.TrimSpace(token)
+	}
+
+	var principal Principal
+	var err error
+	switch {
+	case strings.HasPrefix(credentials, KeyPrefix):
+		principal, err = a.apiKey(ctx, credentials)
+	case strings.HasPrefix(credentials, SessionPrefix):
+		principal, err = a.session(ctx, credentials)
+	default:
+		principal, err = a.token(ctx, credentials)
+	}
+	if err != nil {
+		return Principal{}, false, err
+	}
+	return principal, true, nil
+}
+
+// cookie authenticates a request by its session cookie, if any. A stale
+// cookie is no credentials, not to lock the browsers out of the pages.
+func (a *Authenticator) cookie(r *http.Request) (Principal, bool, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || a.options.Accounts == nil {
+		return Principal{}, false, nil
+	}
+	principal, err := a.session(r.Context(), cookie.Value)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return Principal{}, false, nil
+	} else if err != nil {
+		return Principal{}, false, err
+	}
+	return principal, true, nil
+}
+
+func (a *Authenticator) session(ctx context.Context, token string) (Principal, error) {
+	if a.options.Accounts == nil {
+		return Principal{}, fmt.Errorf("%w: sessions are not accepted", ErrInvalidCredentials)
+	}
+	return a.options.Accounts.Authenticate(ctx, token)
+}
+
+func (a *Authenticator) apiKey(ctx context.Context, key string) (Principal, error) {
+	hash := HashKey(key)
+	if a.adminKey != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.adminKey)) == 1 {
+		return Principal{Subject: "admin", Name: "admin key", Method: MethodAdminKey, Roles: []string{RoleAdmin}}, nil
+	}
+	apiKey, err := a.keys.Find(ctx, hash)
+	if errors.Is(err, repository.ErrKeyNotFound) {
+		return Principal{}, fmt.Errorf("%w: unknown or revoked API key", ErrInvalidCredentials)
+	} else if err != nil {
+		return Principal{}, fmt.Errorf("cannot check the API key: %w", err)
+	}
+	return keyPrincipal(apiKey), nil
+}
+
+func keyPrincipal(key models.APIKey) Principal {
+	return Principal{Subject: strconv.FormatUint(uint64(key.ID), 10), Name: key.Name, Method: MethodAPIKey, Roles: []string{key.Role}, Tenant: key.TenantID}
+}
+
+func (a *Authenticator) token(ctx context.Context, token string) (Principal, error) {
+	if a.options.Tokens == nil {
+		return Principal{}, fmt.Errorf("%w: bearer tokens are not accepted", ErrInvalidCredentials)
+	}
+	claims, err := a.options.Tokens.Verify(ctx, token)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	name := claims.String("name")
+	if name == "" {
+		name = claims.String("preferred_username")
+	}
+	return Principal{Subject: claims.String("sub"), Name: name, Method: MethodJWT, Roles: a.options.Roles.Map(claims), Claims: claims}, nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"library/models"
+	"library/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	keys := repository.NewMemoryKeys()
+	key, hash, err := NewKey()
+	require.NoError(t, err)
+	assert.Equal(t, HashKey(key), hash)
+	require.NoError(t, keys.Create(ctx, &models.APIKey{Name: "catalogue", Role: RoleLibrarian, Hash: hash, Hint: Hint(key)}))
+	revoked, hash, err := NewKey()
+	require.NoError(t, err)
+	apiKey := models.APIKey{Name: "revoked", Hash: hash}
+	require.NoError(t, keys.Create(ctx, &apiKey))
+	require.NoError(t, keys.Revoke(ctx, apiKey.ID))
+
+	adminKey := "lib_the-admin-key-of-the-library"
+	authenticator := New(keys, Options{Tokens: NewVerifier([]byte(testSecret), nil, "", ""), AdminKey: adminKey, Roles: RoleMapping{Claim: "groups"}})
+	token := sign(t, map[string]any{"alg": "HS256"}, map[string]any{
+		"sub": "alice", "preferred_username": "Alice", "exp": time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"staff", "librarian"},
+	}, []byte(testSecret))
+	patron := sign(t, map[string]any{"alg": "HS256"}, map[string]any{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix()}, []byte(testSecret))
+
+	testCases := []struct {
+		Description string
+		Headers     map[string]string
+		Principal   string
+		Name        string
+		Roles       []string
+		Err         string
+	}{
+		{Description: "No credentials"},
+		{Description: "API key header", Headers: map[string]string{"X-API-Key": key}, Principal: "api_key:1", Name: "catalogue", Roles: []string{RoleLibrarian}},
+		{Description: "API key bearer", Headers: map[string]string{"Authorization": "Bearer " + key}, Principal: "api_key:1", Name: "catalogue", Roles: []string{RoleLibrarian}},
+		{Description: "Admin key", Headers: map[string]string{"Authorization": "bearer " + adminKey}, Principal: "admin_key:admin", Name: "admin key", Roles: []string{RoleAdmin}},
+		{Description: "JWT", Headers: map[string]string{"Authorization": "Bearer " + token}, Principal: "jwt:alice", Name: "Alice", Roles: []string{RoleLibrarian}},
+		{Description: "JWT without roles", Headers: map[string]string{"Authorization": "Bearer " + patron}, Principal: "jwt:bob", Roles: []string{RolePatron}},
+		{Description: "Revoked key", Headers: map[string]string{"X-API-Key": revoked}, Err: "invalid credentials: unknown or revoked API key"},
+		{Description: "Unknown key", Headers: map[string]string{"X-API-Key": "lib_unknown"}, Err: "unknown or revoked API key"},
+		{Description: "Invalid JWT", Headers: map[string]string{"Authorization": "Bearer " + token + "x"}, Err: "invalid credentials: invalid token signature"},
+		{Description: "Basic", Headers: map[string]string{"Authorization": "Basic YWxpY2U6c2VjcmV0"}, Err: "expected a bearer token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/books", nil)
+			for name, value := range tc.Headers {
+				request.Header.Set(name, value)
+			}
+			principal, ok, err := authenticator.Authenticate(request)
+			if tc.Err != "" {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				assert.ErrorContains(t, err, tc.Err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.Principal != "", ok)
+			if ok {
+				assert.Equal(t, tc.Principal, principal.String())
+				assert.Equal(t, tc.Name, principal.Name)
+				assert.Equal(t, tc.Roles, principal.Roles)
+			}
+		})
+	}
+
+	// Without a verifier, the bearer tokens are rejected
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/books", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	_, _, err = New(keys, Options{}).Authenticate(request)
+	assert.ErrorContains(t, err, "bearer tokens are not accepted")
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	principal, ok := FromContext(WithPrincipal(context.Background(), Anonymous))
+	assert.True(t, ok)
+	assert.Equal(t, "none:anonymous", principal.String())
+}
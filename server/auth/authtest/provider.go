@@ -0,0 +1,229 @@
+// Package authtest runs a stub OpenID provider, to test the logins with an
+// identity provider without one.
+package authtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Provider is an OpenID provider logging in a single user, by the
+// authorization code flow with PKCE, and signing its tokens with RS256.
+type Provider struct {
+	*httptest.Server
+	// ClientID and ClientSecret identify the client, a public one without
+	// a secret
+	ClientID     string
+	ClientSecret string
+	// Claims are the claims of the user logging in, such as sub and groups
+	Claims map[string]any
+
+	t       *testing.T
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	keyID   int
+	fetches int
+	codes   map[string]grant
+}
+
+// grant is an authorization code not yet exchanged.
+type grant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	claims      map[string]any
+}
+
+// NewProvider starts a provider for a client, stopped at the end of the test.
+func NewProvider(t *testing.T, clientID, clientSecret string) *Provider {
+	p := &Provider{ClientID: clientID, ClientSecret: clientSecret, Claims: map[string]any{}, t: t, codes: map[string]grant{}}
+	p.Rotate()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// Issuer returns the issuer of the tokens of the provider.
+func (p *Provider) Issuer() string {
+	return p.URL
+}
+
+// KeyID returns the ID of the signing key, changed by Rotate.
+func (p *Provider) KeyID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return fmt.Sprintf("key-%d", p.keyID)
+}
+
+// Rotate replaces the signing key, whose tokens are no longer valid.
+func (p *Provider) Rotate() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(p.t, err)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.keyID++
+}
+
+// Fetches returns the number of requests of the JWKS.
+func (p *Provider) Fetches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fetches
+}
+
+// Token returns a token of the claims signed by the provider, issued by it
+// now and expiring in an hour unless the claims say otherwise.
+func (p *Provider) Token(claims map[string]any) string {
+	all := map[string]any{"iss": p.Issuer(), "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()}
+	for name, value := range claims {
+		all[name] = value
+	}
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(p.t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	signed := encode(map[string]any{"alg": "RS256", "typ": "JWT", "kid": fmt.Sprintf("key-%d", p.keyID)}) + "." + encode(all)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	require.NoError(p.t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Authorize logs the user in at the authorization URL a login redirects the
+// browser to, and returns the URL the provider redirects it back to.
+func (p *Provider) Authorize(authURL string) string {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(authURL)
+	require.NoError(p.t, err)
+	defer response.Body.Close()
+	require.Equal(p.t, http.StatusFound, response.StatusCode, "the provider refused the authorization request")
+	return response.Header.Get("Location")
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != p.ClientID ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("redirect_uri") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	code := random(p.t)
+	p.mu.Lock()
+	claims := map[string]any{}
+	for name, value := range p.Claims {
+		claims[name] = value
+	}
+	p.codes[code] = grant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), redirectURI: query.Get("redirect_uri"), claims: claims}
+	p.mu.Unlock()
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if p.ClientSecret != "" {
+		// The credentials are form-encoded, as RFC 6749 asks
+		id, secret, ok := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if !ok || id != p.ClientID || secret != p.ClientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+	}
+	code := r.PostFormValue("code")
+	p.mu.Lock()
+	grant, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	switch {
+	case r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("client_id") != p.ClientID:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+	case !ok || r.PostFormValue("redirect_uri") != grant.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+	default:
+		claims := map[string]any{"aud": p.ClientID, "nonce": grant.nonce}
+		for name, value := range grant.claims {
+			claims[name] = value
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"token_type":   "Bearer",
+			"access_token": p.Token(grant.claims),
+			"id_token":     p.Token(claims),
+			"expires_in":   3600,
+		})
+	}
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetches++
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]any{{
+		"kty": "RSA", "kid": fmt.Sprintf("key-%d", p.keyID), "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func random(t *testing.T) string {
+	secret := make([]byte, 16)
+	_, err := rand.Read(secret)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(secret)
+}
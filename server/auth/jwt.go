@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is the leeway given to the expiry and start times of the tokens,
+// as the clocks of their issuer and of the server may differ.
+const clockSkew = time.Minute
+
+// Claims are the claims of a JWT.
+type Claims map[string]any
+
+// String returns a string claim, or "" if it is missing or not a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim holding a string or an array of strings. Unless
+// a claim has that very name, a dotted name reaches into nested claims, as
+// realm_access.roles.
+func (c Claims) Strings(name string) []string {
+	claim, ok := c[name]
+	if !ok && strings.Contains(name, ".") {
+		parent, child, _ := strings.Cut(name, ".")
+		if nested, ok := c[parent].(map[string]any); ok {
+			return Claims(nested).Strings(child)
+		}
+	}
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// time returns a NumericDate claim, and false if it is missing.
+func (c Claims) time(name string) (time.Time, bool, error) {
+	value, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("the %s claim is not a number", name)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("the %s claim is not a number", name)
+	}
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// KeySource returns the RSA public keys verifying the RS256 tokens.
+type KeySource interface {
+	// Key returns the key of an ID, or the only key if the ID is empty.
+	Key(ctx context.Context, id string) (*rsa.PublicKey, error)
+}
+
+// KeySet is a fixed set of RSA public keys by ID, as read from a JWKS file.
+type KeySet map[string]*rsa.PublicKey
+
+func (s KeySet) Key(ctx context.Context, id string) (*rsa.PublicKey, error) {
+	if id == "" && len(s) == 1 {
+		for _, key := range s {
+			return key, nil
+		}
+	}
+	key, ok := s[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// jwk is a JSON Web Key, of which only the RSA signing keys are used.
+type jwk struct {
+	KeyType string `json:"kty"`
+	ID      string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+// ParseJWKS returns the RSA signing keys of a JSON Web Key Set, ignoring the
+// other keys.
+func ParseJWKS(data []byte) (KeySet, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := KeySet{}
+	for _, k := range jwks.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %q: %w", k.ID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent of key %q", k.ID)
+		}
+		keys[k.ID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the JWKS holds no RSA signing key")
+	}
+	return keys, nil
+}
+
+// LoadJWKS reads the RSA signing keys of a JWKS file.
+func LoadJWKS(path string) (KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// Verifier verifies the signature and the claims of JWTs, signed with HS256
+// by a shared secret or with RS256 by the keys of a KeySource.
+type Verifier struct {
+	secret   []byte
+	keys     KeySource
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// NewVerifier returns a verifier of the tokens signed with the secret or the
+// keys, either of which may be empty, and issued by the issuer for the
+// audience, unless empty.
+func NewVerifier(secret []byte, keys KeySource, issuer, audience string) *Verifier {
+	return &Verifier{secret: secret, keys: keys, issuer: issuer, audience: audience, now: time.Now}
+}
+
+// Verify returns the claims of a token, once its signature, expiry, issuer
+// and audience are checked.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+	if err := v.verifySignature(ctx, header.Algorithm, header.KeyID, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	return claims, v.verifyClaims(claims)
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, algorithm, keyID, signed string, signature []byte) error {
+	switch algorithm {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid token signature")
+		}
+	case "RS256":
+		if v.keys == nil {
+			return errors.New("RS256 tokens are not accepted")
+		}
+		key, err := v.keys.Key(ctx, keyID)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", algorithm)
+	}
+	return nil
+}
+
+func (v *Verifier) verifyClaims(claims Claims) error {
+	now := v.now()
+	expires, ok, err := claims.time("exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the token does not expire")
+	}
+	if now.After(expires.Add(clockSkew)) {
+		return errors.New("the token expired")
+	}
+	notBefore, ok, err := claims.time("nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(clockSkew).Before(notBefore) {
+		return errors.New("the token is not valid yet")
+	}
+	if v.issuer != "" && claims.String("iss") != v.issuer {
+		return fmt.Errorf("the token is not issued by %s", v.issuer)
+	}
+	if v.audience != "" && !slices.Contains(claims.Strings("aud"), v.audience) {
+		return fmt.Errorf("the token is not meant for %s", v.audience)
+	}
+	if claims.String("sub") == "" {
+		return errors.New("the token has no subject")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
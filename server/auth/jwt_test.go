@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "a secret of at least thirty-two bytes"
+
+// sign returns a token of the claims signed with the algorithm and key.
+func sign(t *testing.T, header map[string]any, claims map[string]any, key any) string {
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// jwks returns the JWKS of the public key of a private key.
+func jwks(t *testing.T, id string, key *rsa.PrivateKey) []byte {
+	data, err := json.Marshal(map[string]any{"keys": []map[string]any{
+		{"kty": "EC", "kid": "other", "crv": "P-256"},
+		{
+			"kty": "RSA", "kid": id, "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		},
+	}})
+	require.NoError(t, err)
+	return data
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks(t, "key-1", rsaKey), 0o600))
+	keys, err := LoadJWKS(path)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1, "the other keys are ignored")
+
+	verifier := NewVerifier([]byte(testSecret), keys, "https://id.example.org", "library")
+	verifier.now = func() time.Time { return now }
+	hs256 := map[string]any{"alg": "HS256", "typ": "JWT"}
+	rs256 := map[string]any{"alg": "RS256", "kid": "key-1"}
+	claims := func(changes map[string]any) map[string]any {
+		claims := map[string]any{
+			"sub": "alice",
+			"iss": "https://id.example.org",
+			"aud": []string{"library", "catalogue"},
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+
+	testCases := []struct {
+		Description string
+		Token       string
+		Err         string
+	}{
+		{Description: "HS256", Token: sign(t, hs256, claims(nil), []byte(testSecret))},
+		{Description: "RS256", Token: sign(t, rs256, claims(nil), rsaKey)},
+		{Description: "Audience string", Token: sign(t, hs256, claims(map[string]any{"aud": "library"}), []byte(testSecret))},
+		{Description: "Within clock skew", Token: sign(t, hs256, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}), []byte(testSecret))},
+		{Description: "Wrong secret", Token: sign(t, hs256, claims(nil), []byte("another secret")), Err: "invalid token signature"},
+		{Description: "Unknown key", Token: sign(t, map[string]any{"alg": "RS256", "kid": "key-2"}, claims(nil), rsaKey), Err: `unknown key "key-2"`},
+		{Description: "Unsigned", Token: sign(t, map[string]any{"alg": "none"}, claims(nil), nil), Err: `unsupported token algorithm "none"`},
+		{Description: "Expired", Token: sign(t, hs256, claims(map[string]any{"exp": now.Add(-time.Hour).Unix()}), []byte(testSecret)), Err: "the token expired"},
+		{Description: "Not expiring", Token: sign(t, hs256, claims(map[string]any{"exp": nil}), []byte(testSecret)), Err: "the token does not expire"},
+		{Description: "Not valid yet", Token: sign(t, hs256, claims(map[string]any{"nbf": now.Add(time.Hour).Unix()}), []byte(testSecret)), Err: "the token is not valid yet"},
+		{Description: "Other issuer", Token: sign(t, hs256, claims(map[string]any{"iss": "https://elsewhere.example.org"}), []byte(testSecret)), Err: "the token is not issued by https://id.example.org"},
+		{Description: "Other audience", Token: sign(t, hs256, claims(map[string]any{"aud": "catalogue"}), []byte(testSecret)), Err: "the token is not meant for library"},
+		{Description: "No subject", Token: sign(t, hs256, claims(map[string]any{"sub": nil}), []byte(testSecret)), Err: "the token has no subject"},
+		{Description: "Malformed", Token: "not.a-token", Err: "malformed token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			claims, err := verifier.Verify(ctx, tc.Token)
+			if tc.Err != "" {
+				assert.ErrorContains(t, err, tc.Err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "alice", claims.String("sub"))
+		})
+	}
+
+	// A verifier without secret rejects the HS256 tokens
+	verifier = NewVerifier(nil, keys, "", "")
+	verifier.now = func() time.Time { return now }
+	_, err = verifier.Verify(ctx, sign(t, hs256, claims(nil), []byte(testSecret)))
+	assert.ErrorContains(t, err, "HS256 tokens are not accepted")
+	_, err = verifier.Verify(ctx, sign(t, map[string]any{"alg": "RS256"}, claims(nil), rsaKey))
+	assert.NoError(t, err, "the only key verifies the tokens without key ID")
+}
+
+func TestParseJWKS(t *testing.T) {
+	for _, data := range []string{
+		`{"keys": []}`,
+		`{"keys": [{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`,
+		`not JSON`,
+	} {
+		_, err := ParseJWKS([]byte(data))
+		assert.Error(t, err, fmt.Sprintf("%s is invalid", data))
+	}
+}
@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"log/slog"
+
+	"library/repository"
+)
+
+// discoveryPath is where an OpenID provider describes itself, under its issuer.
+const discoveryPath = "/.well-known/openid-configuration"
+
+// maxUsername is the length of the usernames of the database.
+const maxUsername = 64
+
+// Discovery is the metadata of an OpenID provider the server uses.
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// Discover returns the metadata of the OpenID provider of an issuer, which
+// must name that issuer and support PKCE with S256 if it lists its methods.
+func Discover(ctx context.Context, client *http.Client, issuer string) (Discovery, error) {
+	var discovery Discovery
+	if err := getJSON(ctx, client, strings.TrimSuffix(issuer, "/")+discoveryPath, &discovery); err != nil {
+		return discovery, fmt.Errorf("cannot discover the OpenID provider: %w", err)
+	}
+	switch {
+	case discovery.Issuer != issuer:
+		return discovery, fmt.Errorf("the OpenID provider of %s names the issuer %s", issuer, discovery.Issuer)
+	case discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "":
+		return discovery, errors.New("the OpenID provider lacks an authorization, token or JWKS endpoint")
+	case len(discovery.CodeChallengeMethods) > 0 && !slices.Contains(discovery.CodeChallengeMethods, "S256"):
+		return discovery, errors.New("the OpenID provider does not support PKCE with S256")
+	}
+	return discovery, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(v)
+}
+
+// RemoteKeys is the JWKS of an identity provider, fetched when first needed
+// and cached for a TTL. A token naming an unknown key fetches it again, as
+// after a rotation of the keys, at most every minute. When the provider
+// cannot be reached, the cached keys are kept.
+type RemoteKeys struct {
+	client *http.Client
+	url    string
+	ttl    time.Duration
+	// minRefresh bounds how often the unknown keys fetch the JWKS
+	minRefresh time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	keys    KeySet
+	fetched time.Time
+}
+
+// NewRemoteKeys returns the keys of the JWKS of a URL, cached for ttl.
+func NewRemoteKeys(client *http.Client, url string, ttl time.Duration) *RemoteKeys {
+	return &RemoteKeys{client: client, url: url, ttl: ttl, minRefresh: time.Minute, now: time.Now}
+}
+
+func (r *RemoteKeys) Key(ctx context.Context, id string) (*rsa.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys == nil || r.now().Sub(r.fetched) >= r.ttl {
+		if err := r.fetch(ctx); err != nil && r.keys == nil {
+			return nil, err
+		}
+	}
+	key, err := r.keys.Key(ctx, id)
+	if err != nil && r.now().Sub(r.fetched) >= r.minRefresh {
+		if err := r.fetch(ctx); err != nil {
+			return nil, err
+		}
+		return r.keys.Key(ctx, id)
+	}
+	return key, err
+}
+
+// fetch fetches the keys, keeping the cached ones if it fails.
+func (r *RemoteKeys) fetch(ctx context.Context) error {
+	// Whether it succeeds or not, not to fetch the keys at every request
+	r.fetched = r.now()
+	var data json.RawMessage
+	err := getJSON(ctx, r.client, r.url, &data)
+	var keys KeySet
+	if err == nil {
+		keys, err = ParseJWKS(data)
+	}
+	if err != nil {
+		slog.Warn("Cannot fetch the keys of the identity provider.", "url", r.url, "error", err)
+		return fmt.Errorf("cannot fetch the keys of the identity provider: %w", err)
+	}
+	r.keys = keys
+	return nil
+}
+
+// OIDCOptions configure the login of the users with an OpenID provider.
+type OIDCOptions struct {
+	// Issuer is the URL of the provider, discovered under it
+	Issuer string
+	// ClientID and ClientSecret identify the server to the provider; a
+	// public client has no secret
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback of the server the provider redirects to
+	RedirectURL string
+	// Scopes are requested besides openid
+	Scopes []string
+	// Roles maps the claims of the ID tokens to the role of the users
+	Roles RoleMapping
+	// TenantClaim is the claim of the ID tokens naming the tenant of their
+	// user, who belongs to the default tenant without; the logins to another
+	// tenant are refused. The claims are ignored if empty, as when tenancy
+	// is disabled
+	TenantClaim string
+	// KeysTTL is how long the keys of the provider are cached, an hour if 0
+	KeysTTL time.Duration
+	// Client calls the provider, with a timeout of 10 seconds if nil
+	Client *http.Client
+}
+
+// OIDC logs the users in with an OpenID provider, by the authorization code
+// flow with PKCE, opening a session of the accounts for them.
+type OIDC struct {
+	options   OIDCOptions
+	discovery Discovery
+	keys      *RemoteKeys
+	idTokens  *Verifier
+	accounts  *Accounts
+}
+
+// NewOIDC discovers the provider of the options, to log the users of the
+// accounts in with it.
+func NewOIDC(ctx context.Context, accounts *Accounts, options OIDCOptions) (*OIDC, error) {
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if options.KeysTTL == 0 {
+		options.KeysTTL = time.Hour
+	}
+	if !slices.Contains(options.Scopes, "openid") {
+		options.Scopes = append([]string{"openid"}, options.Scopes...)
+	}
+	discovery, err := Discover(ctx, options.Client, options.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	keys := NewRemoteKeys(options.Client, discovery.JWKSURI, options.KeysTTL)
+	return &OIDC{
+		options:   options,
+		discovery: discovery,
+		keys:      keys,
+		idTokens:  NewVerifier(nil, keys, discovery.Issuer, options.ClientID),
+		accounts:  accounts,
+	}, nil
+}
+
+// Issuer returns the issuer of the tokens of the provider.
+func (o *OIDC) Issuer() string {
+	return o.discovery.Issuer
+}
+
+// Keys returns the keys of the provider, to verify its bearer tokens too.
+func (o *OIDC) Keys() KeySource {
+	return o.keys
+}
+
+// Tokens returns the verifier of the bearer tokens signed by the keys of
+// the provider or by secret, naming issuer and audience: by default the
+// provider and the client ID of the server, not to accept the tokens the
+// provider issues to its other clients.
+func (o *OIDC) Tokens(secret []byte, issuer, audience string) *Verifier {
+	if issuer == "" {
+		issuer = o.Issuer()
+	}
+	if audience == "" {
+		audience = o.options.ClientID
+	}
+	return NewVerifier(secret, o.keys, issuer, audience)
+}
+
+// Flow is the state of a login between its start and its callback, kept
+// by the browser: the state binding the callback to the browser, the nonce
+// binding the ID token to the login, and the PKCE verifier binding the
+// authorization code to the server.
+type Flow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// Encode returns the flow as a cookie value.
+func (f Flow) Encode() string {
+	data, _ := json.Marshal(f)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeFlow returns the flow of a cookie value.
+func DecodeFlow(value string) (Flow, error) {
+	var flow Flow
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &flow)
+	}
+	if err != nil || flow.State == "" || flow.Nonce == "" || flow.Verifier == "" {
+		return Flow{}, fmt.Errorf("%w: invalid login state", ErrInvalidCredentials)
+	}
+	return flow, nil
+}
+
+// Start starts a login, returning its flow and the URL of the provider to
+// redirect the browser to.
+func (o *OIDC) Start() (Flow, string, error) {
+	var flow Flow
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Flow{}, "", err
+		}
+		*value = base64.RawURLEncoding.EncodeToString(secret)
+	}
+	challenge := sha256.Sum256([]byte(flow.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.options.ClientID},
+		"redirect_uri":          {o.options.RedirectURL},
+		"scope":                 {strings.Join(o.options.Scopes, " ")},
+		"state":                 {flow.State},
+		"nonce":                 {flow.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(o.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return flow, o.discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Finish finishes the login of a flow to the tenant of a slug with the state
+// and authorization code the provider redirected the browser with, and opens
+// a session for its user. It returns an error wrapping ErrInvalidCredentials
+// if the provider does not vouch for the user, or for its belonging to the
+// tenant.
+func (o *OIDC) Finish(ctx context.Context, flow Flow, state, code, tenant string) (Session, error) {
+	if subtle.ConstantTimeCompare([]byte(state), []byte(flow.State)) != 1 {
+		return Session{}, fmt.Errorf("%w: the state of the login does not match", ErrInvalidCredentials)
+	}
+	token, err := o.exchange(ctx, code, flow.Verifier)
+	if err != nil {
+		return Session{}, err
+	}
+	claims, err := o.idTokens.Verify(ctx, token)
+	if err != nil {
+		return Session{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(flow.Nonce)) != 1 {
+		return Session{}, fmt.Errorf("%w: the nonce of the ID token does not match", ErrInvalidCredentials)
+	}
+
+	subject := claims.String("sub")
+	if subject == "" {
+		return Session{}, fmt.Errorf("%w: the ID token has no subject", ErrInvalidCredentials)
+	}
+	if o.options.TenantClaim != "" {
+		// The provider may serve the users of every tenant, who must not log
+		// in to the others
+		claimed := claims.String(o.options.TenantClaim)
+		if claimed == "" {
+			claimed = repository.DefaultTenantSlug
+		}
+		if claimed != tenant {
+			return Session{}, fmt.Errorf("%w: the user belongs to the %s tenant rather than %s", ErrInvalidCredentials, claimed, tenant)
+		}
+	}
+	username := claims.String("preferred_username")
+	if username == "" || len(username) > maxUsername {
+		username = subject
+	}
+	roles := o.options.Roles.Map(claims)
+	return o.accounts.Federate(ctx, subject, username, roles[len(roles)-1])
+}
+
+// exchange exchanges an authorization code for the ID token of its user.
+func (o *OIDC) exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.options.RedirectURL},
+		"client_id":     {o.options.ClientID},
+		"code_verifier": {verifier},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if o.options.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(o.options.ClientID), url.QueryEscape(o.options.ClientSecret))
+	}
+	response, err := o.options.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("cannot reach the identity provider: %w", err)
+	}
+	defer response.Body.Close()
+
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("invalid response of the identity provider (%s): %w", response.Status, err)
+	}
+	if response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("%w: the identity provider refused the code: %s %s", ErrInvalidCredentials, tokens.Error, tokens.Description)
+	}
+	if response.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return "", fmt.Errorf("the identity provider returned no ID token: %s %s", response.Status, tokens.Error)
+	}
+	return tokens.IDToken, nil
+}
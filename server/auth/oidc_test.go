@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"library/auth/authtest"
+	"library/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscover(t *testing.T) {
+	ctx := context.Background()
+	provider := authtest.NewProvider(t, "library", "")
+	discovery, err := Discover(ctx, http.DefaultClient, provider.Issuer())
+	require.NoError(t, err)
+	assert.Equal(t, provider.URL+"/token", discovery.TokenEndpoint)
+	assert.Equal(t, provider.URL+"/jwks", discovery.JWKSURI)
+
+	_, err = Discover(ctx, http.DefaultClient, provider.Issuer()+"/")
+	assert.ErrorContains(t, err, "names the issuer "+provider.Issuer())
+	_, err = Discover(ctx, http.DefaultClient, provider.Issuer()+"/realms/unknown")
+	assert.ErrorContains(t, err, "404 Not Found")
+}
+
+func TestRemoteKeys(t *testing.T) {
+	ctx := context.Background()
+	provider := authtest.NewProvider(t, "library", "")
+	keys := NewRemoteKeys(http.DefaultClient, provider.URL+"/jwks", time.Hour)
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	// The keys are fetched once, then cached
+	first := provider.KeyID()
+	_, err := keys.Key(ctx, first)
+	require.NoError(t, err)
+	_, err = keys.Key(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.Fetches())
+
+	// A rotated key is fetched, though not more than every minute
+	provider.Rotate()
+	second := provider.KeyID()
+	now = now.Add(10 * time.Second)
+	_, err = keys.Key(ctx, second)
+	assert.ErrorContains(t, err, "unknown key")
+	assert.Equal(t, 1, provider.Fetches())
+	now = now.Add(time.Minute)
+	_, err = keys.Key(ctx, second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, provider.Fetches())
+	_, err = keys.Key(ctx, first)
+	assert.ErrorContains(t, err, "unknown key", "the retired key")
+
+	// The keys are fetched again after the TTL, and kept if the provider is down
+	now = now.Add(time.Hour)
+	_, err = keys.Key(ctx, second)
+	require.NoError(t, err)
+	assert.Equal(t, 3, provider.Fetches())
+	provider.Close()
+	now = now.Add(time.Hour)
+	_, err = keys.Key(ctx, second)
+	assert.NoError(t, err)
+}
+
+// login logs a user in with the provider, returning the state and code of
+// the callback of a flow.
+func login(t *testing.T, provider *authtest.Provider, oidc *OIDC) (Flow, string, string) {
+	flow, authURL, err := oidc.Start()
+	require.NoError(t, err)
+	callback, err := url.Parse(provider.Authorize(authURL))
+	require.NoError(t, err)
+	assert.Equal(t, "/auth/oidc/callback", callback.Path)
+	return flow, callback.Query().Get("state"), callback.Query().Get("code")
+}
+
+func TestOIDC(t *testing.T) {
+	ctx := context.Background()
+	provider := authtest.NewProvider(t, "library", "a client secret")
+	provider.Claims = map[string]any{"sub": "f3a1c2", "preferred_username": "alice", "groups": []string{"library-staff", "students"}}
+	accounts, _ := newAccounts(t)
+	oidc, err := NewOIDC(ctx, accounts, OIDCOptions{
+		Issuer:       provider.Issuer(),
+		ClientID:     "library",
+		ClientSecret: "a client secret",
+		RedirectURL:  "https://library.example.edu/auth/oidc/callback",
+		Scopes:       []string{"profile"},
+		Roles:        RoleMapping{Claim: "groups", Roles: map[string]string{"library-staff": RoleLibrarian}},
+	})
+	require.NoError(t, err)
+
+	_, authURL, err := oidc.Start()
+	require.NoError(t, err)
+	query, err := url.ParseQuery(authURL[len(provider.URL+"/authorize?"):])
+	require.NoError(t, err)
+	assert.Equal(t, "openid profile", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.NotEmpty(t, query.Get("code_challenge"))
+
+	// The users of the provider are created once, with the mapped role
+	flow, state, code := login(t, provider, oidc)
+	session, err := oidc.Finish(ctx, flow, state, code, repository.DefaultTenantSlug)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", session.User.Username)
+	assert.Equal(t, "f3a1c2", session.User.Subject)
+	assert.Equal(t, RoleLibrarian, session.User.Role)
+	principal, err := accounts.Authenticate(ctx, session.Token)
+	require.NoError(t, err)
+	assert.Equal(t, []string{RoleLibrarian}, principal.Roles)
+
+	provider.Claims["groups"] = []string{"students"}
+	flow, state, code = login(t, provider, oidc)
+	again, err := oidc.Finish(ctx, flow, state, code, repository.DefaultTenantSlug)
+	require.NoError(t, err)
+	assert.Equal(t, session.User.ID, again.User.ID)
+	assert.Equal(t, RolePatron, again.User.Role, "the role follows the groups")
+
+	// A local user of the same name keeps it
+	_, err = accounts.CreateUser(ctx, "bob", password, RoleAdmin)
+	require.NoError(t, err)
+	provider.Claims = map[string]any{"sub": "b0b", "preferred_username": "bob"}
+	flow, state, code = login(t, provider, oidc)
+	bob, err := oidc.Finish(ctx, flow, state, code, repository.DefaultTenantSlug)
+	require.NoError(t, err)
+	assert.Equal(t, "b0b", bob.User.Username)
+	assert.Equal(t, RolePatron, bob.User.Role)
+
+	testCases := []struct {
+		Description string
+		Change      func(flow *Flow, state, code *string)
+		Err         string
+	}{
+		{Description: "Wrong state", Change: func(flow *Flow, state, code *string) { *state = "forged" }, Err: "the state of the login does not match"},
+		{Description: "Wrong verifier", Change: func(flow *Flow, state, code *string) { flow.Verifier = "stolen code" }, Err: "PKCE verification failed"},
+		{Description: "Unknown code", Change: func(flow *Flow, state, code *string) { *code = "unknown" }, Err: "unknown code"},
+		{Description: "Wrong nonce", Change: func(flow *Flow, state, code *string) { flow.Nonce = "replayed" }, Err: "the nonce of the ID token does not match"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			flow, state, code := login(t, provider, oidc)
+			tc.Change(&flow, &state, &code)
+			_, err := oidc.Finish(ctx, flow, state, code, repository.DefaultTenantSlug)
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+			assert.ErrorContains(t, err, tc.Err)
+		})
+	}
+
+	t.Run("Replayed code", func(t *testing.T) {
+		flow, state, code := login(t, provider, oidc)
+		_, err := oidc.Finish(ctx, flow, state, code, repository.DefaultTenantSlug)
+		require.NoError(t, err)
+		_, err = oidc.Finish(ctx, flow, state, code, repository.DefaultTenantSlug)
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("Flow cookie", func(t *testing.T) {
+		flow, _, _ := login(t, provider, oidc)
+		decoded, err := DecodeFlow(flow.Encode())
+		require.NoError(t, err)
+		assert.Equal(t, flow, decoded)
+		_, err = DecodeFlow("forged")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
+
+func TestOIDCTokens(t *testing.T) {
+	ctx := context.Background()
+	provider := authtest.NewProvider(t, "library", "a client secret")
+	accounts, _ := newAccounts(t)
+	oidc, err := NewOIDC(ctx, accounts, OIDCOptions{Issuer: provider.Issuer(), ClientID: "library"})
+	require.NoError(t, err)
+
+	// The tokens the provider issues to its other clients are refused
+	tokens := oidc.Tokens(nil, "", "")
+	_, err = tokens.Verify(ctx, provider.Token(map[string]any{"sub": "f3a1c2", "aud": "library"}))
+	assert.NoError(t, err)
+	_, err = tokens.Verify(ctx, provider.Token(map[string]any{"sub": "f3a1c2", "aud": "payroll"}))
+	assert.ErrorContains(t, err, "the token is not meant for library")
+	_, err = tokens.Verify(ctx, provider.Token(map[string]any{"sub": "f3a1c2"}))
+	assert.ErrorContains(t, err, "the token is not meant for library")
+
+	// Unless the settings name another audience
+	_, err = oidc.Tokens(nil, "", "catalogue").Verify(ctx, provider.Token(map[string]any{"sub": "f3a1c2", "aud": []string{"catalogue", "payroll"}}))
+	assert.NoError(t, err)
+}
+
+func TestOIDCTenant(t *testing.T) {
+	ctx := context.Background()
+	provider := authtest.NewProvider(t, "library", "a client secret")
+	accounts, _ := newAccounts(t)
+	oidc, err := NewOIDC(ctx, accounts, OIDCOptions{
+		Issuer:       provider.Issuer(),
+		ClientID:     "library",
+		ClientSecret: "a client secret",
+		RedirectURL:  "https://library.example.edu/auth/oidc/callback",
+		TenantClaim:  "tenant",
+	})
+	require.NoError(t, err)
+
+	// The users log in to the tenant their claim names, the default one without
+	provider.Claims = map[string]any{"sub": "f3a1c2", "tenant": "springfield"}
+	flow, state, code := login(t, provider, oidc)
+	_, err = oidc.Finish(ctx, flow, state, code, "springfield")
+	assert.NoError(t, err)
+	flow, state, code = login(t, provider, oidc)
+	_, err = oidc.Finish(ctx, flow, state, code, "shelbyville")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.ErrorContains(t, err, "the user belongs to the springfield tenant rather than shelbyville")
+
+	provider.Claims = map[string]any{"sub": "b0b"}
+	flow, state, code = login(t, provider, oidc)
+	_, err = oidc.Finish(ctx, flow, state, code, "springfield")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	flow, state, code = login(t, provider, oidc)
+	_, err = oidc.Finish(ctx, flow, state, code, repository.DefaultTenantSlug)
+	assert.NoError(t, err)
+}
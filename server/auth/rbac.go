@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Permission allows an action on the library.
+type Permission string
+
+// Permissions
+const (
+	// Public marks the routes anyone may use, without permission
+	Public            Permission = ""
+	PermBooksRead     Permission = "books:read"
+	PermBooksWrite    Permission = "books:write"
+	PermBooksDelete   Permission = "books:delete"
+	PermKeysManage    Permission = "keys:manage"
+	PermUsersManage   Permission = "users:manage"
+	PermServerInspect Permission = "server:inspect"
+	PermLimitsManage  Permission = "limits:manage"
+	// PermTenantsManage provisions the tenants, but only to the principals
+	// of no tenant in particular (see Principal.Operator)
+	PermTenantsManage Permission = "tenants:manage"
+)
+
+// Roles
+const (
+	// RolePatron reads the books
+	RolePatron = "patron"
+	// RoleLibrarian also creates and edits them
+	RoleLibrarian = "librarian"
+	// RoleAdmin also deletes them, manages the API keys, the users, the rate
+	// limits and the tenants and inspects the server
+	RoleAdmin = "admin"
+)
+
+// Roles lists the roles, from the least privileged.
+var Roles = []string{RolePatron, RoleLibrarian, RoleAdmin}
+
+// rolePermissions are the permissions of every role.
+var rolePermissions = map[string][]Permission{
+	RolePatron:    {PermBooksRead},
+	RoleLibrarian: {PermBooksRead, PermBooksWrite},
+	RoleAdmin:     {PermBooksRead, PermBooksWrite, PermBooksDelete, PermKeysManage, PermUsersManage, PermServerInspect, PermLimitsManage, PermTenantsManage},
+}
+
+// ValidRole reports whether a role exists.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// knownRoles returns the roles that exist among names, in order.
+func knownRoles(names []string) []string {
+	var roles []string
+	for _, role := range Roles {
+		if slices.Contains(names, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// RoleMapping maps the claims of the tokens of an identity provider to roles.
+type RoleMapping struct {
+	// Claim lists the groups or roles of the subject, DefaultRolesClaim if
+	// empty; see Claims.Strings for the nested claims
+	Claim string
+	// Roles maps the values of the claim to roles, besides the values naming
+	// a role
+	Roles map[string]string
+}
+
+// Map returns the roles of the claims, from the least privileged, or only
+// the patron role if they grant none.
+func (m RoleMapping) Map(claims Claims) []string {
+	claim := m.Claim
+	if claim == "" {
+		claim = DefaultRolesClaim
+	}
+	var names []string
+	for _, value := range claims.Strings(claim) {
+		if role, ok := m.Roles[value]; ok {
+			value = role
+		}
+		names = append(names, value)
+	}
+	roles := knownRoles(names)
+	if len(roles) == 0 {
+		return []string{RolePatron}
+	}
+	return roles
+}
+
+// ParseRoleMapping parses the "value=role" pairs mapping the values of a
+// claim to roles.
+func ParseRoleMapping(pairs []string) (map[string]string, error) {
+	roles := map[string]string{}
+	for _, pair := range pairs {
+		value, role, ok := strings.Cut(pair, "=")
+		value, role = strings.TrimSpace(value), strings.TrimSpace(role)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("expected value=role, got %q", pair)
+		}
+		if !ValidRole(role) {
+			return nil, fmt.Errorf("unknown role %q, expected one of %s", role, strings.Join(Roles, ", "))
+		}
+		roles[value] = role
+	}
+	return roles, nil
+}
+
+// Permissions returns the permissions of the principal, granted by any of
+// its roles, in a stable order.
+func (p Principal) Permissions() []Permission {
+	permissions := []Permission{}
+	for _, role := range p.Roles {
+		for _, permission := range rolePermissions[role] {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	slices.Sort(permissions)
+	return permissions
+}
+
+// Can reports whether the principal has a permission.
+func (p Principal) Can(permission Permission) bool {
+	return permission == Public || slices.Contains(p.Permissions(), permission)
+}
+
+// ForbiddenError tells why a principal may not do an action.
+type ForbiddenError struct {
+	Principal  Principal
+	Permission Permission
+}
+
+func (e *ForbiddenError) Error() string {
+	if !e.Principal.Authenticated() {
+		return fmt.Sprintf("authentication required: guests lack the %s permission", e.Permission)
+	}
+	return fmt.Sprintf("%s lacks the %s permission", e.Principal, e.Permission)
+}
+
+// Check returns a ForbiddenError unless the principal of the context has a
+// permission. The contexts without principal have none.
+func Check(ctx context.Context, permission Permission) error {
+	principal, _ := FromContext(ctx)
+	if !principal.Can(permission) {
+		return &ForbiddenError{Principal: principal, Permission: permission}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissions(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Roles       []string
+		Permissions []Permission
+	}{
+		{Description: "None"},
+		{Description: "Patron", Roles: []string{RolePatron}, Permissions: []Permission{PermBooksRead}},
+		{Description: "Librarian", Roles: []string{RoleLibrarian}, Permissions: []Permission{PermBooksRead, PermBooksWrite}},
+		{Description: "Admin", Roles: []string{RoleAdmin}, Permissions: []Permission{PermBooksDelete, PermBooksRead, PermBooksWrite, PermKeysManage, PermLimitsManage, PermServerInspect, PermTenantsManage, PermUsersManage}},
+		{Description: "Several", Roles: []string{RolePatron, RoleLibrarian, "unknown"}, Permissions: []Permission{PermBooksRead, PermBooksWrite}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			principal := Principal{Subject: "alice", Method: MethodJWT, Roles: tc.Roles}
+			assert.ElementsMatch(t, tc.Permissions, principal.Permissions())
+			assert.True(t, principal.Can(Public))
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	librarian := Principal{Subject: "3", Method: MethodAPIKey, Roles: []string{RoleLibrarian}}
+	ctx := WithPrincipal(context.Background(), librarian)
+	assert.NoError(t, Check(ctx, PermBooksWrite))
+	assert.EqualError(t, Check(ctx, PermBooksDelete), "api_key:3 lacks the books:delete permission")
+
+	guest := New(nil, Options{GuestRole: RolePatron}).Guest()
+	assert.False(t, guest.Authenticated())
+	ctx = WithPrincipal(context.Background(), guest)
+	assert.NoError(t, Check(ctx, PermBooksRead))
+	assert.EqualError(t, Check(ctx, PermBooksWrite), "authentication required: guests lack the books:write permission")
+
+	assert.Error(t, Check(context.Background(), PermBooksRead), "without principal")
+	assert.NoError(t, Check(WithPrincipal(context.Background(), Anonymous), PermKeysManage))
+}
+
+func TestRoleMapping(t *testing.T) {
+	roles, err := ParseRoleMapping([]string{"library-staff=librarian", " it-admins = admin "})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"library-staff": RoleLibrarian, "it-admins": RoleAdmin}, roles)
+	_, err = ParseRoleMapping([]string{"library-staff"})
+	assert.EqualError(t, err, `expected value=role, got "library-staff"`)
+	_, err = ParseRoleMapping([]string{"library-staff=staff"})
+	assert.EqualError(t, err, `unknown role "staff", expected one of patron, librarian, admin`)
+
+	mapping := RoleMapping{Claim: "realm_access.roles", Roles: roles}
+	testCases := []struct {
+		Description string
+		Claims      Claims
+		Roles       []string
+	}{
+		{Description: "Mapped", Claims: Claims{"realm_access": map[string]any{"roles": []any{"library-staff", "students"}}}, Roles: []string{RoleLibrarian}},
+		{Description: "Role names", Claims: Claims{"realm_access": map[string]any{"roles": []any{"admin", "library-staff"}}}, Roles: []string{RoleLibrarian, RoleAdmin}},
+		{Description: "Exact claim first", Claims: Claims{"realm_access.roles": []any{"it-admins"}}, Roles: []string{RoleAdmin}},
+		{Description: "Unknown values", Claims: Claims{"realm_access": map[string]any{"roles": []any{"students"}}}, Roles: []string{RolePatron}},
+		{Description: "No claim", Claims: Claims{"sub": "alice"}, Roles: []string{RolePatron}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert.Equal(t, tc.Roles, mapping.Map(tc.Claims))
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"library/models"
+	"library/repository"
+)
+
+// ErrOtherTenant is returned when the credentials of a request belong to
+// another tenant than the one it names.
+var ErrOtherTenant = errors.New("the credentials belong to another tenant")
+
+// ResolveTenant returns the tenant serving a request of a principal, that of
+// slug if the request names one, or else that of the claim of its bearer
+// token, of its API key or of its user, or the default tenant. The tokens
+// without the claim belong to the default tenant; an empty claim ignores
+// the claims, as when tenancy is disabled. It returns the tenant with the
+// slug it looked for and an error wrapping repository.ErrTenantNotFound for
+// an unknown tenant, and one wrapping ErrOtherTenant when the credentials
+// belong to another tenant.
+func ResolveTenant(ctx context.Context, tenants repository.TenantRepository, principal Principal, slug, claim string) (models.Tenant, error) {
+	var claimed string
+	if claim != "" && principal.Method == MethodJWT {
+		claimed = principal.Claims.String(claim)
+		if claimed == "" {
+			claimed = repository.DefaultTenantSlug
+		}
+	}
+	if slug == "" {
+		slug = claimed
+	}
+
+	var tenant models.Tenant
+	var err error
+	switch {
+	case slug != "":
+		tenant, err = tenants.FindBySlug(ctx, slug)
+	case principal.Tenant != 0:
+		tenant, err = tenants.Get(ctx, principal.Tenant)
+	default:
+		tenant, err = tenants.Get(ctx, repository.DefaultTenant)
+	}
+	if errors.Is(err, repository.ErrTenantNotFound) {
+		return models.Tenant{Slug: slug}, err
+	} else if err != nil {
+		return models.Tenant{}, err
+	}
+
+	if (claimed != "" && claimed != tenant.Slug) || (principal.Tenant != 0 && principal.Tenant != tenant.ID) {
+		return tenant, fmt.Errorf("%w than %s", ErrOtherTenant, tenant.Slug)
+	}
+	return tenant, nil
+}
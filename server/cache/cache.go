@@ -0,0 +1,77 @@
+// Package cache stores serialized values for a time, in process with LRU or
+// in an external cache behind the Cache interface, and counts the hits and
+// misses of its users.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache stores values by key until they expire. Its implementations are
+// safe for concurrent use; an external cache, such as Redis, implements it
+// to share the values between the instances of the server.
+type Cache interface {
+	// Get returns the value of a key, and false if it is missing or expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value of a key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes keys, missing or not.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Counts are the hits and misses of an operation.
+type Counts struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// Metrics counts the hits and misses of the cached operations by name.
+type Metrics struct {
+	mutex  sync.Mutex
+	counts map[string]*Counts
+}
+
+// NewMetrics returns metrics without hits or misses.
+func NewMetrics() *Metrics {
+	return &Metrics{counts: map[string]*Counts{}}
+}
+
+// Hit counts a value of the operation found in the cache.
+func (m *Metrics) Hit(operation string) {
+	m.count(operation, true)
+}
+
+// Miss counts a value of the operation missing from the cache.
+func (m *Metrics) Miss(operation string) {
+	m.count(operation, false)
+}
+
+func (m *Metrics) count(operation string, hit bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counts, ok := m.counts[operation]
+	if !ok {
+		counts = &Counts{}
+		m.counts[operation] = counts
+	}
+	if hit {
+		counts.Hits++
+	} else {
+		counts.Misses++
+	}
+	counts.HitRatio = float64(counts.Hits) / float64(counts.Hits+counts.Misses)
+}
+
+// Counts returns the hits and misses of every operation.
+func (m *Metrics) Counts() map[string]Counts {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counts := make(map[string]Counts, len(m.counts))
+	for operation, c := range m.counts {
+		counts[operation] = *c
+	}
+	return counts
+}
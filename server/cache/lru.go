@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process cache holding a bounded number of values, evicting
+// the least recently used one to store another.
+type LRU struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	// recent orders the entries from the most recently used
+	recent *list.List
+	now    func() time.Time
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU returns an empty cache of up to size values.
+func NewLRU(size int) *LRU {
+	return &LRU{size: size, entries: map[string]*list.Element{}, recent: list.New(), now: time.Now}
+}
+
+// Get returns the value of a key, and false if it is missing or expired.
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := element.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.remove(element)
+		return nil, false, nil
+	}
+	c.recent.MoveToFront(element)
+	return e.value, true, nil
+}
+
+// Set stores the value of a key for ttl, evicting the least recently used
+// value when the cache is full.
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expires := c.now().Add(ttl)
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.recent.MoveToFront(element)
+		return nil
+	}
+	if c.size <= 0 {
+		return nil
+	}
+	for c.recent.Len() >= c.size {
+		c.remove(c.recent.Back())
+	}
+	c.entries[key] = c.recent.PushFront(&entry{key: key, value: value, expires: expires})
+	return nil
+}
+
+// Delete removes keys, missing or not.
+func (c *LRU) Delete(ctx context.Context, keys ...string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of values held, expired or not.
+func (c *LRU) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.recent.Len()
+}
+
+func (c *LRU) remove(element *list.Element) {
+	c.recent.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(2)
+	c.now = func() time.Time { return now }
+	get := func(key string) string {
+		value, ok, err := c.Get(ctx, key)
+		require.NoError(t, err)
+		if !ok {
+			return ""
+		}
+		return string(value)
+	}
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, c.Set(ctx, "b", []byte("2"), time.Minute))
+	assert.Equal(t, "1", get("a"))
+
+	// b is the least recently used
+	require.NoError(t, c.Set(ctx, "c", []byte("3"), time.Minute))
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, "", get("b"))
+	assert.Equal(t, "1", get("a"))
+	assert.Equal(t, "3", get("c"))
+
+	// Setting a key again replaces its value and expiry
+	require.NoError(t, c.Set(ctx, "a", []byte("4"), 2*time.Minute))
+	assert.Equal(t, "4", get("a"))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, "", get("c"), "expired")
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, "4", get("a"))
+
+	require.NoError(t, c.Delete(ctx, "a", "missing"))
+	assert.Equal(t, "", get("a"))
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Hit("get")
+	m.Hit("get")
+	m.Hit("get")
+	m.Miss("get")
+	m.Miss("count")
+
+	assert.Equal(t, map[string]Counts{
+		"get":   {Hits: 3, Misses: 1, HitRatio: 0.75},
+		"count": {Misses: 1},
+	}, m.Counts())
+}
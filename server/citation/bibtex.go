@@ -0,0 +1,102 @@
+package citation
+
+import (
+	"fmt"
+	"io"
+	"library/models"
+	"strconv"
+	"strings"
+)
+
+var bibtexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"{", `\{`,
+	"}", `\}`,
+	"&", `\&`,
+	"%", `\%`,
+	"$", `\$`,
+	"#", `\#`,
+	"_", `\_`,
+)
+
+// WriteBibTeX writes books as BibTeX @book entries. Citation keys are made
+// unique within the output by appending a letter, as reference managers do:
+// a to z, then aa, ab and so on.
+func WriteBibTeX(w io.Writer, books []models.Book) error {
+	emitted := map[string]bool{}
+	suffixes := map[string]int{}
+	for index, book := range books {
+		if index > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+
+		names := ParseAuthors(book.Author)
+		year := 0
+		if !book.Published.IsZero() {
+			year = book.Published.Year()
+		}
+		entryKey := key(names, year)
+		// Another book may already have taken a suffixed key, such as an
+		// author whose name ends with a letter
+		for base := entryKey; emitted[entryKey]; {
+			suffixes[base]++
+			entryKey = base + suffix(suffixes[base])
+		}
+		emitted[entryKey] = true
+
+		if err := writeBibTeXEntry(w, entryKey, names, book); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// suffix returns the nth letter suffix of a citation key, counting from 1:
+// a to z, then aa to zz, then aaa and so on.
+func suffix(n int) string {
+	var letters []byte
+	for ; n > 0; n = (n - 1) / 26 {
+		letters = append([]byte{byte('a' + (n-1)%26)}, letters...)
+	}
+	return string(letters)
+}
+
+func writeBibTeXEntry(w io.Writer, entryKey string, names []Name, book models.Book) error {
+	authors := make([]string, 0, len(names))
+	for _, name := range names {
+		authors = append(authors, name.Inverted())
+	}
+
+	fields := [][2]string{
+		{"title", book.Title},
+		{"author", strings.Join(authors, " and ")},
+	}
+	if !book.Published.IsZero() {
+		fields = append(fields, [2]string{"year", strconv.Itoa(book.Published.Year())})
+		fields = append(fields, [2]string{"month", strings.ToLower(book.Published.Month().String()[:3])})
+	}
+	if book.Edition > 1 {
+		fields = append(fields, [2]string{"edition", Ordinal(book.Edition)})
+	}
+	fields = append(fields,
+		[2]string{"isbn", book.ISBN},
+		[2]string{"abstract", book.Description},
+		[2]string{"keywords", book.GenreName},
+	)
+
+	if _, err := fmt.Fprintf(w, "@book{%s", entryKey); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, ",\n  %s = {%s}", field[0], bibtexEscaper.Replace(field[1])); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n}\n")
+	return err
+}
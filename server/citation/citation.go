@@ -0,0 +1,111 @@
+// Package citation renders books as bibliographic references: BibTeX, RIS
+// and CSL-JSON for reference managers, and formatted APA, MLA and Chicago
+// citation strings for people.
+package citation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var authorSeparator = regexp.MustCompile(`\s*;\s*|\s+and\s+|\s*&\s*`)
+
+// Name is a personal name split into its family and given parts.
+type Name struct {
+	Family string
+	Given  string
+}
+
+// ParseAuthors splits an author string such as "F. Scott Fitzgerald",
+// "Fitzgerald, F. Scott" or "Terry Pratchett and Neil Gaiman" into names.
+func ParseAuthors(author string) []Name {
+	var names []Name
+	for _, part := range authorSeparator.Split(strings.TrimSpace(author), -1) {
+		if part == "" {
+			continue
+		}
+		names = append(names, parseName(part))
+	}
+	return names
+}
+
+func parseName(name string) Name {
+	if family, given, found := strings.Cut(name, ","); found {
+		return Name{Family: strings.TrimSpace(family), Given: strings.TrimSpace(given)}
+	}
+
+	parts := strings.Fields(name)
+	if len(parts) == 1 {
+		return Name{Family: parts[0]}
+	}
+	return Name{Family: parts[len(parts)-1], Given: strings.Join(parts[:len(parts)-1], " ")}
+}
+
+// Inverted returns the name as "Family, Given".
+func (n Name) Inverted() string {
+	if n.Given == "" {
+		return n.Family
+	}
+	return n.Family + ", " + n.Given
+}
+
+// Natural returns the name as "Given Family".
+func (n Name) Natural() string {
+	if n.Given == "" {
+		return n.Family
+	}
+	return n.Given + " " + n.Family
+}
+
+// Initials returns the given names as initials, e.g. "J. R. R." for "J.R.R."
+// and "M.-J." for "Mohamad-Jaafar".
+func (n Name) Initials() string {
+	var initials []string
+	for _, part := range strings.FieldsFunc(n.Given, func(r rune) bool { return r == ' ' || r == '.' }) {
+		var hyphenated []string
+		for _, segment := range strings.Split(part, "-") {
+			if segment != "" {
+				hyphenated = append(hyphenated, string([]rune(segment)[0])+".")
+			}
+		}
+		initials = append(initials, strings.Join(hyphenated, "-"))
+	}
+	return strings.Join(initials, " ")
+}
+
+// Ordinal returns the English ordinal of a positive number, e.g. "2nd".
+func Ordinal(number int) string {
+	suffix := "th"
+	switch {
+	case number%100 >= 11 && number%100 <= 13:
+	case number%10 == 1:
+		suffix = "st"
+	case number%10 == 2:
+		suffix = "nd"
+	case number%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", number, suffix)
+}
+
+// key builds a citation key from the first author's family name and the
+// publication year, e.g. "fitzgerald1925".
+func key(names []Name, year int) string {
+	family := "anonymous"
+	if len(names) > 0 {
+		family = names[0].Family
+	}
+
+	var builder strings.Builder
+	for _, r := range strings.ToLower(family) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			builder.WriteRune(r)
+		}
+	}
+	if year > 0 {
+		fmt.Fprintf(&builder, "%d", year)
+	}
+	return builder.String()
+}
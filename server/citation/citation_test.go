@@ -0,0 +1,180 @@
+package citation
+
+import (
+	"bytes"
+	"encoding/json"
+	"library/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func sampleBook() models.Book {
+	return models.Book{
+		Model:       gorm.Model{ID: 7},
+		Title:       "The Great Gatsby",
+		Author:      "F. Scott Fitzgerald",
+		Published:   time.Date(1925, 4, 10, 0, 0, 0, 0, time.UTC),
+		Edition:     2,
+		Description: "A classic novel depicting the glamour & excess of the Jazz Age.",
+		GenreName:   "Fiction",
+	}
+}
+
+func TestParseAuthors(t *testing.T) {
+	testCases := []struct {
+		Author   string
+		Expected []Name
+	}{
+		{Author: "F. Scott Fitzgerald", Expected: []Name{{Family: "Fitzgerald", Given: "F. Scott"}}},
+		{Author: "Fitzgerald, F. Scott", Expected: []Name{{Family: "Fitzgerald", Given: "F. Scott"}}},
+		{Author: "Homer", Expected: []Name{{Family: "Homer"}}},
+		{Author: "Terry Pratchett and Neil Gaiman", Expected: []Name{{Family: "Pratchett", Given: "Terry"}, {Family: "Gaiman", Given: "Neil"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Author, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, ParseAuthors(tc.Author))
+		})
+	}
+	assert.Equal(t, "J. R. R.", Name{Family: "Tolkien", Given: "J.R.R."}.Initials())
+	assert.Equal(t, "M.-J.", Name{Family: "Nehme", Given: "Mohamad-Jaafar"}.Initials())
+}
+
+func TestFormat(t *testing.T) {
+	book := sampleBook()
+	firstEdition := sampleBook()
+	firstEdition.Edition = 1
+	coAuthored := sampleBook()
+	coAuthored.Author = "Terry Pratchett and Neil Gaiman"
+	coAuthored.Title = "Good Omens"
+	coAuthored.Published = time.Date(1990, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		Description string
+		Book        models.Book
+		Style       Style
+		Expected    string
+	}{
+		{Description: "APA", Book: book, Style: APA, Expected: "Fitzgerald, F. S. (1925). The Great Gatsby (2nd ed.)."},
+		{Description: "MLA", Book: book, Style: MLA, Expected: "Fitzgerald, F. Scott. The Great Gatsby. 2nd ed., 1925."},
+		{Description: "Chicago", Book: book, Style: Chicago, Expected: "Fitzgerald, F. Scott. The Great Gatsby. 2nd ed. 1925."},
+		{Description: "APA First Edition", Book: firstEdition, Style: APA, Expected: "Fitzgerald, F. S. (1925). The Great Gatsby."},
+		{Description: "APA Two Authors", Book: coAuthored, Style: APA, Expected: "Pratchett, T., & Gaiman, N. (1990). Good Omens (2nd ed.)."},
+		{Description: "MLA Two Authors", Book: coAuthored, Style: MLA, Expected: "Pratchett, Terry, and Neil Gaiman. Good Omens. 2nd ed., 1990."},
+		{Description: "Chicago Two Authors", Book: coAuthored, Style: Chicago, Expected: "Pratchett, Terry, and Neil Gaiman. Good Omens. 2nd ed. 1990."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			citation, err := Format(tc.Book, tc.Style)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Expected, citation)
+		})
+	}
+
+	_, err := ParseStyle("harvard")
+	assert.ErrorIs(t, err, ErrUnknownStyle)
+}
+
+func TestWriteBibTeX(t *testing.T) {
+	book := sampleBook()
+
+	var buffer bytes.Buffer
+	err := WriteBibTeX(&buffer, []models.Book{book, book})
+	assert.NoError(t, err)
+
+	output := buffer.String()
+	assert.Contains(t, output, "@book{fitzgerald1925,\n  title = {The Great Gatsby}")
+	assert.Contains(t, output, "@book{fitzgerald1925a,")
+	assert.Contains(t, output, "author = {Fitzgerald, F. Scott}")
+	assert.Contains(t, output, "edition = {2nd}")
+	assert.Contains(t, output, `glamour \& excess`)
+
+	// Without a publication date, the key has no year
+	buffer.Reset()
+	book.Published = time.Time{}
+	err = WriteBibTeX(&buffer, []models.Book{book})
+	assert.NoError(t, err)
+	assert.Contains(t, buffer.String(), "@book{fitzgerald,")
+}
+
+func TestWriteBibTeXKeys(t *testing.T) {
+	smith := models.Book{Title: "Essays", Author: "Jane Smith", Published: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	// Without a publication date, the name alone makes a suffixed key
+	suffixed := models.Book{Title: "Letters", Author: "Jane Smith2020a"}
+
+	testCases := []struct {
+		Description string
+		Books       []models.Book
+		Keys        []string
+	}{
+		{Description: "Suffixed Key First", Books: []models.Book{smith, suffixed, smith, smith}, Keys: []string{"smith2020", "smith2020a", "smith2020b", "smith2020c"}},
+		{Description: "Suffixed Key Last", Books: []models.Book{smith, smith, suffixed}, Keys: []string{"smith2020", "smith2020a", "smith2020aa"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			var buffer bytes.Buffer
+			err := WriteBibTeX(&buffer, tc.Books)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Keys, bibTeXKeys(buffer.String()))
+		})
+	}
+
+	t.Run("Beyond z", func(t *testing.T) {
+		books := make([]models.Book, 30)
+		for index := range books {
+			books[index] = smith
+		}
+
+		var buffer bytes.Buffer
+		err := WriteBibTeX(&buffer, books)
+		assert.NoError(t, err)
+
+		keys := bibTeXKeys(buffer.String())
+		assert.Len(t, keys, 30)
+		assert.Equal(t, []string{"smith2020y", "smith2020z", "smith2020aa", "smith2020ab", "smith2020ac"}, keys[25:])
+	})
+}
+
+// bibTeXKeys returns the citation keys of the entries of a BibTeX output.
+func bibTeXKeys(output string) []string {
+	var keys []string
+	for _, line := range strings.Split(output, "\n") {
+		if entryKey, ok := strings.CutPrefix(line, "@book{"); ok {
+			keys = append(keys, strings.TrimSuffix(entryKey, ","))
+		}
+	}
+	return keys
+}
+
+func TestWriteRIS(t *testing.T) {
+	var buffer bytes.Buffer
+	err := WriteRIS(&buffer, []models.Book{sampleBook()})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\r\n")
+	assert.Equal(t, "TY  - BOOK", lines[0])
+	assert.Contains(t, lines, "AU  - Fitzgerald, F. Scott")
+	assert.Contains(t, lines, "PY  - 1925")
+	assert.Equal(t, "ER  -", strings.TrimSpace(lines[len(lines)-1]))
+}
+
+func TestCSL(t *testing.T) {
+	data, err := json.Marshal(CSL([]models.Book{sampleBook()}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{
+		"id": "7",
+		"type": "book",
+		"title": "The Great Gatsby",
+		"author": [{"family": "Fitzgerald", "given": "F. Scott"}],
+		"issued": {"date-parts": [[1925, 4, 10]]},
+		"edition": "2",
+		"abstract": "A classic novel depicting the glamour & excess of the Jazz Age.",
+		"genre": "Fiction"
+	}]`, string(data))
+}
@@ -0,0 +1,62 @@
+package citation
+
+import (
+	"library/models"
+	"strconv"
+)
+
+// CSLItem is a bibliographic item in the Citation Style Language JSON schema.
+type CSLItem struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Author   []CSLName `json:"author,omitempty"`
+	Issued   *CSLDate  `json:"issued,omitempty"`
+	Edition  string    `json:"edition,omitempty"`
+	ISBN     string    `json:"ISBN,omitempty"`
+	Abstract string    `json:"abstract,omitempty"`
+	Genre    string    `json:"genre,omitempty"`
+}
+
+// CSLName is a personal name in CSL-JSON.
+type CSLName struct {
+	Family string `json:"family"`
+	Given  string `json:"given,omitempty"`
+}
+
+// CSLDate is a date in CSL-JSON, expressed as date parts.
+type CSLDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+// CSL converts books to CSL-JSON items.
+func CSL(books []models.Book) []CSLItem {
+	items := make([]CSLItem, 0, len(books))
+	for _, book := range books {
+		items = append(items, NewCSLItem(book))
+	}
+	return items
+}
+
+// NewCSLItem converts a book to a CSL-JSON item.
+func NewCSLItem(book models.Book) CSLItem {
+	item := CSLItem{
+		ID:       strconv.FormatUint(uint64(book.ID), 10),
+		Type:     "book",
+		Title:    book.Title,
+		ISBN:     book.ISBN,
+		Abstract: book.Description,
+		Genre:    book.GenreName,
+	}
+	for _, name := range ParseAuthors(book.Author) {
+		item.Author = append(item.Author, CSLName{Family: name.Family, Given: name.Given})
+	}
+	if !book.Published.IsZero() {
+		published := book.Published.UTC()
+		item.Issued = &CSLDate{DateParts: [][]int{{published.Year(), int(published.Month()), published.Day()}}}
+	}
+	if book.Edition > 1 {
+		item.Edition = strconv.Itoa(book.Edition)
+	}
+	return item
+}
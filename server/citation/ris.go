@@ -0,0 +1,54 @@
+package citation
+
+import (
+	"fmt"
+	"io"
+	"library/models"
+	"strconv"
+)
+
+// WriteRIS writes books as RIS records of type BOOK.
+func WriteRIS(w io.Writer, books []models.Book) error {
+	for _, book := range books {
+		if err := writeRISRecord(w, book); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRISRecord(w io.Writer, book models.Book) error {
+	tags := [][2]string{{"TY", "BOOK"}}
+	if book.ID != 0 {
+		tags = append(tags, [2]string{"ID", strconv.FormatUint(uint64(book.ID), 10)})
+	}
+	tags = append(tags, [2]string{"TI", book.Title})
+	for _, name := range ParseAuthors(book.Author) {
+		tags = append(tags, [2]string{"AU", name.Inverted()})
+	}
+	if !book.Published.IsZero() {
+		tags = append(tags,
+			[2]string{"PY", strconv.Itoa(book.Published.Year())},
+			[2]string{"DA", book.Published.Format("2006/01/02")},
+		)
+	}
+	if book.Edition > 0 {
+		tags = append(tags, [2]string{"ET", Ordinal(book.Edition)})
+	}
+	tags = append(tags,
+		[2]string{"SN", book.ISBN},
+		[2]string{"AB", book.Description},
+		[2]string{"KW", book.GenreName},
+		[2]string{"ER", ""},
+	)
+
+	for _, tag := range tags {
+		if tag[1] == "" && tag[0] != "ER" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s  - %s\r\n", tag[0], tag[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
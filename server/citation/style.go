@@ -0,0 +1,158 @@
+package citation
+
+import (
+	"errors"
+	"library/models"
+	"strconv"
+	"strings"
+)
+
+// Style is a citation style used to format a reference for people.
+type Style string
+
+const (
+	APA     Style = "apa"
+	MLA     Style = "mla"
+	Chicago Style = "chicago"
+)
+
+// ErrUnknownStyle is returned for citation styles that are not supported.
+var ErrUnknownStyle = errors.New("unknown citation style")
+
+// ParseStyle returns the style with the given case-insensitive name.
+func ParseStyle(name string) (Style, error) {
+	switch style := Style(strings.ToLower(strings.TrimSpace(name))); style {
+	case APA, MLA, Chicago:
+		return style, nil
+	}
+	return "", ErrUnknownStyle
+}
+
+// Format renders a book as a citation string in the given style, based on its
+// title, author, publication date and edition.
+func Format(book models.Book, style Style) (string, error) {
+	names := ParseAuthors(book.Author)
+	switch style {
+	case APA:
+		return formatAPA(book, names), nil
+	case MLA:
+		return formatMLA(book, names), nil
+	case Chicago:
+		return formatChicago(book, names), nil
+	}
+	return "", ErrUnknownStyle
+}
+
+// formatAPA follows the APA 7th edition book reference:
+// Fitzgerald, F. S. (1925). The Great Gatsby (2nd ed.).
+func formatAPA(book models.Book, names []Name) string {
+	authors := make([]string, 0, len(names))
+	for _, name := range names {
+		if initials := name.Initials(); initials != "" {
+			authors = append(authors, name.Family+", "+initials)
+		} else {
+			authors = append(authors, name.Family)
+		}
+	}
+
+	var author string
+	switch len(authors) {
+	case 0:
+	case 1:
+		author = authors[0]
+	case 2:
+		author = authors[0] + ", & " + authors[1]
+	default:
+		author = strings.Join(authors[:len(authors)-1], ", ") + ", & " + authors[len(authors)-1]
+	}
+
+	year := "n.d."
+	if !book.Published.IsZero() {
+		year = strconv.Itoa(book.Published.Year())
+	}
+
+	title := book.Title
+	if book.Edition > 1 {
+		title += " (" + Ordinal(book.Edition) + " ed.)"
+	}
+
+	return join(sentence(author), sentence("("+year+")"), sentence(title))
+}
+
+// formatMLA follows the MLA 9th edition works-cited entry:
+// Fitzgerald, F. Scott. The Great Gatsby. 2nd ed., 1925.
+func formatMLA(book models.Book, names []Name) string {
+	var author string
+	switch len(names) {
+	case 0:
+	case 1:
+		author = names[0].Inverted()
+	case 2:
+		author = names[0].Inverted() + ", and " + names[1].Natural()
+	default:
+		author = names[0].Inverted() + ", et al"
+	}
+
+	var publication []string
+	if book.Edition > 1 {
+		publication = append(publication, Ordinal(book.Edition)+" ed.")
+	}
+	if !book.Published.IsZero() {
+		publication = append(publication, strconv.Itoa(book.Published.Year()))
+	}
+
+	return join(sentence(author), sentence(book.Title), sentence(strings.Join(publication, ", ")))
+}
+
+// formatChicago follows the Chicago Manual of Style bibliography entry:
+// Fitzgerald, F. Scott. The Great Gatsby. 2nd ed. 1925.
+func formatChicago(book models.Book, names []Name) string {
+	authors := make([]string, 0, len(names))
+	for index, name := range names {
+		if index == 0 {
+			authors = append(authors, name.Inverted())
+		} else {
+			authors = append(authors, name.Natural())
+		}
+	}
+
+	var author string
+	switch len(authors) {
+	case 0:
+	case 1:
+		author = authors[0]
+	case 2:
+		author = authors[0] + ", and " + authors[1]
+	default:
+		author = strings.Join(authors[:len(authors)-1], ", ") + ", and " + authors[len(authors)-1]
+	}
+
+	var edition, year string
+	if book.Edition > 1 {
+		edition = Ordinal(book.Edition) + " ed."
+	}
+	if !book.Published.IsZero() {
+		year = strconv.Itoa(book.Published.Year())
+	}
+
+	return join(sentence(author), sentence(book.Title), sentence(edition), sentence(year))
+}
+
+// sentence terminates a non-empty citation element with a period.
+func sentence(element string) string {
+	element = strings.TrimSpace(element)
+	if element == "" || strings.HasSuffix(element, ".") || strings.HasSuffix(element, "?") || strings.HasSuffix(element, "!") {
+		return element
+	}
+	return element + "."
+}
+
+func join(elements ...string) string {
+	var parts []string
+	for _, element := range elements {
+		if element != "" {
+			parts = append(parts, element)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"library/models"
+	"library/repository"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// orders names the orders of the listed books.
+var orders = map[string]repository.Order{
+	"id":        repository.OrderByID,
+	"newest":    repository.OrderByNewest,
+	"oldest":    repository.OrderByOldest,
+	"title":     repository.OrderByTitle,
+	"published": repository.OrderByPublished,
+}
+
+const booksDetails = `Commands:
+  get ID         print a book as JSON
+  list           list the books
+  search         list the books matching the given criteria
+  delete ID...   delete books
+Run "server books COMMAND -help" for the flags of a command.
+`
+
+// books runs the "books" command, dispatching to its subcommands.
+func (c *CLI) books(args []string) error {
+	flags := c.flags("books")
+	// The flags after the subcommand are its own
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return err
+	} else if err != nil {
+		return errUsage
+	}
+	if flags.NArg() == 0 {
+		return usageError(flags, "")
+	}
+
+	switch command, args := flags.Arg(0), flags.Args()[1:]; command {
+	case "get":
+		return c.getBook(args)
+	case "list":
+		return c.listBooks(args)
+	case "search":
+		return c.searchBooks(args)
+	case "delete":
+		return c.deleteBooks(args)
+	default:
+		return usageError(flags, "Unknown books command %q", command)
+	}
+}
+
+func (c *CLI) getBook(args []string) error {
+	flags := c.configFlags(c.flagSet("books get", "ID", "Print a book as JSON"))
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageError(flags, "Expected one book ID")
+	}
+	id, err := parseID(flags, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	store, closeStore, err := c.openRepository()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	book, err := store.Get(context.Background(), id)
+	if err != nil {
+		return fmt.Errorf("book %d: %w", id, err)
+	}
+	encoder := json.NewEncoder(c.Stdout)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(book)
+}
+
+// listFlags are the flags shared by "books list" and "books search".
+type listFlags struct {
+	limit  *int
+	offset *int
+	order  *string
+	json   *bool
+}
+
+func addListFlags(flags *flag.FlagSet) listFlags {
+	return listFlags{
+		limit:  flags.Int("limit", 20, "maximum number of books, 0 for all of them"),
+		offset: flags.Int("offset", 0, "number of books to skip"),
+		order:  flags.String("order", "id", "order of the books: id, newest, oldest, title or published"),
+		json:   flags.Bool("json", false, "print the books as JSON rather than a table"),
+	}
+}
+
+func (l listFlags) options(flags *flag.FlagSet) (repository.ListOptions, error) {
+	order, ok := orders[*l.order]
+	if !ok {
+		return repository.ListOptions{}, usageError(flags, "Unknown order %q", *l.order)
+	}
+	if *l.limit < 0 || *l.offset < 0 {
+		return repository.ListOptions{}, usageError(flags, "The limit and offset cannot be negative")
+	}
+	return repository.ListOptions{Order: order, Limit: *l.limit, Offset: *l.offset}, nil
+}
+
+func (c *CLI) listBooks(args []string) error {
+	flags := c.configFlags(c.flagSet("books list", "", "List the books"))
+	list := addListFlags(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "Unexpected arguments %q", flags.Args())
+	}
+	options, err := list.options(flags)
+	if err != nil {
+		return err
+	}
+
+	store, closeStore, err := c.openRepository()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	books, err := store.List(context.Background(), options)
+	if err != nil {
+		return err
+	}
+	return c.printBooks(books, *list.json)
+}
+
+func (c *CLI) searchBooks(args []string) error {
+	flags := c.configFlags(c.flagSet("books search", "", "List the books matching every given criterion"))
+	var filter repository.Filter
+	flags.StringVar(&filter.Query, "q", "", "substring of the title or the author")
+	flags.StringVar(&filter.Title, "title", "", "substring of the title")
+	flags.StringVar(&filter.Author, "author", "", "substring of the author")
+	flags.StringVar(&filter.Description, "description", "", "substring of the description")
+	flags.StringVar(&filter.Genre, "genre", "", "substring of the genre")
+	flags.StringVar(&filter.From, "from", "", "earliest publication date, as YYYY-MM-DD")
+	flags.StringVar(&filter.To, "to", "", "latest publication date, as YYYY-MM-DD")
+	list := addListFlags(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "Unexpected arguments %q", flags.Args())
+	}
+	if err := filter.Validate(); err != nil {
+		return usageError(flags, "%s", err)
+	}
+	options, err := list.options(flags)
+	if err != nil {
+		return err
+	}
+
+	store, closeStore, err := c.openRepository()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	books, err := store.Search(context.Background(), filter, options)
+	if err != nil {
+		return err
+	}
+	return c.printBooks(books, *list.json)
+}
+
+func (c *CLI) deleteBooks(args []string) error {
+	flags := c.configFlags(c.flagSet("books delete", "ID...", "Delete books"))
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return usageError(flags, "Expected at least one book ID")
+	}
+	ids := make([]uint, flags.NArg())
+	for index, arg := range flags.Args() {
+		id, err := parseID(flags, arg)
+		if err != nil {
+			return err
+		}
+		ids[index] = id
+	}
+
+	store, closeStore, err := c.openRepository()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	for _, id := range ids {
+		if err := store.Delete(context.Background(), id); err != nil {
+			return fmt.Errorf("book %d: %w", id, err)
+		}
+		fmt.Fprintln(c.Stdout, "Deleted book", id)
+	}
+	return nil
+}
+
+func parseID(flags *flag.FlagSet, arg string) (uint, error) {
+	id, err := strconv.ParseUint(arg, 10, 0)
+	if err != nil || id == 0 {
+		return 0, usageError(flags, "Invalid book ID %q", arg)
+	}
+	return uint(id), nil
+}
+
+func (c *CLI) printBooks(books []models.Book, asJSON bool) error {
+	if asJSON {
+		return writeJSON(c.Stdout, books)
+	}
+	return writeTable(c.Stdout, books)
+}
+
+func writeTable(w io.Writer, books []models.Book) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tTITLE\tAUTHOR\tPUBLISHED\tGENRE")
+	for _, book := range books {
+		published := ""
+		if !book.Published.IsZero() {
+			published = book.Published.UTC().Format(time.DateOnly)
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\n", book.ID, cell(book.Title), cell(book.Author), published, cell(book.GenreName))
+	}
+	return table.Flush()
+}
+
+// cell keeps a value on one line of a table.
+func cell(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,274 @@
+// Package cli implements the subcommands of the server binary: serving the
+// API, migrating and seeding the database, importing and exporting the
+// catalogue, managing books and printing the configuration.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"library/config"
+	"library/db"
+	"library/repository"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exit codes shared by every command
+const (
+	ExitOK       = 0
+	ExitError    = 1
+	ExitUsage    = 2
+	ExitNotFound = 3
+)
+
+const contextTimeout = 10
+
+// errUsage reports invalid arguments, after the usage was printed.
+var errUsage = errors.New("invalid usage")
+
+// command is a subcommand of the binary.
+type command struct {
+	name    string
+	args    string
+	summary string
+	// details describes the arguments in the help of the command
+	details string
+	// config adds the flags locating the configuration
+	config bool
+	run    func(c *CLI, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "serve", config: true, summary: "Start the REST and gRPC servers (the default command)", details: serveDetails, run: (*CLI).serve},
+		{name: "migrate", config: true, args: "up | down [n|all] | status | create NAME", summary: "Manage the database schema migrations", details: migrateDetails, run: (*CLI).migrate},
+		{name: "seed", config: true, args: "[FILE]", summary: "Add the sample books, or those of a JSON file, to an empty catalogue", run: (*CLI).seed},
+		{name: "import", config: true, args: "FILE", summary: "Add the books of a JSON or CSV file (- for standard input)", run: (*CLI).importBooks},
+		{name: "export", config: true, args: "", summary: "Write every book as JSON or CSV", run: (*CLI).exportBooks},
+		{name: "books", args: "get ID | list | search | delete ID...", summary: "Read and delete books directly in the database", details: booksDetails, run: (*CLI).books},
+		{name: "config", config: true, args: "print", summary: "Print the effective configuration, secrets redacted", run: (*CLI).config},
+		{name: "help", args: "[COMMAND]", summary: "Show the help of the binary or of a command", run: (*CLI).help},
+	}
+}
+
+// CLI runs commands with its standard streams.
+type CLI struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// configFile and settings are set by the configuration flags
+	configFile string
+	settings   settingFlags
+}
+
+// Run runs the command named by the arguments, serving when there is none,
+// and returns the exit code of the process.
+func Run(args []string) int {
+	c := &CLI{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	return c.Run(args)
+}
+
+// Run runs the command named by the arguments and returns its exit code.
+func (c *CLI) Run(args []string) int {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "-h" || name == "-help" || name == "--help" {
+		name = "help"
+	}
+
+	cmd, ok := lookup(name)
+	if !ok {
+		fmt.Fprintf(c.Stderr, "Unknown command %q\n\n", name)
+		c.usage()
+		return ExitUsage
+	}
+
+	err := cmd.run(c, args)
+	switch {
+	case err == nil || errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.Is(err, errUsage):
+		return ExitUsage
+	case errors.Is(err, repository.ErrNotFound):
+		fmt.Fprintln(c.Stderr, "Error:", err)
+		return ExitNotFound
+	default:
+		fmt.Fprintln(c.Stderr, "Error:", err)
+		return ExitError
+	}
+}
+
+func lookup(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func (c *CLI) usage() {
+	fmt.Fprint(c.Stderr, "Usage: server [COMMAND] [FLAGS] [ARGS]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(c.Stderr, "\nRun \"server help COMMAND\" for the flags of a command.\n\n"+
+		"Exit codes: %d success, %d failure, %d invalid usage, %d book not found.\n",
+		ExitOK, ExitError, ExitUsage, ExitNotFound)
+}
+
+func (c *CLI) help(args []string) error {
+	if len(args) == 0 {
+		c.usage()
+		return nil
+	}
+	cmd, ok := lookup(args[0])
+	if !ok || cmd.name == "help" {
+		c.usage()
+		return errUsage
+	}
+	return cmd.run(c, []string{"-help"})
+}
+
+// flags returns the flag set of a command, printing its usage on errors.
+func (c *CLI) flags(name string) *flag.FlagSet {
+	cmd, _ := lookup(name)
+	flags := c.flagSet(name, cmd.args, cmd.summary)
+	if cmd.config {
+		c.configFlags(flags)
+	}
+	if cmd.details != "" {
+		usage := flags.Usage
+		flags.Usage = func() {
+			usage()
+			fmt.Fprint(c.Stderr, "\n"+cmd.details)
+		}
+	}
+	return flags
+}
+
+// flagSet returns a flag set whose usage shows the arguments and summary.
+func (c *CLI) flagSet(name string, args string, summary string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.Stderr, "Usage: %s\n\n%s.\n", strings.TrimSpace("server "+name+" [FLAGS] "+args), summary)
+		hasFlags := false
+		flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprint(c.Stderr, "\nFlags:\n")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+// parse parses the flags of a command, before or after its arguments, mapping
+// their errors to errUsage. The arguments are left in flags.Args().
+func parse(flags *flag.FlagSet, args []string) error {
+	var arguments []string
+	for {
+		err := flags.Parse(args)
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			return errUsage
+		} else if err != nil {
+			return err
+		}
+
+		rest := flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			// Everything after "--" is an argument
+			arguments = append(arguments, rest...)
+			break
+		}
+		arguments = append(arguments, rest[0])
+		args = rest[1:]
+	}
+	return flags.Parse(append([]string{"--"}, arguments...))
+}
+
+// usageError prints a problem with the arguments and the usage of the command.
+func usageError(flags *flag.FlagSet, format string, args ...any) error {
+	if format != "" {
+		fmt.Fprintf(flags.Output(), format+"\n\n", args...)
+	}
+	flags.Usage()
+	return errUsage
+}
+
+// configFlags adds the flags locating the configuration to a flag set.
+func (c *CLI) configFlags(flags *flag.FlagSet) *flag.FlagSet {
+	c.settings = settingFlags{}
+	flags.StringVar(&c.configFile, "config", os.Getenv("CONFIG_FILE"), "configuration `file`, as YAML, TOML or env (default $CONFIG_FILE)")
+	flags.Var(c.settings, "set", "override a setting, as `key=value` (repeatable), e.g. server.port=8080")
+	return flags
+}
+
+// settingFlags collects the settings of the repeated -set flag.
+type settingFlags map[string]string
+
+func (s settingFlags) String() string {
+	return ""
+}
+
+func (s settingFlags) Set(value string) error {
+	key, value, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return errors.New("expected key=value")
+	}
+	s[key] = value
+	return nil
+}
+
+// sources locates the configuration: the defaults, the -config file, the
+// environment and the -set flags.
+func (c *CLI) sources() config.Sources {
+	return config.Sources{File: c.configFile, Flags: c.settings}
+}
+
+// loadConfig loads the configuration from its sources.
+func (c *CLI) loadConfig() (config.Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout*time.Second)
+	defer cancel()
+	cfg, err := config.Load(ctx, c.sources())
+	if err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// openRepository connects to the database of the configuration, migrating
+// it, and returns its books along with the function closing it.
+func (c *CLI) openRepository() (repository.BookRepository, func(), error) {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	database := db.New()
+	if err := database.Connect(&cfg.Database); err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to the database: %w", err)
+	}
+	return repository.NewGORM(database.DB), func() { _ = database.Close() }, nil
+}
+
+// oneOf checks that a flag value is among the allowed ones.
+func oneOf(flags *flag.FlagSet, name string, value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return usageError(flags, "Invalid -%s %q, expected %s", name, value, strings.Join(allowed, " or "))
+}
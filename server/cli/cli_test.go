@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"library/config"
+	"library/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run runs the CLI with the given standard input and returns its exit code
+// and outputs.
+func run(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &CLI{Stdin: strings.NewReader(stdin), Stdout: &stdout, Stderr: &stderr}
+	code := c.Run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+// useSQLite points the commands to a new SQLite database.
+func useSQLite(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("DB_DRIVER", config.DriverSQLite)
+	t.Setenv("SQLITE_PATH", filepath.Join(dir, "library.db"))
+	return dir
+}
+
+func TestUsage(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Args        []string
+		Code        int
+		Stderr      string
+	}{
+		{Description: "Help", Args: []string{"--help"}, Code: ExitOK, Stderr: "Commands:"},
+		{Description: "Help Command", Args: []string{"help", "seed"}, Code: ExitOK, Stderr: "Usage: server seed [FLAGS] [FILE]"},
+		{Description: "Command Help", Args: []string{"books", "search", "-help"}, Code: ExitOK, Stderr: "-author"},
+		{Description: "Unknown Command", Args: []string{"lend"}, Code: ExitUsage, Stderr: `Unknown command "lend"`},
+		{Description: "Unknown Flag", Args: []string{"export", "-pretty"}, Code: ExitUsage, Stderr: "flag provided but not defined"},
+		{Description: "Unknown Format", Args: []string{"export", "-format", "xml"}, Code: ExitUsage, Stderr: `Invalid -format "xml"`},
+		{Description: "Missing Argument", Args: []string{"books", "get"}, Code: ExitUsage, Stderr: "Expected one book ID"},
+		{Description: "Invalid ID", Args: []string{"books", "delete", "1", "two"}, Code: ExitUsage, Stderr: `Invalid book ID "two"`},
+		{Description: "Invalid Date", Args: []string{"books", "search", "-from", "1990"}, Code: ExitUsage, Stderr: "expected YYYY-MM-DD"},
+		{Description: "Unknown Migrate Command", Args: []string{"migrate", "sideways"}, Code: ExitUsage, Stderr: "Unknown migrate command"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			code, _, stderr := run("", tc.Args...)
+			assert.Equal(t, tc.Code, code)
+			assert.Contains(t, stderr, tc.Stderr)
+		})
+	}
+}
+
+func TestBooks(t *testing.T) {
+	useSQLite(t)
+
+	code, stdout, stderr := run("", "seed")
+	require.Equal(t, ExitOK, code, stderr)
+	assert.Contains(t, stdout, "Seeded 18 books")
+
+	code, stdout, _ = run("", "seed")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, "not seeding")
+
+	code, stdout, _ = run("", "books", "get", "3")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, `"title": "1984"`)
+
+	code, stdout, _ = run("", "books", "list", "-limit", "2")
+	assert.Equal(t, ExitOK, code)
+	assert.Len(t, strings.Split(strings.TrimSpace(stdout), "\n"), 3, "a header and 2 books")
+
+	code, stdout, _ = run("", "books", "search", "-author", "Orwell", "-json")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, "George Orwell")
+	assert.NotContains(t, stdout, "Jane Austen")
+
+	code, stdout, _ = run("", "books", "delete", "3")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "Deleted book 3\n", stdout)
+
+	code, _, stderr = run("", "books", "get", "3")
+	assert.Equal(t, ExitNotFound, code)
+	assert.Contains(t, stderr, "book 3: book not found")
+}
+
+func TestImportAndExport(t *testing.T) {
+	dir := useSQLite(t)
+
+	code, stdout, stderr := run(`[{"title": "Dune", "author": "Frank Herbert", "published": "1965-08-01T00:00:00Z", "edition": 1}]`, "import", "-")
+	require.Equal(t, ExitOK, code, stderr)
+	assert.Equal(t, "Imported 1 books\n", stdout)
+
+	csvFile := filepath.Join(dir, "books.csv")
+	code, _, stderr = run("", "export", "-format", "csv", "-output", csvFile)
+	require.Equal(t, ExitOK, code, stderr)
+
+	code, _, stderr = run("", "import", csvFile)
+	require.Equal(t, ExitOK, code, stderr)
+
+	code, stdout, _ = run("", "export")
+	assert.Equal(t, ExitOK, code)
+	books, err := readJSON(strings.NewReader(stdout))
+	require.NoError(t, err)
+	require.Len(t, books, 2)
+	assert.Equal(t, uint(2), books[1].ID)
+	assert.Equal(t, books[0].Title, books[1].Title)
+	assert.True(t, books[0].Published.Equal(books[1].Published))
+
+	// Invalid books are reported and none of them is imported
+	code, _, stderr = run("title,author,edition\nEmma,Jane Austen,1\nUntitled,,1\n", "import", "-format", "csv", "-")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "book 2 of - is invalid")
+
+	code, _, stderr = run("title,pages\nEmma,474\n", "import", "-format", "csv", "-")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, `unknown column "pages"`)
+
+	code, stdout, _ = run("", "books", "list")
+	assert.Equal(t, ExitOK, code)
+	assert.NotContains(t, stdout, "Emma")
+}
+
+func TestCSV(t *testing.T) {
+	books := []models.Book{{Title: "Dune, Messiah", Author: "Frank Herbert", Edition: 2, Description: "A \"sequel\""}}
+	books[0].ID = 7
+
+	var buffer bytes.Buffer
+	require.NoError(t, writeCSV(&buffer, books))
+	read, err := readCSV(&buffer)
+	require.NoError(t, err)
+	require.Len(t, read, 1)
+	assert.Equal(t, books[0].Title, read[0].Title)
+	assert.Equal(t, books[0].Description, read[0].Description)
+	assert.Equal(t, books[0].Edition, read[0].Edition)
+	assert.Zero(t, read[0].ID, "the id column is ignored")
+
+	_, err = readCSV(strings.NewReader("title,edition\nDune,first\n"))
+	assert.ErrorContains(t, err, `line 2: invalid edition "first"`)
+}
+
+func TestConfigPrint(t *testing.T) {
+	useSQLite(t)
+	t.Setenv("POSTGRES_PASSWORD", "hunter2")
+
+	code, stdout, _ := run("", "config", "print")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, `DB_DRIVER="sqlite"`)
+	assert.Contains(t, stdout, `POSTGRES_PASSWORD="`+config.RedactedValue+`"`)
+	assert.NotContains(t, stdout, "hunter2")
+
+	code, stdout, _ = run("", "config", "print", "-format", "json")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, `"Password": "`+config.RedactedValue+`"`)
+
+	// The flags override the file, which the environment overrides
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("server:\n  port: 8080\n  grpc_port: 8081\ndatabase:\n  driver: postgres\n"), 0o644))
+	code, stdout, _ = run("", "config", "print", "-config", file, "-set", "server.port=8082")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, `SERVER_PORT="8082"`)
+	assert.Contains(t, stdout, `GRPC_PORT="8081"`)
+	assert.Contains(t, stdout, `DB_DRIVER="sqlite"`)
+
+	code, _, stderr := run("", "config", "print", "-set", "server.port=0", "-set", "database.ssl_mode=maybe")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "server.port (SERVER_PORT): must be at least 1")
+	assert.Contains(t, stderr, "database.ssl_mode (POSTGRES_SSL_MODE): must be one of")
+
+	code, _, stderr = run("", "config", "print", "-set", "server.port")
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, "expected key=value")
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"library/config"
+	"strings"
+)
+
+// config runs the "config" command.
+func (c *CLI) config(args []string) error {
+	flags := c.flags("config")
+	format := flags.String("format", "env", "format of the configuration, env or json")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || flags.Arg(0) != "print" {
+		return usageError(flags, "")
+	}
+	if err := oneOf(flags, "format", *format, "env", "json"); err != nil {
+		return err
+	}
+
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	cfg = cfg.Redacted()
+
+	if *format == "json" {
+		encoder := json.NewEncoder(c.Stdout)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(cfg)
+	}
+	printEnv(c.Stdout, cfg)
+	return nil
+}
+
+// printEnv prints the settings as environment variables, as in config.env,
+// grouped by section.
+func printEnv(w io.Writer, cfg config.Config) {
+	section := ""
+	for _, setting := range config.Settings(&cfg) {
+		if prefix, _, _ := strings.Cut(setting.Key, "."); prefix != section {
+			if section != "" {
+				fmt.Fprintln(w)
+			}
+			section = prefix
+			fmt.Fprintf(w, "# %s\n", section)
+		}
+		fmt.Fprintf(w, "%s=%q\n", setting.Env, setting.Value())
+	}
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"library/db"
+	"library/migrations"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateDetails = `Commands:
+  up            apply the pending migrations
+  down [n]      roll back the last n migrations (default 1, "all" for every one)
+  status        list the migrations and whether they were applied
+  create NAME   write empty up and down migrations named NAME for every database
+`
+
+// migrate runs the "migrate" command.
+func (c *CLI) migrate(args []string) error {
+	flags := c.flags("migrate")
+	dir := flags.String("dir", "migrations", "directory of the migration sources, for create")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return usageError(flags, "")
+	}
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	if command == "create" {
+		if len(args) != 1 {
+			return usageError(flags, "Expected the name of the migration")
+		}
+		paths, err := migrations.Create(*dir, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to create the migration: %w", err)
+		}
+		for _, path := range paths {
+			fmt.Fprintln(c.Stdout, "Created", path)
+		}
+		return nil
+	}
+
+	steps := 1
+	switch {
+	case command == "down" && len(args) == 1 && args[0] == "all":
+		steps = -1
+	case command == "down" && len(args) == 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return usageError(flags, "Invalid number of migrations %q", args[0])
+		}
+		steps = n
+	case command != "up" && command != "down" && command != "status", len(args) > 0:
+		return usageError(flags, "Unknown migrate command %q", strings.Join(flags.Args(), " "))
+	}
+
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	database := db.New()
+	if err := database.Open(&cfg.Database); err != nil {
+		return fmt.Errorf("cannot connect to the database: %w", err)
+	}
+	defer database.Close()
+	migrator, err := migrations.New(database.DB)
+	if err != nil {
+		return err
+	}
+
+	// Migrations may take long: only bound the connection, not the work
+	ctx := context.Background()
+	var changed []migrations.Migration
+	switch command {
+	case "up":
+		changed, err = migrator.Up(ctx)
+	case "down":
+		changed, err = migrator.Down(ctx, steps)
+	case "status":
+		err = printStatus(ctx, migrator, c.Stdout)
+	}
+	for _, migration := range changed {
+		fmt.Fprintf(c.Stdout, "%s %s\n", command, migration)
+	}
+	if err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	if command != "status" && len(changed) == 0 {
+		fmt.Fprintln(c.Stdout, "Nothing to migrate")
+	}
+	return nil
+}
+
+func printStatus(ctx context.Context, migrator *migrations.Migrator, stdout io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", ""
+		if status.Applied {
+			state, appliedAt = "applied", status.AppliedAt.Format(time.RFC3339)
+		}
+		if status.Modified {
+			state = "modified"
+		}
+		if status.Unknown {
+			state = "unknown"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "Schema:", migrations.State(statuses))
+	return nil
+}
@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"library/api"
+	"library/auth"
+	"library/cache"
+	"library/config"
+	"library/db"
+	"library/health"
+	"library/ratelimit"
+	"library/repository"
+	"library/rpc"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"log/slog"
+)
+
+const serveDetails = `Signals:
+  On SIGTERM or SIGINT, /readyz fails for server.drain_period while the
+  requests are still served, then the servers wait up to
+  server.shutdown_timeout for the requests in flight. A second signal stops
+  at once. The exit code is 0 once stopped gracefully, 1 if a server failed
+  or the requests did not complete in time. SIGHUP reloads the configuration.
+`
+
+// serve runs the "serve" command, starting the gRPC server alongside the
+// API server until a server fails or SIGTERM or SIGINT asks them to stop.
+func (c *CLI) serve(args []string) error {
+	flags := c.flags("serve")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "Unexpected arguments %q", flags.Args())
+	}
+
+	// Load config
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+	slog.Info("loaded configuration successfully.", "Configuration", cfg)
+
+	roles, err := auth.ParseRoleMapping(cfg.Auth.RoleMap)
+	if err != nil {
+		return fmt.Errorf("auth.role_map (AUTH_ROLE_MAP): %w", err)
+	}
+	mapping := auth.RoleMapping{Claim: cfg.Auth.RolesClaim, Roles: roles}
+
+	// Initialize the database connection, retrying within its budget
+	db := db.New()
+	err = db.Connect(&cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	// Connect with the new password once its secret file changes; the
+	// changes of the other secret files are logged, as they need a restart
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	err = config.WatchSecrets(watchCtx, cfg, func(cfg config.Config) {
+		db.SetPassword(cfg.Database.Password)
+	})
+	if err != nil {
+		slog.Warn("Cannot watch the secret files, their changes need a restart.", "error", err)
+	}
+
+	// Report when the database connection is lost and restored
+	go db.Monitor(watchCtx, cfg.Database.PingInterval, cfg.Server.HealthTimeout)
+
+	// Apply the runtime settings again when the configuration file changes or on SIGHUP
+	live := config.NewLive(cfg)
+	live.OnChange(func(runtime config.RuntimeConfig) {
+		slog.SetLogLoggerLevel(runtime.Level())
+	})
+	if err := live.Watch(watchCtx, c.sources()); err != nil {
+		slog.Warn("Cannot watch the configuration file, reload it with SIGHUP.", "error", err)
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go func() {
+		for range hangup {
+			slog.Info("Reloading the configuration on SIGHUP.")
+			if _, err := live.Reload(watchCtx, c.sources()); err != nil {
+				slog.Error("Cannot reload the configuration.", "error", err)
+			}
+		}
+	}()
+
+	// Stop on SIGTERM, as sent by Kubernetes, or SIGINT
+	stopping, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// Read from the replicas, if any, and cache the books read by ID
+	var books repository.BookRepository = repository.NewReplicatedGORM(db.DB, db.Reader)
+	if cfg.Cache.Backend == config.CacheMemory {
+		books = repository.NewCached(books, cache.NewLRU(cfg.Cache.Size), cfg.Cache.TTL)
+	}
+	status := health.New(cfg.Server.HealthTimeout)
+	db.RegisterChecks(status)
+	failures := make(chan error, 2)
+
+	// Start the API server, authenticating the clients by their API key,
+	// bearer token or session
+	keys := repository.NewGORMKeys(db.DB)
+	accounts := auth.NewAccounts(repository.NewGORMUsers(db.DB), repository.NewGORMSessions(db.DB), auth.AccountOptions{
+		SessionTTL:       cfg.Auth.SessionTTL,
+		LockoutThreshold: cfg.Auth.LockoutThreshold,
+		LockoutDuration:  cfg.Auth.LockoutDuration,
+		ResetTTL:         cfg.Auth.ResetTTL,
+	})
+	oidc, err := provider(stopping, cfg.Auth, cfg.Tenancy, accounts, mapping)
+	if err != nil {
+		return errors.Join(err, shutdown(cfg.Server.ShutdownTimeout, &db))
+	}
+	tokens, err := verifier(cfg.Auth, oidc)
+	if err != nil {
+		return errors.Join(err, shutdown(cfg.Server.ShutdownTimeout, &db))
+	}
+	authenticate := authenticator(cfg.Auth, keys, accounts, tokens, mapping)
+	limiter := ratelimit.New()
+	tenants := repository.NewGORMTenants(db.DB)
+	router := api.SetupRouter(books, api.Options{
+		Live:           live,
+		Health:         status,
+		Keys:           keys,
+		Accounts:       accounts,
+		OIDC:           oidc,
+		Tenants:        tenants,
+		Tenancy:        cfg.Tenancy,
+		OAI:            cfg.OAI,
+		TrustedProxies: cfg.Server.TrustedProxies,
+		Limiter:        limiter,
+		Auth:           authenticate,
+	})
+	go func() {
+		if err := api.StartServer(stopping, cfg.Server.Port, router); err != nil {
+			failures <- fmt.Errorf("API server: %w", err)
+		}
+	}()
+
+	// Start the gRPC server alongside the API server, sharing its
+	// repositories, credentials and rate limits
+	server := rpc.NewServer(books, rpc.Options{
+		Live:    live,
+		Limiter: limiter,
+		Tenants: tenants,
+		Tenancy: cfg.Tenancy,
+		Auth:    authenticate,
+	})
+	go func() {
+		if err := rpc.StartServer(stopping, cfg.Server.GRPCPort, server); err != nil {
+			failures <- fmt.Errorf("gRPC server: %w", err)
+		}
+	}()
+
+	var failure error
+	select {
+	case <-stopping.Done():
+		// Fail the readiness check while still serving, until the load
+		// balancers stop routing requests here. A second signal stops at once.
+		stop()
+		slog.Info("Draining the server before stopping.", "period", cfg.Server.DrainPeriod)
+		status.Drain()
+		select {
+		case <-time.After(cfg.Server.DrainPeriod):
+		case failure = <-failures:
+		}
+	case failure = <-failures:
+	}
+	if failure != nil {
+		slog.Error("Stopping the server after a failure.", "error", failure)
+	}
+
+	return errors.Join(failure, shutdown(cfg.Server.ShutdownTimeout, &db))
+}
+
+// provider returns the OpenID provider of the settings the users log in
+// with, or nil if there is none. With tenancy, it only logs the users in to
+// the tenant their tenant claim names.
+func provider(ctx context.Context, cfg config.AuthConfig, tenancy config.TenancyConfig, accounts *auth.Accounts, roles auth.RoleMapping) (*auth.OIDC, error) {
+	if cfg.OIDCIssuer == "" {
+		return nil, nil
+	}
+	if cfg.JWKSFile != "" {
+		return nil, errors.New("auth.jwks_file (AUTH_JWKS_FILE): cannot be set with auth.oidc_issuer (AUTH_OIDC_ISSUER), whose keys are discovered")
+	}
+	var tenantClaim string
+	if tenancy.Enabled {
+		tenantClaim = tenancy.Claim
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	oidc, err := auth.NewOIDC(ctx, accounts, auth.OIDCOptions{
+		Issuer:       cfg.OIDCIssuer,
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		RedirectURL:  cfg.OIDCRedirectURL,
+		Scopes:       cfg.OIDCScopes,
+		Roles:        roles,
+		TenantClaim:  tenantClaim,
+		KeysTTL:      cfg.OIDCKeysTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("auth.oidc_issuer (AUTH_OIDC_ISSUER): %w", err)
+	}
+	slog.Info("Logging the users in with an OpenID provider.", "issuer", oidc.Issuer())
+	return oidc, nil
+}
+
+// verifier returns the verifier of the bearer tokens of the settings and
+// OpenID provider, or nil if they accept none. The tokens of the provider
+// must be issued by it to the client of the server, unless the settings name
+// another issuer or audience.
+func verifier(cfg config.AuthConfig, oidc *auth.OIDC) (*auth.Verifier, error) {
+	if oidc != nil {
+		return oidc.Tokens([]byte(cfg.JWTSecret), cfg.JWTIssuer, cfg.JWTAudience), nil
+	}
+	if cfg.JWTSecret == "" && cfg.JWKSFile == "" {
+		return nil, nil
+	}
+	var keys auth.KeySource
+	if cfg.JWKSFile != "" {
+		set, err := auth.LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth.jwks_file (AUTH_JWKS_FILE): %w", err)
+		}
+		keys = set
+	}
+	return auth.NewVerifier([]byte(cfg.JWTSecret), keys, cfg.JWTIssuer, cfg.JWTAudience), nil
+}
+
+// authenticator returns the authenticator of the settings, or nil if
+// authentication is disabled.
+func authenticator(cfg config.AuthConfig, keys repository.KeyRepository, accounts *auth.Accounts, tokens *auth.Verifier, roles auth.RoleMapping) *auth.Authenticator {
+	if !cfg.Enabled {
+		slog.Warn("Authentication is disabled: anyone may change the books and administer the server.")
+		return nil
+	}
+	if cfg.AdminKey == "" && tokens == nil {
+		slog.Info("Neither an admin key nor bearer tokens are configured: only the API keys and the users of the database authenticate.")
+	}
+	return auth.New(keys, auth.Options{Tokens: tokens, AdminKey: cfg.AdminKey, Accounts: accounts, GuestRole: cfg.GuestRole, Roles: roles})
+}
+
+// shutdown stops the servers, waiting up to timeout for the requests in
+// flight, then closes the database connections.
+func shutdown(timeout time.Duration, database *db.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := api.ShutdownServer(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := rpc.ShutdownServer(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := database.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close the database: %w", err))
+	}
+	if len(errs) == 0 {
+		slog.Info("Stopped the server.")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"library/models"
+	"library/repository"
+	"library/tools"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Formats of the imported and exported files
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// sampleBooks is the default file of the "seed" command, under the root directory.
+const sampleBooks = "json/book_list_sample.json"
+
+// exportBatchSize is the number of books read at once when exporting.
+const exportBatchSize = 100
+
+// csvHeader lists the CSV columns, named after the JSON fields of a book.
+var csvHeader = []string{"id", "title", "author", "published", "edition", "description", "genre_name", "isbn"}
+
+var validate = validator.New()
+
+// seed runs the "seed" command.
+func (c *CLI) seed(args []string) error {
+	flags := c.flags("seed")
+	force := flags.Bool("force", false, "add the books even when the catalogue is not empty")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return usageError(flags, "Expected at most one file")
+	}
+	path := flags.Arg(0)
+	if path == "" {
+		root, err := tools.SearchRootDirectory()
+		if err != nil {
+			root = "."
+		}
+		path = filepath.Join(root, sampleBooks)
+	}
+
+	books, err := readBooksFile(c.Stdin, path, formatJSON)
+	if err != nil {
+		return err
+	}
+
+	store, closeStore, err := c.openRepository()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	ctx := context.Background()
+	count, err := store.Count(ctx, repository.Filter{})
+	if err != nil {
+		return err
+	}
+	if count > 0 && !*force {
+		fmt.Fprintf(c.Stdout, "The catalogue already has %d books, not seeding (use -force to seed anyway)\n", count)
+		return nil
+	}
+	if err := store.Create(ctx, books...); err != nil {
+		return fmt.Errorf("failed to seed the books: %w", err)
+	}
+	fmt.Fprintf(c.Stdout, "Seeded %d books from %s\n", len(books), path)
+	return nil
+}
+
+// importBooks runs the "import" command.
+func (c *CLI) importBooks(args []string) error {
+	flags := c.flags("import")
+	format := flags.String("format", "", "format of the file, json or csv (default from the file extension, else json)")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageError(flags, "Expected one file")
+	}
+	if *format != "" {
+		if err := oneOf(flags, "format", *format, formatJSON, formatCSV); err != nil {
+			return err
+		}
+	}
+
+	books, err := readBooksFile(c.Stdin, flags.Arg(0), *format)
+	if err != nil {
+		return err
+	}
+
+	store, closeStore, err := c.openRepository()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	// Import all the books or none of them
+	if err := store.Create(context.Background(), books...); err != nil {
+		return fmt.Errorf("failed to import the books: %w", err)
+	}
+	fmt.Fprintf(c.Stdout, "Imported %d books\n", len(books))
+	return nil
+}
+
+// exportBooks runs the "export" command.
+func (c *CLI) exportBooks(args []string) error {
+	flags := c.flags("export")
+	format := flags.String("format", formatJSON, "format of the books, json or csv")
+	output := flags.String("output", "-", "file to write, - for the standard output")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "Unexpected arguments %q", flags.Args())
+	}
+	if err := oneOf(flags, "format", *format, formatJSON, formatCSV); err != nil {
+		return err
+	}
+
+	store, closeStore, err := c.openRepository()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	ctx := context.Background()
+	books := []models.Book{}
+	for offset := 0; ; offset += exportBatchSize {
+		batch, err := store.List(ctx, repository.ListOptions{Order: repository.OrderByID, Limit: exportBatchSize, Offset: offset})
+		if err != nil {
+			return err
+		}
+		books = append(books, batch...)
+		if len(batch) < exportBatchSize {
+			break
+		}
+	}
+
+	w := c.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if *format == formatCSV {
+		err = writeCSV(w, books)
+	} else {
+		err = writeJSON(w, books)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export the books: %w", err)
+	}
+	if *output != "-" {
+		fmt.Fprintf(c.Stderr, "Exported %d books to %s\n", len(books), *output)
+	}
+	return nil
+}
+
+// readBooksFile reads and validates the books of a file, or of stdin when the
+// path is "-". The format defaults to the extension of the file.
+func readBooksFile(stdin io.Reader, path string, format string) ([]*models.Book, error) {
+	if format == "" {
+		format = formatJSON
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = formatCSV
+		}
+	}
+
+	r := stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var books []*models.Book
+	var err error
+	if format == formatCSV {
+		books, err = readCSV(r)
+	} else {
+		books, err = readJSON(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s file %s: %w", format, path, err)
+	}
+	if len(books) == 0 {
+		return nil, fmt.Errorf("no books found in %s", path)
+	}
+
+	for index, book := range books {
+		// Imported books are new: the database assigns their IDs
+		book.Model = gorm.Model{}
+		if err := validate.Struct(book); err != nil {
+			return nil, fmt.Errorf("book %d of %s is invalid: %w", index+1, path, err)
+		}
+	}
+	return books, nil
+}
+
+func readJSON(r io.Reader) ([]*models.Book, error) {
+	var books []*models.Book
+	err := json.NewDecoder(r).Decode(&books)
+	return books, err
+}
+
+func writeJSON(w io.Writer, books []models.Book) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(books)
+}
+
+// readCSV reads books from CSV whose header names the columns, in any order,
+// among csvHeader. The id column is ignored.
+func readCSV(r io.Reader) ([]*models.Book, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, column := range header {
+		if !slices.Contains(csvHeader, column) {
+			return nil, fmt.Errorf("unknown column %q, expected some of %s", column, strings.Join(csvHeader, ","))
+		}
+	}
+
+	var books []*models.Book
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return books, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		book := &models.Book{}
+		for index, value := range record {
+			if err := setCSVField(book, header[index], value); err != nil {
+				line, _ := reader.FieldPos(index)
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		books = append(books, book)
+	}
+}
+
+func setCSVField(book *models.Book, column string, value string) error {
+	var err error
+	switch column {
+	case "title":
+		book.Title = value
+	case "author":
+		book.Author = value
+	case "published":
+		if value != "" {
+			book.Published, err = parseDate(value)
+		}
+	case "edition":
+		if value != "" {
+			book.Edition, err = strconv.Atoi(value)
+		}
+	case "description":
+		book.Description = value
+	case "genre_name":
+		book.GenreName = value
+	case "isbn":
+		book.ISBN = value
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", column, value)
+	}
+	return nil
+}
+
+// parseDate parses a publication date as YYYY-MM-DD or RFC 3339.
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func writeCSV(w io.Writer, books []models.Book) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, book := range books {
+		published := ""
+		if !book.Published.IsZero() {
+			published = book.Published.UTC().Format(time.DateOnly)
+		}
+		record := []string{
+			strconv.FormatUint(uint64(book.ID), 10),
+			book.Title,
+			book.Author,
+			published,
+			strconv.Itoa(book.Edition),
+			book.Description,
+			book.GenreName,
+			book.ISBN,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
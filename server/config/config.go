@@ -2,160 +2,340 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"library/tools"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
-	"log"
-
+	"github.com/go-playground/validator/v10"
 	"github.com/spf13/viper"
-
-	"github.com/caarlos0/env"
 )
 
-var (
-	configFileName      = "config"
-	configFileExtension = "env"
-)
+// Sources locates the layers of a configuration. Each layer overrides the
+// settings of the previous ones: the defaults, then the file, then the
+// environment, then the flags.
+type Sources struct {
+	// File is an optional YAML (.yaml, .yml), TOML (.toml) or env (any other
+	// extension, as config.env) file. Its keys are those of the settings,
+	// nested in sections or not, or their environment variables.
+	File string
+	// Environ lists the environment as KEY=value strings, os.Environ() if nil.
+	Environ []string
+	// Flags sets settings by key or environment variable, as given on the
+	// command line.
+	Flags map[string]string
+}
 
-func Load(ctx context.Context) (Config, error) {
-	err := addEnvirnomentVariables()
-	if err != nil {
-		return Config{}, err
-	}
-	return parseEnvironmentVariables(ctx)
+// Setting describes a configuration setting.
+type Setting struct {
+	// Key names the setting in files and flags, as "database.port".
+	Key string
+	// Env is the environment variable of the setting, as "POSTGRES_PORT".
+	Env string
+	// Secret is set for the settings that are redacted when shown.
+	Secret bool
+
+	field string
+	value reflect.Value
 }
 
-func parseEnvironmentVariables(ctx context.Context) (Config, error) {
-	var dbConfig DatabaseConfig
-	var serverConfig ServerConfig
+// Settings lists the settings of a configuration, in the order of its fields.
+func Settings(cfg *Config) []Setting {
+	return settings(reflect.ValueOf(cfg).Elem(), "")
+}
 
-	if err := env.Parse(&dbConfig); err != nil {
-		log.Fatal("Error parsing database config:", err)
+func settings(v reflect.Value, prefix string) []Setting {
+	var list []Setting
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("config")
+		if key == "" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			list = append(list, settings(v.Field(i), prefix+key+".")...)
+			continue
+		}
+		list = append(list, Setting{
+			Key:    prefix + key,
+			Env:    field.Tag.Get("env"),
+			Secret: field.Tag.Get("secret") == "true",
+			field:  field.Name,
+			value:  v.Field(i),
+		})
 	}
+	return list
+}
 
-	if err := env.Parse(&serverConfig); err != nil {
-		log.Fatal("Error parsing server config:", err)
+// Value returns the value of the setting, as it would be written in a file.
+func (s Setting) Value() string {
+	if list, ok := s.value.Interface().([]string); ok {
+		return strings.Join(list, ",")
 	}
-
-	return Config{Database: dbConfig, Server: serverConfig}, nil
+	return fmt.Sprint(s.value.Interface())
 }
 
-func addEnvirnomentVariables() error {
-	config, err := loadConfigFile()
-	if err != nil {
-		return fmt.Errorf("cannot load config file: %s", err)
-	}
-	err = addEnvirnomentVariablesFromFile(config)
-	if err != nil {
-		return fmt.Errorf("cannot add environment variables: %s", err)
+// set parses a value into the setting.
+func (s Setting) set(value string) error {
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(value)
+	case int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		s.value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		s.value.SetBool(b)
+	case []string:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		s.value.Set(reflect.ValueOf(list))
+	case time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		s.value.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported type %s", s.value.Type())
 	}
-
 	return nil
 }
 
-func loadConfigFile() (config Config, err error) {
-	configFilePath, err := tools.SearchRootDirectory()
-	if err != nil {
-		log.Fatal("cannot find root directory:", err)
-	}
-	viper.AddConfigPath(configFilePath + "/../")
-	viper.AddConfigPath(configFilePath)
-	viper.SetConfigName(configFileName)
-	viper.SetConfigType(configFileExtension)
-
-	viper.AutomaticEnv()
+// layerValue is the value of a setting and where it comes from.
+type layerValue struct {
+	value  string
+	source string
+}
 
-	err = viper.ReadInConfig()
-	if err != nil {
-		return
+// Load builds the configuration from its sources and validates it. Every
+// invalid setting is reported in the returned error, joined.
+func Load(ctx context.Context, sources Sources) (Config, error) {
+	cfg := Default()
+	list := Settings(&cfg)
+	byName := map[string]Setting{}
+	for _, setting := range list {
+		byName[strings.ToLower(setting.Key)] = setting
+		byName[strings.ToLower(setting.Env)] = setting
 	}
 
-	var databaseConfig DatabaseConfig
-	var serverConfig ServerConfig
+	var errs []error
+	values := map[string]layerValue{}
+	if sources.File != "" {
+		file, err := readFile(sources.File)
+		if err != nil {
+			return cfg, fmt.Errorf("cannot read config file %s: %w", sources.File, err)
+		}
+		for _, name := range sortedKeys(file) {
+			setting, ok := byName[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("unknown setting %q in %s", name, sources.File))
+				continue
+			}
+			values[setting.Key] = layerValue{file[name], sources.File}
+		}
+	}
 
-	var POSTGRES_HOST string
-	err = viper.UnmarshalKey("POSTGRES_HOST", &POSTGRES_HOST)
-	if err != nil {
-		return Config{}, err
+	environ := sources.Environ
+	if environ == nil {
+		environ = os.Environ()
 	}
-	var POSTGRES_PORT int
-	err = viper.UnmarshalKey("POSTGRES_PORT", &POSTGRES_PORT)
-	if err != nil {
-		return Config{}, err
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		for _, setting := range list {
+			if setting.Env == name {
+				values[setting.Key] = layerValue{value, "environment variable " + name}
+			}
+		}
 	}
-	var POSTGRES_USERNAME string
-	err = viper.UnmarshalKey("POSTGRES_USERNAME", &POSTGRES_USERNAME)
-	if err != nil {
-		return Config{}, err
+
+	for _, name := range sortedKeys(sources.Flags) {
+		setting, ok := byName[strings.ToLower(name)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %q in the flags", name))
+			continue
+		}
+		values[setting.Key] = layerValue{sources.Flags[name], "the flags"}
 	}
-	var POSTGRES_PASSWORD string
-	err = viper.UnmarshalKey("POSTGRES_PASSWORD", &POSTGRES_PASSWORD)
-	if err != nil {
-		return Config{}, err
+
+	for _, setting := range list {
+		if value, ok := values[setting.Key]; ok {
+			if err := setting.set(value.value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w, from %s", setting.Key, err, value.source))
+			}
+		}
 	}
-	var POSTGRES_NAME string
-	err = viper.UnmarshalKey("POSTGRES_NAME", &POSTGRES_NAME)
-	if err != nil {
-		return Config{}, err
+	errs = append(errs, readSecrets(&cfg)...)
+	errs = append(errs, cfg.validate(list)...)
+	return cfg, errors.Join(errs...)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-	var POSTGRES_SSL_MODE string
-	err = viper.UnmarshalKey("POSTGRES_SSL_MODE", &POSTGRES_SSL_MODE)
-	if err != nil {
-		return Config{}, err
+	sort.Strings(keys)
+	return keys
+}
+
+// readFile reads the settings of a configuration file by lowercase name.
+func readFile(path string) (map[string]string, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		v.SetConfigType("yaml")
+	case ".toml":
+		v.SetConfigType("toml")
+	default:
+		v.SetConfigType("env")
 	}
-	var SERVER_HOST string
-	err = viper.UnmarshalKey("SERVER_HOST", &SERVER_HOST)
-	if err != nil {
-		return Config{}, err
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
 	}
-	var SERVER_PORT int
-	err = viper.UnmarshalKey("SERVER_PORT", &SERVER_PORT)
-	if err != nil {
-		return Config{}, err
+
+	values := map[string]string{}
+	for _, key := range v.AllKeys() {
+		switch value := v.Get(key).(type) {
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
 	}
+	return values, nil
+}
 
-	databaseConfig = DatabaseConfig{POSTGRES_HOST, POSTGRES_PORT, POSTGRES_USERNAME, POSTGRES_PASSWORD, POSTGRES_NAME, POSTGRES_SSL_MODE}
-	serverConfig = ServerConfig{SERVER_HOST, SERVER_PORT}
+var validate = newValidator()
 
-	return Config{databaseConfig, serverConfig}, nil
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("config")
+	})
+	v.RegisterValidation("ratelimit", func(field validator.FieldLevel) bool {
+		_, _, _, err := parseRateLimit(field.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("quota", func(field validator.FieldLevel) bool {
+		_, _, err := parseQuota(field.Field().String())
+		return err == nil
+	})
+	return v
 }
 
-func addEnvirnomentVariablesFromFile(config Config) error {
-	// Set the environment variables for the test
-	err := os.Setenv("POSTGRES_HOST", config.Database.Host)
-	if err != nil {
-		return err
-	}
-	err = os.Setenv("POSTGRES_PORT", strconv.Itoa(config.Database.Port))
-	if err != nil {
-		return err
-	}
-	err = os.Setenv("POSTGRES_NAME", config.Database.Name)
-	if err != nil {
-		return err
-	}
-	err = os.Setenv("POSTGRES_USERNAME", config.Database.Username)
-	if err != nil {
-		return err
-	}
-	err = os.Setenv("POSTGRES_PASSWORD", config.Database.Password)
-	if err != nil {
-		return err
+// Validate checks every setting of the configuration, reporting all the
+// invalid ones.
+func (c Config) Validate() error {
+	return errors.Join(c.validate(Settings(&c))...)
+}
+
+func (c Config) validate(list []Setting) []error {
+	return validationErrors(validate.Struct(c), "", list)
+}
+
+// Validate checks every runtime setting, reporting all the invalid ones.
+func (r RuntimeConfig) Validate() error {
+	cfg := Config{Runtime: r}
+	return errors.Join(validationErrors(validate.Struct(r), "runtime.", Settings(&cfg))...)
+}
+
+// validationErrors describes the errors of a validated struct, whose
+// settings are named with the prefix.
+func validationErrors(err error, prefix string, list []Setting) []error {
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		if err != nil {
+			return []error{err}
+		}
+		return nil
 	}
-	err = os.Setenv("POSTGRES_SSL_MODE", config.Database.SSLMode)
-	if err != nil {
-		return err
+
+	settings := map[string]Setting{}
+	for _, setting := range list {
+		settings[setting.Key] = setting
 	}
-	err = os.Setenv("SERVER_HOST", config.Server.Host)
-	if err != nil {
-		return err
+	errs := make([]error, len(fieldErrors))
+	for i, fieldError := range fieldErrors {
+		// Drop the name of the validated struct from the namespace
+		_, key, _ := strings.Cut(fieldError.Namespace(), ".")
+		// Name the items of the lists after their setting
+		key, _, _ = strings.Cut(prefix+key, "[")
+		value := fieldError.Value()
+		if settings[key].Secret {
+			value = RedactedValue
+		}
+		errs[i] = fmt.Errorf("%s (%s): %s", key, settings[key].Env, describe(fieldError, sibling(list, key, fieldError.Param()), value))
 	}
-	err = os.Setenv("SERVER_PORT", strconv.Itoa(config.Server.Port))
-	if err != nil {
-		return err
+	return errs
+}
+
+// sibling returns the key of the named field in the section of a setting,
+// as compared by the rules such as ltefield.
+func sibling(list []Setting, key string, field string) string {
+	section := key[:strings.LastIndex(key, ".")+1]
+	for _, setting := range list {
+		if setting.field == field && strings.HasPrefix(setting.Key, section) && !strings.Contains(setting.Key[len(section):], ".") {
+			return setting.Key
+		}
 	}
+	return field
+}
 
-	return nil
+// describe explains why a setting is invalid; other is the key of the
+// setting it is compared to, if any, and value is its value as shown.
+func describe(fieldError validator.FieldError, other string, value any) string {
+	switch fieldError.Tag() {
+	case "required", "required_if", "required_unless", "required_with":
+		return "is required"
+	case "min":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fieldError.Param())
+		}
+		return fmt.Sprintf("must be at least %s, got %v", fieldError.Param(), value)
+	case "max":
+		return fmt.Sprintf("must be at most %s, got %v", fieldError.Param(), value)
+	case "ltefield":
+		return fmt.Sprintf("must not be greater than %s, got %v", other, value)
+	case "oneof":
+		return fmt.Sprintf("must be one of %s, got %q", strings.Join(strings.Fields(fieldError.Param()), ", "), value)
+	case "startswith":
+		return fmt.Sprintf("must start with %q", fieldError.Param())
+	case "ratelimit":
+		return fmt.Sprintf("must be group=rate:burst pairs, got %q", value)
+	case "quota":
+		return fmt.Sprintf("must be group=requests pairs, got %q", value)
+	case "url":
+		return fmt.Sprintf("must be a URL, got %q", value)
+	case "fqdn":
+		return fmt.Sprintf("must be a domain name, got %q", value)
+	case "email":
+		return fmt.Sprintf("must be an email address, got %q", value)
+	case "ip|cidr":
+		return fmt.Sprintf("must be an IP or a CIDR range, got %q", value)
+	default:
+		return fmt.Sprintf("failed the %s rule, got %v", fieldError.Tag(), value)
+	}
 }
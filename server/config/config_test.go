@@ -2,10 +2,13 @@ package config
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -18,20 +21,29 @@ const (
 	dbName    = "postgres"
 	dbSslMode = "disable"
 
-	srvHost = "localhost"
-	srvPort = 8090
+	srvHost  = "localhost"
+	srvPort  = 8090
+	grpcPort = 9090
 )
 
-func TestLoadConfigFromEnv(t *testing.T) {
-	err := addEnvirnomentVariables()
-	assert.NoError(t, err)
-
-	// Call the function to load the configuration from environment variables
+func load(t *testing.T, sources Sources) (Config, error) {
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(contextTimeout*time.Second))
 	defer cancel()
-	cfg, err := parseEnvironmentVariables(ctx)
+	if sources.Environ == nil {
+		sources.Environ = []string{}
+	}
+	return Load(ctx, sources)
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(t, Sources{})
 	assert.NoError(t, err)
-	assert.NotNil(t, cfg)
 
 	// Check individual fields in the Config struct
 	assert.Equal(t, dbHost, cfg.Database.Host)
@@ -40,6 +52,150 @@ func TestLoadConfigFromEnv(t *testing.T) {
 	assert.Equal(t, dbUser, cfg.Database.Username)
 	assert.Equal(t, dbPass, cfg.Database.Password)
 	assert.Equal(t, dbSslMode, cfg.Database.SSLMode)
+	assert.Equal(t, DriverPostgres, cfg.Database.Driver)
 	assert.Equal(t, srvHost, cfg.Server.Host)
 	assert.Equal(t, srvPort, cfg.Server.Port)
+	assert.Equal(t, grpcPort, cfg.Server.GRPCPort)
+	assert.Zero(t, cfg.Server.DrainPeriod)
+	assert.Equal(t, 10*time.Second, cfg.Server.ShutdownTimeout)
+	assert.Equal(t, 30*time.Second, cfg.Database.RetryBudget)
+	assert.Equal(t, 20, cfg.Database.MaxOpenConns)
+	assert.Equal(t, 30*time.Second, cfg.Runtime.QueryTimeout)
+}
+
+func TestLoadFiles(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Name        string
+		Content     string
+	}{
+		{
+			Description: "Env",
+			Name:        "config.env",
+			Content:     "# Database\nPOSTGRES_HOST=\"db\"\nPOSTGRES_PORT=6543\nSERVER_PORT=8080\n",
+		},
+		{
+			Description: "YAML",
+			Name:        "config.yaml",
+			Content:     "database:\n  host: db\n  port: 6543\nserver:\n  port: 8080\n",
+		},
+		{
+			Description: "YAML With Variables",
+			Name:        "configmap.yml",
+			Content:     "POSTGRES_HOST: db\nPOSTGRES_PORT: \"6543\"\nSERVER_PORT: \"8080\"\n",
+		},
+		{
+			Description: "TOML",
+			Name:        "config.toml",
+			Content:     "[database]\nhost = \"db\"\nport = 6543\n\n[server]\nport = 8080\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			cfg, err := load(t, Sources{File: writeFile(t, tc.Name, tc.Content)})
+			assert.NoError(t, err)
+			assert.Equal(t, "db", cfg.Database.Host)
+			assert.Equal(t, 6543, cfg.Database.Port)
+			assert.Equal(t, 8080, cfg.Server.Port)
+			assert.Equal(t, dbName, cfg.Database.Name, "unset settings keep their default")
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", "database:\n  host: file\n  name: file\nserver:\n  host: file\n")
+	cfg, err := load(t, Sources{
+		File:    file,
+		Environ: []string{"POSTGRES_HOST=env", "POSTGRES_NAME=env", "PATH=/bin"},
+		Flags:   map[string]string{"database.host": "flag"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "flag", cfg.Database.Host)
+	assert.Equal(t, "env", cfg.Database.Name)
+	assert.Equal(t, "file", cfg.Server.Host)
+	assert.Equal(t, srvPort, cfg.Server.Port)
+
+	// An empty variable still overrides the file
+	cfg, err = load(t, Sources{File: file, Environ: []string{"SERVER_HOST="}})
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Server.Host)
+}
+
+func TestLoadErrors(t *testing.T) {
+	file := writeFile(t, "config.yaml", "database:\n  ssl_mode: sometimes\n  hots: db\n")
+	_, err := load(t, Sources{
+		File:    file,
+		Environ: []string{"SERVER_PORT=http", "GRPC_PORT=70000", "DRAIN_PERIOD=5", "SHUTDOWN_TIMEOUT=0s"},
+		Flags:   map[string]string{"database.port": "0", "color": "blue"},
+	})
+	require.Error(t, err)
+
+	// Every problem is reported at once
+	for _, message := range []string{
+		`unknown setting "database.hots" in ` + file,
+		`unknown setting "color" in the flags`,
+		`server.port: invalid integer "http", from environment variable SERVER_PORT`,
+		"server.grpc_port (GRPC_PORT): must be at most 65535, got 70000",
+		`server.drain_period: invalid duration "5", from environment variable DRAIN_PERIOD`,
+		"server.shutdown_timeout (SHUTDOWN_TIMEOUT): must be at least 1s, got 0s",
+		"database.port (POSTGRES_PORT): must be at least 1, got 0",
+		`database.ssl_mode (POSTGRES_SSL_MODE): must be one of disable, allow, prefer, require, verify-ca, verify-full, got "sometimes"`,
+	} {
+		assert.ErrorContains(t, err, message)
+	}
+
+	_, err = load(t, Sources{File: filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.ErrorContains(t, err, "cannot read config file")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Host = ""
+	assert.ErrorContains(t, cfg.Validate(), "database.host (POSTGRES_HOST): is required")
+
+	// SQLite needs no server
+	cfg.Database.Driver = DriverSQLite
+	cfg.Database.Name = ""
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Database.Driver = "mysql"
+	assert.ErrorContains(t, cfg.Validate(), "database.driver (DB_DRIVER): must be one of postgres, sqlite")
+
+	cfg = Default()
+	cfg.Tenancy.Domain = "https://library.example.org"
+	assert.ErrorContains(t, cfg.Validate(), `tenancy.domain (TENANCY_DOMAIN): must be a domain name, got "https://library.example.org"`)
+
+	cfg = Default()
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1", "proxy.example.org"}
+	assert.ErrorContains(t, cfg.Validate(), `server.trusted_proxies (TRUSTED_PROXIES): must be an IP or a CIDR range, got "proxy.example.org"`)
+
+	// The OAI-PMH provider tells the harvesters whom to contact
+	cfg = Default()
+	cfg.OAI.Enabled = true
+	assert.ErrorContains(t, cfg.Validate(), "oai.admin_email (OAI_ADMIN_EMAIL): is required")
+	cfg.OAI.AdminEmail = "librarian"
+	assert.ErrorContains(t, cfg.Validate(), `oai.admin_email (OAI_ADMIN_EMAIL): must be an email address, got "librarian"`)
+	cfg.OAI.AdminEmail = "librarian@library.example.org"
+	assert.NoError(t, cfg.Validate())
+
+	// The invalid secrets are not shown
+	cfg = Default()
+	cfg.Auth.AdminKey = "hunter2"
+	cfg.Auth.JWTSecret = "hunter2"
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, `auth.admin_key (AUTH_ADMIN_KEY): must start with "lib_"`)
+	assert.ErrorContains(t, err, "auth.jwt_secret (AUTH_JWT_SECRET): must be at least 32 characters long")
+	assert.NotContains(t, err.Error(), "hunter2")
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Config{Database: DatabaseConfig{Username: "librarian", Password: "secret"}, Server: ServerConfig{Port: srvPort}}
+	redacted := cfg.Redacted()
+	assert.Equal(t, RedactedValue, redacted.Database.Password)
+	assert.Equal(t, "librarian", redacted.Database.Username)
+	assert.Equal(t, srvPort, redacted.Server.Port)
+	assert.Equal(t, "secret", cfg.Database.Password, "the original configuration is left as is")
+
+	assert.Empty(t, Config{}.Redacted().Database.Password, "empty secrets stay empty")
 }
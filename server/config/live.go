@@ -0,0 +1,151 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"log/slog"
+)
+
+// Applied is a version of the runtime configuration applied by the server.
+type Applied struct {
+	Version   int           `json:"version"`
+	AppliedAt time.Time     `json:"applied_at"`
+	Runtime   RuntimeConfig `json:"runtime"`
+}
+
+// Change is a setting whose value changed.
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Diff lists the settings that differ between two configurations, in the
+// order of their fields. The values of secrets are redacted.
+func Diff(old, new Config) []Change {
+	oldSettings, newSettings := Settings(&old), Settings(&new)
+	var changes []Change
+	for i, setting := range oldSettings {
+		before, after := setting.Value(), newSettings[i].Value()
+		if before == after {
+			continue
+		}
+		if setting.Secret {
+			before, after = RedactedValue, RedactedValue
+		}
+		changes = append(changes, Change{Key: setting.Key, Old: before, New: after})
+	}
+	return changes
+}
+
+// Live holds the configuration of a running server. Its runtime section is
+// replaced atomically when reloaded, and read by the server on every use;
+// the other settings need a restart to change.
+type Live struct {
+	// mu serializes the changes, which current publishes to the readers
+	mu      sync.Mutex
+	current atomic.Pointer[Applied]
+	// loaded is the configuration the server started with
+	loaded      Config
+	subscribers []func(RuntimeConfig)
+}
+
+// NewLive returns the live configuration of a server started with cfg, at
+// version 1.
+func NewLive(cfg Config) *Live {
+	l := &Live{loaded: cfg}
+	l.current.Store(&Applied{Version: 1, AppliedAt: time.Now().UTC(), Runtime: cfg.Runtime})
+	return l
+}
+
+// Current returns the applied version of the runtime configuration.
+func (l *Live) Current() Applied {
+	return *l.current.Load()
+}
+
+// Runtime returns the applied runtime configuration.
+func (l *Live) Runtime() RuntimeConfig {
+	return l.current.Load().Runtime
+}
+
+// OnChange calls f with the applied runtime configuration, then with every
+// one applied later.
+func (l *Live) OnChange(f func(RuntimeConfig)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subscribers = append(l.subscribers, f)
+	f(l.Runtime())
+}
+
+// Apply validates a runtime configuration and applies it, returning the
+// settings it changed. An invalid configuration is not applied at all.
+func (l *Live) Apply(runtime RuntimeConfig) ([]Change, error) {
+	if err := runtime.Validate(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.current.Load()
+	changes := Diff(Config{Runtime: current.Runtime}, Config{Runtime: runtime})
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	applied := &Applied{Version: current.Version + 1, AppliedAt: time.Now().UTC(), Runtime: runtime}
+	l.current.Store(applied)
+	for _, change := range changes {
+		slog.Info("Changed a runtime setting.", "setting", change.Key, "old", change.Old, "new", change.New, "version", applied.Version)
+	}
+	for _, f := range l.subscribers {
+		f(runtime)
+	}
+	return changes, nil
+}
+
+// Reload loads the configuration from its sources and applies its runtime
+// section. The other settings that changed are only logged, as they need a
+// restart. Nothing is applied when the configuration is invalid.
+func (l *Live) Reload(ctx context.Context, sources Sources) ([]Change, error) {
+	cfg, err := Load(ctx, sources)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration, keeping the applied one: %w", err)
+	}
+
+	changes, err := l.Apply(cfg.Runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := l.loaded
+	cfg.Runtime, loaded.Runtime = RuntimeConfig{}, RuntimeConfig{}
+	fromFiles := map[string]bool{}
+	for _, secret := range secretFiles(&cfg) {
+		fromFiles[secret.key] = true
+	}
+	for _, change := range Diff(loaded, cfg) {
+		// The secrets read from files are reloaded on their own, see WatchSecrets
+		if fromFiles[change.Key] {
+			continue
+		}
+		slog.Warn("A changed setting needs a restart to apply.", "setting", change.Key, "old", change.Old, "new", change.New)
+	}
+	return changes, nil
+}
+
+// Watch reloads the configuration whenever its file changes, until the
+// context is done. It does nothing without a file.
+func (l *Live) Watch(ctx context.Context, sources Sources) error {
+	if sources.File == "" {
+		return nil
+	}
+	return Watch(ctx, []string{sources.File}, func() {
+		if _, err := l.Reload(ctx, sources); err != nil {
+			slog.Error("Cannot reload the configuration.", "file", sources.File, "error", err)
+		}
+	})
+}
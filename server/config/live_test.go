@@ -0,0 +1,105 @@
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveApply(t *testing.T) {
+	live := NewLive(Default())
+	var applied []RuntimeConfig
+	live.OnChange(func(runtime RuntimeConfig) { applied = append(applied, runtime) })
+	require.Len(t, applied, 1, "the subscriber starts with the applied configuration")
+
+	runtime := live.Runtime()
+	runtime.LogLevel = LogLevelDebug
+	runtime.CORSOrigins = []string{"https://example.org"}
+	changes, err := live.Apply(runtime)
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Key: "runtime.log_level", Old: "info", New: "debug"},
+		{Key: "runtime.cors_origins", Old: "", New: "https://example.org"},
+	}, changes)
+	assert.Equal(t, 2, live.Current().Version)
+	assert.Len(t, applied, 2)
+	assert.Equal(t, "DEBUG", live.Runtime().Level().String())
+
+	// Applying the same values changes nothing
+	changes, err = live.Apply(runtime)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, 2, live.Current().Version)
+
+	// Invalid values are all rejected, and none is applied
+	runtime.PageSize = 500
+	runtime.LogLevel = "verbose"
+	_, err = live.Apply(runtime)
+	assert.ErrorContains(t, err, "runtime.page_size (PAGE_SIZE): must not be greater than runtime.max_page_size, got 500")
+	assert.ErrorContains(t, err, "runtime.log_level (LOG_LEVEL): must be one of debug, info, warn, error")
+	assert.Equal(t, 2, live.Current().Version)
+	assert.Equal(t, LogLevelDebug, live.Runtime().LogLevel)
+}
+
+func TestLiveReload(t *testing.T) {
+	file := writeFile(t, "config.yaml", "runtime:\n  rate_limit: 10\n")
+	sources := Sources{File: file, Environ: []string{}}
+	cfg, err := Load(context.Background(), sources)
+	require.NoError(t, err)
+	live := NewLive(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, live.Watch(ctx, sources))
+
+	// Settings outside the runtime section are left to a restart
+	require.NoError(t, os.WriteFile(file, []byte("runtime:\n  rate_limit: 5\n  cors_origins: [\"https://a.example\", \"https://b.example\"]\nserver:\n  port: 8091\n"), 0o644))
+	assert.Eventually(t, func() bool { return live.Current().Version == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 5, live.Runtime().RateLimit)
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, live.Runtime().CORSOrigins)
+
+	// An invalid file is not applied
+	require.NoError(t, os.WriteFile(file, []byte("runtime:\n  rate_limit: -1\n"), 0o644))
+	_, err = live.Reload(ctx, sources)
+	assert.ErrorContains(t, err, "keeping the applied one")
+	assert.Equal(t, 2, live.Current().Version)
+}
+
+func TestRateLimits(t *testing.T) {
+	runtime := Default().Runtime
+	runtime.RateLimit = 10
+	runtime.RateLimits = []string{"search=2:5", " import = 0:0 "}
+	runtime.Quotas = []string{"export=20"}
+	require.NoError(t, runtime.Validate())
+
+	testCases := []struct {
+		Group string
+		Rate  int
+		Burst int
+		Quota int
+	}{
+		{Group: "search", Rate: 2, Burst: 5},
+		{Group: "import"},
+		{Group: "export", Rate: 10, Burst: 20, Quota: 20},
+		{Group: "default", Rate: 10, Burst: 20},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Group, func(t *testing.T) {
+			rate, burst := runtime.Limit(tc.Group)
+			assert.Equal(t, tc.Rate, rate)
+			assert.Equal(t, tc.Burst, burst)
+			assert.Equal(t, tc.Quota, runtime.Quota(tc.Group))
+		})
+	}
+
+	runtime.RateLimits = []string{"search=2"}
+	runtime.Quotas = []string{"export=-1"}
+	err := runtime.Validate()
+	assert.ErrorContains(t, err, `runtime.rate_limits (RATE_LIMITS): must be group=rate:burst pairs, got "search=2"`)
+	assert.ErrorContains(t, err, `runtime.quotas (QUOTAS): must be group=requests pairs, got "export=-1"`)
+}
@@ -1,24 +1,377 @@
 package config
 
-// Config holds the configuration settings for the Library application
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the configuration settings for the Library application.
+//
+// Every setting is named by its `config` key, prefixed by the key of its
+// section as in "database.port", in configuration files and flags, and by its
+// `env` environment variable. It is checked with its `validate` rules. The
+// `secret` settings are redacted when shown, and may be read from the file of
+// the setting their `file` tag names instead.
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
+	Database DatabaseConfig `config:"database"`
+	Server   ServerConfig   `config:"server"`
+	Cache    CacheConfig    `config:"cache"`
+	Auth     AuthConfig     `config:"auth"`
+	Tenancy  TenancyConfig  `config:"tenancy"`
+	OAI      OAIConfig      `config:"oai"`
+	Runtime  RuntimeConfig  `config:"runtime"`
 }
 
+// Database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// SQLiteMemory is the SQLite path of a private in-memory database.
+const SQLiteMemory = ":memory:"
+
 // DatabaseConfig holds the database configuration settings
 type DatabaseConfig struct {
-	Host     string `env:"POSTGRES_HOST"`
-	Port     int    `env:"POSTGRES_PORT"`
-	Username string `env:"POSTGRES_USERNAME"`
-	Password string `env:"POSTGRES_PASSWORD"`
-	Name     string `env:"POSTGRES_NAME"`
-	SSLMode  string `env:"POSTGRES_SSL_MODE"`
+	Host     string `config:"host" env:"POSTGRES_HOST" validate:"required_unless=Driver sqlite"`
+	Port     int    `config:"port" env:"POSTGRES_PORT" validate:"min=1,max=65535"`
+	Username string `config:"username" env:"POSTGRES_USERNAME"`
+	Password string `config:"password" env:"POSTGRES_PASSWORD" secret:"true" file:"PasswordFile" reload:"true"`
+	// PasswordFile holds the password instead, as a mounted Kubernetes
+	// Secret; the new connections use the new password once it changes
+	PasswordFile string `config:"password_file" env:"POSTGRES_PASSWORD_FILE"`
+	Name         string `config:"name" env:"POSTGRES_NAME" validate:"required_unless=Driver sqlite"`
+	SSLMode      string `config:"ssl_mode" env:"POSTGRES_SSL_MODE" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+	// Driver is DriverPostgres (the default) or DriverSQLite
+	Driver string `config:"driver" env:"DB_DRIVER" validate:"omitempty,oneof=postgres sqlite"`
+	// SQLitePath is the file of the SQLite database, in memory if empty
+	SQLitePath string `config:"sqlite_path" env:"SQLITE_PATH"`
+	// RetryBudget is how long to retry connecting on start, waiting longer
+	// after every failed attempt, as when the database starts after the
+	// server; 0 tries once
+	RetryBudget time.Duration `config:"retry_budget" env:"DB_RETRY_BUDGET" validate:"min=0s"`
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime size the connection
+	// pool, without limit when 0
+	MaxOpenConns    int           `config:"max_open_conns" env:"DB_MAX_OPEN_CONNS" validate:"min=0"`
+	MaxIdleConns    int           `config:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" validate:"min=0"`
+	ConnMaxLifetime time.Duration `config:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" validate:"min=0s"`
+	// PingInterval is how often the connection is checked in the background,
+	// to report when it is lost and restored, and to return the ejected
+	// replicas to the rotation; 0 disables it
+	PingInterval time.Duration `config:"ping_interval" env:"DB_PING_INTERVAL" validate:"min=0s"`
+	// Replicas lists the read replicas of a Postgres database, as host or
+	// host:port, with the same name and credentials. They serve the reads in
+	// turn, but for the reads of a client for ReadYourWrites after it writes.
+	Replicas       []string      `config:"replicas" env:"POSTGRES_REPLICAS"`
+	ReadYourWrites time.Duration `config:"read_your_writes" env:"DB_READ_YOUR_WRITES" validate:"min=0s"`
 }
 
 // ServerConfig holds the server configuration settings
 type ServerConfig struct {
-	Host string `env:"SERVER_HOST"`
-	Port int    `env:"SERVER_PORT"`
+	Host     string `config:"host" env:"SERVER_HOST"`
+	Port     int    `config:"port" env:"SERVER_PORT" validate:"min=1,max=65535"`
+	GRPCPort int    `config:"grpc_port" env:"GRPC_PORT" validate:"min=1,max=65535"`
 	//RootDir string `env:"ROOT_DIRECTORY"`
+	// DrainPeriod is how long the server keeps serving once asked to stop,
+	// failing its readiness check, so that the load balancers stop routing
+	// requests to it first
+	DrainPeriod time.Duration `config:"drain_period" env:"DRAIN_PERIOD" validate:"min=0s"`
+	// ShutdownTimeout bounds the wait for the requests in flight after the
+	// drain period, before closing their connections
+	ShutdownTimeout time.Duration `config:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" validate:"min=1s"`
+	// HealthTimeout bounds each check of the dependencies of the readiness
+	// endpoint, as pinging the database
+	HealthTimeout time.Duration `config:"health_timeout" env:"HEALTH_TIMEOUT" validate:"min=1ms"`
+	// TrustedProxies are the IPs and CIDR ranges of the reverse proxies
+	// whose X-Forwarded-For and X-Forwarded-Proto headers tell the IP and
+	// scheme of the clients, none by default not to let the clients spoof
+	// theirs
+	TrustedProxies []string `config:"trusted_proxies" env:"TRUSTED_PROXIES" validate:"dive,ip|cidr"`
+}
+
+// Cache backends
+const (
+	CacheMemory = "memory"
+	CacheNone   = "none"
+)
+
+// CacheConfig holds the settings of the cache of the books
+type CacheConfig struct {
+	// Backend is CacheMemory, an in-process LRU cache, or CacheNone
+	Backend string `config:"backend" env:"CACHE_BACKEND" validate:"oneof=memory none"`
+	// Size is the number of values the in-process cache holds
+	Size int `config:"size" env:"CACHE_SIZE" validate:"min=1"`
+	// TTL is how long the values are cached, as the writes of the other
+	// instances of the server do not invalidate an in-process cache
+	TTL time.Duration `config:"ttl" env:"CACHE_TTL" validate:"min=1ms"`
+}
+
+// AuthConfig holds the settings authenticating and authorizing the clients
+// of the API
+type AuthConfig struct {
+	// Enabled authorizes the clients by the roles of their credentials;
+	// otherwise anyone may do anything
+	Enabled bool `config:"enabled" env:"AUTH_ENABLED"`
+	// AdminKey is an API key of the admin role accepted besides those of
+	// the database, to create them
+	AdminKey     string `config:"admin_key" env:"AUTH_ADMIN_KEY" secret:"true" file:"AdminKeyFile" validate:"omitempty,startswith=lib_,min=24"`
+	AdminKeyFile string `config:"admin_key_file" env:"AUTH_ADMIN_KEY_FILE"`
+	// JWTSecret verifies the HS256 bearer tokens, and the keys of JWKSFile
+	// the RS256 ones; the tokens are only accepted when either is set
+	JWTSecret     string `config:"jwt_secret" env:"AUTH_JWT_SECRET" secret:"true" file:"JWTSecretFile" validate:"omitempty,min=32"`
+	JWTSecretFile string `config:"jwt_secret_file" env:"AUTH_JWT_SECRET_FILE"`
+	JWKSFile      string `config:"jwks_file" env:"AUTH_JWKS_FILE"`
+	// JWTIssuer and JWTAudience, unless empty, must match the iss and aud
+	// claims of the tokens; with an OpenID provider they default to its
+	// issuer and to OIDCClientID
+	JWTIssuer   string `config:"jwt_issuer" env:"AUTH_JWT_ISSUER"`
+	JWTAudience string `config:"jwt_audience" env:"AUTH_JWT_AUDIENCE"`
+	// RolesClaim is the claim of the tokens listing the roles of their
+	// subject, who is a patron without; a dotted path such as
+	// realm_access.roles names a nested claim
+	RolesClaim string `config:"roles_claim" env:"AUTH_ROLES_CLAIM" validate:"required"`
+	// RoleMap maps the values of the roles claim to roles, as value=role
+	// pairs such as library-staff=librarian; the values without a pair are
+	// taken as roles
+	RoleMap []string `config:"role_map" env:"AUTH_ROLE_MAP"`
+	// OIDCIssuer is the issuer of an OpenID provider the users log in with,
+	// whose bearer tokens the API accepts too
+	OIDCIssuer string `config:"oidc_issuer" env:"AUTH_OIDC_ISSUER" validate:"omitempty,url"`
+	// OIDCClientID and OIDCClientSecret identify the server to the
+	// provider, a public client without a secret
+	OIDCClientID         string `config:"oidc_client_id" env:"AUTH_OIDC_CLIENT_ID" validate:"required_with=OIDCIssuer"`
+	OIDCClientSecret     string `config:"oidc_client_secret" env:"AUTH_OIDC_CLIENT_SECRET" secret:"true" file:"OIDCClientSecretFile"`
+	OIDCClientSecretFile string `config:"oidc_client_secret_file" env:"AUTH_OIDC_CLIENT_SECRET_FILE"`
+	// OIDCRedirectURL is the URL of /auth/oidc/callback as the browsers
+	// reach it, registered with the provider
+	OIDCRedirectURL string `config:"oidc_redirect_url" env:"AUTH_OIDC_REDIRECT_URL" validate:"required_with=OIDCIssuer,omitempty,url"`
+	// OIDCScopes are requested besides openid
+	OIDCScopes []string `config:"oidc_scopes" env:"AUTH_OIDC_SCOPES"`
+	// OIDCKeysTTL is how long the keys of the provider are cached
+	OIDCKeysTTL time.Duration `config:"oidc_keys_ttl" env:"AUTH_OIDC_KEYS_TTL" validate:"min=1m"`
+	// GuestRole is the role of the clients without credentials, who may
+	// only use the public endpoints if empty
+	GuestRole string `config:"guest_role" env:"AUTH_GUEST_ROLE" validate:"omitempty,oneof=patron librarian admin"`
+	// SessionTTL is how long the sessions of the users logging in with a
+	// password last, unless refreshed
+	SessionTTL time.Duration `config:"session_ttl" env:"AUTH_SESSION_TTL" validate:"min=1m"`
+	// LockoutThreshold failed logins in a row lock an account for
+	// LockoutDuration; 0 never locks them
+	LockoutThreshold int           `config:"lockout_threshold" env:"AUTH_LOCKOUT_THRESHOLD" validate:"min=0"`
+	LockoutDuration  time.Duration `config:"lockout_duration" env:"AUTH_LOCKOUT_DURATION" validate:"min=0s"`
+	// ResetTTL is how long the tokens resetting a password are valid
+	ResetTTL time.Duration `config:"reset_ttl" env:"AUTH_RESET_TTL" validate:"min=1m"`
+}
+
+// TenancyConfig holds the settings of the deployments hosting several
+// libraries, the tenants, each with its own books, API keys and users
+type TenancyConfig struct {
+	// Enabled serves every request the tenant it names; otherwise all of
+	// them are served the default tenant
+	Enabled bool `config:"enabled" env:"TENANCY_ENABLED"`
+	// Domain is the domain whose subdomains name the tenants, as
+	// springfield.library.example.org for library.example.org; none if empty
+	Domain string `config:"domain" env:"TENANCY_DOMAIN" validate:"omitempty,fqdn"`
+	// Header is the header naming the tenant of a request, before its
+	// subdomain
+	Header string `config:"header" env:"TENANCY_HEADER" validate:"required"`
+	// Claim is the claim of the bearer tokens naming the tenant of their
+	// subject, who belongs to the default tenant without
+	Claim string `config:"claim" env:"TENANCY_CLAIM" validate:"required"`
+}
+
+// OAIConfig holds the settings of the OAI-PMH provider harvesting the
+// catalogue
+type OAIConfig struct {
+	// Enabled serves the OAI-PMH provider under /oai
+	Enabled bool `config:"enabled" env:"OAI_ENABLED"`
+	// AdminEmail is the address of the administrator of the repository,
+	// which the harvesters are told
+	AdminEmail string `config:"admin_email" env:"OAI_ADMIN_EMAIL" validate:"required_if=Enabled true,omitempty,email"`
+}
+
+// Log levels
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// RuntimeConfig holds the settings the server applies without restarting,
+// when its configuration file changes or on SIGHUP (see Live).
+type RuntimeConfig struct {
+	LogLevel string `config:"log_level" env:"LOG_LEVEL" validate:"oneof=debug info warn error"`
+	// RateLimit is the number of requests per second a client may make on
+	// average, beyond bursts of RateBurst requests; 0 disables the limit
+	RateLimit int `config:"rate_limit" env:"RATE_LIMIT" validate:"min=0"`
+	RateBurst int `config:"rate_burst" env:"RATE_BURST" validate:"min=0"`
+	// RateLimits override the limit of groups of routes, every group being
+	// limited apart, as group=rate:burst pairs such as search=2:10
+	RateLimits []string `config:"rate_limits" env:"RATE_LIMITS" validate:"dive,ratelimit"`
+	// Quotas are the requests a client may make to groups of routes a day,
+	// counted until midnight UTC, as group=requests pairs such as export=20
+	Quotas []string `config:"quotas" env:"QUOTAS" validate:"dive,quota"`
+	// CORSOrigins lists the origins of the browsers allowed to call the API,
+	// "*" for any of them
+	CORSOrigins []string `config:"cors_origins" env:"CORS_ORIGINS"`
+	// PageSize and MaxPageSize are the default and largest number of books
+	// in the pages of the paginated endpoints
+	PageSize    int `config:"page_size" env:"PAGE_SIZE" validate:"min=1,ltefield=MaxPageSize"`
+	MaxPageSize int `config:"max_page_size" env:"MAX_PAGE_SIZE" validate:"min=1"`
+	// QueryTimeout bounds the database queries of every request, canceled
+	// once it expires or the client goes away; 0 disables it
+	QueryTimeout time.Duration `config:"query_timeout" env:"QUERY_TIMEOUT" validate:"min=0s"`
+	// CacheMaxAge is how long the clients may reuse the books they read,
+	// sent in the Cache-Control header; 0 asks them to revalidate
+	CacheMaxAge time.Duration `config:"cache_max_age" env:"CACHE_MAX_AGE" validate:"min=0s"`
+}
+
+// Limit returns the rate and burst of the requests to a group of routes, of
+// RateLimits or else RateLimit and RateBurst.
+func (r RuntimeConfig) Limit(group string) (rate, burst int) {
+	for _, pair := range r.RateLimits {
+		if name, rate, burst, err := parseRateLimit(pair); err == nil && name == group {
+			return rate, burst
+		}
+	}
+	return r.RateLimit, r.RateBurst
+}
+
+// Quota returns the requests a client may make to a group of routes a day,
+// 0 for no quota.
+func (r RuntimeConfig) Quota(group string) int {
+	for _, pair := range r.Quotas {
+		if name, quota, err := parseQuota(pair); err == nil && name == group {
+			return quota
+		}
+	}
+	return 0
+}
+
+// parseRateLimit parses a group=rate:burst pair.
+func parseRateLimit(pair string) (group string, rate, burst int, err error) {
+	group, limit, ok := strings.Cut(pair, "=")
+	rates, bursts, hasBurst := strings.Cut(limit, ":")
+	if !ok || !hasBurst || strings.TrimSpace(group) == "" {
+		return "", 0, 0, fmt.Errorf("expected group=rate:burst, got %q", pair)
+	}
+	rate, rateErr := strconv.Atoi(strings.TrimSpace(rates))
+	burst, burstErr := strconv.Atoi(strings.TrimSpace(bursts))
+	if rateErr != nil || burstErr != nil || rate < 0 || burst < 0 {
+		return "", 0, 0, fmt.Errorf("expected group=rate:burst, got %q", pair)
+	}
+	return strings.TrimSpace(group), rate, burst, nil
+}
+
+// parseQuota parses a group=requests pair.
+func parseQuota(pair string) (group string, quota int, err error) {
+	group, requests, ok := strings.Cut(pair, "=")
+	quota, err = strconv.Atoi(strings.TrimSpace(requests))
+	if !ok || err != nil || quota < 0 || strings.TrimSpace(group) == "" {
+		return "", 0, fmt.Errorf("expected group=requests, got %q", pair)
+	}
+	return strings.TrimSpace(group), quota, nil
+}
+
+// Level returns the slog level of LogLevel.
+func (r RuntimeConfig) Level() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(r.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// Default returns the configuration used for the settings no source sets.
+func Default() Config {
+	return Config{
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			Username:        "postgres",
+			Name:            "postgres",
+			SSLMode:         "disable",
+			Driver:          DriverPostgres,
+			RetryBudget:     30 * time.Second,
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			PingInterval:    10 * time.Second,
+			ReadYourWrites:  5 * time.Second,
+		},
+		Server: ServerConfig{
+			Host:            "localhost",
+			Port:            8090,
+			GRPCPort:        9090,
+			ShutdownTimeout: 10 * time.Second,
+			HealthTimeout:   2 * time.Second,
+		},
+		Cache: CacheConfig{
+			Backend: CacheMemory,
+			Size:    10000,
+			TTL:     time.Minute,
+		},
+		Auth: AuthConfig{
+			Enabled:          true,
+			RolesClaim:       "roles",
+			GuestRole:        "patron",
+			SessionTTL:       12 * time.Hour,
+			LockoutThreshold: 5,
+			LockoutDuration:  15 * time.Minute,
+			ResetTTL:         time.Hour,
+			OIDCScopes:       []string{"profile", "email"},
+			OIDCKeysTTL:      time.Hour,
+		},
+		Tenancy: TenancyConfig{
+			Header: "X-Tenant",
+			Claim:  "tenant",
+		},
+		Runtime: RuntimeConfig{
+			LogLevel:     LogLevelInfo,
+			RateBurst:    20,
+			PageSize:     25,
+			MaxPageSize:  100,
+			QueryTimeout: 30 * time.Second,
+			CacheMaxAge:  30 * time.Second,
+		},
+	}
+}
+
+// RedactedValue replaces the values of secrets, such as passwords, when showing them.
+const RedactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the configuration whose non-empty fields tagged
+// `secret:"true"` are replaced by RedactedValue, fit to be printed or logged.
+func (c Config) Redacted() Config {
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// LogValue redacts the secrets of the configuration wherever it is logged.
+func (c Config) LogValue() slog.Value {
+	type redacted Config
+	return slog.AnyValue(redacted(c.Redacted()))
+}
+
+// LogValue redacts the secrets of the database configuration wherever it is logged.
+func (c DatabaseConfig) LogValue() slog.Value {
+	type redacted DatabaseConfig
+	return slog.AnyValue(redacted(Config{Database: c}.Redacted().Database))
+}
+
+func redact(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			redact(field)
+		case v.Type().Field(i).Tag.Get("secret") == "true" && field.Kind() == reflect.String && field.String() != "":
+			field.SetString(RedactedValue)
+		}
+	}
 }
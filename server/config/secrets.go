@@ -0,0 +1,99 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"log/slog"
+)
+
+// readSecrets sets the secrets whose file setting is set to the content of
+// their file, without its trailing newline.
+func readSecrets(cfg *Config) []error {
+	var errs []error
+	for _, secret := range secretFiles(cfg) {
+		content, err := os.ReadFile(secret.path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): cannot read the secret: %w", secret.file.Key, secret.file.Env, err))
+			continue
+		}
+		secret.value.SetString(strings.TrimRight(string(content), "\r\n"))
+	}
+	return errs
+}
+
+// secretFile is a secret read from a file. A reloadable secret, tagged
+// reload:"true", applies without a restart when its file changes.
+type secretFile struct {
+	key        string
+	value      reflect.Value
+	file       Setting
+	path       string
+	reloadable bool
+}
+
+func secretFiles(cfg *Config) []secretFile {
+	var files []secretFile
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), prefix+field.Tag.Get("config")+".")
+				continue
+			}
+			fileField, ok := v.Type().FieldByName(field.Tag.Get("file"))
+			if !ok || v.FieldByIndex(fileField.Index).String() == "" {
+				continue
+			}
+			files = append(files, secretFile{
+				key:        prefix + field.Tag.Get("config"),
+				value:      v.Field(i),
+				file:       Setting{Key: prefix + fileField.Tag.Get("config"), Env: fileField.Tag.Get("env")},
+				path:       v.FieldByIndex(fileField.Index).String(),
+				reloadable: field.Tag.Get("reload") == "true",
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return files
+}
+
+// WatchSecrets re-reads the secret files of the configuration when they
+// change and calls update with the configuration holding their new values,
+// until the context is done. Only the reloadable secrets, the database
+// password, are applied by update; the changes of the others are logged, as
+// they need a restart.
+func WatchSecrets(ctx context.Context, cfg Config, update func(Config)) error {
+	var paths []string
+	for _, secret := range secretFiles(&cfg) {
+		paths = append(paths, secret.path)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	return Watch(ctx, paths, func() {
+		next := cfg
+		if err := errors.Join(readSecrets(&next)...); err != nil {
+			slog.Warn("Cannot reload the secrets, keeping the previous ones.", "error", err)
+			return
+		}
+		if reflect.DeepEqual(next, cfg) {
+			return
+		}
+		previous := secretFiles(&cfg)
+		for index, secret := range secretFiles(&next) {
+			if !secret.reloadable && secret.value.String() != previous[index].value.String() {
+				slog.Warn("A changed secret needs a restart to apply.", "setting", secret.key, "file", secret.path)
+			}
+		}
+		cfg = next
+		slog.Info("Reloaded the secrets.", "files", paths)
+		update(next)
+	})
+}
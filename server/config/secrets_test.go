@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"log/slog"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSecretFile(t *testing.T) {
+	secret := writeFile(t, "password", "s3cret\n")
+	cfg, err := load(t, Sources{Environ: []string{"POSTGRES_PASSWORD=plain", "POSTGRES_PASSWORD_FILE=" + secret}})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.Database.Password, "the file wins, without its newline")
+
+	file := writeFile(t, "config.yaml", "database:\n  password_file: "+secret+"\n")
+	cfg, err = load(t, Sources{File: file})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.Database.Password)
+
+	_, err = load(t, Sources{Flags: map[string]string{"database.password_file": filepath.Join(t.TempDir(), "missing")}})
+	assert.ErrorContains(t, err, "database.password_file (POSTGRES_PASSWORD_FILE): cannot read the secret")
+}
+
+func TestWatchSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(secret, []byte("first"), 0o600))
+	cfg, err := load(t, Sources{Environ: []string{"POSTGRES_PASSWORD_FILE=" + secret}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan Config, 1)
+	require.NoError(t, WatchSecrets(ctx, cfg, func(cfg Config) { updates <- cfg }))
+
+	// Kubernetes swaps a symbolic link to the new version of the Secret
+	next := filepath.Join(dir, "password.next")
+	require.NoError(t, os.WriteFile(next, []byte("second\n"), 0o600))
+	require.NoError(t, os.Rename(next, secret))
+
+	select {
+	case updated := <-updates:
+		assert.Equal(t, "second", updated.Database.Password)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the secret was not reloaded")
+	}
+
+	// Nothing happens when the content is the same
+	require.NoError(t, os.WriteFile(secret, []byte("second"), 0o600))
+	select {
+	case <-updates:
+		t.Fatal("the unchanged secret was reloaded")
+	case <-time.After(5 * watchDelay):
+	}
+}
+
+func TestWatchSecretsRestart(t *testing.T) {
+	dir := t.TempDir()
+	password := filepath.Join(dir, "password")
+	jwtSecret := filepath.Join(dir, "jwt")
+	require.NoError(t, os.WriteFile(password, []byte("first"), 0o600))
+	require.NoError(t, os.WriteFile(jwtSecret, []byte(strings.Repeat("a", 32)), 0o600))
+	cfg, err := load(t, Sources{Environ: []string{"POSTGRES_PASSWORD_FILE=" + password, "AUTH_JWT_SECRET_FILE=" + jwtSecret}})
+	require.NoError(t, err)
+
+	var buffer bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buffer, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan Config, 1)
+	require.NoError(t, WatchSecrets(ctx, cfg, func(cfg Config) { updates <- cfg }))
+
+	// The JWT secret is only read at startup
+	require.NoError(t, os.WriteFile(jwtSecret, []byte(strings.Repeat("b", 32)), 0o600))
+	select {
+	case <-updates:
+		assert.Contains(t, buffer.String(), "A changed secret needs a restart to apply.")
+		assert.Contains(t, buffer.String(), "setting=auth.jwt_secret")
+		assert.NotContains(t, buffer.String(), "setting=database.password")
+		assert.NotContains(t, buffer.String(), strings.Repeat("b", 32))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the secret was not reloaded")
+	}
+}
+
+func TestLogValue(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buffer, nil))
+	cfg := Default()
+	cfg.Database.Password = "s3cret"
+
+	logger.Info("Loaded.", "Configuration", cfg, "Database", cfg.Database)
+	assert.NotContains(t, buffer.String(), "s3cret")
+	assert.Contains(t, buffer.String(), RedactedValue)
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"log/slog"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay groups the events of a file written in several steps.
+const watchDelay = 100 * time.Millisecond
+
+// Watch calls changed whenever one of the files may have changed, until the
+// context is done. It watches their directories so that it notices the
+// files replaced through symbolic links, as Kubernetes updates the mounted
+// ConfigMaps and Secrets.
+func Watch(ctx context.Context, files []string, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	watched := map[string]bool{}
+	for _, file := range files {
+		dir := filepath.Dir(filepath.Clean(file))
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+		watched[dir] = true
+	}
+
+	go func() {
+		defer watcher.Close()
+		var delay <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				delay = time.After(watchDelay)
+			case <-delay:
+				delay = nil
+				changed()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("Error watching the configuration files.", "error", err)
+			}
+		}
+	}()
+	return nil
+}
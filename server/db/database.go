@@ -1,63 +1,225 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"library/config"
-	"library/models"
-	"log"
+	"library/migrations"
+	"sync/atomic"
+	"time"
 
 	"log/slog"
 
+	"github.com/glebarez/sqlite"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// sqlitePragmas make SQLite wait for locks instead of failing, and match
+// text case-sensitively like Postgres does.
+const sqlitePragmas = "_pragma=busy_timeout(5000)&_pragma=case_sensitive_like(1)"
+
 type Database struct {
 	DB *gorm.DB
+	// password is used by the new Postgres connections
+	password *atomic.Pointer[string]
+	// state tracks whether the database is reachable
+	state *connectionState
+	// replicas serve the reads, if any
+	replicas *replicaSet
 }
 
 func New() Database {
-	return Database{DB: &gorm.DB{}}
+	return Database{DB: &gorm.DB{}, password: &atomic.Pointer[string]{}, state: &connectionState{}, replicas: &replicaSet{}}
+}
+
+// SetPassword changes the password of the new connections, as when the
+// secret holding it rotates. The open connections are kept.
+func (db *Database) SetPassword(password string) {
+	db.password.Store(&password)
 }
 
-// InitDB initializes the database connection pool
+// Connect initializes the database connection pool and migrates the schema
+// to the latest version
 func (db *Database) Connect(cfg *config.DatabaseConfig) error {
-	slog.Info("Connecting to database.", "Host", cfg.Host, "Port", cfg.Port)
+	if err := db.Open(cfg); err != nil {
+		return err
+	}
+	if err := db.Migrate(context.Background()); err != nil {
+		return fmt.Errorf("failed to migrate the database: %w", err)
+	}
+
+	slog.Info("Connected to database successfully..")
+	return nil
+}
+
+// Open initializes the database connection pool, leaving the schema as is
+func (db *Database) Open(cfg *config.DatabaseConfig) error {
+	var dialector gorm.Dialector
+	gormConfig := &gorm.Config{}
+	switch cfg.Driver {
+	case "", config.DriverPostgres:
+		slog.Info("Connecting to database.", "Host", cfg.Host, "Port", cfg.Port)
+		// Read the password when connecting, so that it can rotate
+		db.SetPassword(cfg.Password)
+		var err error
+		dialector, err = db.postgres(cfg)
+		if err != nil {
+			return err
+		}
+	case config.DriverSQLite:
+		if len(cfg.Replicas) > 0 {
+			return errors.New("read replicas need the postgres driver")
+		}
+		slog.Info("Opening SQLite database.", "Path", sqlitePath(cfg))
+		dialector = sqlite.Open(buildSQLiteDSN(cfg))
+		// SQLite has no time zones: store every timestamp in UTC so they compare as text
+		gormConfig.NowFunc = func() time.Time { return time.Now().UTC() }
+	default:
+		return fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+
+	err := retry(cfg.RetryBudget, func() error {
+		var err error
+		db.DB, err = gorm.Open(dialector, gormConfig)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	db.state.up()
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	if cfg.Driver == config.DriverSQLite && sqlitePath(cfg) == config.SQLiteMemory {
+		// Every connection to ":memory:" opens a new empty database
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		return nil
+	}
+	configurePool(sqlDB, cfg)
+	return db.openReplicas(cfg)
+}
+
+// postgres returns the dialector of a Postgres database, connecting with the
+// current password.
+func (db *Database) postgres(cfg *config.DatabaseConfig) (gorm.Dialector, error) {
 	connectionString := buildDatabaseConnectionString(cfg)
 	slog.Debug("Built database connection string.", "Connection String", connectionString)
-
-	var err error
-	db.DB, err = gorm.Open(postgres.Open(connectionString), &gorm.Config{})
+	connConfig, err := pgx.ParseConfig(connectionString)
 	if err != nil {
-		log.Fatalf("Failed to connect to database. %v", err)
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+		connConfig.Password = *db.password.Load()
+		return nil
+	}))
+	return postgres.New(postgres.Config{Conn: sqlDB}), nil
+}
+
+// configurePool sizes a connection pool.
+func configurePool(sqlDB *sql.DB, cfg *config.DatabaseConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+}
+
+// Retries of the connection on start
+const (
+	retryFirstDelay = 250 * time.Millisecond
+	retryMaxDelay   = 8 * time.Second
+)
+
+// retry calls connect until it succeeds, waiting twice as long after every
+// failure, up to retryMaxDelay, as long as the next attempt starts within
+// the budget. It returns the last error.
+func retry(budget time.Duration, connect func() error) error {
+	deadline := time.Now().Add(budget)
+	delay := retryFirstDelay
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+		slog.Warn("Cannot connect to the database, retrying.", "attempt", attempt, "delay", delay, "error", err)
+		time.Sleep(delay)
+		delay = min(2*delay, retryMaxDelay)
 	}
+}
 
-	err = db.DB.AutoMigrate(&models.Book{})
+// Close closes the database connection pool
+func (db *Database) Close() error {
+	sqlDB, err := db.DB.DB()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	errs := []error{sqlDB.Close()}
+	for _, replica := range db.replicas.replicas {
+		errs = append(errs, replica.close())
 	}
+	return errors.Join(errs...)
+}
 
-	slog.Info("Connected to database successfully..")
-	return nil
+// Migrate applies the pending schema migrations
+func (db *Database) Migrate(ctx context.Context) error {
+	migrator, err := migrations.New(db.DB)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(ctx)
+	return err
 }
 
 func buildDatabaseConnectionString(cfg *config.DatabaseConfig) string {
 	connectionString := fmt.Sprintf("host=%s port=%d dbname=%s sslmode=%s", cfg.Host, cfg.Port, cfg.Name, cfg.SSLMode)
 
 	if cfg.Username != "" {
-		// If the user is not provided in the config, assume there is no user authentication
-		connectionString += fmt.Sprintf(" user=%s password=%s", cfg.Username, cfg.Password)
+		// If the user is not provided in the config, assume there is no user
+		// authentication. The password is given when connecting.
+		connectionString += fmt.Sprintf(" user=%s", cfg.Username)
 	}
 
 	return connectionString
 }
 
+func sqlitePath(cfg *config.DatabaseConfig) string {
+	if cfg.SQLitePath == "" {
+		return config.SQLiteMemory
+	}
+	return cfg.SQLitePath
+}
+
+func buildSQLiteDSN(cfg *config.DatabaseConfig) string {
+	path := sqlitePath(cfg)
+	if path != config.SQLiteMemory {
+		path = "file:" + path
+	}
+	return path + "?" + sqlitePragmas
+}
+
 // Teardown cleans up the database after testing
 func (db *Database) Teardown() error {
 	if db.DB == nil {
 		return errors.New("database is pointing to nil")
 	}
 
-	return db.DB.Migrator().DropTable(&models.Book{})
+	// Roll back every migration, then forget about them
+	ctx := context.Background()
+	migrator, err := migrations.New(db.DB)
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Down(ctx, -1); err != nil {
+		return err
+	}
+	return migrator.Drop(ctx)
 }
@@ -1,9 +1,17 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"library/config"
+	"library/migrations"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestInitDB tests the database connection initialization
@@ -12,3 +20,122 @@ func TestDB(t *testing.T) {
 	err := db.Teardown()
 	assert.NoError(t, err)
 }
+
+func TestConnectUnknownDriver(t *testing.T) {
+	db := New()
+	err := db.Connect(&config.DatabaseConfig{Driver: "oracle"})
+	assert.ErrorContains(t, err, "unknown database driver")
+}
+
+func TestBuildSQLiteDSN(t *testing.T) {
+	assert.Equal(t, ":memory:?"+sqlitePragmas, buildSQLiteDSN(&config.DatabaseConfig{Driver: config.DriverSQLite}))
+	assert.Equal(t, "file:library.db?"+sqlitePragmas, buildSQLiteDSN(&config.DatabaseConfig{Driver: config.DriverSQLite, SQLitePath: "library.db"}))
+}
+
+// TestConcurrentMigrations migrates the same database from several
+// connections at once, as replicas starting together do.
+func TestConcurrentMigrations(t *testing.T) {
+	db := SetupTest(t)
+	defer func() {
+		assert.NoError(t, db.Teardown())
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.Migrate(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	migrator, err := migrations.New(db.DB)
+	assert.NoError(t, err)
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "up to date", migrations.State(statuses))
+}
+
+func TestBuildDatabaseConnectionString(t *testing.T) {
+	cfg := &config.DatabaseConfig{Host: "db", Port: 5432, Name: "library", SSLMode: "require", Username: "librarian", Password: "s3cret"}
+	// The password is given when connecting, so that it can rotate
+	assert.Equal(t, "host=db port=5432 dbname=library sslmode=require user=librarian", buildDatabaseConnectionString(cfg))
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Budget      time.Duration
+		Failures    int
+		Attempts    int
+		Err         string
+	}{
+		{Description: "First Attempt", Budget: time.Second, Attempts: 1},
+		{Description: "After Failures", Budget: time.Second, Failures: 2, Attempts: 3},
+		{Description: "Out Of Budget", Budget: time.Second, Failures: 5, Attempts: 3, Err: "gave up after 3 attempts: connection refused"},
+		{Description: "No Budget", Failures: 1, Attempts: 1, Err: "gave up after 1 attempts: connection refused"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			attempts := 0
+			err := retry(tc.Budget, func() error {
+				attempts++
+				if attempts <= tc.Failures {
+					return errors.New("connection refused")
+				}
+				return nil
+			})
+			assert.Equal(t, tc.Attempts, attempts)
+			if tc.Err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.Err)
+			}
+		})
+	}
+}
+
+func TestPoolSettings(t *testing.T) {
+	db := New()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "library.db")
+	cfg.MaxOpenConns = 3
+	require.NoError(t, db.Open(&cfg))
+	defer db.Close()
+
+	sqlDB, err := db.DB.DB()
+	require.NoError(t, err)
+	assert.Equal(t, 3, sqlDB.Stats().MaxOpenConnections)
+}
+
+func TestReconnection(t *testing.T) {
+	db := New()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	require.NoError(t, db.Open(&cfg))
+	ctx := context.Background()
+
+	assert.NoError(t, db.Ping(ctx))
+	assert.Equal(t, 0, db.state.details()["reconnections"])
+	assert.Contains(t, db.state.details(), "connected_since")
+
+	db.state.down(errors.New("connection reset"))
+	assert.Contains(t, db.state.details(), "disconnected_since")
+
+	assert.NoError(t, db.Ping(ctx))
+	assert.Equal(t, 1, db.state.details()["reconnections"])
+	assert.Contains(t, db.state.details(), "connected_since")
+
+	// A closed pool cannot reconnect
+	require.NoError(t, db.Close())
+	assert.Error(t, db.Ping(ctx))
+	assert.Contains(t, db.state.details(), "disconnected_since")
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"library/health"
+	"library/migrations"
+)
+
+// Names of the health checks of the database
+const (
+	CheckDatabase   = "database"
+	CheckMigrations = "migrations"
+	CheckPool       = "pool"
+	CheckReplicas   = "replicas"
+)
+
+// RegisterChecks adds the health checks of the database to the server: that
+// it answers, that its schema is migrated, that its connection pool is not
+// saturated, and which of its read replicas are in the rotation, if any.
+func (db *Database) RegisterChecks(h *health.Health) {
+	h.Register(CheckDatabase, db.checkDatabase)
+	h.Register(CheckMigrations, db.checkMigrations)
+	h.Register(CheckPool, db.checkPool)
+	if len(db.replicas.replicas) > 0 {
+		h.Register(CheckReplicas, db.checkReplicas)
+	}
+}
+
+// checkDatabase pings the database, and reports since when it is connected
+// or not, and how many times it reconnected.
+func (db *Database) checkDatabase(ctx context.Context) (map[string]any, error) {
+	err := db.Ping(ctx)
+	details := db.state.details()
+	details["driver"] = db.DB.Dialector.Name()
+	return details, err
+}
+
+// checkMigrations fails while migrations are pending, and reports the
+// migrations modified since applied, or applied by a newer release, as
+// degraded.
+func (db *Database) checkMigrations(ctx context.Context) (map[string]any, error) {
+	migrator, err := migrations.New(db.DB)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := migrator.Current(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the applied migrations: %w", err)
+	}
+
+	var version int64
+	pending, other := false, false
+	for _, status := range statuses {
+		switch {
+		case status.Unknown || status.Modified:
+			other = true
+		case !status.Applied:
+			pending = true
+		}
+		if status.Applied && status.Version > version {
+			version = status.Version
+		}
+	}
+	state := migrations.State(statuses)
+	details := map[string]any{"version": version, "state": state}
+	switch {
+	case pending:
+		return details, fmt.Errorf("migrations are %s", state)
+	case other:
+		return details, health.Degraded(fmt.Errorf("migrations are %s", state))
+	}
+	return details, nil
+}
+
+// checkPool reports the pool as degraded once all its connections are in
+// use, as the requests then wait for one.
+func (db *Database) checkPool(ctx context.Context) (map[string]any, error) {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	stats := sqlDB.Stats()
+	details := map[string]any{
+		"max_open":         stats.MaxOpenConnections,
+		"open":             stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"idle":             stats.Idle,
+		"wait_count":       stats.WaitCount,
+		"wait_duration_ms": stats.WaitDuration.Milliseconds(),
+	}
+	if stats.MaxOpenConnections > 0 {
+		details["saturation"] = float64(stats.InUse) / float64(stats.MaxOpenConnections)
+		if stats.InUse >= stats.MaxOpenConnections {
+			return details, health.Degraded(fmt.Errorf("%d of %d connections are in use", stats.InUse, stats.MaxOpenConnections))
+		}
+	}
+	return details, nil
+}
+
+// checkReplicas reports the use of every replica, degraded while some are
+// out of the rotation, as the others, or the primary, serve their reads.
+func (db *Database) checkReplicas(ctx context.Context) (map[string]any, error) {
+	stats := db.ReplicaStats()
+	ejected := 0
+	for _, replica := range stats {
+		if !replica.InRotation {
+			ejected++
+		}
+	}
+	details := map[string]any{"replicas": stats}
+	if ejected > 0 {
+		return details, health.Degraded(fmt.Errorf("%d of %d replicas are out of the rotation", ejected, len(stats)))
+	}
+	return details, nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"library/health"
+	"library/migrations"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthChecks(t *testing.T) {
+	db := SetupTest(t)
+	defer func() {
+		assert.NoError(t, db.Teardown())
+	}()
+	ctx := context.Background()
+
+	status := health.New(time.Second)
+	db.RegisterChecks(status)
+	report := status.Check(ctx)
+	assert.Equal(t, health.StatusOK, report.Status)
+	for _, name := range []string{CheckDatabase, CheckMigrations, CheckPool} {
+		assert.Equal(t, health.StatusUp, report.Dependencies[name].Status, name)
+	}
+	assert.Equal(t, "up to date", report.Dependencies[CheckMigrations].Details["state"])
+
+	// A schema behind the binary is not ready
+	migrator, err := migrations.New(db.DB)
+	require.NoError(t, err)
+	_, err = migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	report = status.Check(ctx)
+	assert.Equal(t, health.StatusFailing, report.Status)
+	assert.Equal(t, health.StatusDown, report.Dependencies[CheckMigrations].Status)
+	assert.Equal(t, "migrations are 1 pending", report.Dependencies[CheckMigrations].Error)
+	require.NoError(t, db.Migrate(ctx))
+}
+
+func TestPoolSaturation(t *testing.T) {
+	db := SetupTest(t)
+	defer func() {
+		assert.NoError(t, db.Teardown())
+	}()
+	ctx := context.Background()
+
+	sqlDB, err := db.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	_, err = db.checkPool(ctx)
+	assert.NoError(t, err)
+
+	// Hold the only connection
+	conn, err := sqlDB.Conn(ctx)
+	require.NoError(t, err)
+	details, err := db.checkPool(ctx)
+	assert.ErrorContains(t, err, "1 of 1 connections are in use")
+	assert.Equal(t, 1.0, details["saturation"])
+	require.NoError(t, conn.Close())
+}
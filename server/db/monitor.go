@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"log/slog"
+)
+
+// connectionState tracks whether the database is reachable, from the result
+// of the pings, to report when the connection is lost and restored.
+type connectionState struct {
+	mutex sync.Mutex
+	// connected is set while the last ping succeeded, since since
+	connected     bool
+	since         time.Time
+	lastError     error
+	reconnections int
+}
+
+// up records that the database is reachable.
+func (s *connectionState) up() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now().UTC()
+	switch {
+	case s.since.IsZero():
+		s.connected, s.since = true, now
+	case !s.connected:
+		slog.Info("Reconnected to the database.", "downtime", now.Sub(s.since).Round(time.Millisecond))
+		s.connected, s.since, s.lastError = true, now, nil
+		s.reconnections++
+	}
+}
+
+// down records that the database cannot be reached.
+func (s *connectionState) down(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.connected {
+		slog.Error("Lost the connection to the database.", "error", err)
+		s.connected, s.since = false, time.Now().UTC()
+	}
+	s.lastError = err
+}
+
+// details describes the state of the connection, for the health checks.
+func (s *connectionState) details() map[string]any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	details := map[string]any{"reconnections": s.reconnections}
+	if s.connected {
+		details["connected_since"] = s.since
+	} else if !s.since.IsZero() {
+		details["disconnected_since"] = s.since
+	}
+	return details
+}
+
+// Ping checks that the database is reachable, reporting in the logs when the
+// connection is lost and restored.
+func (db *Database) Ping(ctx context.Context) error {
+	sqlDB, err := db.DB.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		db.state.down(err)
+		return err
+	}
+	db.state.up()
+	return nil
+}
+
+// Monitor pings the database and its replicas every interval until ctx is
+// done, so that a lost connection is reported even when no request needs it,
+// and the ejected replicas return to the rotation once they answer.
+func (db *Database) Monitor(ctx context.Context, interval, timeout time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			db.Ping(pingCtx)
+			db.pingReplicas(pingCtx)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"library/config"
+	"library/repository"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// replicaPingTimeout bounds the first ping of a replica, when connecting.
+const replicaPingTimeout = 2 * time.Second
+
+// ReplicaStats describes the use of a read replica.
+type ReplicaStats struct {
+	Host       string `json:"host"`
+	InRotation bool   `json:"in_rotation"`
+	// Reads counts the queries it served, of which Failures failed
+	Reads     int64      `json:"reads"`
+	Failures  int64      `json:"failures"`
+	Ejections int64      `json:"ejections"`
+	EjectedAt *time.Time `json:"ejected_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// replica is a read-only copy of the primary database. It is ejected from
+// the rotation once a query or a ping fails, and returns to it once a ping
+// succeeds.
+type replica struct {
+	host string
+	db   *gorm.DB
+
+	mutex     sync.Mutex
+	ejected   bool
+	ejectedAt time.Time
+	lastError error
+	reads     int64
+	failures  int64
+	ejections int64
+}
+
+// replicaSet routes the reads to the replicas in turn.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	// window is how long the reads of a client go to the primary after it
+	// writes, as the replicas may not have applied the write yet
+	window time.Duration
+
+	writesMutex sync.Mutex
+	// writes holds the time of the last write of every client, those older
+	// than the window pruned once in a window
+	writes   map[string]time.Time
+	prunedAt time.Time
+}
+
+// openReplicas connects to the read replicas of the configuration. Those
+// that cannot be reached yet start out of the rotation.
+func (db *Database) openReplicas(cfg *config.DatabaseConfig) error {
+	db.replicas.window = cfg.ReadYourWrites
+	if len(cfg.Replicas) == 0 {
+		return nil
+	}
+	if err := db.replicas.trackWrites(db.DB); err != nil {
+		return err
+	}
+
+	for _, address := range cfg.Replicas {
+		replicaCfg := *cfg
+		var err error
+		replicaCfg.Host, replicaCfg.Port, err = splitHostPort(address, cfg.Port)
+		if err != nil {
+			return err
+		}
+		dialector, err := db.postgres(&replicaCfg)
+		if err != nil {
+			return err
+		}
+		replicaDB, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			return fmt.Errorf("failed to open the read replica %s: %w", address, err)
+		}
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			return err
+		}
+		configurePool(sqlDB, cfg)
+
+		r, err := db.replicas.add(address, replicaDB)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), replicaPingTimeout)
+		if err := r.ping(ctx); err == nil {
+			slog.Info("Connected to a read replica.", "host", address)
+		}
+		cancel()
+	}
+	return nil
+}
+
+// splitHostPort parses the address of a replica, as host or host:port.
+func splitHostPort(address string, defaultPort int) (string, int, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		// No port
+		return address, defaultPort, nil
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in the read replica %q", address)
+	}
+	return host, port, nil
+}
+
+// trackWrites records the time of the writes to the primary, by the client
+// of their context.
+func (s *replicaSet) trackWrites(primary *gorm.DB) error {
+	wrote := func(tx *gorm.DB) {
+		if tx.Error == nil {
+			s.wrote(repository.ClientOf(tx.Statement.Context), time.Now())
+		}
+	}
+	callbacks := primary.Callback()
+	return errors.Join(
+		callbacks.Create().After("gorm:create").Register("library:track_writes", wrote),
+		callbacks.Update().After("gorm:update").Register("library:track_writes", wrote),
+		callbacks.Delete().After("gorm:delete").Register("library:track_writes", wrote),
+	)
+}
+
+// add puts a replica in the rotation, observing the result of its queries.
+func (s *replicaSet) add(host string, replicaDB *gorm.DB) (*replica, error) {
+	r := &replica{host: host, db: replicaDB}
+	observe := func(tx *gorm.DB) { r.observe(tx.Error) }
+	callbacks := replicaDB.Callback()
+	err := errors.Join(
+		callbacks.Query().After("gorm:query").Register("library:observe_replica", observe),
+		callbacks.Row().After("gorm:row").Register("library:observe_replica", observe),
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.replicas = append(s.replicas, r)
+	return r, nil
+}
+
+// wrote records a write of a client.
+func (s *replicaSet) wrote(client string, now time.Time) {
+	s.writesMutex.Lock()
+	defer s.writesMutex.Unlock()
+	if s.writes == nil {
+		s.writes = map[string]time.Time{}
+	}
+	if now.Sub(s.prunedAt) >= s.window {
+		for other, at := range s.writes {
+			if now.Sub(at) >= s.window {
+				delete(s.writes, other)
+			}
+		}
+		s.prunedAt = now
+	}
+	s.writes[client] = now
+}
+
+// recentWrite reports whether a client wrote to the primary within the
+// window, the other clients reading from the replicas meanwhile.
+func (s *replicaSet) recentWrite(client string) bool {
+	s.writesMutex.Lock()
+	defer s.writesMutex.Unlock()
+	at, ok := s.writes[client]
+	return ok && time.Since(at) < s.window
+}
+
+// Reader returns the database serving a read: the next replica in the
+// rotation, or the primary when none is, or right after a write of the
+// client of the context.
+func (db *Database) Reader(ctx context.Context) *gorm.DB {
+	s := db.replicas
+	if len(s.replicas) == 0 || s.recentWrite(repository.ClientOf(ctx)) {
+		return db.DB
+	}
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		r := s.replicas[(start+uint64(i))%uint64(len(s.replicas))]
+		if r.inRotation() {
+			return r.db
+		}
+	}
+	return db.DB
+}
+
+// ReplicaStats describes the use of every read replica.
+func (db *Database) ReplicaStats() []ReplicaStats {
+	stats := make([]ReplicaStats, len(db.replicas.replicas))
+	for i, r := range db.replicas.replicas {
+		stats[i] = r.stats()
+	}
+	return stats
+}
+
+// pingReplicas pings every replica, returning those that answer to the
+// rotation.
+func (db *Database) pingReplicas(ctx context.Context) {
+	for _, r := range db.replicas.replicas {
+		r.ping(ctx)
+	}
+}
+
+func (r *replica) inRotation() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return !r.ejected
+}
+
+// observe counts a query of the replica, ejecting it when it failed. The
+// missing records and the canceled queries are not failures of the replica.
+func (r *replica) observe(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reads++
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	r.failures++
+	r.eject(err)
+}
+
+// eject takes the replica out of the rotation, with the mutex held.
+func (r *replica) eject(err error) {
+	r.lastError = err
+	if r.ejected {
+		return
+	}
+	slog.Warn("Ejected a read replica from the rotation.", "host", r.host, "error", err)
+	r.ejected, r.ejectedAt = true, time.Now().UTC()
+	r.ejections++
+}
+
+// ping checks the replica, ejecting it when it does not answer, and
+// returning it to the rotation when it does.
+func (r *replica) ping(ctx context.Context) error {
+	sqlDB, err := r.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err != nil {
+		r.eject(err)
+		return err
+	}
+	if r.ejected {
+		slog.Info("Returned a read replica to the rotation.", "host", r.host, "downtime", time.Since(r.ejectedAt).Round(time.Millisecond))
+		r.ejected = false
+	}
+	return nil
+}
+
+func (r *replica) stats() ReplicaStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stats := ReplicaStats{
+		Host:       r.host,
+		InRotation: !r.ejected,
+		Reads:      r.reads,
+		Failures:   r.failures,
+		Ejections:  r.ejections,
+	}
+	if r.ejected {
+		ejectedAt := r.ejectedAt
+		stats.EjectedAt = &ejectedAt
+	}
+	if r.lastError != nil {
+		stats.LastError = r.lastError.Error()
+	}
+	return stats
+}
+
+func (r *replica) close() error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"library/config"
+	"library/models"
+	"library/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openMemory returns a migrated in-memory SQLite database holding n books.
+func openMemory(t *testing.T, n int) Database {
+	db := New()
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSQLite
+	require.NoError(t, db.Connect(&cfg))
+	t.Cleanup(func() { db.Close() })
+	for i := 0; i < n; i++ {
+		require.NoError(t, db.DB.Create(&models.Book{Title: "Dune", Author: "Frank Herbert"}).Error)
+	}
+	return db
+}
+
+func TestReplicas(t *testing.T) {
+	ctx := context.Background()
+	// Each database holds a different number of books, to tell which one
+	// served a count
+	db := openMemory(t, 0)
+	replicas := []Database{openMemory(t, 1), openMemory(t, 2)}
+	db.replicas.window = time.Hour
+	require.NoError(t, db.replicas.trackWrites(db.DB))
+	for i, replica := range replicas {
+		_, err := db.replicas.add([]string{"replica-1", "replica-2"}[i], replica.DB)
+		require.NoError(t, err)
+	}
+	books := repository.NewReplicatedGORM(db.DB, db.Reader)
+	count := func() int64 {
+		count, err := books.Count(ctx, repository.Filter{})
+		require.NoError(t, err)
+		return count
+	}
+
+	// The replicas serve the reads in turn
+	first := count()
+	assert.Contains(t, []int64{1, 2}, first)
+	assert.Equal(t, 3-first, count())
+	assert.Equal(t, first, count())
+
+	// A replica failing a query leaves the rotation, until a ping succeeds
+	require.NoError(t, replicas[0].DB.Exec("DROP TABLE books").Error)
+	for i := 0; i < 3; i++ {
+		// The read failing on the replica is an error
+		books.Count(ctx, repository.Filter{})
+	}
+	assert.Equal(t, int64(2), count())
+	assert.Equal(t, int64(2), count())
+	stats := db.ReplicaStats()
+	assert.False(t, stats[0].InRotation)
+	assert.Equal(t, int64(1), stats[0].Ejections)
+	assert.Equal(t, int64(1), stats[0].Failures)
+	assert.Contains(t, stats[0].LastError, "books")
+	assert.True(t, stats[1].InRotation)
+
+	details, err := db.checkReplicas(ctx)
+	assert.ErrorContains(t, err, "1 of 2 replicas are out of the rotation")
+	assert.Len(t, details["replicas"], 2)
+
+	db.pingReplicas(ctx)
+	assert.True(t, db.ReplicaStats()[0].InRotation)
+
+	// The reads go to the primary after a write, and those of the write itself
+	book := models.Book{Title: "Emma", Author: "Jane Austen"}
+	require.NoError(t, books.Create(ctx, &book))
+	assert.Equal(t, int64(1), count())
+	_, err = books.Patch(ctx, book.ID, map[string]interface{}{"edition": 2})
+	assert.NoError(t, err, "the book is not on the replicas")
+}
+
+func TestReadYourWrites(t *testing.T) {
+	ctx := context.Background()
+	db := openMemory(t, 0)
+	db.replicas.window = time.Hour
+	require.NoError(t, db.replicas.trackWrites(db.DB))
+	_, err := db.replicas.add("replica", openMemory(t, 2).DB)
+	require.NoError(t, err)
+	books := repository.NewReplicatedGORM(db.DB, db.Reader)
+	count := func(ctx context.Context) int64 {
+		count, err := books.Count(ctx, repository.Filter{})
+		require.NoError(t, err)
+		return count
+	}
+
+	// The reads of a client go to the primary after its write, while the
+	// other clients keep reading the replica
+	writer, other := repository.WithClient(ctx, "api_key:1"), repository.WithClient(ctx, "ip:192.0.2.1")
+	assert.Equal(t, int64(2), count(writer))
+	require.NoError(t, books.Create(writer, &models.Book{Title: "Emma", Author: "Jane Austen"}))
+	assert.Equal(t, int64(1), count(writer))
+	assert.Equal(t, int64(2), count(other))
+	assert.Equal(t, int64(2), count(ctx))
+
+	// Until the window passes
+	db.replicas.writes["api_key:1"] = time.Now().Add(-time.Hour)
+	assert.Equal(t, int64(2), count(writer))
+}
+
+func TestSplitHostPort(t *testing.T) {
+	testCases := []struct {
+		Address string
+		Host    string
+		Port    int
+		Err     bool
+	}{
+		{Address: "replica", Host: "replica", Port: 5432},
+		{Address: "replica:6543", Host: "replica", Port: 6543},
+		{Address: "[::1]:6543", Host: "::1", Port: 6543},
+		{Address: "replica:http", Err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Address, func(t *testing.T) {
+			host, port, err := splitHostPort(tc.Address, 5432)
+			if tc.Err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Host, host)
+			assert.Equal(t, tc.Port, port)
+		})
+	}
+}
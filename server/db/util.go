@@ -22,7 +22,7 @@ func SetupTest(t *testing.T) Database {
 	// Load config
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(contextTimeout*time.Second))
 	defer cancel()
-	cfg, err := config.Load(ctx)
+	cfg, err := config.Load(ctx, config.Sources{})
 	assert.NoError(t, err)
 	assert.NotZero(t, cfg.Database.Port)
 	assert.NotZero(t, cfg.Server.Port)
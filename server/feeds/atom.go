@@ -0,0 +1,77 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"library/models"
+	"time"
+)
+
+// AtomFeed is an Atom 1.0 feed.
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+// AtomEntry is an entry of an Atom feed.
+type AtomEntry struct {
+	ID        string        `xml:"id"`
+	Title     string        `xml:"title"`
+	Updated   string        `xml:"updated"`
+	Published string        `xml:"published"`
+	Author    AtomPerson    `xml:"author"`
+	Category  *AtomCategory `xml:"category,omitempty"`
+	Summary   string        `xml:"summary,omitempty"`
+	Links     []AtomLink    `xml:"link"`
+}
+
+// AtomLink is an Atom link.
+type AtomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// AtomPerson is an Atom person construct.
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+// AtomCategory is an Atom category.
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Atom renders books as an Atom feed, updated when its newest entry was.
+func (c Channel) Atom(books []models.Book, updated time.Time) AtomFeed {
+	feed := AtomFeed{
+		ID:      c.ID,
+		Title:   c.Title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []AtomLink{
+			{Rel: "self", Href: c.Self, Type: "application/atom+xml"},
+			{Rel: "alternate", Href: c.Link, Type: "application/json"},
+		},
+	}
+
+	for _, book := range books {
+		entry := AtomEntry{
+			ID:        bookID(book),
+			Title:     book.Title,
+			Updated:   book.UpdatedAt.UTC().Format(time.RFC3339),
+			Published: book.CreatedAt.UTC().Format(time.RFC3339),
+			Author:    AtomPerson{Name: book.Author},
+			Summary:   book.Description,
+			Links:     []AtomLink{{Rel: "alternate", Href: c.BookURL(book.ID), Type: "application/json"}},
+		}
+		if book.GenreName != "" {
+			entry.Category = &AtomCategory{Term: book.GenreName}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
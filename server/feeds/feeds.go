@@ -0,0 +1,41 @@
+// Package feeds renders lists of books as Atom 1.0 and RSS 2.0 syndication
+// feeds.
+package feeds
+
+import (
+	"library/models"
+	"strconv"
+	"time"
+)
+
+// Channel describes a feed independently of its syndication format.
+type Channel struct {
+	ID          string
+	Title       string
+	Description string
+	// Link is the absolute URL of the page the feed summarises and Self the
+	// absolute URL of the feed itself.
+	Link string
+	Self string
+	// BookURL returns the absolute URL of a book.
+	BookURL func(id uint) string
+}
+
+// Updated returns the time the most recently changed book was updated, or
+// fallback when there are no books.
+func Updated(books []models.Book, fallback time.Time) time.Time {
+	updated := time.Time{}
+	for _, book := range books {
+		if book.UpdatedAt.After(updated) {
+			updated = book.UpdatedAt
+		}
+	}
+	if updated.IsZero() {
+		return fallback
+	}
+	return updated
+}
+
+func bookID(book models.Book) string {
+	return "urn:library:book:" + strconv.FormatUint(uint64(book.ID), 10)
+}
@@ -0,0 +1,72 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"library/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func testChannel() Channel {
+	return Channel{
+		ID:          "urn:library:feeds:new",
+		Title:       "New arrivals",
+		Description: "Books recently added",
+		Link:        "http://localhost/api/v1/books",
+		Self:        "http://localhost/feeds/new.atom",
+		BookURL: func(id uint) string {
+			return "http://localhost/api/v1/books/" + strconv.FormatUint(uint64(id), 10)
+		},
+	}
+}
+
+func testBooks() []models.Book {
+	created := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	return []models.Book{
+		{Model: gorm.Model{ID: 2, CreatedAt: created.Add(time.Hour), UpdatedAt: created.Add(2 * time.Hour)}, Title: "Dune", Author: "Frank Herbert", GenreName: "Science Fiction"},
+		{Model: gorm.Model{ID: 1, CreatedAt: created, UpdatedAt: created}, Title: "The Hobbit", Author: "J.R.R. Tolkien"},
+	}
+}
+
+func TestUpdated(t *testing.T) {
+	fallback := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC), Updated(testBooks(), fallback))
+	assert.Equal(t, fallback, Updated(nil, fallback))
+}
+
+func TestAtom(t *testing.T) {
+	books := testBooks()
+	feed := testChannel().Atom(books, Updated(books, time.Time{}))
+
+	assert.Equal(t, "2023-09-01T12:00:00Z", feed.Updated)
+	assert.Len(t, feed.Entries, 2)
+	assert.Equal(t, "urn:library:book:2", feed.Entries[0].ID)
+	assert.Equal(t, "2023-09-01T11:00:00Z", feed.Entries[0].Published)
+	assert.Equal(t, "Science Fiction", feed.Entries[0].Category.Term)
+	assert.Nil(t, feed.Entries[1].Category)
+	assert.Equal(t, "http://localhost/api/v1/books/1", feed.Entries[1].Links[0].Href)
+
+	output, err := xml.Marshal(feed)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(output), `<feed xmlns="http://www.w3.org/2005/Atom">`))
+}
+
+func TestRSS(t *testing.T) {
+	books := testBooks()
+	document := testChannel().RSS(books, Updated(books, time.Time{}))
+
+	assert.Equal(t, "Fri, 01 Sep 2023 12:00:00 +0000", document.Channel.LastBuildDate)
+	assert.Len(t, document.Channel.Items, 2)
+	assert.Equal(t, "Fri, 01 Sep 2023 11:00:00 +0000", document.Channel.Items[0].PubDate)
+
+	output, err := xml.Marshal(document)
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), `<dc:creator>Frank Herbert</dc:creator>`)
+	assert.Contains(t, string(output), `<guid isPermaLink="false">urn:library:book:2</guid>`)
+	assert.Contains(t, string(output), `<atom:link rel="self" href="http://localhost/feeds/new.atom" type="application/rss+xml"></atom:link>`)
+}
@@ -0,0 +1,80 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"library/models"
+	"time"
+)
+
+// RSS is an RSS 2.0 document.
+type RSS struct {
+	XMLName       xml.Name   `xml:"rss"`
+	Version       string     `xml:"version,attr"`
+	AtomNamespace string     `xml:"xmlns:atom,attr"`
+	DCNamespace   string     `xml:"xmlns:dc,attr"`
+	Channel       RSSChannel `xml:"channel"`
+}
+
+// RSSChannel is the channel of an RSS document.
+type RSSChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	LastBuildDate string      `xml:"lastBuildDate"`
+	AtomLink      RSSAtomLink `xml:"atom:link"`
+	Items         []RSSItem   `xml:"item"`
+}
+
+// RSSAtomLink points an RSS channel to its own URL.
+type RSSAtomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// RSSItem is an item of an RSS channel.
+type RSSItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        RSSGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"dc:creator"`
+	Category    string  `xml:"category,omitempty"`
+	Description string  `xml:"description,omitempty"`
+}
+
+// RSSGUID uniquely identifies an item.
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS renders books as an RSS 2.0 feed, last built when its newest item was updated.
+func (c Channel) RSS(books []models.Book, updated time.Time) RSS {
+	document := RSS{
+		Version:       "2.0",
+		AtomNamespace: "http://www.w3.org/2005/Atom",
+		DCNamespace:   "http://purl.org/dc/elements/1.1/",
+		Channel: RSSChannel{
+			Title:         c.Title,
+			Link:          c.Link,
+			Description:   c.Description,
+			LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+			AtomLink:      RSSAtomLink{Rel: "self", Href: c.Self, Type: "application/rss+xml"},
+		},
+	}
+
+	for _, book := range books {
+		document.Channel.Items = append(document.Channel.Items, RSSItem{
+			Title:       book.Title,
+			Link:        c.BookURL(book.ID),
+			GUID:        RSSGUID{Value: bookID(book)},
+			PubDate:     book.CreatedAt.UTC().Format(time.RFC1123Z),
+			Creator:     book.Author,
+			Category:    book.GenreName,
+			Description: book.Description,
+		})
+	}
+
+	return document
+}
@@ -0,0 +1,291 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"library/models"
+	"library/repository"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore is an in-memory repository counting the calls made to each
+// of its methods.
+type countingStore struct {
+	repository.BookRepository
+	calls map[string]int
+	// pages are the options of the searches
+	pages []repository.ListOptions
+}
+
+func newMemoryStore() *countingStore {
+	store := &countingStore{BookRepository: repository.NewMemory(), calls: map[string]int{}}
+	for _, book := range []models.Book{
+		{Title: "The Hobbit", Author: "J.R.R. Tolkien", GenreName: "Fantasy", Edition: 1},
+		{Title: "The Lord of the Rings", Author: "J.R.R. Tolkien", GenreName: "Fantasy", Edition: 1},
+		{Title: "Dune", Author: "Frank Herbert", GenreName: "Science Fiction", Edition: 1},
+		{Title: "Children of Dune", Author: "Frank Herbert", GenreName: "Science Fiction", Edition: 1},
+		{Title: "Foundation", Author: "Isaac Asimov", GenreName: "Science Fiction", Edition: 1},
+	} {
+		_ = store.BookRepository.Create(context.Background(), &book)
+	}
+	return store
+}
+
+func (c *countingStore) Get(ctx context.Context, id uint) (models.Book, error) {
+	c.calls["Get"]++
+	return c.BookRepository.Get(ctx, id)
+}
+
+func (c *countingStore) Search(ctx context.Context, filter repository.Filter, options repository.ListOptions) ([]models.Book, error) {
+	c.calls["Search"]++
+	c.pages = append(c.pages, options)
+	return c.BookRepository.Search(ctx, filter, options)
+}
+
+func (c *countingStore) Count(ctx context.Context, filter repository.Filter) (int64, error) {
+	c.calls["Count"]++
+	return c.BookRepository.Count(ctx, filter)
+}
+
+func (c *countingStore) Groups(ctx context.Context, field repository.Field, filter repository.Filter) ([]repository.Group, error) {
+	c.calls["Groups"]++
+	return c.BookRepository.Groups(ctx, field, filter)
+}
+
+func (c *countingStore) size(t *testing.T) int64 {
+	count, err := c.BookRepository.Count(context.Background(), repository.Filter{})
+	assert.NoError(t, err)
+	return count
+}
+
+func execute(t *testing.T, store repository.BookRepository, query string, variables map[string]interface{}, mutations bool) *graphql.Result {
+	server, err := NewServer(6, 500)
+	assert.NoError(t, err)
+	authorize := func(mutation string) error {
+		if !mutations {
+			return errors.New("Mutations must be sent with POST")
+		}
+		return nil
+	}
+	result, _ := server.Do(context.Background(), store, Request{Query: query, Variables: variables}, authorize)
+	return result
+}
+
+// decode converts the data of a result to JSON and back into v.
+func decode(t *testing.T, result *graphql.Result, v interface{}) {
+	assert.Empty(t, result.Errors)
+	data, err := json.Marshal(result.Data)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, v))
+}
+
+func TestQueryBooks(t *testing.T) {
+	store := newMemoryStore()
+	result := execute(t, store, `{
+		books(genre: "Science Fiction", limit: 2) { id title }
+		count(genre: "Science Fiction")
+		book(id: "1") { title genre { name bookCount } }
+		missing: book(id: "42") { title }
+	}`, nil, false)
+
+	var data struct {
+		Books []struct {
+			ID    string
+			Title string
+		}
+		Count int
+		Book  struct {
+			Title string
+			Genre struct {
+				Name      string
+				BookCount int
+			}
+		}
+		Missing *struct{}
+	}
+	decode(t, result, &data)
+	assert.Len(t, data.Books, 2)
+	assert.Equal(t, "3", data.Books[0].ID)
+	assert.Equal(t, 3, data.Count)
+	assert.Equal(t, "The Hobbit", data.Book.Title)
+	assert.Equal(t, "Fantasy", data.Book.Genre.Name)
+	assert.Equal(t, 2, data.Book.Genre.BookCount)
+	assert.Nil(t, data.Missing)
+}
+
+func TestNestedRelationsAreBatched(t *testing.T) {
+	store := newMemoryStore()
+	result := execute(t, store, `{
+		books { title byAuthor { title } genre { name bookCount books(limit: 1) { title } } }
+		first: book(id: "1") { title }
+		second: book(id: "2") { title }
+	}`, nil, false)
+
+	var data struct {
+		Books []struct {
+			Title    string
+			ByAuthor []struct{ Title string }
+		}
+	}
+	decode(t, result, &data)
+	assert.Len(t, data.Books, 5)
+	assert.Equal(t, "The Lord of the Rings", data.Books[0].ByAuthor[0].Title)
+	assert.Empty(t, data.Books[4].ByAuthor)
+
+	// One fetch per relation, however many books were resolved: the list,
+	// the books by ID, by author and by genre, and the genre counts
+	assert.Equal(t, map[string]int{"Search": 4, "Groups": 1}, store.calls)
+}
+
+func TestNestedPages(t *testing.T) {
+	store := newMemoryStore()
+	_ = store.BookRepository.Create(context.Background(), &models.Book{Title: "Dune Messiah", Author: "Frank Herbert", GenreName: "Science Fiction", Edition: 1})
+	result := execute(t, store, `{
+		books(genre: "Science Fiction") { title byAuthor(limit: 1, offset: 1) { title } genre { books(limit: 1, offset: 2) { title } } }
+	}`, nil, false)
+
+	var data struct {
+		Books []struct {
+			Title    string
+			ByAuthor []struct{ Title string }
+			Genre    struct{ Books []struct{ Title string } }
+		}
+	}
+	decode(t, result, &data)
+	byAuthor := map[string][]struct{ Title string }{}
+	for _, book := range data.Books {
+		byAuthor[book.Title] = book.ByAuthor
+		assert.Equal(t, []struct{ Title string }{{"Foundation"}}, book.Genre.Books)
+	}
+	assert.Equal(t, []struct{ Title string }{{"Dune Messiah"}}, byAuthor["Dune"], "past the book itself")
+	assert.Equal(t, []struct{ Title string }{{"Dune Messiah"}}, byAuthor["Children of Dune"])
+	assert.Equal(t, []struct{ Title string }{{"Children of Dune"}}, byAuthor["Dune Messiah"])
+	assert.Empty(t, byAuthor["Foundation"])
+
+	// The pages are loaded rather than every book of the authors and genres
+	for _, page := range store.pages[1:] {
+		assert.NotEmpty(t, page.Per)
+		assert.LessOrEqual(t, page.Limit, 2)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Query       string
+		Variables   map[string]interface{}
+		Error       string
+	}{
+		{Description: "Too Deep", Query: `{ books { byAuthor { byAuthor { byAuthor { byAuthor { byAuthor { title } } } } } } }`, Error: "Query depth 7 exceeds the maximum of 6"},
+		{Description: "Too Complex", Query: `{ books(limit: 100) { title byAuthor(limit: 10) { title } } }`, Error: "Query complexity 1201 exceeds the maximum of 500"},
+		{Description: "Too Complex With Variables", Query: `query($n: Int) { genres { books(limit: $n) { title byAuthor { title } } } }`, Variables: map[string]interface{}{"n": float64(100)}, Error: "Query complexity"},
+		{Description: "Too Complex With Fragments", Query: `{ books(limit: 50) { ...details } } fragment details on Book { byAuthor(limit: 50) { title } }`, Error: "Query complexity"},
+		{Description: "Negative Limit", Query: `{ free: books(limit: -1) { byAuthor(limit: 100) { byAuthor(limit: 100) { title } } } books(limit: 100) { byAuthor(limit: 100) { title } } }`, Error: "Query complexity 10102 exceeds the maximum of 500"},
+		{Description: "Negative Limit With Variables", Query: `query($n: Int) { free: books(limit: $n) { byAuthor(limit: 100) { byAuthor(limit: 100) { title } } } books(limit: 100) { byAuthor(limit: 100) { title } } }`, Variables: map[string]interface{}{"n": float64(-1)}, Error: "Query complexity"},
+		{Description: "Limit Above Maximum", Query: `{ books(limit: 101) { title } }`, Error: "limit must be between 0 and 100"},
+		{Description: "Invalid Date", Query: `{ count(from: "yesterday") }`, Error: "invalid date"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			result := execute(t, newMemoryStore(), tc.Query, tc.Variables, false)
+			assert.NotEmpty(t, result.Errors)
+			assert.Contains(t, result.Errors[0].Message, tc.Error)
+		})
+	}
+}
+
+func TestIntrospectionIsNotLimited(t *testing.T) {
+	result := execute(t, newMemoryStore(), `{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name } } } } } } } }`, nil, false)
+	assert.Empty(t, result.Errors)
+}
+
+func TestMutations(t *testing.T) {
+	store := newMemoryStore()
+
+	t.Run("Rejected Without Permission", func(t *testing.T) {
+		result := execute(t, store, `mutation { deleteBook(id: "1") }`, nil, false)
+		assert.Nil(t, result.Data)
+		assert.Contains(t, result.Errors[0].Message, "POST")
+	})
+
+	t.Run("Add", func(t *testing.T) {
+		result := execute(t, store, `mutation($book: BookInput!) { addBook(input: $book) { id title published } }`, map[string]interface{}{
+			"book": map[string]interface{}{"title": "Emma", "author": "Jane Austen", "edition": 1, "published": "1815-12-23T00:00:00Z"},
+		}, true)
+		var data struct {
+			AddBook struct {
+				ID        string
+				Title     string
+				Published time.Time
+			}
+		}
+		decode(t, result, &data)
+		assert.Equal(t, "6", data.AddBook.ID)
+		assert.Equal(t, 1815, data.AddBook.Published.Year())
+	})
+
+	t.Run("Invalid Add", func(t *testing.T) {
+		result := execute(t, store, `mutation { addBook(input: {title: "Emma", author: "Jane Austen", edition: 0}) { id } }`, nil, true)
+		assert.NotEmpty(t, result.Errors)
+		assert.Equal(t, int64(6), store.size(t))
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		result := execute(t, store, `mutation { updateBook(id: "6", input: {title: "Emma", author: "Jane Austen", edition: 2}) { edition } }`, nil, true)
+		var data struct{ UpdateBook struct{ Edition int } }
+		decode(t, result, &data)
+		assert.Equal(t, 2, data.UpdateBook.Edition)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		result := execute(t, store, `mutation { patchBook(id: "6", input: {title: "Emma: A Novel"}) { title author edition } }`, nil, true)
+		var data struct {
+			PatchBook struct{ Title, Author string }
+		}
+		decode(t, result, &data)
+		assert.Equal(t, "Emma: A Novel", data.PatchBook.Title)
+		assert.Equal(t, "Jane Austen", data.PatchBook.Author)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		result := execute(t, store, `mutation { deleteBook(id: "6") }`, nil, true)
+		assert.Empty(t, result.Errors)
+		assert.Equal(t, int64(5), store.size(t))
+
+		result = execute(t, store, `mutation { deleteBook(id: "6") }`, nil, true)
+		assert.Contains(t, result.Errors[0].Message, repository.ErrNotFound.Error())
+	})
+}
+
+func TestLoader(t *testing.T) {
+	fetches := 0
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		fetches++
+		values := map[int]int{}
+		for _, key := range keys {
+			values[key] = key * key
+		}
+		return values, nil
+	})
+
+	ctx := context.Background()
+	two, three := loader.Load(ctx, 2), loader.Load(ctx, 3)
+	value, err := three()
+	assert.NoError(t, err)
+	assert.Equal(t, 9, value)
+	value, _ = two()
+	assert.Equal(t, 4, value)
+	value, _ = loader.Load(ctx, 2)()
+	assert.Equal(t, 4, value)
+	assert.Equal(t, 1, fetches)
+
+	_, _ = loader.Load(ctx, 4)()
+	assert.Equal(t, 2, fetches)
+}
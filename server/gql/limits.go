@@ -0,0 +1,161 @@
+package gql
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// cost measures an operation before it runs.
+type cost struct {
+	Depth      int
+	Complexity int
+	// Roots are the fields selected at the root of the operation, fragments
+	// included, but for introspection
+	Roots []string
+}
+
+// analyzer computes the cost of an operation. Every field costs one, and the
+// fields selected below a list are multiplied by the number of items it may
+// return, given by its limit argument. Introspection is free so that tools
+// like GraphiQL keep working under tight limits.
+type analyzer struct {
+	schema    graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+func analyze(schema graphql.Schema, document *ast.Document, operation *ast.OperationDefinition, variables map[string]interface{}) cost {
+	a := analyzer{schema: schema, fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			a.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	root := schema.QueryType()
+	if operation.Operation == ast.OperationTypeMutation {
+		root = schema.MutationType()
+	}
+	return a.selections(root, operation.SelectionSet, 1, map[string]bool{})
+}
+
+func (a analyzer) selections(parent *graphql.Object, set *ast.SelectionSet, depth int, visiting map[string]bool) cost {
+	total := cost{}
+	if set == nil || parent == nil {
+		return total
+	}
+
+	for _, selection := range set.Selections {
+		var c cost
+		switch selection := selection.(type) {
+		case *ast.Field:
+			c = a.field(parent, selection, depth, visiting)
+			if depth == 1 && !strings.HasPrefix(selection.Name.Value, "__") {
+				c.Roots = []string{selection.Name.Value}
+			}
+		case *ast.InlineFragment:
+			c = a.selections(a.condition(parent, selection.TypeCondition), selection.SelectionSet, depth, visiting)
+		case *ast.FragmentSpread:
+			// Cycles are rejected by validation, but guard against them anyway
+			fragment := a.fragments[selection.Name.Value]
+			if fragment == nil || visiting[fragment.Name.Value] {
+				continue
+			}
+			visiting[fragment.Name.Value] = true
+			c = a.selections(a.condition(parent, fragment.TypeCondition), fragment.SelectionSet, depth, visiting)
+			delete(visiting, fragment.Name.Value)
+		}
+		total.Complexity += c.Complexity
+		total.Roots = append(total.Roots, c.Roots...)
+		if c.Depth > total.Depth {
+			total.Depth = c.Depth
+		}
+	}
+	return total
+}
+
+func (a analyzer) field(parent *graphql.Object, field *ast.Field, depth int, visiting map[string]bool) cost {
+	name := field.Name.Value
+	if strings.HasPrefix(name, "__") {
+		return cost{}
+	}
+	definition, ok := parent.Fields()[name]
+	if !ok {
+		return cost{Depth: depth, Complexity: 1}
+	}
+
+	fieldType, isList := unwrap(definition.Type)
+	object, _ := fieldType.(*graphql.Object)
+	children := a.selections(object, field.SelectionSet, depth+1, visiting)
+
+	multiplier := 1
+	if isList {
+		multiplier = a.limit(definition, field)
+	}
+	return cost{
+		Depth:      max(depth, children.Depth),
+		Complexity: 1 + multiplier*children.Complexity,
+	}
+}
+
+// limit returns the number of items a list field may return, clamped to
+// the page sizes the resolvers accept: a negative limit fails its field, but
+// must not subtract the cost of its selections from that of the others.
+func (a analyzer) limit(definition *graphql.FieldDefinition, field *ast.Field) int {
+	return min(max(a.requested(definition, field), 0), MaxLimit)
+}
+
+// requested returns the limit argument of a list field, or its default.
+func (a analyzer) requested(definition *graphql.FieldDefinition, field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "limit" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if limit, err := strconv.Atoi(value.Value); err == nil {
+				return limit
+			}
+		case *ast.Variable:
+			if limit, ok := a.variables[value.Name.Value].(float64); ok {
+				return int(limit)
+			}
+			if limit, ok := a.variables[value.Name.Value].(int); ok {
+				return limit
+			}
+		}
+	}
+	for _, argument := range definition.Args {
+		if limit, ok := argument.DefaultValue.(int); ok && argument.Name() == "limit" {
+			return limit
+		}
+	}
+	return nestedLimit
+}
+
+func (a analyzer) condition(parent *graphql.Object, condition *ast.Named) *graphql.Object {
+	if condition == nil {
+		return parent
+	}
+	object, _ := a.schema.Type(condition.Name.Value).(*graphql.Object)
+	return object
+}
+
+// unwrap strips the non-null and list wrappers of a type, reporting whether
+// it was a list.
+func unwrap(t graphql.Type) (graphql.Type, bool) {
+	isList := false
+	for {
+		switch wrapper := t.(type) {
+		case *graphql.NonNull:
+			t = wrapper.OfType
+		case *graphql.List:
+			t, isList = wrapper.OfType, true
+		default:
+			return t, isList
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package gql
+
+import (
+	"context"
+	"sync"
+)
+
+// Loader batches the loads of a request. Loads return thunks; the first thunk
+// called fetches every key requested so far in a single call, which lets the
+// executor resolve a whole level of the response tree with one query.
+// Results are cached for the lifetime of the loader.
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]*loaded[V]
+}
+
+type loaded[V any] struct {
+	done  bool
+	value V
+	err   error
+}
+
+// NewLoader returns a loader fetching its keys with fetch. Keys missing from
+// the fetched map load as the zero value of V.
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, results: map[K]*loaded[V]{}}
+}
+
+// Load schedules key for the next batch and returns a thunk yielding its value.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) func() (V, error) {
+	l.mu.Lock()
+	if _, ok := l.results[key]; !ok {
+		l.results[key] = &loaded[V]{}
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		result := l.results[key]
+		if !result.done {
+			l.dispatch(ctx)
+		}
+		return result.value, result.err
+	}
+}
+
+// dispatch fetches the pending keys. It must be called with the lock held.
+func (l *Loader[K, V]) dispatch(ctx context.Context) {
+	keys := l.pending
+	l.pending = nil
+
+	values, err := l.fetch(ctx, keys)
+	for _, key := range keys {
+		result := l.results[key]
+		result.done = true
+		result.value, result.err = values[key], err
+	}
+}
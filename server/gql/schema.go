@@ -0,0 +1,549 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"library/models"
+	"library/repository"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	// DefaultLimit and MaxLimit bound the size of the book lists.
+	DefaultLimit = 20
+	MaxLimit     = 100
+	// nestedLimit is the default size of the lists nested in a book or genre.
+	nestedLimit = 10
+)
+
+var validate = validator.New()
+
+// NewSchema builds the GraphQL schema of the catalogue.
+func NewSchema() (graphql.Schema, error) {
+	genreType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Genre",
+		Description: "A genre of the catalogue",
+		Fields:      graphql.Fields{},
+	})
+
+	bookType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Book",
+		Description: "A book of the library",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: bookField(func(b models.Book) interface{} { return strconv.FormatUint(uint64(b.ID), 10) })},
+			"title":       &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: bookField(func(b models.Book) interface{} { return b.Title })},
+			"author":      &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: bookField(func(b models.Book) interface{} { return b.Author })},
+			"published":   &graphql.Field{Type: graphql.DateTime, Resolve: bookField(func(b models.Book) interface{} { return b.Published })},
+			"edition":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: bookField(func(b models.Book) interface{} { return b.Edition })},
+			"description": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: bookField(func(b models.Book) interface{} { return b.Description })},
+			"genreName":   &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: bookField(func(b models.Book) interface{} { return b.GenreName })},
+			"isbn":        &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: bookField(func(b models.Book) interface{} { return b.ISBN })},
+			"createdAt":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: bookField(func(b models.Book) interface{} { return b.CreatedAt })},
+			"updatedAt":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: bookField(func(b models.Book) interface{} { return b.UpdatedAt })},
+		},
+	})
+	bookList := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType)))
+
+	bookType.AddFieldConfig("genre", &graphql.Field{
+		Type:        genreType,
+		Description: "The genre of the book, if any",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			book := p.Source.(models.Book)
+			if book.GenreName == "" {
+				return nil, nil
+			}
+			return book.GenreName, nil
+		},
+	})
+	bookType.AddFieldConfig("byAuthor", &graphql.Field{
+		Type:        bookList,
+		Description: "Other books by the same author, oldest first",
+		Args:        pageArgs(nestedLimit),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			book := p.Source.(models.Book)
+			page, err := pageOf(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			if page.Limit == 0 {
+				return []models.Book{}, nil
+			}
+			// One more book than the page, in case the book is among them
+			thunk := loadersFrom(p.Context).byAuthor.Load(p.Context, pageKey{Name: book.Author, Limit: page.Limit + 1, Offset: page.Offset})
+			return func() (interface{}, error) {
+				books, err := thunk()
+				if err != nil {
+					return nil, err
+				}
+				others := make([]models.Book, 0, len(books))
+				for _, other := range books {
+					if other.ID != book.ID {
+						others = append(others, other)
+					}
+				}
+				// The book skipped before the page shifts the others by one
+				if len(others) == len(books) && len(others) > 0 && page.Offset > 0 && precedes(book, others[0]) {
+					others = others[1:]
+				}
+				return window(others, repository.ListOptions{Limit: page.Limit}), nil
+			}, nil
+		},
+	})
+
+	genreType.AddFieldConfig("name", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(string), nil
+		},
+	})
+	genreType.AddFieldConfig("bookCount", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "The number of books of the genre",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			thunk := loadersFrom(p.Context).genreCount.Load(p.Context, p.Source.(string))
+			return func() (interface{}, error) {
+				count, err := thunk()
+				return int(count), err
+			}, nil
+		},
+	})
+	genreType.AddFieldConfig("books", &graphql.Field{
+		Type:        bookList,
+		Description: "The books of the genre, oldest first",
+		Args:        pageArgs(nestedLimit),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			page, err := pageOf(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			if page.Limit == 0 {
+				return []models.Book{}, nil
+			}
+			thunk := loadersFrom(p.Context).byGenre.Load(p.Context, pageKey{Name: p.Source.(string), Limit: page.Limit, Offset: page.Offset})
+			return func() (interface{}, error) {
+				books, err := thunk()
+				if books == nil {
+					books = []models.Book{}
+				}
+				return books, err
+			}, nil
+		},
+	})
+
+	bookInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "BookInput",
+		Description: "The details of a book",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"author":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"published":   &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"edition":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"description": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"genreName":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"isbn":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+	bookPatch := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "BookPatch",
+		Description: "The details of a book to change; omitted fields are left untouched",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"author":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"published":   &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"edition":     &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"description": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"genreName":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"isbn":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"book": &graphql.Field{
+				Type:        bookType,
+				Description: "A book by ID",
+				Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					thunk := loadersFrom(p.Context).books.Load(p.Context, id)
+					return func() (interface{}, error) {
+						book, err := thunk()
+						if err != nil || book.ID == 0 {
+							return nil, err
+						}
+						return book, nil
+					}, nil
+				},
+			},
+			"books": &graphql.Field{
+				Type:        bookList,
+				Description: "The books matching the search criteria",
+				Args:        mergeArgs(filterArgs(), pageArgs(DefaultLimit)),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter, err := filterOf(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					page, err := pageOf(p.Args)
+					if err != nil || page.Limit == 0 {
+						return []models.Book{}, err
+					}
+					return storeFrom(p.Context).Search(p.Context, filter, page)
+				},
+			},
+			"count": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "The number of books matching the search criteria",
+				Args:        filterArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter, err := filterOf(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					count, err := storeFrom(p.Context).Count(p.Context, filter)
+					return int(count), err
+				},
+			},
+			"genres": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(genreType))),
+				Description: "The genres of the catalogue",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					groups, err := storeFrom(p.Context).Groups(p.Context, repository.FieldGenre, repository.Filter{})
+					genres := make([]string, 0, len(groups))
+					for _, group := range groups {
+						genres = append(genres, group.Name)
+					}
+					return genres, err
+				},
+			},
+			"genre": &graphql.Field{
+				Type:        genreType,
+				Description: "A genre by name",
+				Args:        graphql.FieldConfigArgument{"name": {Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Args["name"].(string), nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"addBook": &graphql.Field{
+				Type:        graphql.NewNonNull(bookType),
+				Description: "Add a new book to the library",
+				Args:        graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(bookInput)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var book models.Book
+					applyInput(&book, p.Args["input"].(map[string]interface{}))
+					if err := validate.Struct(book); err != nil {
+						return nil, err
+					}
+					err := storeFrom(p.Context).Create(p.Context, &book)
+					return book, err
+				},
+			},
+			"updateBook": &graphql.Field{
+				Type:        graphql.NewNonNull(bookType),
+				Description: "Replace the details of a book",
+				Args: graphql.FieldConfigArgument{
+					"id":    {Type: graphql.NewNonNull(graphql.ID)},
+					"input": {Type: graphql.NewNonNull(bookInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					book := models.Book{}
+					book.ID = id
+					applyInput(&book, p.Args["input"].(map[string]interface{}))
+					if err := validate.Struct(book); err != nil {
+						return nil, err
+					}
+					err = storeFrom(p.Context).Update(p.Context, &book)
+					return book, err
+				},
+			},
+			"patchBook": &graphql.Field{
+				Type:        graphql.NewNonNull(bookType),
+				Description: "Change some details of a book",
+				Args: graphql.FieldConfigArgument{
+					"id":    {Type: graphql.NewNonNull(graphql.ID)},
+					"input": {Type: graphql.NewNonNull(bookPatch)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					store := storeFrom(p.Context)
+					book, err := store.Get(p.Context, id)
+					if err != nil {
+						return nil, err
+					}
+
+					// Validate the book as it will be once patched
+					input := p.Args["input"].(map[string]interface{})
+					applyInput(&book, input)
+					if err := validate.Struct(book); err != nil {
+						return nil, err
+					}
+					return store.Patch(p.Context, id, columns(input))
+				},
+			},
+			"deleteBook": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "Delete a book, returning its ID",
+				Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return p.Args["id"], storeFrom(p.Context).Delete(p.Context, id)
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func bookField(value func(models.Book) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return value(p.Source.(models.Book)), nil
+	}
+}
+
+func filterArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"q":           {Type: graphql.String, Description: "Free text matching the title or the author"},
+		"title":       {Type: graphql.String, Description: "Title of the book"},
+		"author":      {Type: graphql.String, Description: "Author of the book"},
+		"from":        {Type: graphql.String, Description: "Published date range start (YYYY-MM-DD)"},
+		"to":          {Type: graphql.String, Description: "Published date range end (YYYY-MM-DD)"},
+		"description": {Type: graphql.String, Description: "Description of the book"},
+		"genre":       {Type: graphql.String, Description: "Genre of the book"},
+	}
+}
+
+func pageArgs(limit int) graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"limit":  {Type: graphql.Int, DefaultValue: limit, Description: "Maximum number of books, up to " + strconv.Itoa(MaxLimit)},
+		"offset": {Type: graphql.Int, DefaultValue: 0, Description: "Number of books to skip"},
+	}
+}
+
+func mergeArgs(args ...graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	merged := graphql.FieldConfigArgument{}
+	for _, arg := range args {
+		for name, config := range arg {
+			merged[name] = config
+		}
+	}
+	return merged
+}
+
+func filterOf(args map[string]interface{}) (repository.Filter, error) {
+	text := func(name string) string {
+		value, _ := args[name].(string)
+		return value
+	}
+	filter := repository.Filter{
+		Query:       text("q"),
+		Title:       text("title"),
+		Author:      text("author"),
+		From:        text("from"),
+		To:          text("to"),
+		Description: text("description"),
+		Genre:       text("genre"),
+	}
+	return filter, filter.Validate()
+}
+
+func pageOf(args map[string]interface{}) (repository.ListOptions, error) {
+	page := repository.ListOptions{Limit: args["limit"].(int), Offset: args["offset"].(int)}
+	if page.Limit < 0 || page.Limit > MaxLimit {
+		return page, fmt.Errorf("limit must be between 0 and %d", MaxLimit)
+	}
+	if page.Offset < 0 {
+		return page, errors.New("offset must not be negative")
+	}
+	return page, nil
+}
+
+// precedes reports whether a book comes before another, oldest first.
+func precedes(a, b models.Book) bool {
+	if a.CreatedAt.Equal(b.CreatedAt) {
+		return a.ID < b.ID
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// window returns the page of an already loaded list of books.
+func window(books []models.Book, page repository.ListOptions) []models.Book {
+	if page.Offset >= len(books) {
+		return []models.Book{}
+	}
+	books = books[page.Offset:]
+	if page.Limit < len(books) {
+		books = books[:page.Limit]
+	}
+	return books
+}
+
+func parseID(value interface{}) (uint, error) {
+	id, err := strconv.ParseUint(fmt.Sprint(value), 10, 0)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid book ID %q", value)
+	}
+	return uint(id), nil
+}
+
+// inputColumns maps the fields of the book inputs to their database columns.
+var inputColumns = map[string]string{
+	"title":       "title",
+	"author":      "author",
+	"published":   "published",
+	"edition":     "edition",
+	"description": "description",
+	"genreName":   "genre_name",
+	"isbn":        "isbn",
+}
+
+// applyInput copies the fields present in a book input to book.
+func applyInput(book *models.Book, input map[string]interface{}) {
+	for field, value := range input {
+		if value == nil {
+			continue
+		}
+		switch field {
+		case "title":
+			book.Title = value.(string)
+		case "author":
+			book.Author = value.(string)
+		case "published":
+			book.Published = value.(time.Time)
+		case "edition":
+			book.Edition = value.(int)
+		case "description":
+			book.Description = value.(string)
+		case "genreName":
+			book.GenreName = value.(string)
+		case "isbn":
+			book.ISBN = value.(string)
+		}
+	}
+}
+
+// columns returns the column updates of a book patch.
+func columns(input map[string]interface{}) map[string]interface{} {
+	updates := map[string]interface{}{}
+	for field, value := range input {
+		if column, ok := inputColumns[field]; ok && value != nil {
+			if published, ok := value.(time.Time); ok {
+				value = published.UTC()
+			}
+			updates[column] = value
+		}
+	}
+	return updates
+}
+
+type contextKey int
+
+const (
+	storeKey contextKey = iota
+	loadersKey
+)
+
+// loaders batch the relations of the books resolved during a request.
+type loaders struct {
+	books      *Loader[uint, models.Book]
+	byAuthor   *Loader[pageKey, []models.Book]
+	byGenre    *Loader[pageKey, []models.Book]
+	genreCount *Loader[string, int64]
+}
+
+// pageKey names a page of the books of an author or a genre, oldest first.
+type pageKey struct {
+	Name          string
+	Limit, Offset int
+}
+
+func newLoaders(store repository.BookRepository) *loaders {
+	return &loaders{
+		books: NewLoader(func(ctx context.Context, ids []uint) (map[uint]models.Book, error) {
+			books, err := store.Search(ctx, repository.Filter{IDs: ids}, repository.ListOptions{})
+			found := make(map[uint]models.Book, len(books))
+			for _, book := range books {
+				found[book.ID] = book
+			}
+			return found, err
+		}),
+		byAuthor: NewLoader(func(ctx context.Context, keys []pageKey) (map[pageKey][]models.Book, error) {
+			return pages(ctx, store, repository.FieldAuthor, keys)
+		}),
+		byGenre: NewLoader(func(ctx context.Context, keys []pageKey) (map[pageKey][]models.Book, error) {
+			return pages(ctx, store, repository.FieldGenre, keys)
+		}),
+		genreCount: NewLoader(func(ctx context.Context, genres []string) (map[string]int64, error) {
+			groups, err := store.Groups(ctx, repository.FieldGenre, repository.Filter{Genres: genres})
+			counts := make(map[string]int64, len(groups))
+			for _, group := range groups {
+				counts[group.Name] = group.Count
+			}
+			return counts, err
+		}),
+	}
+}
+
+// pages loads the pages of the books of the authors or genres of the keys,
+// with a query per size of page rather than the whole lists.
+func pages(ctx context.Context, store repository.BookRepository, field repository.Field, keys []pageKey) (map[pageKey][]models.Book, error) {
+	names := map[repository.ListOptions][]string{}
+	for _, key := range keys {
+		page := repository.ListOptions{Order: repository.OrderByOldest, Limit: key.Limit, Offset: key.Offset, Per: field}
+		names[page] = append(names[page], key.Name)
+	}
+
+	found := make(map[pageKey][]models.Book, len(keys))
+	for page, values := range names {
+		filter := repository.Filter{Authors: values}
+		if field == repository.FieldGenre {
+			filter = repository.Filter{Genres: values}
+		}
+		books, err := store.Search(ctx, filter, page)
+		if err != nil {
+			return found, err
+		}
+		for _, book := range books {
+			key := pageKey{Name: book.Author, Limit: page.Limit, Offset: page.Offset}
+			if field == repository.FieldGenre {
+				key.Name = book.GenreName
+			}
+			found[key] = append(found[key], book)
+		}
+	}
+	return found, nil
+}
+
+func storeFrom(ctx context.Context) repository.BookRepository {
+	return ctx.Value(storeKey).(repository.BookRepository)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey).(*loaders)
+}
@@ -0,0 +1,115 @@
+// Package gql serves the catalogue over GraphQL. Nested relations are
+// resolved through per-request loaders that batch their fetches, and queries
+// are bounded in depth and complexity before they run.
+package gql
+
+import (
+	"context"
+	"fmt"
+
+	"library/repository"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request is a GraphQL request, as sent in the body of a POST or the query
+// string of a GET.
+type Request struct {
+	Query         string                 `json:"query" form:"query"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Server executes GraphQL requests against a book repository.
+type Server struct {
+	Schema graphql.Schema
+	// MaxDepth and MaxComplexity reject expensive operations before they
+	// run; zero disables the limit.
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// NewServer returns a server of the catalogue schema with the given limits.
+func NewServer(maxDepth, maxComplexity int) (*Server, error) {
+	schema, err := NewSchema()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Schema: schema, MaxDepth: maxDepth, MaxComplexity: maxComplexity}, nil
+}
+
+// Do parses, validates and executes a request, reporting whether it was
+// executed or rejected beforehand. A mutation runs if authorize returns nil
+// for each of its root fields, as "addBook", and is rejected with the error
+// otherwise.
+func (s *Server) Do(ctx context.Context, store repository.BookRepository, request Request, authorize func(mutation string) error) (*graphql.Result, bool) {
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(request.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, false
+	}
+
+	validation := graphql.ValidateDocument(&s.Schema, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}, false
+	}
+
+	operation := findOperation(document, request.OperationName)
+	if operation == nil {
+		return rejected("Unknown operation %q", request.OperationName), false
+	}
+	c := analyze(s.Schema, document, operation, request.Variables)
+	if operation.Operation == ast.OperationTypeMutation {
+		for _, mutation := range c.Roots {
+			if err := authorize(mutation); err != nil {
+				return rejected("%s", err), false
+			}
+		}
+	}
+	if s.MaxDepth > 0 && c.Depth > s.MaxDepth {
+		return rejected("Query depth %d exceeds the maximum of %d", c.Depth, s.MaxDepth), false
+	}
+	if s.MaxComplexity > 0 && c.Complexity > s.MaxComplexity {
+		return rejected("Query complexity %d exceeds the maximum of %d", c.Complexity, s.MaxComplexity), false
+	}
+
+	ctx = context.WithValue(ctx, storeKey, store)
+	ctx = context.WithValue(ctx, loadersKey, newLoaders(store))
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.Schema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       ctx,
+	}), true
+}
+
+// findOperation returns the named operation of a document, or its only
+// operation when no name is given.
+func findOperation(document *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = operation
+		} else if operation.Name != nil && operation.Name.Value == name {
+			return operation
+		}
+	}
+	return found
+}
+
+func rejected(format string, args ...interface{}) *graphql.Result {
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(fmt.Sprintf(format, args...))}}
+}
@@ -0,0 +1,162 @@
+// Package health tracks whether the server is alive and ready to serve
+// requests, as reported to Kubernetes by the liveness and readiness
+// endpoints, from the state of the dependencies of the server.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of the server, as reported by the readiness check
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+	// StatusDegraded is the status of a server, or of a dependency, that
+	// works poorly but still serves requests
+	StatusDegraded = "degraded"
+)
+
+// Statuses of a dependency, besides StatusDegraded
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check probes a dependency of the server, returning details on its state
+// and an error when it is down, or degraded (see Degraded). It must return
+// once ctx is done.
+type Check func(ctx context.Context) (map[string]any, error)
+
+// degraded is the error of a dependency that still works.
+type degraded struct {
+	err error
+}
+
+func (d degraded) Error() string { return d.err.Error() }
+func (d degraded) Unwrap() error { return d.err }
+
+// Degraded wraps the error of a dependency that still works, but poorly, as
+// a saturated connection pool. It does not fail the readiness check.
+func Degraded(err error) error {
+	return degraded{err: err}
+}
+
+// Dependency is the state of a dependency, as probed by its check.
+type Dependency struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	// Error and Details are only shown by the verbose checks
+	Error   string         `json:"error,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Report is the state of the server and of its dependencies by name.
+type Report struct {
+	Status       string                `json:"status"`
+	Dependencies map[string]Dependency `json:"dependencies,omitempty"`
+}
+
+// Ready reports whether the server accepts new requests.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK || r.Status == StatusDegraded
+}
+
+// Brief returns the report without the errors and details of the
+// dependencies.
+func (r Report) Brief() Report {
+	brief := Report{Status: r.Status}
+	if r.Dependencies != nil {
+		brief.Dependencies = make(map[string]Dependency, len(r.Dependencies))
+		for name, dependency := range r.Dependencies {
+			brief.Dependencies[name] = Dependency{Status: dependency.Status, LatencyMS: dependency.LatencyMS}
+		}
+	}
+	return brief
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Health is the state of a running server. It is ready while its
+// dependencies are up, until it drains, once asked to stop, so that no new
+// requests are routed to it.
+type Health struct {
+	draining atomic.Bool
+	timeout  time.Duration
+	checks   []namedCheck
+}
+
+// New returns the health of a server ready to serve requests, whose checks
+// time out after timeout.
+func New(timeout time.Duration) *Health {
+	return &Health{timeout: timeout}
+}
+
+// Register adds the check of a dependency, before the server starts.
+func (h *Health) Register(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Drain marks the server as stopping: it is no longer ready, but still
+// serves the requests it receives until it shuts down.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Draining reports whether the server is stopping.
+func (h *Health) Draining() bool {
+	return h.draining.Load()
+}
+
+// Check probes the dependencies one after the other, so that they do not
+// compete for the same connections, and reports the readiness of the
+// server. A draining server is not ready, whatever its dependencies.
+func (h *Health) Check(ctx context.Context) Report {
+	if h.Draining() {
+		return Report{Status: StatusDraining}
+	}
+
+	report := Report{Status: StatusOK}
+	if len(h.checks) > 0 {
+		report.Dependencies = make(map[string]Dependency, len(h.checks))
+	}
+	for _, c := range h.checks {
+		dependency := h.probe(ctx, c.check)
+		report.Dependencies[c.name] = dependency
+		switch {
+		case dependency.Status == StatusDown:
+			report.Status = StatusFailing
+		case dependency.Status == StatusDegraded && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// probe runs a check within the timeout.
+func (h *Health) probe(ctx context.Context, check Check) Dependency {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check(ctx)
+	dependency := Dependency{
+		Status:    StatusUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Details:   details,
+	}
+	if err != nil {
+		dependency.Status = StatusDown
+		if errors.As(err, &degraded{}) {
+			dependency.Status = StatusDegraded
+		}
+		dependency.Error = err.Error()
+	}
+	return dependency
+}
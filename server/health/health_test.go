@@ -0,0 +1,105 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func up(ctx context.Context) (map[string]any, error) {
+	return map[string]any{"version": 2}, nil
+}
+
+func down(ctx context.Context) (map[string]any, error) {
+	return nil, errors.New("connection refused")
+}
+
+func saturated(ctx context.Context) (map[string]any, error) {
+	return nil, Degraded(errors.New("all the connections are in use"))
+}
+
+func hanging(ctx context.Context) (map[string]any, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		Description  string
+		Checks       map[string]Check
+		Drain        bool
+		Status       string
+		Dependencies map[string]string
+	}{
+		{Description: "No Dependencies", Status: StatusOK},
+		{
+			Description:  "Up",
+			Checks:       map[string]Check{"database": up, "migrations": up},
+			Status:       StatusOK,
+			Dependencies: map[string]string{"database": StatusUp, "migrations": StatusUp},
+		},
+		{
+			Description:  "Degraded",
+			Checks:       map[string]Check{"database": up, "pool": saturated},
+			Status:       StatusDegraded,
+			Dependencies: map[string]string{"database": StatusUp, "pool": StatusDegraded},
+		},
+		{
+			Description:  "Down",
+			Checks:       map[string]Check{"database": down, "pool": saturated},
+			Status:       StatusFailing,
+			Dependencies: map[string]string{"database": StatusDown, "pool": StatusDegraded},
+		},
+		{
+			Description:  "Timeout",
+			Checks:       map[string]Check{"database": hanging},
+			Status:       StatusFailing,
+			Dependencies: map[string]string{"database": StatusDown},
+		},
+		{
+			Description: "Draining",
+			Checks:      map[string]Check{"database": up},
+			Drain:       true,
+			Status:      StatusDraining,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			h := New(10 * time.Millisecond)
+			for name, check := range tc.Checks {
+				h.Register(name, check)
+			}
+			if tc.Drain {
+				h.Drain()
+			}
+
+			report := h.Check(context.Background())
+			assert.Equal(t, tc.Status, report.Status)
+			assert.Equal(t, tc.Status == StatusOK || tc.Status == StatusDegraded, report.Ready())
+			assert.Len(t, report.Dependencies, len(tc.Dependencies))
+			for name, status := range tc.Dependencies {
+				assert.Equal(t, status, report.Dependencies[name].Status, name)
+			}
+		})
+	}
+}
+
+func TestBrief(t *testing.T) {
+	h := New(time.Second)
+	h.Register("database", down)
+	h.Register("migrations", up)
+
+	report := h.Check(context.Background())
+	assert.Equal(t, "connection refused", report.Dependencies["database"].Error)
+	assert.Equal(t, map[string]any{"version": 2}, report.Dependencies["migrations"].Details)
+
+	brief := report.Brief()
+	assert.Equal(t, StatusFailing, brief.Status)
+	assert.Equal(t, Dependency{Status: StatusDown, LatencyMS: report.Dependencies["database"].LatencyMS}, brief.Dependencies["database"])
+	assert.Nil(t, brief.Dependencies["migrations"].Details)
+	assert.NotNil(t, report.Dependencies["migrations"].Details, "the report is left as is")
+}
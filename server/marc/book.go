@@ -0,0 +1,164 @@
+package marc
+
+import (
+	"fmt"
+	"library/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	yearPattern     = regexp.MustCompile(`\d{4}`)
+	numberPattern   = regexp.MustCompile(`\d+`)
+	ordinalEditions = map[string]int{
+		"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5,
+		"sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+	}
+)
+
+// FromBook maps a book onto a MARC21 bibliographic record.
+func FromBook(book models.Book) Record {
+	record := Record{Leader: DefaultLeader}
+
+	if book.ID != 0 {
+		record.AddControlField("001", strconv.FormatUint(uint64(book.ID), 10))
+	}
+	if !book.UpdatedAt.IsZero() {
+		record.AddControlField("005", book.UpdatedAt.UTC().Format("20060102150405.0"))
+	}
+	record.AddControlField("008", fixedLengthData(book))
+
+	record.AddDataField("020", ' ', ' ', Subfield{'a', book.ISBN})
+	record.AddDataField("100", '1', ' ', Subfield{'a', book.Author})
+	record.AddDataField("245", '1', '0', Subfield{'a', book.Title})
+	if book.Edition > 0 {
+		record.AddDataField("250", ' ', ' ', Subfield{'a', editionStatement(book.Edition)})
+	}
+	if !book.Published.IsZero() {
+		record.AddDataField("264", ' ', '1', Subfield{'c', strconv.Itoa(book.Published.Year())})
+	}
+	record.AddDataField("520", ' ', ' ', Subfield{'a', book.Description})
+	record.AddDataField("655", ' ', '7', Subfield{'a', book.GenreName}, Subfield{'2', "local"})
+
+	return record
+}
+
+// ToBook maps a MARC21 bibliographic record onto a book. Fields missing from
+// the record are left empty so that callers can validate the result.
+func ToBook(record Record) models.Book {
+	book := models.Book{
+		ISBN:        isbn(record.Subfield("020", 'a')),
+		Author:      trimPunctuation(firstNonEmpty(record.Subfield("100", 'a'), record.Subfield("110", 'a'), record.Subfield("700", 'a'))),
+		Description: strings.TrimSpace(record.Subfield("520", 'a')),
+		GenreName:   trimPunctuation(firstNonEmpty(record.Subfield("655", 'a'), record.Subfield("650", 'a'))),
+		Edition:     edition(record.Subfield("250", 'a')),
+		Published:   published(record),
+	}
+
+	for _, field := range record.Fields("245") {
+		book.Title = trimPunctuation(field.Join("ab"))
+		break
+	}
+
+	return book
+}
+
+// fixedLengthData builds the 40 character 008 field of a book record.
+func fixedLengthData(book models.Book) string {
+	entered := strings.Repeat(" ", 6)
+	if !book.CreatedAt.IsZero() {
+		entered = book.CreatedAt.UTC().Format("060102")
+	}
+	year := "    "
+	if !book.Published.IsZero() {
+		year = fmt.Sprintf("%04d", book.Published.Year())
+	}
+	return entered + "s" + year + "    " + "xx " + strings.Repeat(" ", 17) + "und" + " " + "d"
+}
+
+func editionStatement(edition int) string {
+	suffix := "th"
+	switch {
+	case edition%100 >= 11 && edition%100 <= 13:
+	case edition%10 == 1:
+		suffix = "st"
+	case edition%10 == 2:
+		suffix = "nd"
+	case edition%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s ed.", edition, suffix)
+}
+
+// edition extracts the edition number from an edition statement such as
+// "2nd ed." or "Third edition", defaulting to the first edition.
+func edition(statement string) int {
+	if number := numberPattern.FindString(statement); number != "" {
+		if edition, err := strconv.Atoi(number); err == nil && edition > 0 {
+			return edition
+		}
+	}
+	for _, word := range strings.Fields(strings.ToLower(statement)) {
+		if edition, ok := ordinalEditions[strings.Trim(word, ".,")]; ok {
+			return edition
+		}
+	}
+	return 1
+}
+
+// published reads the publication year from 264, 260 or the 008 field.
+func published(record Record) time.Time {
+	candidates := []string{}
+	for _, field := range record.Fields("264") {
+		if field.Ind2 == '1' {
+			candidates = append(candidates, field.Subfield('c'))
+		}
+	}
+	candidates = append(candidates, record.Subfield("264", 'c'), record.Subfield("260", 'c'))
+	if fixed := record.ControlField("008"); len(fixed) >= 11 {
+		candidates = append(candidates, fixed[7:11])
+	}
+
+	for _, candidate := range candidates {
+		if year := yearPattern.FindString(candidate); year != "" {
+			value, _ := strconv.Atoi(year)
+			return time.Date(value, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}
+	}
+	return time.Time{}
+}
+
+// isbn strips qualifiers such as "(pbk.)" from an ISBN subfield.
+func isbn(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// trimPunctuation removes the ISBD punctuation that cataloguers leave at the
+// end of subfields, keeping periods that close an initial (e.g. "Tolkien, J.R.R.").
+func trimPunctuation(value string) string {
+	value = strings.TrimRight(strings.TrimSpace(value), " /:;,=")
+	if strings.HasSuffix(value, ".") && len(value) > 2 {
+		previous := rune(value[len(value)-2])
+		beforePrevious := rune(value[len(value)-3])
+		if !unicode.IsUpper(previous) || unicode.IsLetter(beforePrevious) {
+			value = strings.TrimSuffix(value, ".")
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
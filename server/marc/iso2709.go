@@ -0,0 +1,243 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+
+	leaderLength         = 24
+	directoryEntryLength = 12
+	maxRecordLength      = 99999
+
+	// DefaultLeader describes a new, Unicode encoded, monograph record of
+	// language material. Lengths and addresses are filled in on write.
+	DefaultLeader = "00000nam a2200000 i 4500"
+)
+
+// ErrInvalidRecord is returned when binary MARC data is malformed.
+var ErrInvalidRecord = errors.New("invalid MARC record")
+
+// Reader decodes a stream of binary ISO 2709 records.
+type Reader struct {
+	reader *bufio.Reader
+}
+
+// NewReader returns a Reader reading binary records from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReader(r)}
+}
+
+// Read returns the next record in the stream, or io.EOF when there is none left.
+func (r *Reader) Read() (Record, error) {
+	// Tolerate line breaks some tools insert between records
+	for {
+		b, err := r.reader.Peek(1)
+		if err != nil {
+			return Record{}, err
+		}
+		if b[0] != '\n' && b[0] != '\r' {
+			break
+		}
+		_, _ = r.reader.Discard(1)
+	}
+
+	prefix, err := r.reader.Peek(5)
+	if errors.Is(err, io.EOF) {
+		return Record{}, fmt.Errorf("%w: truncated record length", ErrInvalidRecord)
+	} else if err != nil {
+		return Record{}, err
+	}
+	length, err := strconv.Atoi(string(prefix))
+	if err != nil || length < leaderLength+2 {
+		return Record{}, fmt.Errorf("%w: bad record length %q", ErrInvalidRecord, prefix)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return Record{}, fmt.Errorf("%w: expected %d bytes: %w", ErrInvalidRecord, length, err)
+	}
+	return decodeRecord(data)
+}
+
+// ReadAll decodes every record in r.
+func ReadAll(r io.Reader) ([]Record, error) {
+	reader := NewReader(r)
+	var records []Record
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func decodeRecord(data []byte) (Record, error) {
+	if data[len(data)-1] != recordTerminator {
+		return Record{}, fmt.Errorf("%w: missing record terminator", ErrInvalidRecord)
+	}
+
+	leader := string(data[:leaderLength])
+	baseAddress, err := strconv.Atoi(leader[12:17])
+	if err != nil || baseAddress <= leaderLength || baseAddress > len(data) {
+		return Record{}, fmt.Errorf("%w: bad base address %q", ErrInvalidRecord, leader[12:17])
+	}
+
+	directory := data[leaderLength : baseAddress-1]
+	if len(directory)%directoryEntryLength != 0 {
+		return Record{}, fmt.Errorf("%w: directory length %d", ErrInvalidRecord, len(directory))
+	}
+
+	record := Record{Leader: leader}
+	fields := data[baseAddress:]
+	for i := 0; i < len(directory); i += directoryEntryLength {
+		entry := directory[i : i+directoryEntryLength]
+		tag := string(entry[:3])
+		length, err := strconv.Atoi(string(entry[3:7]))
+		if err != nil {
+			return Record{}, fmt.Errorf("%w: field %s has bad length", ErrInvalidRecord, tag)
+		}
+		start, err := strconv.Atoi(string(entry[7:12]))
+		if err != nil || start < 0 || start+length > len(fields) || length < 1 {
+			return Record{}, fmt.Errorf("%w: field %s has bad offset", ErrInvalidRecord, tag)
+		}
+
+		// Drop the field terminator
+		value := fields[start : start+length-1]
+		if isControlTag(tag) {
+			record.AddControlField(tag, string(value))
+			continue
+		}
+
+		field, err := decodeDataField(tag, value)
+		if err != nil {
+			return Record{}, err
+		}
+		record.DataFields = append(record.DataFields, field)
+	}
+
+	return record, nil
+}
+
+func decodeDataField(tag string, value []byte) (DataField, error) {
+	if len(value) < 2 {
+		return DataField{}, fmt.Errorf("%w: field %s is missing indicators", ErrInvalidRecord, tag)
+	}
+
+	field := DataField{Tag: tag, Ind1: value[0], Ind2: value[1]}
+	for _, chunk := range bytes.Split(value[2:], []byte{subfieldDelimiter}) {
+		if len(chunk) == 0 {
+			continue
+		}
+		field.Subfields = append(field.Subfields, Subfield{Code: chunk[0], Value: string(chunk[1:])})
+	}
+
+	return field, nil
+}
+
+// Writer encodes records in the binary ISO 2709 format.
+type Writer struct {
+	writer io.Writer
+}
+
+// NewWriter returns a Writer writing binary records to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{writer: w}
+}
+
+// Write encodes a single record.
+func (w *Writer) Write(record Record) error {
+	data, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.writer.Write(data)
+	return err
+}
+
+// WriteAll encodes every record in order.
+func WriteAll(w io.Writer, records []Record) error {
+	writer := NewWriter(w)
+	for _, record := range records {
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeRecord(record Record) ([]byte, error) {
+	var directory, fields bytes.Buffer
+
+	addEntry := func(tag string, value []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("%w: tag %q must have three characters", ErrInvalidRecord, tag)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(value)+1, fields.Len())
+		fields.Write(value)
+		fields.WriteByte(fieldTerminator)
+		return nil
+	}
+
+	for _, field := range record.ControlFields {
+		if err := addEntry(field.Tag, []byte(field.Value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range record.DataFields {
+		var value bytes.Buffer
+		value.WriteByte(indicator(field.Ind1))
+		value.WriteByte(indicator(field.Ind2))
+		for _, subfield := range field.Subfields {
+			value.WriteByte(subfieldDelimiter)
+			value.WriteByte(subfield.Code)
+			value.WriteString(subfield.Value)
+		}
+		if err := addEntry(field.Tag, value.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	baseAddress := leaderLength + directory.Len() + 1
+	length := baseAddress + fields.Len() + 1
+	if length > maxRecordLength {
+		return nil, fmt.Errorf("%w: record is %d bytes long", ErrInvalidRecord, length)
+	}
+
+	leader := []byte(record.Leader)
+	if len(leader) != leaderLength {
+		leader = []byte(DefaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[10:12], "22")
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+	copy(leader[20:24], "4500")
+
+	data := make([]byte, 0, length)
+	data = append(data, leader...)
+	data = append(data, directory.Bytes()...)
+	data = append(data, fieldTerminator)
+	data = append(data, fields.Bytes()...)
+	data = append(data, recordTerminator)
+	return data, nil
+}
+
+// indicator replaces an unset indicator with a blank.
+func indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
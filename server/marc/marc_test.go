@@ -0,0 +1,123 @@
+package marc
+
+import (
+	"bytes"
+	"library/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func sampleBook() models.Book {
+	return models.Book{
+		Model:       gorm.Model{ID: 42, CreatedAt: time.Date(2023, 8, 27, 0, 0, 0, 0, time.UTC), UpdatedAt: time.Date(2023, 8, 28, 10, 30, 0, 0, time.UTC)},
+		Title:       "How to implement a Library",
+		Author:      "Mohamad-Jaafar NEHME",
+		Published:   time.Date(2023, 8, 27, 15, 4, 5, 0, time.UTC),
+		Edition:     2,
+		Description: "A book on how to create a Book Management System in Golang",
+		GenreName:   "Tutoring",
+		ISBN:        "9780306406157",
+	}
+}
+
+func assertSameBook(t *testing.T, expected, actual models.Book) {
+	assert.Equal(t, expected.Title, actual.Title, "Title mismatch")
+	assert.Equal(t, expected.Author, actual.Author, "Author mismatch")
+	assert.Equal(t, expected.Edition, actual.Edition, "Edition mismatch")
+	assert.Equal(t, expected.Published.Year(), actual.Published.Year(), "Published mismatch")
+	assert.Equal(t, expected.Description, actual.Description, "Description mismatch")
+	assert.Equal(t, expected.GenreName, actual.GenreName, "Genre mismatch")
+	assert.Equal(t, expected.ISBN, actual.ISBN, "ISBN mismatch")
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	book := sampleBook()
+
+	var buffer bytes.Buffer
+	err := WriteAll(&buffer, []Record{FromBook(book), FromBook(book)})
+	assert.NoError(t, err)
+
+	records, err := ReadAll(&buffer)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "42", records[0].ControlField("001"))
+	assert.Equal(t, "20230828103000.0", records[0].ControlField("005"))
+	assertSameBook(t, book, ToBook(records[1]))
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	book := sampleBook()
+
+	var buffer bytes.Buffer
+	err := WriteXML(&buffer, []Record{FromBook(book)})
+	assert.NoError(t, err)
+	assert.Contains(t, buffer.String(), `<collection xmlns="http://www.loc.gov/MARC21/slim">`)
+
+	records, err := ReadXML(&buffer)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assertSameBook(t, book, ToBook(records[0]))
+
+	buffer.Reset()
+	err = WriteXMLRecord(&buffer, FromBook(book))
+	assert.NoError(t, err)
+	records, err = ReadXML(&buffer)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestToBookFromCatalogueRecord(t *testing.T) {
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>01142cam  2200301 a 4500</leader>
+  <controlfield tag="008">920219s1925    nyu           000 1 eng  </controlfield>
+  <datafield tag="020" ind1=" " ind2=" "><subfield code="a">0684801523 (pbk.)</subfield></datafield>
+  <datafield tag="100" ind1="1" ind2=" "><subfield code="a">Fitzgerald, F. Scott,</subfield></datafield>
+  <datafield tag="245" ind1="1" ind2="4"><subfield code="a">The great Gatsby :</subfield><subfield code="b">a novel /</subfield><subfield code="c">F. Scott Fitzgerald.</subfield></datafield>
+  <datafield tag="250" ind1=" " ind2=" "><subfield code="a">Third edition.</subfield></datafield>
+  <datafield tag="260" ind1=" " ind2=" "><subfield code="c">c1925.</subfield></datafield>
+  <datafield tag="650" ind1=" " ind2="0"><subfield code="a">Rich people.</subfield></datafield>
+</record>`
+
+	records, err := ReadXML(strings.NewReader(document))
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	book := ToBook(records[0])
+	assert.Equal(t, "The great Gatsby : a novel", book.Title)
+	assert.Equal(t, "Fitzgerald, F. Scott", book.Author)
+	assert.Equal(t, "0684801523", book.ISBN)
+	assert.Equal(t, 3, book.Edition)
+	assert.Equal(t, 1925, book.Published.Year())
+	assert.Equal(t, "Rich people", book.GenreName)
+}
+
+func TestReadInvalidRecord(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Data        string
+	}{
+		{Description: "Bad Length", Data: "abcdefghijklmnopqrstuvwxyz"},
+		{Description: "Truncated Record", Data: "00100nam a2200000 i 4500"},
+		{Description: "Missing Terminator", Data: "00026nam a2200025 i 4500\x1e\x1e"},
+		{Description: "Negative Offset", Data: "00042nam a2200037 i 4500" + "2450005-0001\x1e" + "abc\x1e\x1d"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			_, err := ReadAll(strings.NewReader(tc.Data))
+			assert.ErrorIs(t, err, ErrInvalidRecord)
+		})
+	}
+}
+
+func TestEditionStatement(t *testing.T) {
+	for number, statement := range map[int]string{1: "1st ed.", 2: "2nd ed.", 3: "3rd ed.", 11: "11th ed.", 22: "22nd ed."} {
+		assert.Equal(t, statement, editionStatement(number))
+		assert.Equal(t, number, edition(statement))
+	}
+}
@@ -0,0 +1,141 @@
+package marc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Namespace is the MARCXML schema namespace.
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"http://www.loc.gov/MARC21/slim collection"`
+	Records []xmlRecord `xml:"record"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"http://www.loc.gov/MARC21/slim record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ReadXML decodes every record of a MARCXML document. Both a <collection>
+// of records and a single <record> root element are accepted.
+func ReadXML(r io.Reader) ([]Record, error) {
+	decoder := xml.NewDecoder(r)
+	var records []Record
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRecord, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var element xmlRecord
+		if err := decoder.DecodeElement(&element, &start); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+		}
+		records = append(records, element.record())
+	}
+
+	return records, nil
+}
+
+// WriteXML encodes records as a MARCXML <collection>.
+func WriteXML(w io.Writer, records []Record) error {
+	collection := xmlCollection{}
+	for _, record := range records {
+		collection.Records = append(collection.Records, newXMLRecord(record))
+	}
+	return writeXML(w, collection)
+}
+
+// WriteXMLRecord encodes a single record as a MARCXML <record> root element.
+func WriteXMLRecord(w io.Writer, record Record) error {
+	return writeXML(w, newXMLRecord(record))
+}
+
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func newXMLRecord(record Record) xmlRecord {
+	leader := record.Leader
+	if len(leader) != leaderLength {
+		leader = DefaultLeader
+	}
+
+	element := xmlRecord{Leader: leader}
+	for _, field := range record.ControlFields {
+		element.ControlFields = append(element.ControlFields, xmlControlField{Tag: field.Tag, Value: field.Value})
+	}
+	for _, field := range record.DataFields {
+		dataField := xmlDataField{
+			Tag:  field.Tag,
+			Ind1: string(indicator(field.Ind1)),
+			Ind2: string(indicator(field.Ind2)),
+		}
+		for _, subfield := range field.Subfields {
+			dataField.Subfields = append(dataField.Subfields, xmlSubfield{Code: string(subfield.Code), Value: subfield.Value})
+		}
+		element.DataFields = append(element.DataFields, dataField)
+	}
+	return element
+}
+
+func (element xmlRecord) record() Record {
+	record := Record{Leader: element.Leader}
+	for _, field := range element.ControlFields {
+		record.AddControlField(field.Tag, field.Value)
+	}
+	for _, field := range element.DataFields {
+		dataField := DataField{Tag: field.Tag, Ind1: firstByte(field.Ind1), Ind2: firstByte(field.Ind2)}
+		for _, subfield := range field.Subfields {
+			dataField.Subfields = append(dataField.Subfields, Subfield{Code: firstByte(subfield.Code), Value: subfield.Value})
+		}
+		record.DataFields = append(record.DataFields, dataField)
+	}
+	return record
+}
+
+func firstByte(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
@@ -0,0 +1,110 @@
+// Package marc reads and writes bibliographic records in MARC21, both in its
+// binary ISO 2709 transmission format and as MARCXML.
+package marc
+
+import "strings"
+
+// Record is a single MARC21 bibliographic record.
+type Record struct {
+	Leader        string
+	ControlFields []ControlField
+	DataFields    []DataField
+}
+
+// ControlField is a variable control field (tags 001-009).
+type ControlField struct {
+	Tag   string
+	Value string
+}
+
+// DataField is a variable data field made of indicators and subfields.
+type DataField struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+// Subfield is a single coded value inside a data field.
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// ControlField returns the value of the first control field with the given tag.
+func (r *Record) ControlField(tag string) string {
+	for _, field := range r.ControlFields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Fields returns all the data fields with the given tag, in record order.
+func (r *Record) Fields(tag string) []DataField {
+	var fields []DataField
+	for _, field := range r.DataFields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Subfield returns the first value of the given subfield code in the first
+// data field with the given tag.
+func (r *Record) Subfield(tag string, code byte) string {
+	for _, field := range r.Fields(tag) {
+		if value := field.Subfield(code); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// AddControlField appends a control field to the record.
+func (r *Record) AddControlField(tag, value string) {
+	r.ControlFields = append(r.ControlFields, ControlField{Tag: tag, Value: value})
+}
+
+// AddDataField appends a data field to the record, skipping empty subfields.
+// Nothing is added when all subfields are empty.
+func (r *Record) AddDataField(tag string, ind1, ind2 byte, subfields ...Subfield) {
+	field := DataField{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for _, subfield := range subfields {
+		if subfield.Value != "" {
+			field.Subfields = append(field.Subfields, subfield)
+		}
+	}
+	if len(field.Subfields) > 0 {
+		r.DataFields = append(r.DataFields, field)
+	}
+}
+
+// Subfield returns the first value of the given subfield code.
+func (f DataField) Subfield(code byte) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+	return ""
+}
+
+// Join concatenates the values of the given subfield codes separated by a
+// space, in field order.
+func (f DataField) Join(codes string) string {
+	var values []string
+	for _, subfield := range f.Subfields {
+		if strings.IndexByte(codes, subfield.Code) >= 0 {
+			values = append(values, subfield.Value)
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+// isControlTag reports whether a tag denotes a control field.
+func isControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// lockKey identifies the Postgres advisory lock of the migrations; any
+// number works as long as every replica uses the same.
+const lockKey = 7262830593
+
+// dialect holds what differs between the databases.
+type dialect struct {
+	createTable string
+	placeholder func(n int) string
+	// lock takes the migration lock on the connection and returns its release.
+	lock func(ctx context.Context, conn *sql.Conn) (func(), error)
+}
+
+var dialects = map[string]dialect{
+	"postgres": {
+		createTable: `CREATE TABLE IF NOT EXISTS ` + Table + ` (
+			version    BIGINT PRIMARY KEY,
+			name       VARCHAR(255) NOT NULL,
+			checksum   CHAR(64) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`,
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		// Session-level advisory locks are held by the connection until released
+		lock: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+			if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+				return nil, err
+			}
+			return func() {
+				_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+			}, nil
+		},
+	},
+	"sqlite": {
+		createTable: `CREATE TABLE IF NOT EXISTS ` + Table + ` (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			checksum   TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`,
+		placeholder: func(int) string { return "?" },
+		// A SQLite database belongs to a single server: each migration's
+		// transaction is all the locking it needs
+		lock: func(context.Context, *sql.Conn) (func(), error) {
+			return func() {}, nil
+		},
+	},
+}
@@ -0,0 +1,406 @@
+// Package migrations versions the database schema with ordered up and down
+// SQL migrations embedded in the binary. The applied versions are recorded
+// with the checksum of their SQL in the schema_migrations table, and
+// migrating holds a lock so that replicas starting together do not race.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Table records the applied migrations.
+const Table = "schema_migrations"
+
+// fileName matches the files of a migration, e.g. 0002_index_books.up.sql.
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned change of the schema.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the SQL applied by the migration.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status is the state of a migration in the database.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the SQL of an applied migration changed since.
+	Modified bool
+	// Unknown is set when the database applied a migration this binary
+	// does not know, as when it was migrated by a newer release.
+	Unknown bool
+}
+
+// State summarizes a list of statuses, as "up to date", "2 pending" or
+// "1 modified".
+func State(statuses []Status) string {
+	var pending, modified, unknown int
+	for _, status := range statuses {
+		switch {
+		case status.Unknown:
+			unknown++
+		case status.Modified:
+			modified++
+		case !status.Applied:
+			pending++
+		}
+	}
+
+	var states []string
+	for _, count := range []struct {
+		n     int
+		state string
+	}{{modified, "modified"}, {unknown, "unknown"}, {pending, "pending"}} {
+		if count.n > 0 {
+			states = append(states, fmt.Sprintf("%d %s", count.n, count.state))
+		}
+	}
+	if len(states) == 0 {
+		return "up to date"
+	}
+	return strings.Join(states, ", ")
+}
+
+// Migrator applies the migrations of its dialect to a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// New returns a migrator of the database with the embedded migrations of
+// its dialect.
+func New(db *gorm.DB) (*Migrator, error) {
+	name := db.Dialector.Name()
+	dialect, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for the %s dialect", name)
+	}
+	migrations, err := Load(files, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: sqlDB, dialect: dialect, migrations: migrations}, nil
+}
+
+// Load reads the migrations of a directory, ordered by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %s has no up SQL", migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies the pending migrations in order and returns them. It refuses
+// to run when an applied migration was modified.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Modified {
+				return fmt.Errorf("migration %s was modified after it was applied", status.Migration)
+			}
+			if status.Unknown {
+				slog.Warn("The database has a migration unknown to this release.", "migration", status.Migration.String())
+			}
+		}
+
+		for _, status := range statuses {
+			if status.Applied || status.Unknown {
+				continue
+			}
+			if err := m.apply(ctx, conn, status.Migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, status.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, or all of them when
+// steps is negative, and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && steps != 0; i-- {
+			status := statuses[i]
+			if !status.Applied {
+				continue
+			}
+			if status.Unknown {
+				return fmt.Errorf("cannot roll back migration %s unknown to this release", status.Migration)
+			}
+			if err := m.apply(ctx, conn, status.Migration, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, status.Migration)
+			steps--
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status returns the state of every migration, known or applied, by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		statuses, err = m.status(ctx, conn)
+		return err
+	})
+	return statuses, err
+}
+
+// Current returns the state of every migration like Status, without taking
+// the migration lock nor creating the table of the applied migrations, so as
+// not to wait for a migration in progress. It fails if the database was
+// never migrated.
+func (m *Migrator) Current(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return m.status(ctx, conn)
+}
+
+// Version returns the version of the last applied migration, or 0.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	statuses, err := m.Status(ctx)
+	var version int64
+	for _, status := range statuses {
+		if status.Applied && status.Version > version {
+			version = status.Version
+		}
+	}
+	return version, err
+}
+
+// Drop removes the table of the applied migrations, once they were all rolled back.
+func (m *Migrator) Drop(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+Table)
+	return err
+}
+
+// locked runs f on a connection holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, f func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := m.dialect.lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("cannot lock the migrations: %w", err)
+	}
+	defer unlock()
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return fmt.Errorf("cannot create the %s table: %w", Table, err)
+	}
+	return f(conn)
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]Status, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM "+Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type record struct {
+		name, checksum string
+		appliedAt      time.Time
+	}
+	applied := map[int64]record{}
+	for rows.Next() {
+		var version int64
+		var r record
+		if err := rows.Scan(&version, &r.name, &r.checksum, &r.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if r, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = r.appliedAt
+			status.Modified = r.checksum != migration.Checksum()
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, r := range applied {
+		statuses = append(statuses, Status{Migration: Migration{Version: version, Name: r.name}, Applied: true, AppliedAt: r.appliedAt, Unknown: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// apply runs a migration up or down in a transaction, recording it.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	direction, statement := "up", migration.Up
+	if !up {
+		direction, statement = "down", migration.Down
+	}
+	if strings.TrimSpace(statement) != "" {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %s %s failed: %w", migration, direction, err)
+		}
+	} else if !up {
+		return fmt.Errorf("migration %s cannot be rolled back", migration)
+	}
+
+	p := m.dialect.placeholder
+	if up {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied_at) VALUES (%s, %s, %s, %s)", Table, p(1), p(2), p(3), p(4)),
+			migration.Version, migration.Name, migration.Checksum(), time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %s", Table, p(1)), migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("Applied migration.", "migration", migration.String(), "direction", direction)
+	return nil
+}
+
+// Create writes empty up and down files of a new migration, numbered after
+// the last one, for every dialect under dir, and returns their paths.
+func Create(dir string, name string) ([]string, error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return nil, errors.New("the migration name may only contain letters, digits and underscores")
+	}
+
+	var version int64
+	for dialect := range dialects {
+		migrations, err := Load(os.DirFS(dir), dialect)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(migrations); n > 0 && migrations[n-1].Version > version {
+			version = migrations[n-1].Version
+		}
+	}
+	version++
+
+	var paths []string
+	for dialect := range dialects {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(dir, dialect, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+			content := fmt.Sprintf("-- %s migration %04d_%s for %s\n", direction, version, name, dialect)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,223 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"library/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	migrator, err := New(db)
+	require.NoError(t, err)
+	total := len(migrator.migrations)
+
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, total)
+	assert.True(t, db.Migrator().HasTable(&models.Book{}))
+	assert.NoError(t, db.Create(&models.Book{Title: "Dune", Author: "Frank Herbert", Edition: 1}).Error)
+
+	applied, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "up to date", State(statuses))
+	for _, status := range statuses {
+		assert.True(t, status.Applied)
+		assert.False(t, status.AppliedAt.IsZero())
+	}
+
+	reverted, err := migrator.Down(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{migrator.migrations[total-1]}, reverted)
+	version, err := migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, migrator.migrations[total-2].Version, version)
+
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "1 pending", State(statuses))
+
+	reverted, err = migrator.Down(ctx, -1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, total-1)
+	assert.False(t, db.Migrator().HasTable(&models.Book{}))
+	version, err = migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, version)
+
+	assert.NoError(t, migrator.Drop(ctx))
+	assert.False(t, db.Migrator().HasTable(Table))
+}
+
+// baselineBook is the book of the releases creating their schema with
+// AutoMigrate, before the migrations.
+type baselineBook struct {
+	gorm.Model
+	Title       string `gorm:"size:255"`
+	Author      string `gorm:"size:255"`
+	Published   time.Time
+	Edition     int
+	Description string `gorm:"size:1000"`
+	GenreName   string `gorm:"size:255"`
+}
+
+func (baselineBook) TableName() string {
+	return "books"
+}
+
+func TestAdoptAutoMigratedSchema(t *testing.T) {
+	db := openSQLite(t)
+	require.NoError(t, db.AutoMigrate(&baselineBook{}))
+	require.NoError(t, db.Create(&baselineBook{Title: "Dune", Author: "Frank Herbert", Edition: 1}).Error)
+
+	migrator, err := New(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	assert.NoError(t, err)
+
+	// The books of the baseline and the new ones are stored alike
+	require.NoError(t, db.Create(&models.Book{Title: "Emma", Author: "Jane Austen", Edition: 1, ISBN: "9780141439587"}).Error)
+	var count int64
+	assert.NoError(t, db.Model(&models.Book{}).Where("tenant_id = ?", 1).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestModifiedAndUnknownMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	migrator, err := New(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	// A migration applied by a newer release only warns
+	require.NoError(t, db.Exec("INSERT INTO "+Table+" (version, name, checksum, applied_at) VALUES (999, 'future', '', CURRENT_TIMESTAMP)").Error)
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.True(t, statuses[len(statuses)-1].Unknown)
+	assert.Equal(t, "1 unknown", State(statuses))
+	_, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+
+	// An applied migration whose SQL changed stops the migration
+	require.NoError(t, db.Exec("UPDATE "+Table+" SET checksum = 'changed' WHERE version = 1").Error)
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.True(t, statuses[0].Modified)
+	_, err = migrator.Up(ctx)
+	assert.ErrorContains(t, err, "modified")
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Files       fstest.MapFS
+		Expected    []int64
+		Error       string
+	}{
+		{
+			Description: "Ordered By Version",
+			Files: fstest.MapFS{
+				"sql/0010_later.up.sql":   {Data: []byte("SELECT 10")},
+				"sql/0002_first.up.sql":   {Data: []byte("SELECT 2")},
+				"sql/0002_first.down.sql": {Data: []byte("SELECT 2")},
+				"sql/README.md":           {Data: []byte("ignored")},
+			},
+			Expected: []int64{2, 10},
+		},
+		{
+			Description: "Conflicting Names",
+			Files: fstest.MapFS{
+				"sql/0001_one.up.sql":   {Data: []byte("SELECT 1")},
+				"sql/0001_other.up.sql": {Data: []byte("SELECT 1")},
+			},
+			Error: "is named both",
+		},
+		{
+			Description: "Missing Up",
+			Files: fstest.MapFS{
+				"sql/0001_one.down.sql": {Data: []byte("SELECT 1")},
+			},
+			Error: "has no up SQL",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			migrations, err := Load(tc.Files, "sql")
+			if tc.Error != "" {
+				assert.ErrorContains(t, err, tc.Error)
+				return
+			}
+			assert.NoError(t, err)
+			versions := []int64{}
+			for _, migration := range migrations {
+				versions = append(versions, migration.Version)
+			}
+			assert.Equal(t, tc.Expected, versions)
+		})
+	}
+}
+
+func TestEveryDialectHasTheSameMigrations(t *testing.T) {
+	var expected []string
+	for name := range dialects {
+		migrations, err := Load(files, name)
+		assert.NoError(t, err)
+
+		names := []string{}
+		for _, migration := range migrations {
+			assert.NotEmpty(t, migration.Down, migration.String())
+			names = append(names, migration.String())
+		}
+		if expected == nil {
+			expected = names
+		}
+		assert.Equal(t, expected, names, name)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	for name := range dialects {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name, "0003_existing.up.sql"), []byte("SELECT 1"), 0o644))
+	}
+
+	paths, err := Create(dir, "add_loans")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "postgres", "0004_add_loans.down.sql"),
+		filepath.Join(dir, "postgres", "0004_add_loans.up.sql"),
+		filepath.Join(dir, "sqlite", "0004_add_loans.down.sql"),
+		filepath.Join(dir, "sqlite", "0004_add_loans.up.sql"),
+	}, paths)
+
+	_, err = Create(dir, "add loans")
+	assert.Error(t, err)
+}
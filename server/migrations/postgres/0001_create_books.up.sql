@@ -0,0 +1,15 @@
+-- The books table as AutoMigrate created it, so existing databases adopt it as is
+CREATE TABLE IF NOT EXISTS books (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    title       VARCHAR(255),
+    author      VARCHAR(255),
+    published   TIMESTAMPTZ,
+    edition     BIGINT,
+    description VARCHAR(1000),
+    genre_name  VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books (deleted_at);
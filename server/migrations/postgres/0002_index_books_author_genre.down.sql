@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_books_genre_name;
+DROP INDEX IF EXISTS idx_books_author;
@@ -0,0 +1,11 @@
+-- API keys are looked up by the SHA-256 hash of the key, never stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    name        VARCHAR(255),
+    hash        VARCHAR(64) NOT NULL,
+    hint        VARCHAR(16),
+    revoked_at  TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_hash ON api_keys (hash);
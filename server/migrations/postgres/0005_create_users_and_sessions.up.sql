@@ -0,0 +1,28 @@
+-- Passwords are stored as bcrypt hashes, and the session and reset tokens as
+-- SHA-256 hashes
+CREATE TABLE IF NOT EXISTS users (
+    id                BIGSERIAL PRIMARY KEY,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    username          VARCHAR(64) NOT NULL,
+    password_hash     VARCHAR(72) NOT NULL,
+    role              VARCHAR(32) NOT NULL,
+    failed_logins     INTEGER NOT NULL DEFAULT 0,
+    locked_until      TIMESTAMPTZ,
+    reset_hash        VARCHAR(64) NOT NULL DEFAULT '',
+    reset_expires_at  TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE INDEX IF NOT EXISTS idx_users_reset_hash ON users (reset_hash);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    hash        VARCHAR(64) NOT NULL,
+    user_id     BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_hash ON sessions (hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_subject;
+
+ALTER TABLE users DROP COLUMN subject;
@@ -0,0 +1,5 @@
+-- The users logging in with an identity provider are found by the subject of
+-- their tokens, and have no password
+ALTER TABLE users ADD COLUMN subject VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_users_subject ON users (subject);
@@ -0,0 +1,17 @@
+-- A single library is left: the rows of the other tenants are deleted
+DELETE FROM sessions WHERE user_id IN (SELECT id FROM users WHERE tenant_id <> 1);
+DELETE FROM users WHERE tenant_id <> 1;
+DELETE FROM api_keys WHERE tenant_id <> 1;
+DELETE FROM books WHERE tenant_id <> 1;
+
+DROP INDEX IF EXISTS idx_users_tenant_username;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+ALTER TABLE users DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_api_keys_tenant_id;
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS idx_books_tenant_id;
+ALTER TABLE books DROP COLUMN tenant_id;
+
+DROP TABLE IF EXISTS tenants;
@@ -0,0 +1,30 @@
+-- Every library hosted by the deployment is a tenant owning its books, API
+-- keys and users. Those created before belong to the default tenant.
+CREATE TABLE IF NOT EXISTS tenants (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    slug        VARCHAR(63) NOT NULL,
+    name        VARCHAR(255) NOT NULL,
+    loan_days   INTEGER NOT NULL DEFAULT 14,
+    tagline     VARCHAR(255) NOT NULL DEFAULT '',
+    color       VARCHAR(7) NOT NULL DEFAULT '',
+    logo_url    VARCHAR(2048) NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenants_slug ON tenants (slug);
+
+INSERT INTO tenants (id, created_at, updated_at, slug, name, loan_days)
+VALUES (1, NOW(), NOW(), 'default', 'Book Management API', 14);
+SELECT setval(pg_get_serial_sequence('tenants', 'id'), 1);
+
+ALTER TABLE books ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS idx_books_tenant_id ON books (tenant_id);
+
+ALTER TABLE api_keys ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant_id ON api_keys (tenant_id);
+
+-- The usernames are unique within each tenant
+ALTER TABLE users ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 1;
+DROP INDEX IF EXISTS idx_users_username;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username ON users (tenant_id, username);
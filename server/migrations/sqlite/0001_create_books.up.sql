@@ -0,0 +1,15 @@
+-- The books table as AutoMigrate created it, so existing databases adopt it as is
+CREATE TABLE IF NOT EXISTS books (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME,
+    title       TEXT,
+    author      TEXT,
+    published   DATETIME,
+    edition     INTEGER,
+    description TEXT,
+    genre_name  TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books (deleted_at);
@@ -0,0 +1,3 @@
+-- Authors and genres are browsed and grouped by the OPDS, OAI-PMH and GraphQL endpoints
+CREATE INDEX IF NOT EXISTS idx_books_author ON books (author);
+CREATE INDEX IF NOT EXISTS idx_books_genre_name ON books (genre_name);
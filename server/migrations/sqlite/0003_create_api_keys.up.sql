@@ -0,0 +1,11 @@
+-- API keys are looked up by the SHA-256 hash of the key, never stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    name        TEXT,
+    hash        TEXT NOT NULL,
+    hint        TEXT,
+    revoked_at  DATETIME
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_hash ON api_keys (hash);
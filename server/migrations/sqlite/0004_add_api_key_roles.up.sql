@@ -0,0 +1,3 @@
+-- The keys created before the roles keep changing the books, but no longer
+-- delete them or manage the keys
+ALTER TABLE api_keys ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'librarian';
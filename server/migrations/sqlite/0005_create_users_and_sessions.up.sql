@@ -0,0 +1,28 @@
+-- Passwords are stored as bcrypt hashes, and the session and reset tokens as
+-- SHA-256 hashes
+CREATE TABLE IF NOT EXISTS users (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at        DATETIME,
+    updated_at        DATETIME,
+    username          TEXT NOT NULL,
+    password_hash     TEXT NOT NULL,
+    role              TEXT NOT NULL,
+    failed_logins     INTEGER NOT NULL DEFAULT 0,
+    locked_until      DATETIME,
+    reset_hash        TEXT NOT NULL DEFAULT '',
+    reset_expires_at  DATETIME
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE INDEX IF NOT EXISTS idx_users_reset_hash ON users (reset_hash);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    hash        TEXT NOT NULL,
+    user_id     INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at  DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_hash ON sessions (hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
@@ -0,0 +1,29 @@
+-- Every library hosted by the deployment is a tenant owning its books, API
+-- keys and users. Those created before belong to the default tenant.
+CREATE TABLE IF NOT EXISTS tenants (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    slug        TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    loan_days   INTEGER NOT NULL DEFAULT 14,
+    tagline     TEXT NOT NULL DEFAULT '',
+    color       TEXT NOT NULL DEFAULT '',
+    logo_url    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenants_slug ON tenants (slug);
+
+INSERT INTO tenants (id, created_at, updated_at, slug, name, loan_days)
+VALUES (1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'default', 'Book Management API', 14);
+
+ALTER TABLE books ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS idx_books_tenant_id ON books (tenant_id);
+
+ALTER TABLE api_keys ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant_id ON api_keys (tenant_id);
+
+-- The usernames are unique within each tenant
+ALTER TABLE users ADD COLUMN tenant_id INTEGER NOT NULL DEFAULT 1;
+DROP INDEX IF EXISTS idx_users_username;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_username ON users (tenant_id, username);
@@ -0,0 +1,3 @@
+-- The ISBNs of the books, imported from and exported to MARC records
+ALTER TABLE books ADD COLUMN isbn TEXT;
+CREATE INDEX IF NOT EXISTS idx_books_isbn ON books (isbn);
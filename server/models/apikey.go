@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// APIKey authenticates a client of the API. Only the SHA-256 hash of the key
+// is stored: the key itself is shown once, when it is created.
+type APIKey struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name" gorm:"size:255"`
+	Hash      string    `json:"-" gorm:"size:64;uniqueIndex"`
+	// Hint is the start of the key, to tell the keys apart
+	Hint string `json:"hint" gorm:"size:16"`
+	// Role grants the permissions of the key: patron, librarian or admin
+	Role      string     `json:"role" gorm:"size:32"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// TenantID is the library the key gives access to
+	TenantID uint `json:"-" gorm:"index;default:1"`
+}
@@ -21,6 +21,10 @@ type Book struct {
 	Edition     int       `json:"edition" validate:"gte=1"`
 	Description string    `json:"description" gorm:"size:1000"`
 	GenreName   string    `json:"genre_name" gorm:"size:255"`
+	ISBN        string    `json:"isbn" gorm:"size:17;index"`
+	// TenantID is the library holding the book. Its column is added by the
+	// migrations, not to the schemas GORM created before them.
+	TenantID uint `json:"-" gorm:"-:migration;default:1"`
 }
 
 func (b *Book) BeforeSave(tx *gorm.DB) error {
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// DefaultLoanDays is how long the books are lent for, unless a tenant sets
+// its own loan period.
+const DefaultLoanDays = 14
+
+// Tenant is a library hosted by the deployment, with its own books, API keys
+// and users. Its requests name it by its slug, as their subdomain or in a
+// header, and it configures its loans and the branding of its welcome page.
+type Tenant struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Slug      string    `json:"slug" gorm:"size:63;uniqueIndex"`
+	Name      string    `json:"name" gorm:"size:255"`
+	// LoanDays is how many days the books of the tenant are lent for
+	LoanDays int `json:"loan_days"`
+	// Tagline, Color and LogoURL brand the welcome page of the tenant
+	Tagline string `json:"tagline" gorm:"size:255"`
+	Color   string `json:"color" gorm:"size:7"`
+	LogoURL string `json:"logo_url" gorm:"size:2048"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// User is a member of the staff logging in with a password or with an
+// identity provider. Only the bcrypt hash of the password is stored, and the
+// SHA-256 hash of a reset token.
+type User struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Username is unique within the library of the user, its TenantID
+	TenantID     uint   `json:"-" gorm:"uniqueIndex:idx_users_tenant_username;default:1"`
+	Username     string `json:"username" gorm:"size:64;uniqueIndex:idx_users_tenant_username"`
+	PasswordHash string `json:"-" gorm:"size:72"`
+	// Subject is the subject of the tokens of the identity provider the user
+	// logs in with, who then has no password
+	Subject string `json:"subject,omitempty" gorm:"size:255;index"`
+	// Role grants the permissions of the user: patron, librarian or admin
+	Role string `json:"role" gorm:"size:32"`
+	// FailedLogins counts the failed logins since the last successful one,
+	// locking the account until LockedUntil when there are too many
+	FailedLogins int        `json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+	// ResetHash is the hash of the token resetting the password, if any,
+	// valid until ResetExpiresAt
+	ResetHash      string     `json:"-" gorm:"size:64;index"`
+	ResetExpiresAt *time.Time `json:"-"`
+}
+
+// Session keeps a user logged in, until it expires or the user logs out. Only
+// the SHA-256 hash of its token is stored.
+type Session struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	Hash      string    `json:"-" gorm:"size:64;uniqueIndex"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
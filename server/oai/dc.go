@@ -0,0 +1,57 @@
+package oai
+
+import "library/models"
+
+const (
+	// DublinCorePrefix is the metadata prefix of unqualified Dublin Core.
+	DublinCorePrefix = "oai_dc"
+
+	dublinCoreSchema    = "http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+	dublinCoreNamespace = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	dcElementsNamespace = "http://purl.org/dc/elements/1.1/"
+)
+
+// DublinCore is an oai_dc metadata record.
+type DublinCore struct {
+	Namespace      string   `xml:"xmlns:oai_dc,attr"`
+	DCNamespace    string   `xml:"xmlns:dc,attr"`
+	XSINamespace   string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Title          string   `xml:"dc:title"`
+	Creators       []string `xml:"dc:creator"`
+	Subjects       []string `xml:"dc:subject,omitempty"`
+	Description    string   `xml:"dc:description,omitempty"`
+	Date           string   `xml:"dc:date,omitempty"`
+	Type           string   `xml:"dc:type"`
+	Identifiers    []string `xml:"dc:identifier,omitempty"`
+}
+
+var dublinCoreFormat = MetadataFormat{
+	MetadataPrefix:    DublinCorePrefix,
+	Schema:            dublinCoreSchema,
+	MetadataNamespace: dublinCoreNamespace,
+}
+
+// NewDublinCore maps a book onto unqualified Dublin Core.
+func NewDublinCore(book models.Book) *DublinCore {
+	dc := &DublinCore{
+		Namespace:      dublinCoreNamespace,
+		DCNamespace:    dcElementsNamespace,
+		XSINamespace:   xsiNamespace,
+		SchemaLocation: dublinCoreNamespace + " " + dublinCoreSchema,
+		Title:          book.Title,
+		Creators:       []string{book.Author},
+		Description:    book.Description,
+		Type:           "Text",
+	}
+	if book.GenreName != "" {
+		dc.Subjects = append(dc.Subjects, book.GenreName)
+	}
+	if !book.Published.IsZero() {
+		dc.Date = book.Published.UTC().Format(DayLayout)
+	}
+	if book.ISBN != "" {
+		dc.Identifiers = append(dc.Identifiers, "urn:isbn:"+book.ISBN)
+	}
+	return dc
+}
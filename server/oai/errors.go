@@ -0,0 +1,29 @@
+package oai
+
+import "fmt"
+
+// Error codes defined by the OAI-PMH 2.0 specification.
+const (
+	BadArgument             = "badArgument"
+	BadResumptionToken      = "badResumptionToken"
+	BadVerb                 = "badVerb"
+	CannotDisseminateFormat = "cannotDisseminateFormat"
+	IDDoesNotExist          = "idDoesNotExist"
+	NoRecordsMatch          = "noRecordsMatch"
+	NoMetadataFormats       = "noMetadataFormats"
+	NoSetHierarchy          = "noSetHierarchy"
+)
+
+// Error is an OAI-PMH protocol error, reported inside a successful HTTP response.
+type Error struct {
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+func (e Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newError(code, format string, args ...any) Error {
+	return Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,416 @@
+// Package oai implements an OAI-PMH 2.0 data provider exposing the catalogue
+// as unqualified Dublin Core, with genres as sets and deleted records kept
+// visible to incremental harvesters.
+package oai
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"library/models"
+)
+
+const (
+	protocolVersion = "2.0"
+	defaultPageSize = 100
+)
+
+// Verbs defined by the OAI-PMH 2.0 specification.
+const (
+	VerbIdentify            = "Identify"
+	VerbListMetadataFormats = "ListMetadataFormats"
+	VerbListSets            = "ListSets"
+	VerbListIdentifiers     = "ListIdentifiers"
+	VerbListRecords         = "ListRecords"
+	VerbGetRecord           = "GetRecord"
+)
+
+// ErrNotFound is returned by a Catalogue when a record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+var setSpecPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Catalogue is the source of the harvested records. Deleted books must be
+// returned along with live ones so that harvesters learn about deletions.
+type Catalogue interface {
+	// EarliestDatestamp returns the oldest datestamp of the catalogue.
+	EarliestDatestamp(ctx context.Context) (time.Time, error)
+	// Genres returns the distinct genres of the catalogue.
+	Genres(ctx context.Context) ([]string, error)
+	// Book returns a book by ID, or ErrNotFound.
+	Book(ctx context.Context, id uint) (models.Book, error)
+	// Books returns a page of books matching the query ordered by ID, along
+	// with the number of books matching the query regardless of AfterID.
+	Books(ctx context.Context, query Query) ([]models.Book, int64, error)
+}
+
+// Query selects the books of a harvest.
+type Query struct {
+	// From and Until bound the datestamp; zero values leave the range open.
+	From  time.Time
+	Until time.Time
+	// Genre restricts the harvest to a set; empty means all books.
+	Genre string
+	// AfterID resumes the harvest after the last book already returned.
+	AfterID uint
+	Limit   int
+}
+
+// Provider answers OAI-PMH requests.
+type Provider struct {
+	RepositoryName string
+	// RepositoryIdentifier namespaces item identifiers, as in "oai:library:42".
+	RepositoryIdentifier string
+	AdminEmail           string
+	PageSize             int
+	Catalogue            Catalogue
+	Now                  func() time.Time
+}
+
+// Datestamp returns the time a book last changed, including its deletion.
+func Datestamp(book models.Book) time.Time {
+	if book.DeletedAt.Valid {
+		return book.DeletedAt.Time.UTC()
+	}
+	return book.UpdatedAt.UTC()
+}
+
+// SetSpec returns the set specification of a genre, e.g. "science-fiction".
+func SetSpec(genre string) string {
+	return strings.Trim(setSpecPattern.ReplaceAllString(strings.ToLower(genre), "-"), "-")
+}
+
+// Identifier returns the OAI identifier of a book.
+func (p *Provider) Identifier(id uint) string {
+	return "oai:" + p.RepositoryIdentifier + ":" + strconv.FormatUint(uint64(id), 10)
+}
+
+// Handle answers a request made to baseURL with the given arguments. Protocol
+// errors are reported in the response; the returned error is only set when
+// the catalogue fails.
+func (p *Provider) Handle(ctx context.Context, baseURL string, args url.Values) (*Response, error) {
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	response := newResponse(baseURL, now())
+
+	err := p.handle(ctx, response, args)
+	var protocolError Error
+	if errors.As(err, &protocolError) {
+		response.Errors = append(response.Errors, protocolError)
+		// Arguments must not be echoed for badVerb and badArgument errors
+		if protocolError.Code == BadVerb || protocolError.Code == BadArgument {
+			response.Request = Request{BaseURL: baseURL}
+		}
+		return response, nil
+	}
+	return response, err
+}
+
+func (p *Provider) handle(ctx context.Context, response *Response, args url.Values) error {
+	verb := args.Get("verb")
+	response.Request = Request{
+		Verb:            verb,
+		Identifier:      args.Get("identifier"),
+		MetadataPrefix:  args.Get("metadataPrefix"),
+		From:            args.Get("from"),
+		Until:           args.Get("until"),
+		Set:             args.Get("set"),
+		ResumptionToken: args.Get("resumptionToken"),
+		BaseURL:         response.Request.BaseURL,
+	}
+
+	for key, values := range args {
+		if len(values) > 1 {
+			return newError(BadArgument, "argument %s is repeated", key)
+		}
+	}
+
+	switch verb {
+	case VerbIdentify:
+		if err := checkArguments(args, nil, nil); err != nil {
+			return err
+		}
+		return p.identify(ctx, response)
+	case VerbListMetadataFormats:
+		if err := checkArguments(args, nil, []string{"identifier"}); err != nil {
+			return err
+		}
+		return p.listMetadataFormats(ctx, response, args)
+	case VerbListSets:
+		if err := checkArguments(args, nil, []string{"resumptionToken"}); err != nil {
+			return err
+		}
+		return p.listSets(ctx, response, args)
+	case VerbListIdentifiers, VerbListRecords:
+		if args.Has("resumptionToken") {
+			if err := checkArguments(args, []string{"resumptionToken"}, nil); err != nil {
+				return err
+			}
+		} else if err := checkArguments(args, []string{"metadataPrefix"}, []string{"from", "until", "set"}); err != nil {
+			return err
+		}
+		return p.list(ctx, response, verb, args)
+	case VerbGetRecord:
+		if err := checkArguments(args, []string{"identifier", "metadataPrefix"}, nil); err != nil {
+			return err
+		}
+		return p.getRecord(ctx, response, args)
+	case "":
+		return newError(BadVerb, "missing verb argument")
+	}
+	return newError(BadVerb, "illegal verb %s", verb)
+}
+
+// checkArguments verifies that all the required arguments are present and
+// that no argument other than the required and optional ones is given.
+func checkArguments(args url.Values, required, optional []string) error {
+	allowed := map[string]bool{"verb": true}
+	for _, key := range required {
+		if args.Get(key) == "" {
+			return newError(BadArgument, "missing required argument %s", key)
+		}
+		allowed[key] = true
+	}
+	for _, key := range optional {
+		allowed[key] = true
+	}
+	for key := range args {
+		if !allowed[key] {
+			return newError(BadArgument, "illegal argument %s", key)
+		}
+	}
+	return nil
+}
+
+func (p *Provider) identify(ctx context.Context, response *Response) error {
+	earliest, err := p.Catalogue.EarliestDatestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if earliest.IsZero() {
+		earliest = time.Unix(0, 0)
+	}
+
+	response.Identify = &Identify{
+		RepositoryName:    p.RepositoryName,
+		BaseURL:           response.Request.BaseURL,
+		ProtocolVersion:   protocolVersion,
+		AdminEmail:        p.AdminEmail,
+		EarliestDatestamp: earliest.UTC().Format(DatestampLayout),
+		DeletedRecord:     "persistent",
+		Granularity:       "YYYY-MM-DDThh:mm:ssZ",
+	}
+	return nil
+}
+
+func (p *Provider) listMetadataFormats(ctx context.Context, response *Response, args url.Values) error {
+	if identifier := args.Get("identifier"); identifier != "" {
+		if _, err := p.book(ctx, identifier); err != nil {
+			return err
+		}
+	}
+
+	response.ListMetadataFormats = &ListMetadataFormats{MetadataFormats: []MetadataFormat{dublinCoreFormat}}
+	return nil
+}
+
+func (p *Provider) listSets(ctx context.Context, response *Response, args url.Values) error {
+	if token := args.Get("resumptionToken"); token != "" {
+		return newError(BadResumptionToken, "the list of sets is never split")
+	}
+
+	genres, err := p.Catalogue.Genres(ctx)
+	if err != nil {
+		return err
+	}
+
+	sets := &ListSets{}
+	seen := map[string]bool{}
+	for _, genre := range genres {
+		spec := SetSpec(genre)
+		if spec == "" || seen[spec] {
+			continue
+		}
+		seen[spec] = true
+		sets.Sets = append(sets.Sets, Set{SetSpec: spec, SetName: genre})
+	}
+	response.ListSets = sets
+	return nil
+}
+
+func (p *Provider) list(ctx context.Context, response *Response, verb string, args url.Values) error {
+	var state token
+	var err error
+	if encoded := args.Get("resumptionToken"); encoded != "" {
+		state, err = decodeToken(encoded)
+		if err != nil {
+			return err
+		}
+	} else {
+		state = token{MetadataPrefix: args.Get("metadataPrefix"), From: args.Get("from"), Until: args.Get("until"), Set: args.Get("set")}
+	}
+
+	if state.MetadataPrefix != DublinCorePrefix {
+		return newError(CannotDisseminateFormat, "metadata format %s is not supported", state.MetadataPrefix)
+	}
+
+	query, err := p.query(ctx, state)
+	if err != nil {
+		return err
+	}
+
+	books, total, err := p.Catalogue.Books(ctx, query)
+	if err != nil {
+		return err
+	}
+	if len(books) == 0 && state.Cursor == 0 {
+		return newError(NoRecordsMatch, "no records match the request")
+	}
+
+	var resumptionToken *ResumptionToken
+	served := state.Cursor + int64(len(books))
+	if served < total && len(books) > 0 {
+		next := state
+		next.AfterID = books[len(books)-1].ID
+		next.Cursor = served
+		resumptionToken = &ResumptionToken{CompleteListSize: total, Cursor: state.Cursor, Token: next.encode()}
+	} else if state.Cursor > 0 {
+		// The last page of a split list carries an empty token
+		resumptionToken = &ResumptionToken{CompleteListSize: total, Cursor: state.Cursor}
+	}
+
+	if verb == VerbListIdentifiers {
+		identifiers := &ListIdentifiers{ResumptionToken: resumptionToken}
+		for _, book := range books {
+			identifiers.Headers = append(identifiers.Headers, p.header(book))
+		}
+		response.ListIdentifiers = identifiers
+		return nil
+	}
+
+	records := &ListRecords{ResumptionToken: resumptionToken}
+	for _, book := range books {
+		records.Records = append(records.Records, p.record(book))
+	}
+	response.ListRecords = records
+	return nil
+}
+
+func (p *Provider) query(ctx context.Context, state token) (Query, error) {
+	pageSize := p.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	query := Query{AfterID: state.AfterID, Limit: pageSize}
+
+	from, fromGranularity, err := parseDatestamp(state.From, false)
+	if err != nil {
+		return query, err
+	}
+	until, untilGranularity, err := parseDatestamp(state.Until, true)
+	if err != nil {
+		return query, err
+	}
+	if state.From != "" && state.Until != "" {
+		if fromGranularity != untilGranularity {
+			return query, newError(BadArgument, "from and until must have the same granularity")
+		}
+		if from.After(until) {
+			return query, newError(BadArgument, "from must not be later than until")
+		}
+	}
+	query.From, query.Until = from, until
+
+	if state.Set != "" {
+		genres, err := p.Catalogue.Genres(ctx)
+		if err != nil {
+			return query, err
+		}
+		for _, genre := range genres {
+			if SetSpec(genre) == state.Set {
+				query.Genre = genre
+				break
+			}
+		}
+		if query.Genre == "" {
+			return query, newError(NoRecordsMatch, "set %s does not exist", state.Set)
+		}
+	}
+
+	return query, nil
+}
+
+// parseDatestamp parses a from or until argument in either granularity. Day
+// granularity upper bounds include the whole day.
+func parseDatestamp(value string, upperBound bool) (time.Time, string, error) {
+	if value == "" {
+		return time.Time{}, "", nil
+	}
+	if datestamp, err := time.Parse(DatestampLayout, value); err == nil {
+		return datestamp, DatestampLayout, nil
+	}
+	datestamp, err := time.Parse(DayLayout, value)
+	if err != nil {
+		return time.Time{}, "", newError(BadArgument, "invalid datestamp %s", value)
+	}
+	if upperBound {
+		datestamp = datestamp.Add(24*time.Hour - time.Second)
+	}
+	return datestamp, DayLayout, nil
+}
+
+func (p *Provider) getRecord(ctx context.Context, response *Response, args url.Values) error {
+	if prefix := args.Get("metadataPrefix"); prefix != DublinCorePrefix {
+		return newError(CannotDisseminateFormat, "metadata format %s is not supported", prefix)
+	}
+
+	book, err := p.book(ctx, args.Get("identifier"))
+	if err != nil {
+		return err
+	}
+	response.GetRecord = &GetRecord{Record: p.record(book)}
+	return nil
+}
+
+func (p *Provider) book(ctx context.Context, identifier string) (models.Book, error) {
+	prefix := "oai:" + p.RepositoryIdentifier + ":"
+	id, err := strconv.ParseUint(strings.TrimPrefix(identifier, prefix), 10, 32)
+	if !strings.HasPrefix(identifier, prefix) || err != nil {
+		return models.Book{}, newError(IDDoesNotExist, "unknown identifier %s", identifier)
+	}
+
+	book, err := p.Catalogue.Book(ctx, uint(id))
+	if errors.Is(err, ErrNotFound) {
+		return models.Book{}, newError(IDDoesNotExist, "unknown identifier %s", identifier)
+	}
+	return book, err
+}
+
+func (p *Provider) header(book models.Book) Header {
+	header := Header{
+		Identifier: p.Identifier(book.ID),
+		Datestamp:  Datestamp(book).Format(DatestampLayout),
+	}
+	if spec := SetSpec(book.GenreName); spec != "" {
+		header.SetSpecs = []string{spec}
+	}
+	if book.DeletedAt.Valid {
+		header.Status = "deleted"
+	}
+	return header
+}
+
+func (p *Provider) record(book models.Book) Record {
+	record := Record{Header: p.header(book)}
+	if !book.DeletedAt.Valid {
+		record.Metadata = &Metadata{DublinCore: NewDublinCore(book)}
+	}
+	return record
+}
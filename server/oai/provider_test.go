@@ -0,0 +1,183 @@
+package oai
+
+import (
+	"context"
+	"encoding/xml"
+	"library/models"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// memoryCatalogue is an in-memory Catalogue for the tests.
+type memoryCatalogue struct {
+	books []models.Book
+}
+
+func (m memoryCatalogue) EarliestDatestamp(ctx context.Context) (time.Time, error) {
+	var earliest time.Time
+	for _, book := range m.books {
+		if earliest.IsZero() || Datestamp(book).Before(earliest) {
+			earliest = Datestamp(book)
+		}
+	}
+	return earliest, nil
+}
+
+func (m memoryCatalogue) Genres(ctx context.Context) ([]string, error) {
+	seen := map[string]bool{}
+	var genres []string
+	for _, book := range m.books {
+		if !seen[book.GenreName] {
+			seen[book.GenreName] = true
+			genres = append(genres, book.GenreName)
+		}
+	}
+	sort.Strings(genres)
+	return genres, nil
+}
+
+func (m memoryCatalogue) Book(ctx context.Context, id uint) (models.Book, error) {
+	for _, book := range m.books {
+		if book.ID == id {
+			return book, nil
+		}
+	}
+	return models.Book{}, ErrNotFound
+}
+
+func (m memoryCatalogue) Books(ctx context.Context, query Query) ([]models.Book, int64, error) {
+	var matches []models.Book
+	for _, book := range m.books {
+		datestamp := Datestamp(book)
+		if (!query.From.IsZero() && datestamp.Before(query.From)) ||
+			(!query.Until.IsZero() && datestamp.After(query.Until)) ||
+			(query.Genre != "" && book.GenreName != query.Genre) {
+			continue
+		}
+		matches = append(matches, book)
+	}
+
+	var page []models.Book
+	for _, book := range matches {
+		if book.ID > query.AfterID && len(page) < query.Limit {
+			page = append(page, book)
+		}
+	}
+	return page, int64(len(matches)), nil
+}
+
+func newTestProvider() *Provider {
+	day := func(d int) time.Time { return time.Date(2023, 9, d, 12, 0, 0, 0, time.UTC) }
+	return &Provider{
+		RepositoryName:       "Library",
+		RepositoryIdentifier: "library",
+		AdminEmail:           "admin@example.com",
+		PageSize:             2,
+		Now:                  func() time.Time { return day(30) },
+		Catalogue: memoryCatalogue{books: []models.Book{
+			{Model: gorm.Model{ID: 1, UpdatedAt: day(1)}, Title: "Dune", Author: "Frank Herbert", GenreName: "Science Fiction"},
+			{Model: gorm.Model{ID: 2, UpdatedAt: day(2)}, Title: "Emma", Author: "Jane Austen", GenreName: "Romance"},
+			{Model: gorm.Model{ID: 3, UpdatedAt: day(3)}, Title: "Neuromancer", Author: "William Gibson", GenreName: "Science Fiction"},
+			{Model: gorm.Model{ID: 4, UpdatedAt: day(4), DeletedAt: gorm.DeletedAt{Time: day(5), Valid: true}}, Title: "Solaris", Author: "Stanislaw Lem", GenreName: "Science Fiction"},
+		}},
+	}
+}
+
+func handle(t *testing.T, provider *Provider, query string) *Response {
+	args, err := url.ParseQuery(query)
+	assert.NoError(t, err)
+	response, err := provider.Handle(context.Background(), "http://localhost/oai", args)
+	assert.NoError(t, err)
+
+	_, err = xml.Marshal(response)
+	assert.NoError(t, err)
+	return response
+}
+
+func TestIdentify(t *testing.T) {
+	response := handle(t, newTestProvider(), "verb=Identify")
+	assert.Empty(t, response.Errors)
+	assert.Equal(t, "2.0", response.Identify.ProtocolVersion)
+	assert.Equal(t, "2023-09-01T12:00:00Z", response.Identify.EarliestDatestamp)
+	assert.Equal(t, "persistent", response.Identify.DeletedRecord)
+}
+
+func TestProtocolErrors(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Query       string
+		Code        string
+	}{
+		{Description: "Missing Verb", Query: "", Code: BadVerb},
+		{Description: "Illegal Verb", Query: "verb=Delete", Code: BadVerb},
+		{Description: "Illegal Argument", Query: "verb=Identify&set=fiction", Code: BadArgument},
+		{Description: "Missing Prefix", Query: "verb=ListRecords", Code: BadArgument},
+		{Description: "Repeated Argument", Query: "verb=ListRecords&metadataPrefix=oai_dc&metadataPrefix=oai_dc", Code: BadArgument},
+		{Description: "Unknown Format", Query: "verb=ListRecords&metadataPrefix=marc21", Code: CannotDisseminateFormat},
+		{Description: "Mixed Granularity", Query: "verb=ListRecords&metadataPrefix=oai_dc&from=2023-09-01&until=2023-09-02T00:00:00Z", Code: BadArgument},
+		{Description: "Bad Token", Query: "verb=ListRecords&resumptionToken=garbage", Code: BadResumptionToken},
+		{Description: "Exclusive Token", Query: "verb=ListRecords&resumptionToken=abc&metadataPrefix=oai_dc", Code: BadArgument},
+		{Description: "Unknown Identifier", Query: "verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:library:99", Code: IDDoesNotExist},
+		{Description: "No Records", Query: "verb=ListIdentifiers&metadataPrefix=oai_dc&from=2024-01-01", Code: NoRecordsMatch},
+		{Description: "Unknown Set", Query: "verb=ListIdentifiers&metadataPrefix=oai_dc&set=poetry", Code: NoRecordsMatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response := handle(t, newTestProvider(), tc.Query)
+			assert.Len(t, response.Errors, 1)
+			assert.Equal(t, tc.Code, response.Errors[0].Code)
+		})
+	}
+}
+
+func TestListSets(t *testing.T) {
+	response := handle(t, newTestProvider(), "verb=ListSets")
+	assert.Equal(t, []Set{{SetSpec: "romance", SetName: "Romance"}, {SetSpec: "science-fiction", SetName: "Science Fiction"}}, response.ListSets.Sets)
+}
+
+func TestListRecordsWithResumption(t *testing.T) {
+	provider := newTestProvider()
+
+	response := handle(t, provider, "verb=ListRecords&metadataPrefix=oai_dc&set=science-fiction")
+	assert.Empty(t, response.Errors)
+	assert.Len(t, response.ListRecords.Records, 2)
+	assert.Equal(t, "oai:library:1", response.ListRecords.Records[0].Header.Identifier)
+	assert.Equal(t, "Dune", response.ListRecords.Records[0].Metadata.DublinCore.Title)
+	token := response.ListRecords.ResumptionToken
+	assert.Equal(t, int64(3), token.CompleteListSize)
+	assert.NotEmpty(t, token.Token)
+
+	response = handle(t, provider, "verb=ListRecords&resumptionToken="+token.Token)
+	assert.Empty(t, response.Errors)
+	assert.Len(t, response.ListRecords.Records, 1)
+	deleted := response.ListRecords.Records[0]
+	assert.Equal(t, "deleted", deleted.Header.Status)
+	assert.Equal(t, "2023-09-05T12:00:00Z", deleted.Header.Datestamp)
+	assert.Nil(t, deleted.Metadata)
+	assert.Empty(t, response.ListRecords.ResumptionToken.Token)
+	assert.Equal(t, int64(2), response.ListRecords.ResumptionToken.Cursor)
+}
+
+func TestIncrementalHarvest(t *testing.T) {
+	response := handle(t, newTestProvider(), "verb=ListIdentifiers&metadataPrefix=oai_dc&from=2023-09-03&until=2023-09-05")
+	assert.Empty(t, response.Errors)
+	assert.Len(t, response.ListIdentifiers.Headers, 2)
+	assert.Equal(t, "oai:library:3", response.ListIdentifiers.Headers[0].Identifier)
+	assert.Equal(t, "oai:library:4", response.ListIdentifiers.Headers[1].Identifier)
+	assert.Nil(t, response.ListIdentifiers.ResumptionToken)
+}
+
+func TestGetRecord(t *testing.T) {
+	response := handle(t, newTestProvider(), "verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:library:2")
+	assert.Empty(t, response.Errors)
+	dc := response.GetRecord.Record.Metadata.DublinCore
+	assert.Equal(t, "Emma", dc.Title)
+	assert.Equal(t, []string{"Jane Austen"}, dc.Creators)
+	assert.Equal(t, []string{"Romance"}, dc.Subjects)
+}
@@ -0,0 +1,135 @@
+package oai
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const (
+	namespace      = "http://www.openarchives.org/OAI/2.0/"
+	schemaLocation = "http://www.openarchives.org/OAI/2.0/ http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	xsiNamespace   = "http://www.w3.org/2001/XMLSchema-instance"
+
+	// DatestampLayout is the seconds granularity of datestamps.
+	DatestampLayout = "2006-01-02T15:04:05Z"
+	// DayLayout is the day granularity of datestamps.
+	DayLayout = "2006-01-02"
+)
+
+// Response is the OAI-PMH envelope returned for every request.
+type Response struct {
+	XMLName        xml.Name `xml:"OAI-PMH"`
+	Namespace      string   `xml:"xmlns,attr"`
+	XSINamespace   string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	ResponseDate   string   `xml:"responseDate"`
+	Request        Request  `xml:"request"`
+
+	Errors              []Error              `xml:"error,omitempty"`
+	Identify            *Identify            `xml:"Identify,omitempty"`
+	ListMetadataFormats *ListMetadataFormats `xml:"ListMetadataFormats,omitempty"`
+	ListSets            *ListSets            `xml:"ListSets,omitempty"`
+	ListIdentifiers     *ListIdentifiers     `xml:"ListIdentifiers,omitempty"`
+	ListRecords         *ListRecords         `xml:"ListRecords,omitempty"`
+	GetRecord           *GetRecord           `xml:"GetRecord,omitempty"`
+}
+
+// Request echoes the verb and arguments of a request. Arguments are omitted
+// when the request produced a badVerb or badArgument error.
+type Request struct {
+	Verb            string `xml:"verb,attr,omitempty"`
+	Identifier      string `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string `xml:"metadataPrefix,attr,omitempty"`
+	From            string `xml:"from,attr,omitempty"`
+	Until           string `xml:"until,attr,omitempty"`
+	Set             string `xml:"set,attr,omitempty"`
+	ResumptionToken string `xml:"resumptionToken,attr,omitempty"`
+	BaseURL         string `xml:",chardata"`
+}
+
+// Identify describes the repository.
+type Identify struct {
+	RepositoryName    string `xml:"repositoryName"`
+	BaseURL           string `xml:"baseURL"`
+	ProtocolVersion   string `xml:"protocolVersion"`
+	AdminEmail        string `xml:"adminEmail"`
+	EarliestDatestamp string `xml:"earliestDatestamp"`
+	DeletedRecord     string `xml:"deletedRecord"`
+	Granularity       string `xml:"granularity"`
+}
+
+// ListMetadataFormats lists the metadata formats the repository disseminates.
+type ListMetadataFormats struct {
+	MetadataFormats []MetadataFormat `xml:"metadataFormat"`
+}
+
+// MetadataFormat describes a metadata format.
+type MetadataFormat struct {
+	MetadataPrefix    string `xml:"metadataPrefix"`
+	Schema            string `xml:"schema"`
+	MetadataNamespace string `xml:"metadataNamespace"`
+}
+
+// ListSets lists the sets of the repository.
+type ListSets struct {
+	Sets []Set `xml:"set"`
+}
+
+// Set is a group of records, here a genre.
+type Set struct {
+	SetSpec string `xml:"setSpec"`
+	SetName string `xml:"setName"`
+}
+
+// ListIdentifiers lists the headers of matching records.
+type ListIdentifiers struct {
+	Headers         []Header         `xml:"header"`
+	ResumptionToken *ResumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+// ListRecords lists matching records.
+type ListRecords struct {
+	Records         []Record         `xml:"record"`
+	ResumptionToken *ResumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+// GetRecord holds a single record.
+type GetRecord struct {
+	Record Record `xml:"record"`
+}
+
+// Record is an item's header and, unless it was deleted, its metadata.
+type Record struct {
+	Header   Header    `xml:"header"`
+	Metadata *Metadata `xml:"metadata,omitempty"`
+}
+
+// Header identifies an item and tells when it last changed.
+type Header struct {
+	Status     string   `xml:"status,attr,omitempty"`
+	Identifier string   `xml:"identifier"`
+	Datestamp  string   `xml:"datestamp"`
+	SetSpecs   []string `xml:"setSpec"`
+}
+
+// Metadata wraps the record metadata in the requested format.
+type Metadata struct {
+	DublinCore *DublinCore `xml:"oai_dc:dc"`
+}
+
+// ResumptionToken lets harvesters continue an incomplete list.
+type ResumptionToken struct {
+	CompleteListSize int64  `xml:"completeListSize,attr"`
+	Cursor           int64  `xml:"cursor,attr"`
+	Token            string `xml:",chardata"`
+}
+
+func newResponse(baseURL string, now time.Time) *Response {
+	return &Response{
+		Namespace:      namespace,
+		XSINamespace:   xsiNamespace,
+		SchemaLocation: schemaLocation,
+		ResponseDate:   now.UTC().Format(DatestampLayout),
+		Request:        Request{BaseURL: baseURL},
+	}
+}
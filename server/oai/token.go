@@ -0,0 +1,32 @@
+package oai
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// token is the state of a split list, handed to harvesters as an opaque
+// resumption token. Harvests resume after the last returned ID, so records
+// added or changed while harvesting do not shift the following pages.
+type token struct {
+	MetadataPrefix string `json:"p"`
+	From           string `json:"f,omitempty"`
+	Until          string `json:"u,omitempty"`
+	Set            string `json:"s,omitempty"`
+	AfterID        uint   `json:"a"`
+	Cursor         int64  `json:"c"`
+}
+
+func (t token) encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeToken(encoded string) (token, error) {
+	var t token
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(data, &t) != nil || t.MetadataPrefix == "" {
+		return token{}, newError(BadResumptionToken, "invalid resumption token")
+	}
+	return t, nil
+}
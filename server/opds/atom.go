@@ -0,0 +1,181 @@
+package opds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"library/models"
+	"net/url"
+	"time"
+)
+
+const (
+	atomNamespace       = "http://www.w3.org/2005/Atom"
+	dcTermsNamespace    = "http://purl.org/dc/terms/"
+	opdsNamespace       = "http://opds-spec.org/2010/catalog"
+	openSearchNamespace = "http://a9.com/-/spec/opensearch/1.1/"
+	threadNamespace     = "http://purl.org/syndication/thread/1.0"
+)
+
+// Feed is an OPDS 1.2 catalogue feed.
+type Feed struct {
+	XMLName             xml.Name `xml:"feed"`
+	Namespace           string   `xml:"xmlns,attr"`
+	DCNamespace         string   `xml:"xmlns:dc,attr"`
+	OPDSNamespace       string   `xml:"xmlns:opds,attr"`
+	OpenSearchNamespace string   `xml:"xmlns:opensearch,attr"`
+	ThreadNamespace     string   `xml:"xmlns:thr,attr"`
+
+	ID           string  `xml:"id"`
+	Title        string  `xml:"title"`
+	Updated      string  `xml:"updated"`
+	Author       *Person `xml:"author,omitempty"`
+	Links        []Link  `xml:"link"`
+	TotalResults int64   `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage int     `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   int     `xml:"opensearch:startIndex,omitempty"`
+	Entries      []Entry `xml:"entry"`
+}
+
+// Entry is a navigation or acquisition entry of a feed.
+type Entry struct {
+	ID         string     `xml:"id"`
+	Title      string     `xml:"title"`
+	Updated    string     `xml:"updated"`
+	Authors    []Person   `xml:"author,omitempty"`
+	Issued     string     `xml:"dc:issued,omitempty"`
+	Identifier string     `xml:"dc:identifier,omitempty"`
+	Categories []Category `xml:"category,omitempty"`
+	Summary    *Text      `xml:"summary,omitempty"`
+	Content    *Text      `xml:"content,omitempty"`
+	Links      []Link     `xml:"link"`
+}
+
+// Link is an Atom link.
+type Link struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count int64  `xml:"thr:count,attr,omitempty"`
+}
+
+// Person is an Atom person construct.
+type Person struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+// Category is an Atom category, used for genres.
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+// Text is an Atom text construct.
+type Text struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Atom renders a page as an OPDS 1.2 feed.
+func (c Catalog) Atom(page Page) Feed {
+	feed := Feed{
+		Namespace:           atomNamespace,
+		DCNamespace:         dcTermsNamespace,
+		OPDSNamespace:       opdsNamespace,
+		OpenSearchNamespace: openSearchNamespace,
+		ThreadNamespace:     threadNamespace,
+		ID:                  page.ID,
+		Title:               page.Title,
+		Updated:             atomTime(page.Updated),
+		Author:              &Person{Name: c.Title, URI: c.Root},
+	}
+
+	mime := MIMENavigation
+	if page.Kind == Acquisition {
+		mime = MIMEAcquisition
+		feed.TotalResults = page.Total
+		feed.ItemsPerPage = page.PerPage
+		feed.StartIndex = (page.Number-1)*page.PerPage + 1
+	}
+
+	self := page.Href
+	if page.Kind == Acquisition && page.Number > 1 {
+		self = page.pageHref(page.Number)
+	}
+	feed.Links = append(feed.Links,
+		Link{Rel: RelSelf, Href: c.Root + self, Type: mime},
+		Link{Rel: RelStart, Href: c.Root, Type: MIMENavigation, Title: c.Title},
+		Link{Rel: RelSearch, Href: c.Root + "/opensearch.xml", Type: MIMEOpenSearch},
+	)
+	if page.Href != "" {
+		feed.Links = append(feed.Links, Link{Rel: RelUp, Href: c.Root, Type: MIMENavigation})
+	}
+	for _, link := range page.paginationLinks() {
+		feed.Links = append(feed.Links, Link{Rel: link[0], Href: c.Root + link[1], Type: mime})
+	}
+
+	for _, item := range page.Navigation {
+		feed.Entries = append(feed.Entries, c.navigationEntry(page, item))
+	}
+	for _, book := range page.Books {
+		feed.Entries = append(feed.Entries, c.acquisitionEntry(book))
+	}
+
+	return feed
+}
+
+func (c Catalog) navigationEntry(page Page, item NavigationItem) Entry {
+	mime := MIMENavigation
+	if item.Kind == Acquisition {
+		mime = MIMEAcquisition
+	}
+
+	entry := Entry{
+		ID:      "urn:library:opds:" + item.Href,
+		Title:   item.Title,
+		Updated: atomTime(page.Updated),
+		Links:   []Link{{Rel: RelSubsection, Href: c.Root + item.Href, Type: mime, Count: item.Count}},
+	}
+	switch {
+	case item.Count == 1:
+		entry.Content = &Text{Type: "text", Value: "1 book"}
+	case item.Count > 1:
+		entry.Content = &Text{Type: "text", Value: fmt.Sprintf("%d books", item.Count)}
+	}
+	return entry
+}
+
+func (c Catalog) acquisitionEntry(book models.Book) Entry {
+	entry := Entry{
+		ID:      bookID(book),
+		Title:   book.Title,
+		Updated: atomTime(book.UpdatedAt),
+		Authors: []Person{{Name: book.Author, URI: c.Root + "/authors/" + url.PathEscape(book.Author)}},
+		Links: []Link{
+			{Rel: RelBorrow, Href: c.BookURL(book.ID), Type: "application/json"},
+			{Rel: RelRelated, Href: c.Root + "/authors/" + url.PathEscape(book.Author), Type: MIMEAcquisition, Title: "More by " + book.Author},
+		},
+	}
+	if !book.Published.IsZero() {
+		entry.Issued = book.Published.UTC().Format("2006-01-02")
+	}
+	if book.ISBN != "" {
+		entry.Identifier = "urn:isbn:" + book.ISBN
+	}
+	if book.GenreName != "" {
+		entry.Categories = []Category{{Term: book.GenreName, Label: book.GenreName}}
+		entry.Links = append(entry.Links, Link{Rel: RelCollection, Href: c.Root + "/genres/" + url.PathEscape(book.GenreName), Type: MIMEAcquisition, Title: book.GenreName})
+	}
+	if book.Description != "" {
+		entry.Summary = &Text{Type: "text", Value: book.Description}
+	}
+	return entry
+}
+
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(time.RFC3339)
+}
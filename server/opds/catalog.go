@@ -0,0 +1,120 @@
+// Package opds renders catalogue pages as OPDS 1.2 (Atom) and OPDS 2.0 (JSON)
+// feeds for e-reader applications.
+package opds
+
+import (
+	"library/models"
+	"strconv"
+	"time"
+)
+
+// Media types of OPDS documents.
+const (
+	MIMENavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	MIMEAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	MIMEEntry       = "application/atom+xml;type=entry;profile=opds-catalog"
+	MIMEOPDS2       = "application/opds+json"
+	MIMEOPDS2Entry  = "application/opds-publication+json"
+	MIMEOpenSearch  = "application/opensearchdescription+xml"
+)
+
+// Link relations used by OPDS catalogues.
+const (
+	RelSelf       = "self"
+	RelStart      = "start"
+	RelUp         = "up"
+	RelSearch     = "search"
+	RelFirst      = "first"
+	RelPrevious   = "previous"
+	RelNext       = "next"
+	RelLast       = "last"
+	RelAlternate  = "alternate"
+	RelSubsection = "subsection"
+	RelNew        = "http://opds-spec.org/sort/new"
+	RelBorrow     = "http://opds-spec.org/acquisition/borrow"
+	RelRelated    = "related"
+	RelCollection = "collection"
+)
+
+// Kind tells whether a catalogue page lists other pages or books.
+type Kind int
+
+const (
+	Navigation Kind = iota
+	Acquisition
+)
+
+// Page is a catalogue page independent of its OPDS version. Hrefs are paths
+// relative to the catalogue root, such as "/genres".
+type Page struct {
+	ID      string
+	Title   string
+	Href    string
+	Updated time.Time
+	Kind    Kind
+
+	Navigation []NavigationItem
+	Books      []models.Book
+
+	// Number is the 1-based page number, PerPage the page size and Total the
+	// number of books across all pages. They only apply to acquisition pages.
+	Number  int
+	PerPage int
+	Total   int64
+}
+
+// NavigationItem links to another catalogue page.
+type NavigationItem struct {
+	Title string
+	Href  string
+	Kind  Kind
+	Count int64
+}
+
+// Catalog holds the absolute URLs the feeds link to.
+type Catalog struct {
+	Title string
+	// Root is the absolute URL of the catalogue root, e.g. "http://host/opds".
+	Root string
+	// BookURL returns the absolute URL of the JSON representation of a book.
+	BookURL func(id uint) string
+}
+
+// LastPage returns the number of the last page of an acquisition page.
+func (p Page) LastPage() int {
+	if p.PerPage <= 0 || p.Total == 0 {
+		return 1
+	}
+	return int((p.Total + int64(p.PerPage) - 1) / int64(p.PerPage))
+}
+
+// pageHref returns the href of another page of the same listing.
+func (p Page) pageHref(number int) string {
+	separator := "?"
+	for _, r := range p.Href {
+		if r == '?' {
+			separator = "&"
+			break
+		}
+	}
+	return p.Href + separator + "page=" + strconv.Itoa(number)
+}
+
+// paginationLinks returns the first, previous, next and last page hrefs by relation.
+func (p Page) paginationLinks() [][2]string {
+	if p.Kind != Acquisition || p.LastPage() <= 1 {
+		return nil
+	}
+	links := [][2]string{{RelFirst, p.pageHref(1)}}
+	if p.Number > 1 {
+		links = append(links, [2]string{RelPrevious, p.pageHref(p.Number - 1)})
+	}
+	if p.Number < p.LastPage() {
+		links = append(links, [2]string{RelNext, p.pageHref(p.Number + 1)})
+	}
+	return append(links, [2]string{RelLast, p.pageHref(p.LastPage())})
+}
+
+func bookID(book models.Book) string {
+	return "urn:library:book:" + strconv.FormatUint(uint64(book.ID), 10)
+}
@@ -0,0 +1,131 @@
+package opds
+
+import (
+	"library/models"
+	"net/url"
+)
+
+// Feed2 is an OPDS 2.0 catalogue feed.
+type Feed2 struct {
+	Metadata     Metadata2      `json:"metadata"`
+	Links        []Link2        `json:"links"`
+	Navigation   []Link2        `json:"navigation,omitempty"`
+	Publications []Publication2 `json:"publications,omitempty"`
+}
+
+// Metadata2 describes an OPDS 2.0 feed.
+type Metadata2 struct {
+	Title         string `json:"title"`
+	Modified      string `json:"modified,omitempty"`
+	NumberOfItems int64  `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int    `json:"itemsPerPage,omitempty"`
+	CurrentPage   int    `json:"currentPage,omitempty"`
+}
+
+// Link2 is an OPDS 2.0 link.
+type Link2 struct {
+	Rel        string          `json:"rel,omitempty"`
+	Href       string          `json:"href"`
+	Type       string          `json:"type,omitempty"`
+	Title      string          `json:"title,omitempty"`
+	Templated  bool            `json:"templated,omitempty"`
+	Properties *LinkProperties `json:"properties,omitempty"`
+}
+
+// LinkProperties holds the OPDS 2.0 link properties.
+type LinkProperties struct {
+	NumberOfItems int64 `json:"numberOfItems,omitempty"`
+}
+
+// Publication2 is an OPDS 2.0 publication.
+type Publication2 struct {
+	Metadata PublicationMetadata `json:"metadata"`
+	Links    []Link2             `json:"links"`
+}
+
+// PublicationMetadata follows the Readium Web Publication Manifest metadata.
+type PublicationMetadata struct {
+	Type        string        `json:"@type"`
+	Identifier  string        `json:"identifier"`
+	Title       string        `json:"title"`
+	Author      []Contributor `json:"author"`
+	Published   string        `json:"published,omitempty"`
+	Modified    string        `json:"modified,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Subject     []Subject     `json:"subject,omitempty"`
+}
+
+// Contributor is a named contributor linking to their other publications.
+type Contributor struct {
+	Name  string  `json:"name"`
+	Links []Link2 `json:"links,omitempty"`
+}
+
+// Subject is a publication subject linking to the matching collection.
+type Subject struct {
+	Name  string  `json:"name"`
+	Links []Link2 `json:"links,omitempty"`
+}
+
+// JSON renders a page as an OPDS 2.0 feed. Its links point to the OPDS 2.0
+// catalogue rooted at Root + "/v2".
+func (c Catalog) JSON(page Page) Feed2 {
+	root := c.Root + "/v2"
+	feed := Feed2{
+		Metadata: Metadata2{Title: page.Title, Modified: atomTime(page.Updated)},
+		Links: []Link2{
+			{Rel: RelSelf, Href: root + page.Href, Type: MIMEOPDS2},
+			{Rel: RelStart, Href: root, Type: MIMEOPDS2},
+			{Rel: RelSearch, Href: root + "/search{?q}", Type: MIMEOPDS2, Templated: true},
+		},
+	}
+
+	if page.Kind == Acquisition {
+		feed.Metadata.NumberOfItems = page.Total
+		feed.Metadata.ItemsPerPage = page.PerPage
+		feed.Metadata.CurrentPage = page.Number
+		if page.Number > 1 {
+			feed.Links[0].Href = root + page.pageHref(page.Number)
+		}
+	}
+	for _, link := range page.paginationLinks() {
+		feed.Links = append(feed.Links, Link2{Rel: link[0], Href: root + link[1], Type: MIMEOPDS2})
+	}
+
+	for _, item := range page.Navigation {
+		link := Link2{Rel: RelSubsection, Href: root + item.Href, Type: MIMEOPDS2, Title: item.Title}
+		if item.Count > 0 {
+			link.Properties = &LinkProperties{NumberOfItems: item.Count}
+		}
+		feed.Navigation = append(feed.Navigation, link)
+	}
+	for _, book := range page.Books {
+		feed.Publications = append(feed.Publications, c.publication(root, book))
+	}
+
+	return feed
+}
+
+func (c Catalog) publication(root string, book models.Book) Publication2 {
+	publication := Publication2{
+		Metadata: PublicationMetadata{
+			Type:        "http://schema.org/Book",
+			Identifier:  bookID(book),
+			Title:       book.Title,
+			Author:      []Contributor{{Name: book.Author, Links: []Link2{{Href: root + "/authors/" + url.PathEscape(book.Author), Type: MIMEOPDS2}}}},
+			Modified:    atomTime(book.UpdatedAt),
+			Description: book.Description,
+		},
+		Links: []Link2{{Rel: RelBorrow, Href: c.BookURL(book.ID), Type: "application/json"}},
+	}
+	if book.ISBN != "" {
+		publication.Metadata.Identifier = "urn:isbn:" + book.ISBN
+	}
+	if !book.Published.IsZero() {
+		publication.Metadata.Published = book.Published.UTC().Format("2006-01-02")
+	}
+	if book.GenreName != "" {
+		publication.Metadata.Subject = []Subject{{Name: book.GenreName, Links: []Link2{{Href: root + "/genres/" + url.PathEscape(book.GenreName), Type: MIMEOPDS2}}}}
+	}
+	return publication
+}
@@ -0,0 +1,108 @@
+package opds
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"library/models"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func testCatalog() Catalog {
+	return Catalog{
+		Title: "Library",
+		Root:  "http://localhost/opds",
+		BookURL: func(id uint) string {
+			return "http://localhost/api/v1/books/" + strconv.FormatUint(uint64(id), 10)
+		},
+	}
+}
+
+func acquisitionPage() Page {
+	updated := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	return Page{
+		ID:      "urn:library:opds:genres:Fantasy",
+		Title:   "Fantasy",
+		Href:    "/genres/Fantasy",
+		Updated: updated,
+		Kind:    Acquisition,
+		Books: []models.Book{
+			{Model: gorm.Model{ID: 8, UpdatedAt: updated}, Title: "The Hobbit", Author: "J.R.R. Tolkien", GenreName: "Fantasy", ISBN: "9780261102217", Published: time.Date(1937, 9, 21, 0, 0, 0, 0, time.UTC)},
+		},
+		Number:  2,
+		PerPage: 1,
+		Total:   3,
+	}
+}
+
+func linkHrefs[T any](links []T, rel func(T) (string, string)) map[string]string {
+	hrefs := map[string]string{}
+	for _, link := range links {
+		r, href := rel(link)
+		hrefs[r] = href
+	}
+	return hrefs
+}
+
+func TestAtomAcquisitionFeed(t *testing.T) {
+	feed := testCatalog().Atom(acquisitionPage())
+
+	_, err := xml.Marshal(feed)
+	assert.NoError(t, err)
+
+	links := linkHrefs(feed.Links, func(l Link) (string, string) { return l.Rel, l.Href })
+	assert.Equal(t, "http://localhost/opds/genres/Fantasy?page=2", links[RelSelf])
+	assert.Equal(t, "http://localhost/opds/genres/Fantasy?page=1", links[RelPrevious])
+	assert.Equal(t, "http://localhost/opds/genres/Fantasy?page=3", links[RelNext])
+	assert.Equal(t, "http://localhost/opds/opensearch.xml", links[RelSearch])
+	assert.Equal(t, int64(3), feed.TotalResults)
+	assert.Equal(t, 2, feed.StartIndex)
+
+	assert.Len(t, feed.Entries, 1)
+	entry := feed.Entries[0]
+	assert.Equal(t, "urn:library:book:8", entry.ID)
+	assert.Equal(t, "urn:isbn:9780261102217", entry.Identifier)
+	assert.Equal(t, "1937-09-21", entry.Issued)
+	entryLinks := linkHrefs(entry.Links, func(l Link) (string, string) { return l.Rel, l.Href })
+	assert.Equal(t, "http://localhost/api/v1/books/8", entryLinks[RelBorrow])
+	assert.Equal(t, "http://localhost/opds/authors/J.R.R.%20Tolkien", entryLinks[RelRelated])
+}
+
+func TestJSONNavigationFeed(t *testing.T) {
+	page := Page{
+		ID:    "urn:library:opds:genres",
+		Title: "By genre",
+		Href:  "/genres",
+		Kind:  Navigation,
+		Navigation: []NavigationItem{
+			{Title: "Fantasy", Href: "/genres/Fantasy", Kind: Acquisition, Count: 3},
+		},
+	}
+	feed := testCatalog().JSON(page)
+
+	data, err := json.Marshal(feed)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"publications"`)
+
+	assert.Len(t, feed.Navigation, 1)
+	assert.Equal(t, "http://localhost/opds/v2/genres/Fantasy", feed.Navigation[0].Href)
+	assert.Equal(t, int64(3), feed.Navigation[0].Properties.NumberOfItems)
+	links := linkHrefs(feed.Links, func(l Link2) (string, string) { return l.Rel, l.Href })
+	assert.Equal(t, "http://localhost/opds/v2/genres", links[RelSelf])
+	assert.Empty(t, links[RelNext])
+}
+
+func TestJSONAcquisitionFeed(t *testing.T) {
+	feed := testCatalog().JSON(acquisitionPage())
+
+	assert.Equal(t, int64(3), feed.Metadata.NumberOfItems)
+	assert.Equal(t, 2, feed.Metadata.CurrentPage)
+	assert.Len(t, feed.Publications, 1)
+	assert.Equal(t, "urn:isbn:9780261102217", feed.Publications[0].Metadata.Identifier)
+	links := linkHrefs(feed.Links, func(l Link2) (string, string) { return l.Rel, l.Href })
+	assert.Equal(t, "http://localhost/opds/v2/genres/Fantasy?page=3", links[RelLast])
+}
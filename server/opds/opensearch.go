@@ -0,0 +1,35 @@
+package opds
+
+import "encoding/xml"
+
+// OpenSearchDescription tells clients how to search the catalogue.
+type OpenSearchDescription struct {
+	XMLName        xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName      string          `xml:"ShortName"`
+	Description    string          `xml:"Description"`
+	InputEncoding  string          `xml:"InputEncoding"`
+	OutputEncoding string          `xml:"OutputEncoding"`
+	URLs           []OpenSearchURL `xml:"Url"`
+}
+
+// OpenSearchURL is a search URL template.
+type OpenSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// OpenSearch describes the catalogue search, whose URLs take the search
+// terms in the q parameter. searchURL is the JSON book search endpoint.
+func (c Catalog) OpenSearch(searchURL string) OpenSearchDescription {
+	return OpenSearchDescription{
+		ShortName:      c.Title,
+		Description:    "Search the " + c.Title + " catalogue by title or author",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URLs: []OpenSearchURL{
+			{Type: MIMEAcquisition, Template: c.Root + "/search?q={searchTerms}&page={startPage?}"},
+			{Type: MIMEOPDS2, Template: c.Root + "/v2/search?q={searchTerms}&page={startPage?}"},
+			{Type: "application/json", Template: searchURL + "?q={searchTerms}"},
+		},
+	}
+}
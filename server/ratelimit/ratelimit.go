@@ -0,0 +1,253 @@
+// Package ratelimit limits the requests of the clients of the server with a
+// token bucket per client and group of routes, and counts them against daily
+// quotas. The counters are kept in process, by every instance of the server.
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxCounters bounds the buckets and the quotas the limiter remembers.
+const maxCounters = 10000
+
+// Limit is the limit of the requests of a client to a group of routes.
+type Limit struct {
+	// Rate is the number of requests per second on average, beyond bursts of
+	// Burst requests; 0 is unlimited
+	Rate  int
+	Burst int
+	// Quota is the number of requests a day, until midnight UTC; 0 is
+	// unlimited
+	Quota int
+}
+
+// Result tells whether a request is allowed, and describes the most
+// restrictive of the limits of its client.
+type Result struct {
+	Allowed bool
+	// Limit is the burst or quota of the limit, 0 if the client is not
+	// limited
+	Limit int
+	// Remaining is the number of requests the client may still make at once
+	Remaining int
+	// Reset is how long until the bucket is full or the quota renewed
+	Reset time.Duration
+	// RetryAfter is how long the client must wait, when not allowed
+	RetryAfter time.Duration
+}
+
+// Counter is the state of the limits of a client on a group of routes.
+type Counter struct {
+	Client string `json:"client"`
+	Group  string `json:"group"`
+	// Remaining is the number of requests of the bucket, out of Burst, if
+	// the group is rate limited
+	Remaining int `json:"remaining"`
+	Burst     int `json:"burst"`
+	// UsedToday is the number of requests counted against the quota
+	UsedToday int `json:"used_today"`
+}
+
+type key struct {
+	client string
+	group  string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// rate and burst are those of the last request, to refill the bucket
+	rate  float64
+	burst float64
+}
+
+// refill adds the tokens earned since the last request.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+type quota struct {
+	day  time.Time
+	used int
+}
+
+// Limiter counts the requests of the clients against their limits. It is
+// safe for concurrent use.
+type Limiter struct {
+	mutex   sync.Mutex
+	buckets map[key]*bucket
+	quotas  map[key]*quota
+	now     func() time.Time
+}
+
+// New returns a limiter without counters.
+func New() *Limiter {
+	return &Limiter{buckets: map[key]*bucket{}, quotas: map[key]*quota{}, now: time.Now}
+}
+
+// Allow counts a request of a client to a group of routes, unless it
+// exceeds their limit.
+func (l *Limiter) Allow(client, group string, limit Limit) Result {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	k := key{client: client, group: group}
+
+	var b *bucket
+	if limit.Rate > 0 {
+		b = l.bucket(k, now, float64(limit.Rate), math.Max(float64(limit.Burst), 1))
+		if b.tokens < 1 {
+			return Result{
+				Limit:      int(b.burst),
+				Reset:      b.untilFull(),
+				RetryAfter: time.Duration((1 - b.tokens) / b.rate * float64(time.Second)),
+			}
+		}
+	}
+	var q *quota
+	renewal := midnight(now).Sub(now)
+	if limit.Quota > 0 {
+		q = l.quota(k, now)
+		if q.used >= limit.Quota {
+			return Result{Limit: limit.Quota, Reset: renewal, RetryAfter: renewal}
+		}
+	}
+
+	result := Result{Allowed: true}
+	if b != nil {
+		b.tokens--
+		result = Result{Allowed: true, Limit: int(b.burst), Remaining: int(b.tokens), Reset: b.untilFull()}
+	}
+	if q != nil {
+		q.used++
+		if remaining := limit.Quota - q.used; b == nil || remaining < result.Remaining {
+			result = Result{Allowed: true, Limit: limit.Quota, Remaining: remaining, Reset: renewal}
+		}
+	}
+	return result
+}
+
+// untilFull returns how long the bucket takes to fill up.
+func (b *bucket) untilFull() time.Duration {
+	return time.Duration((b.burst - b.tokens) / b.rate * float64(time.Second))
+}
+
+// bucket returns the bucket of a key refilled at the rate, full if new.
+func (l *Limiter) bucket(k key, now time.Time, rate, burst float64) *bucket {
+	b, ok := l.buckets[k]
+	if !ok {
+		if len(l.buckets) >= maxCounters {
+			l.forgetFull(now)
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[k] = b
+	}
+	b.rate, b.burst = rate, burst
+	b.refill(now)
+	return b
+}
+
+// forgetFull removes the buckets refilled since, as new ones are the same.
+func (l *Limiter) forgetFull(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// quota returns the quota of a key for the day of now.
+func (l *Limiter) quota(k key, now time.Time) *quota {
+	day := midnight(now).AddDate(0, 0, -1)
+	q, ok := l.quotas[k]
+	if !ok {
+		if len(l.quotas) >= maxCounters {
+			// The quotas of the previous days are renewed
+			for k, q := range l.quotas {
+				if q.day.Before(day) {
+					delete(l.quotas, k)
+				}
+			}
+		}
+		q = &quota{day: day}
+		l.quotas[k] = q
+	}
+	if q.day.Before(day) {
+		q.day, q.used = day, 0
+	}
+	return q
+}
+
+// midnight returns the next midnight UTC after t.
+func midnight(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Counters returns the counters of a client, or of all of them if empty, by
+// client and group.
+func (l *Limiter) Counters(client string) []Counter {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	counters := map[key]*Counter{}
+	counter := func(k key) *Counter {
+		if _, ok := counters[k]; !ok {
+			counters[k] = &Counter{Client: k.client, Group: k.group}
+		}
+		return counters[k]
+	}
+	for k, b := range l.buckets {
+		if client == "" || k.client == client {
+			b.refill(now)
+			c := counter(k)
+			c.Remaining, c.Burst = int(b.tokens), int(b.burst)
+		}
+	}
+	day := midnight(now).AddDate(0, 0, -1)
+	for k, q := range l.quotas {
+		if (client == "" || k.client == client) && !q.day.Before(day) {
+			counter(k).UsedToday = q.used
+		}
+	}
+
+	list := make([]Counter, 0, len(counters))
+	for _, c := range counters {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Client != list[j].Client {
+			return list[i].Client < list[j].Client
+		}
+		return list[i].Group < list[j].Group
+	})
+	return list
+}
+
+// Reset forgets the counters of a client and a group, of any of them if
+// empty, which start over, and returns their number.
+func (l *Limiter) Reset(client, group string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	reset := map[key]bool{}
+	matches := func(k key) bool {
+		return (client == "" || k.client == client) && (group == "" || k.group == group)
+	}
+	for k := range l.buckets {
+		if matches(k) {
+			delete(l.buckets, k)
+			reset[k] = true
+		}
+	}
+	for k := range l.quotas {
+		if matches(k) {
+			delete(l.quotas, k)
+			reset[k] = true
+		}
+	}
+	return len(reset)
+}
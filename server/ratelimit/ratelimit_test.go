@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newLimiter returns a limiter with a clock the tests move, at noon UTC.
+func newLimiter() (*Limiter, *time.Time) {
+	l := New()
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestAllow(t *testing.T) {
+	l, now := newLimiter()
+	limit := Limit{Rate: 1, Burst: 3}
+
+	testCases := []struct {
+		Description string
+		Elapsed     time.Duration
+		Result      Result
+	}{
+		{Description: "First", Result: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{Description: "Second", Result: Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+		{Description: "Third", Result: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{Description: "Beyond the burst", Elapsed: 500 * time.Millisecond, Result: Result{Limit: 3, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{Description: "Refilled", Elapsed: 500 * time.Millisecond, Result: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			*now = now.Add(tc.Elapsed)
+			assert.Equal(t, tc.Result, l.Allow("ip:10.0.0.1", "default", limit))
+		})
+	}
+
+	// The clients and groups have buckets of their own
+	assert.True(t, l.Allow("ip:10.0.0.2", "default", limit).Allowed)
+	assert.True(t, l.Allow("ip:10.0.0.1", "search", limit).Allowed)
+	assert.Equal(t, Result{Allowed: true}, l.Allow("ip:10.0.0.1", "default", Limit{}), "unlimited")
+}
+
+func TestQuota(t *testing.T) {
+	l, now := newLimiter()
+	limit := Limit{Rate: 10, Burst: 10, Quota: 2}
+
+	// The quota is the most restrictive limit
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 12 * time.Hour}, l.Allow("api_key:1", "export", limit))
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, Reset: 12 * time.Hour}, l.Allow("api_key:1", "export", limit))
+	*now = now.Add(time.Hour)
+	assert.Equal(t, Result{Limit: 2, Reset: 11 * time.Hour, RetryAfter: 11 * time.Hour}, l.Allow("api_key:1", "export", limit))
+	assert.True(t, l.Allow("api_key:2", "export", limit).Allowed)
+
+	// A rejected request is not counted, and the quota is renewed at midnight
+	*now = now.Add(11 * time.Hour)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 24 * time.Hour}, l.Allow("api_key:1", "export", limit))
+}
+
+func TestCounters(t *testing.T) {
+	l, now := newLimiter()
+	for i := 0; i < 3; i++ {
+		l.Allow("api_key:1", "export", Limit{Rate: 1, Burst: 5, Quota: 10})
+	}
+	l.Allow("api_key:1", "default", Limit{Rate: 1, Burst: 5})
+	l.Allow("ip:10.0.0.1", "default", Limit{Rate: 1, Burst: 5})
+	*now = now.Add(time.Second)
+
+	assert.Equal(t, []Counter{
+		{Client: "api_key:1", Group: "default", Remaining: 5, Burst: 5},
+		{Client: "api_key:1", Group: "export", Remaining: 3, Burst: 5, UsedToday: 3},
+		{Client: "ip:10.0.0.1", Group: "default", Remaining: 5, Burst: 5},
+	}, l.Counters(""))
+	assert.Len(t, l.Counters("ip:10.0.0.1"), 1)
+	assert.Empty(t, l.Counters("ip:10.0.0.2"))
+
+	assert.Equal(t, 1, l.Reset("api_key:1", "export"))
+	assert.Len(t, l.Counters("api_key:1"), 1)
+	assert.Equal(t, Result{Allowed: true, Limit: 5, Remaining: 4, Reset: time.Second}, l.Allow("api_key:1", "export", Limit{Rate: 1, Burst: 5, Quota: 10}))
+	assert.Equal(t, 3, l.Reset("", ""))
+	assert.Empty(t, l.Counters(""))
+}
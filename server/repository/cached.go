@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"time"
+
+	"library/cache"
+	"library/models"
+
+	"log/slog"
+)
+
+// Cached operations, as counted by the metrics
+const (
+	CachedGet   = "get"
+	CachedCount = "count"
+)
+
+// CacheStats describes the use of the cache of a repository.
+type CacheStats struct {
+	// Entries is the number of values held by an in-process cache
+	Entries    *int                    `json:"entries,omitempty"`
+	TTL        string                  `json:"ttl"`
+	Operations map[string]cache.Counts `json:"operations"`
+}
+
+// Cached caches the books by tenant and ID and their number in front of
+// another repository, and invalidates them when it writes the books. The cache is
+// only a shortcut: when it fails, the books are read from the repository.
+type Cached struct {
+	BookRepository
+	cache   cache.Cache
+	ttl     time.Duration
+	metrics *cache.Metrics
+}
+
+// NewCached returns a repository caching the books of another for ttl.
+func NewCached(books BookRepository, c cache.Cache, ttl time.Duration) *Cached {
+	return &Cached{BookRepository: books, cache: c, ttl: ttl, metrics: cache.NewMetrics()}
+}
+
+// Stats returns the hits and misses of the cached operations.
+func (r *Cached) Stats() CacheStats {
+	stats := CacheStats{TTL: r.ttl.String(), Operations: r.metrics.Counts()}
+	if sized, ok := r.cache.(interface{ Len() int }); ok {
+		entries := sized.Len()
+		stats.Entries = &entries
+	}
+	return stats
+}
+
+// keyPrefix prefixes the keys of the books of the tenant of a context, which
+// the other tenants never read.
+func keyPrefix(ctx context.Context) string {
+	return "books:" + strconv.FormatUint(uint64(TenantOf(ctx)), 10) + ":"
+}
+
+func bookKey(ctx context.Context, id uint) string {
+	return keyPrefix(ctx) + strconv.FormatUint(uint64(id), 10)
+}
+
+// countKey caches the number of all the books of the tenant of a context, as
+// the unfiltered Count.
+func countKey(ctx context.Context) string {
+	return keyPrefix(ctx) + "count"
+}
+
+func (r *Cached) Get(ctx context.Context, id uint) (models.Book, error) {
+	var book models.Book
+	if r.load(ctx, CachedGet, bookKey(ctx, id), &book) {
+		book.TenantID = TenantOf(ctx)
+		return book, nil
+	}
+	book, err := r.BookRepository.Get(ctx, id)
+	if err == nil {
+		r.store(ctx, bookKey(ctx, id), book)
+	}
+	return book, err
+}
+
+func (r *Cached) Count(ctx context.Context, filter Filter) (int64, error) {
+	if !reflect.DeepEqual(filter, Filter{}) {
+		return r.BookRepository.Count(ctx, filter)
+	}
+	var count int64
+	if r.load(ctx, CachedCount, countKey(ctx), &count) {
+		return count, nil
+	}
+	count, err := r.BookRepository.Count(ctx, filter)
+	if err == nil {
+		r.store(ctx, countKey(ctx), count)
+	}
+	return count, err
+}
+
+func (r *Cached) Create(ctx context.Context, books ...*models.Book) error {
+	defer r.invalidate(ctx, countKey(ctx))
+	return r.BookRepository.Create(ctx, books...)
+}
+
+func (r *Cached) Update(ctx context.Context, book *models.Book) error {
+	defer r.invalidate(ctx, bookKey(ctx, book.ID))
+	return r.BookRepository.Update(ctx, book)
+}
+
+func (r *Cached) Patch(ctx context.Context, id uint, updates map[string]interface{}) (models.Book, error) {
+	defer r.invalidate(ctx, bookKey(ctx, id))
+	return r.BookRepository.Patch(ctx, id, updates)
+}
+
+func (r *Cached) Delete(ctx context.Context, id uint) error {
+	defer r.invalidate(ctx, bookKey(ctx, id), countKey(ctx))
+	return r.BookRepository.Delete(ctx, id)
+}
+
+// load reads a cached value, counting the hit or miss of the operation.
+func (r *Cached) load(ctx context.Context, operation string, key string, value any) bool {
+	data, ok, err := r.cache.Get(ctx, key)
+	if err != nil {
+		slog.Warn("Cannot read the cache.", "key", key, "error", err)
+	}
+	if ok && err == nil {
+		if err := json.Unmarshal(data, value); err == nil {
+			r.metrics.Hit(operation)
+			return true
+		}
+	}
+	r.metrics.Miss(operation)
+	return false
+}
+
+func (r *Cached) store(ctx context.Context, key string, value any) {
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = r.cache.Set(ctx, key, data, r.ttl)
+	}
+	if err != nil {
+		slog.Warn("Cannot write the cache.", "key", key, "error", err)
+	}
+}
+
+// invalidate removes the cached values a write changed, even if it failed
+// halfway.
+func (r *Cached) invalidate(ctx context.Context, keys ...string) {
+	// Invalidate even when the request is canceled
+	if err := r.cache.Delete(context.WithoutCancel(ctx), keys...); err != nil {
+		slog.Error("Cannot invalidate the cache, it may serve stale books until they expire.", "keys", keys, "error", err)
+	}
+}
@@ -0,0 +1,63 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"library/cache"
+	"library/models"
+	"library/repository"
+	"library/repository/repositorytest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCached(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.BookRepository {
+		return repository.NewCached(repository.NewMemory(), cache.NewLRU(100), time.Minute)
+	})
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	ctx := context.Background()
+	books := repository.NewCached(repository.NewMemory(), cache.NewLRU(100), time.Minute)
+	book := models.Book{Title: "Dune", Author: "Frank Herbert"}
+	require.NoError(t, books.Create(ctx, &book))
+	get := func() models.Book {
+		book, err := books.Get(ctx, book.ID)
+		require.NoError(t, err)
+		return book
+	}
+	count := func() int64 {
+		count, err := books.Count(ctx, repository.Filter{})
+		require.NoError(t, err)
+		return count
+	}
+
+	assert.Equal(t, "Dune", get().Title)
+	assert.Equal(t, "Dune", get().Title)
+	assert.Equal(t, int64(1), count())
+	assert.Equal(t, int64(1), count())
+
+	// The writes invalidate what they change
+	_, err := books.Patch(ctx, book.ID, map[string]interface{}{"title": "Dune Messiah"})
+	require.NoError(t, err)
+	assert.Equal(t, "Dune Messiah", get().Title)
+	require.NoError(t, books.Create(ctx, &models.Book{Title: "Emma", Author: "Jane Austen"}))
+	assert.Equal(t, int64(2), count())
+	require.NoError(t, books.Delete(ctx, book.ID))
+	_, err = books.Get(ctx, book.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Equal(t, int64(1), count())
+
+	// Filtered counts are not cached
+	_, err = books.Count(ctx, repository.Filter{Author: "Jane Austen"})
+	require.NoError(t, err)
+
+	stats := books.Stats()
+	assert.Equal(t, "1m0s", stats.TTL)
+	assert.Equal(t, cache.Counts{Hits: 1, Misses: 3, HitRatio: 0.25}, stats.Operations[repository.CachedGet])
+	assert.Equal(t, cache.Counts{Hits: 1, Misses: 3, HitRatio: 0.25}, stats.Operations[repository.CachedCount])
+}
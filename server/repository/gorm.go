@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"library/models"
+
+	"gorm.io/gorm"
+)
+
+// changedColumn matches Changed: the deletion time, if any, or the last update.
+const changedColumn = "COALESCE(deleted_at, updated_at)"
+
+var orderClauses = map[Order]string{
+	OrderByID:          "id",
+	OrderByNewest:      "created_at DESC, id DESC",
+	OrderByOldest:      "created_at, id",
+	OrderByTitle:       "title, id",
+	OrderByPublished:   "published, id",
+	OrderByChanged:     changedColumn + ", id",
+	OrderByLastChanged: changedColumn + " DESC, id DESC",
+}
+
+// GORM stores the books in a SQL database through GORM, each query scoped
+// to the tenant of its context by TenantScope.
+type GORM struct {
+	db *gorm.DB
+	// read returns the database serving the reads, such as a replica
+	read func(ctx context.Context) *gorm.DB
+}
+
+// NewGORM returns a repository of the books of the database.
+func NewGORM(db *gorm.DB) *GORM {
+	return &GORM{db: db}
+}
+
+// NewReplicatedGORM returns a repository writing the books to the primary
+// database, and reading them from the one read returns, as a replica. The
+// reads of the contexts from WithPrimary go to the primary.
+func NewReplicatedGORM(primary *gorm.DB, read func(ctx context.Context) *gorm.DB) *GORM {
+	return &GORM{db: primary, read: read}
+}
+
+// reader returns the database serving the reads of the context.
+func (r *GORM) reader(ctx context.Context) *gorm.DB {
+	if r.read == nil || UsesPrimary(ctx) {
+		return r.db
+	}
+	return r.read(ctx)
+}
+
+func (r *GORM) Get(ctx context.Context, id uint) (models.Book, error) {
+	var book models.Book
+	err := r.reader(ctx).WithContext(ctx).Scopes(TenantScope(ctx)).First(&book, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return book, ErrNotFound
+	}
+	return book, err
+}
+
+func (r *GORM) List(ctx context.Context, options ListOptions) ([]models.Book, error) {
+	return r.Search(ctx, Filter{}, options)
+}
+
+func (r *GORM) Search(ctx context.Context, filter Filter, options ListOptions) ([]models.Book, error) {
+	if options.Per != "" {
+		return r.searchPer(ctx, filter, options)
+	}
+	query := r.query(ctx, filter).Order(orderClauses[options.Order]).Offset(options.Offset)
+	if options.Limit > 0 {
+		query = query.Limit(options.Limit)
+	}
+
+	books := []models.Book{}
+	err := query.Find(&books).Error
+	return books, err
+}
+
+// searchPer pages the books sharing each value of options.Per apart, by
+// numbering them within their value, not to load all of them.
+func (r *GORM) searchPer(ctx context.Context, filter Filter, options ListOptions) ([]models.Book, error) {
+	order := orderClauses[options.Order]
+	numbered := r.query(ctx, filter).
+		Select("books.*, ROW_NUMBER() OVER (PARTITION BY " + string(options.Per) + " ORDER BY " + order + ") AS nth")
+	query := r.reader(ctx).WithContext(ctx).Unscoped().Table("(?) AS books", numbered).
+		Where("nth > ?", options.Offset).Order(order)
+	if options.Limit > 0 {
+		query = query.Where("nth <= ?", options.Offset+options.Limit)
+	}
+
+	books := []models.Book{}
+	err := query.Find(&books).Error
+	return books, err
+}
+
+func (r *GORM) Create(ctx context.Context, books ...*models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+	for _, book := range books {
+		book.TenantID = TenantOf(ctx)
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Create(books).Error
+	})
+}
+
+func (r *GORM) Update(ctx context.Context, book *models.Book) error {
+	ctx = WithPrimary(ctx)
+	existingBook, err := r.Get(ctx, book.ID)
+	if err != nil {
+		return err
+	}
+
+	existingBook.Title = book.Title
+	existingBook.Author = book.Author
+	existingBook.Published = book.Published
+	existingBook.Edition = book.Edition
+	existingBook.Description = book.Description
+	existingBook.GenreName = book.GenreName
+	existingBook.ISBN = book.ISBN
+
+	if err := r.db.WithContext(ctx).Save(&existingBook).Error; err != nil {
+		return err
+	}
+	*book = existingBook
+	return nil
+}
+
+func (r *GORM) Patch(ctx context.Context, id uint, updates map[string]interface{}) (models.Book, error) {
+	ctx = WithPrimary(ctx)
+	existingBook, err := r.Get(ctx, id)
+	if err != nil {
+		return existingBook, err
+	}
+	// Only the columns of the details, not to move the book to another tenant
+	columns := map[string]interface{}{}
+	for column, value := range updates {
+		if patchColumns[column] {
+			columns[column] = value
+		}
+	}
+	err = r.db.WithContext(ctx).Model(&existingBook).Updates(columns).Error
+	return existingBook, err
+}
+
+func (r *GORM) Delete(ctx context.Context, id uint) error {
+	ctx = WithPrimary(ctx)
+	existingBook, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Delete(&existingBook).Error
+}
+
+func (r *GORM) Count(ctx context.Context, filter Filter) (int64, error) {
+	var count int64
+	err := r.query(ctx, filter).Count(&count).Error
+	return count, err
+}
+
+func (r *GORM) Groups(ctx context.Context, field Field, filter Filter) ([]Group, error) {
+	column := string(field)
+	groups := []Group{}
+	err := r.query(ctx, filter).
+		Select(column + " AS name, COUNT(*) AS count").
+		Where(column + " <> ''").
+		Group(column).Order(column).
+		Scan(&groups).Error
+	return groups, err
+}
+
+// query selects the books of the tenant of the context matching a filter.
+func (r *GORM) query(ctx context.Context, filter Filter) *gorm.DB {
+	query := r.reader(ctx).WithContext(ctx).Model(&models.Book{}).Scopes(TenantScope(ctx))
+	if filter.Deleted {
+		query = query.Unscoped()
+	}
+
+	if filter.Query != "" {
+		query = query.Where("title LIKE ? OR author LIKE ?", "%"+filter.Query+"%", "%"+filter.Query+"%")
+	}
+	for column, value := range map[string]string{
+		"title":       filter.Title,
+		"author":      filter.Author,
+		"description": filter.Description,
+		"genre_name":  filter.Genre,
+	} {
+		if value != "" {
+			query = query.Where(column+" LIKE ?", "%"+value+"%")
+		}
+	}
+	if filter.From != "" {
+		query = query.Where("published >= ?", date(filter.From))
+	}
+	if filter.To != "" {
+		query = query.Where("published <= ?", date(filter.To))
+	}
+
+	if len(filter.IDs) > 0 {
+		query = query.Where("id IN ?", filter.IDs)
+	}
+	if len(filter.Authors) > 0 {
+		query = query.Where("author IN ?", filter.Authors)
+	}
+	if len(filter.Genres) > 0 {
+		query = query.Where("genre_name IN ?", filter.Genres)
+	}
+	if !filter.ChangedFrom.IsZero() {
+		query = query.Where(changedColumn+" >= ?", filter.ChangedFrom)
+	}
+	if !filter.ChangedUntil.IsZero() {
+		query = query.Where(changedColumn+" <= ?", filter.ChangedUntil)
+	}
+	if filter.AfterID > 0 {
+		query = query.Where("id > ?", filter.AfterID)
+	}
+	return query
+}
+
+// date binds a publication date bound as a timestamp at midnight UTC, which
+// every dialect compares with the stored timestamps alike. Dates that do not
+// parse are left to the database.
+func date(value string) interface{} {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t
+	}
+	return value
+}
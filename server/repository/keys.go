@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"library/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrKeyNotFound is returned when an API key does not exist or was revoked.
+var ErrKeyNotFound = errors.New("API key not found")
+
+// KeyRepository stores the API keys by the hash of their key, each giving
+// access to the tenant of the context it was created in.
+type KeyRepository interface {
+	// Create adds a key to the tenant of the context, setting its ID and
+	// creation time.
+	Create(ctx context.Context, key *models.APIKey) error
+	// Find returns the unrevoked key of a hash, whatever its tenant, or
+	// ErrKeyNotFound.
+	Find(ctx context.Context, hash string) (models.APIKey, error)
+	// List returns all the keys of the tenant of the context by ID, the
+	// revoked ones included.
+	List(ctx context.Context) ([]models.APIKey, error)
+	// Revoke revokes an unrevoked key of the tenant of the context, or
+	// returns ErrKeyNotFound.
+	Revoke(ctx context.Context, id uint) error
+}
+
+// MemoryKeys stores the API keys in memory, for tests and development.
+type MemoryKeys struct {
+	mu   sync.RWMutex
+	keys []models.APIKey
+	now  func() time.Time
+}
+
+// NewMemoryKeys returns an empty in-memory key repository.
+func NewMemoryKeys() *MemoryKeys {
+	return &MemoryKeys{now: time.Now}
+}
+
+func (m *MemoryKeys) Create(ctx context.Context, key *models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key.ID = uint(len(m.keys) + 1)
+	key.CreatedAt = m.now()
+	key.TenantID = TenantOf(ctx)
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+func (m *MemoryKeys) Find(ctx context.Context, hash string) (models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, key := range m.keys {
+		if key.Hash == hash && key.RevokedAt == nil {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrKeyNotFound
+}
+
+func (m *MemoryKeys) List(ctx context.Context) ([]models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := []models.APIKey{}
+	for _, key := range m.keys {
+		if key.TenantID == TenantOf(ctx) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MemoryKeys) Revoke(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == 0 || int(id) > len(m.keys) || m.keys[id-1].TenantID != TenantOf(ctx) || m.keys[id-1].RevokedAt != nil {
+		return ErrKeyNotFound
+	}
+	now := m.now()
+	m.keys[id-1].RevokedAt = &now
+	return nil
+}
+
+// GORMKeys stores the API keys in a SQL database through GORM.
+type GORMKeys struct {
+	db *gorm.DB
+}
+
+// NewGORMKeys returns a repository of the API keys of the database.
+func NewGORMKeys(db *gorm.DB) *GORMKeys {
+	return &GORMKeys{db: db}
+}
+
+func (r *GORMKeys) Create(ctx context.Context, key *models.APIKey) error {
+	key.TenantID = TenantOf(ctx)
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *GORMKeys) Find(ctx context.Context, hash string) (models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.WithContext(ctx).Where("hash = ? AND revoked_at IS NULL", hash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return key, ErrKeyNotFound
+	}
+	return key, err
+}
+
+func (r *GORMKeys) List(ctx context.Context) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	err := r.db.WithContext(ctx).Scopes(TenantScope(ctx)).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+func (r *GORMKeys) Revoke(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).Scopes(TenantScope(ctx)).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"library/models"
+
+	"gorm.io/gorm"
+)
+
+// patchColumns are the columns a patch may update, named after the JSON
+// fields of a book.
+var patchColumns = map[string]bool{
+	"title":       true,
+	"author":      true,
+	"published":   true,
+	"edition":     true,
+	"description": true,
+	"genre_name":  true,
+	"isbn":        true,
+}
+
+// Memory stores the books in memory. It mirrors the behaviour of the GORM
+// repository on Postgres, case-sensitive matching and the scoping by tenant
+// included, and is safe for concurrent use.
+type Memory struct {
+	mu     sync.RWMutex
+	books  []models.Book
+	lastID uint
+	now    func() time.Time
+}
+
+// NewMemory returns an empty in-memory repository.
+func NewMemory() *Memory {
+	return &Memory{now: time.Now}
+}
+
+func (m *Memory) Get(ctx context.Context, id uint) (models.Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.index(TenantOf(ctx), id)
+	if i < 0 {
+		return models.Book{}, ErrNotFound
+	}
+	return m.books[i], nil
+}
+
+func (m *Memory) List(ctx context.Context, options ListOptions) ([]models.Book, error) {
+	return m.Search(ctx, Filter{}, options)
+}
+
+func (m *Memory) Search(ctx context.Context, filter Filter, options ListOptions) ([]models.Book, error) {
+	m.mu.RLock()
+	books := m.filter(TenantOf(ctx), filter)
+	m.mu.RUnlock()
+
+	sort.SliceStable(books, func(i, j int) bool { return less(books[i], books[j], options.Order) })
+
+	if options.Per != "" {
+		paged, seen := []models.Book{}, map[string]int{}
+		for _, book := range books {
+			value := fieldOf(book, options.Per)
+			if seen[value] >= options.Offset && (options.Limit == 0 || seen[value] < options.Offset+options.Limit) {
+				paged = append(paged, book)
+			}
+			seen[value]++
+		}
+		return paged, nil
+	}
+	if options.Offset >= len(books) {
+		return []models.Book{}, nil
+	}
+	books = books[options.Offset:]
+	if options.Limit > 0 && options.Limit < len(books) {
+		books = books[:options.Limit]
+	}
+	return books, nil
+}
+
+func (m *Memory) Create(ctx context.Context, books ...*models.Book) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for _, book := range books {
+		m.lastID++
+		book.ID = m.lastID
+		book.TenantID = TenantOf(ctx)
+		book.CreatedAt, book.UpdatedAt = now, now
+		book.Published = book.Published.UTC()
+		m.books = append(m.books, *book)
+	}
+	return nil
+}
+
+func (m *Memory) Update(ctx context.Context, book *models.Book) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(TenantOf(ctx), book.ID)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	existingBook := m.books[i]
+	existingBook.Title = book.Title
+	existingBook.Author = book.Author
+	existingBook.Published = book.Published.UTC()
+	existingBook.Edition = book.Edition
+	existingBook.Description = book.Description
+	existingBook.GenreName = book.GenreName
+	existingBook.ISBN = book.ISBN
+	existingBook.UpdatedAt = m.now()
+
+	m.books[i] = existingBook
+	*book = existingBook
+	return nil
+}
+
+func (m *Memory) Patch(ctx context.Context, id uint, updates map[string]interface{}) (models.Book, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(TenantOf(ctx), id)
+	if i < 0 {
+		return models.Book{}, ErrNotFound
+	}
+
+	// Decode the updates as JSON so that values are converted the way the
+	// database would, e.g. dates given as strings
+	columns := map[string]interface{}{}
+	for column, value := range updates {
+		if patchColumns[column] {
+			columns[column] = value
+		}
+	}
+	data, err := json.Marshal(columns)
+	if err != nil {
+		return models.Book{}, err
+	}
+	book := m.books[i]
+	if err := json.Unmarshal(data, &book); err != nil {
+		return models.Book{}, err
+	}
+	book.Published = book.Published.UTC()
+	book.UpdatedAt = m.now()
+
+	m.books[i] = book
+	return book, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(TenantOf(ctx), id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.books[i].DeletedAt = gorm.DeletedAt{Time: m.now(), Valid: true}
+	return nil
+}
+
+func (m *Memory) Count(ctx context.Context, filter Filter) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.filter(TenantOf(ctx), filter))), nil
+}
+
+func (m *Memory) Groups(ctx context.Context, field Field, filter Filter) ([]Group, error) {
+	m.mu.RLock()
+	books := m.filter(TenantOf(ctx), filter)
+	m.mu.RUnlock()
+
+	counts := map[string]int64{}
+	for _, book := range books {
+		if value := fieldOf(book, field); value != "" {
+			counts[value]++
+		}
+	}
+
+	groups := make([]Group, 0, len(counts))
+	for name, count := range counts {
+		groups = append(groups, Group{Name: name, Count: count})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// fieldOf returns the value of a field of a book.
+func fieldOf(book models.Book, field Field) string {
+	if field == FieldAuthor {
+		return book.Author
+	}
+	return book.GenreName
+}
+
+// index returns the position of a book of a tenant that is not deleted, or -1.
+func (m *Memory) index(tenant uint, id uint) int {
+	for i, book := range m.books {
+		if book.ID == id && book.TenantID == tenant && !book.DeletedAt.Valid {
+			return i
+		}
+	}
+	return -1
+}
+
+// filter returns a copy of the books of a tenant matching a filter. It must
+// be called with the lock held.
+func (m *Memory) filter(tenant uint, filter Filter) []models.Book {
+	books := []models.Book{}
+	for _, book := range m.books {
+		if book.TenantID == tenant && matches(book, filter) {
+			books = append(books, book)
+		}
+	}
+	return books
+}
+
+func matches(book models.Book, filter Filter) bool {
+	if book.DeletedAt.Valid && !filter.Deleted {
+		return false
+	}
+
+	if filter.Query != "" && !strings.Contains(book.Title, filter.Query) && !strings.Contains(book.Author, filter.Query) {
+		return false
+	}
+	if !strings.Contains(book.Title, filter.Title) ||
+		!strings.Contains(book.Author, filter.Author) ||
+		!strings.Contains(book.Description, filter.Description) ||
+		!strings.Contains(book.GenreName, filter.Genre) {
+		return false
+	}
+	if from, err := time.Parse(time.DateOnly, filter.From); err == nil && book.Published.Before(from) {
+		return false
+	}
+	if to, err := time.Parse(time.DateOnly, filter.To); err == nil && book.Published.After(to) {
+		return false
+	}
+
+	if len(filter.IDs) > 0 && !contains(filter.IDs, book.ID) {
+		return false
+	}
+	if len(filter.Authors) > 0 && !contains(filter.Authors, book.Author) {
+		return false
+	}
+	if len(filter.Genres) > 0 && !contains(filter.Genres, book.GenreName) {
+		return false
+	}
+	changed := Changed(book)
+	if !filter.ChangedFrom.IsZero() && changed.Before(filter.ChangedFrom) {
+		return false
+	}
+	if !filter.ChangedUntil.IsZero() && changed.After(filter.ChangedUntil) {
+		return false
+	}
+	return book.ID > filter.AfterID
+}
+
+func contains[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// less reports whether book a sorts before book b, ties broken by ID.
+func less(a, b models.Book, order Order) bool {
+	cmp := 0
+	switch order {
+	case OrderByNewest:
+		cmp = b.CreatedAt.Compare(a.CreatedAt)
+	case OrderByOldest:
+		cmp = a.CreatedAt.Compare(b.CreatedAt)
+	case OrderByTitle:
+		cmp = strings.Compare(a.Title, b.Title)
+	case OrderByPublished:
+		cmp = a.Published.Compare(b.Published)
+	case OrderByChanged:
+		cmp = Changed(a).Compare(Changed(b))
+	case OrderByLastChanged:
+		cmp = Changed(b).Compare(Changed(a))
+	}
+	if cmp != 0 {
+		return cmp < 0
+	}
+
+	if order == OrderByNewest || order == OrderByLastChanged {
+		return a.ID > b.ID
+	}
+	return a.ID < b.ID
+}
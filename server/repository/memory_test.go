@@ -0,0 +1,38 @@
+package repository_test
+
+import (
+	"testing"
+
+	"library/repository"
+	"library/repository/repositorytest"
+)
+
+func TestMemory(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.BookRepository {
+		return repository.NewMemory()
+	})
+}
+
+func TestMemoryKeys(t *testing.T) {
+	repositorytest.RunKeys(t, func(t *testing.T) repository.KeyRepository {
+		return repository.NewMemoryKeys()
+	})
+}
+
+func TestMemoryUsers(t *testing.T) {
+	repositorytest.RunUsers(t, func(t *testing.T) repository.UserRepository {
+		return repository.NewMemoryUsers()
+	})
+}
+
+func TestMemorySessions(t *testing.T) {
+	repositorytest.RunSessions(t, func(t *testing.T) (repository.UserRepository, repository.SessionRepository) {
+		return repository.NewMemoryUsers(), repository.NewMemorySessions()
+	})
+}
+
+func TestMemoryTenants(t *testing.T) {
+	repositorytest.RunTenants(t, func(t *testing.T) repository.TenantRepository {
+		return repository.NewMemoryTenants()
+	})
+}
@@ -0,0 +1,167 @@
+// Package repository stores the books of the library behind the
+// BookRepository interface, the API keys of its clients behind the
+// KeyRepository interface, and its users and their sessions behind the
+// UserRepository and SessionRepository interfaces, with GORM implementations
+// for production and in-memory ones for tests. They only see the rows of the
+// tenant of their context, one of the libraries the TenantRepository lists.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"library/models"
+)
+
+// ErrNotFound is returned when a book does not exist.
+var ErrNotFound = errors.New("book not found")
+
+// BookRepository stores the books of the library. Deleted books are kept
+// and only returned when a filter asks for them.
+type BookRepository interface {
+	// Get returns a book by ID, or ErrNotFound.
+	Get(ctx context.Context, id uint) (models.Book, error)
+	// List returns a page of all the books.
+	List(ctx context.Context, options ListOptions) ([]models.Book, error)
+	// Search returns a page of the books matching the filter.
+	Search(ctx context.Context, filter Filter, options ListOptions) ([]models.Book, error)
+	// Create adds the books, setting their IDs and timestamps. Either all the
+	// books are added or none of them.
+	Create(ctx context.Context, books ...*models.Book) error
+	// Update replaces the details of an existing book, or returns ErrNotFound.
+	Update(ctx context.Context, book *models.Book) error
+	// Patch updates the given columns of a book and returns it, or returns ErrNotFound.
+	Patch(ctx context.Context, id uint, updates map[string]interface{}) (models.Book, error)
+	// Delete removes a book, or returns ErrNotFound.
+	Delete(ctx context.Context, id uint) error
+	// Count returns the number of books matching the filter.
+	Count(ctx context.Context, filter Filter) (int64, error)
+	// Groups returns the distinct non-empty values of a field among the books
+	// matching the filter, with the number of books sharing each of them.
+	Groups(ctx context.Context, field Field, filter Filter) ([]Group, error)
+}
+
+// Filter selects books. Every criterion left to its zero value matches all
+// the books.
+type Filter struct {
+	// Query matches the title or the author; Title, Author, Description and
+	// Genre match their column. All match substrings, as the REST search does.
+	Query       string
+	Title       string
+	Author      string
+	Description string
+	Genre       string
+	// From and To bound the publication date, formatted as YYYY-MM-DD.
+	From string
+	To   string
+
+	// IDs, Authors and Genres match any of the exact values they list.
+	IDs     []uint
+	Authors []string
+	Genres  []string
+	// ChangedFrom and ChangedUntil bound the time a book last changed, its
+	// deletion included (see Changed).
+	ChangedFrom  time.Time
+	ChangedUntil time.Time
+	// AfterID skips the books up to this ID.
+	AfterID uint
+	// Deleted includes the deleted books.
+	Deleted bool
+}
+
+// Validate checks the format of the publication dates.
+func (f Filter) Validate() error {
+	for _, date := range []string{f.From, f.To} {
+		if _, err := time.Parse(time.DateOnly, date); date != "" && err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+	return nil
+}
+
+// Order sorts the books of a list.
+type Order int
+
+const (
+	// OrderByID sorts the books by ID, the order they were added in.
+	OrderByID Order = iota
+	// OrderByNewest sorts the books most recently added first.
+	OrderByNewest
+	// OrderByOldest sorts the books least recently added first.
+	OrderByOldest
+	// OrderByTitle sorts the books by title.
+	OrderByTitle
+	// OrderByPublished sorts the books by publication date.
+	OrderByPublished
+	// OrderByChanged sorts the books least recently changed first.
+	OrderByChanged
+	// OrderByLastChanged sorts the books most recently changed first.
+	OrderByLastChanged
+)
+
+// ListOptions selects a sorted page of books.
+type ListOptions struct {
+	Order Order
+	// Limit caps the number of books; zero means no limit.
+	Limit  int
+	Offset int
+	// Per, unless empty, pages the books sharing each value of the field
+	// apart, as the first books of several authors at once.
+	Per Field
+}
+
+// Field is a column the books can be grouped by.
+type Field string
+
+const (
+	FieldGenre  Field = "genre_name"
+	FieldAuthor Field = "author"
+)
+
+// Group is a value shared by Count books.
+type Group struct {
+	Name  string
+	Count int64
+}
+
+// Changed returns the time a book last changed, including its deletion.
+func Changed(book models.Book) time.Time {
+	if book.DeletedAt.Valid {
+		return book.DeletedAt.Time
+	}
+	return book.UpdatedAt
+}
+
+// primaryKey marks the contexts whose reads go to the primary database.
+type primaryKey struct{}
+
+// WithPrimary returns a context whose reads are served by the primary
+// database rather than a replica, as those of a write, which must see the
+// latest state of the books.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary reports whether the reads of the context go to the primary
+// database.
+func UsesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// clientKey names the client of the contexts of its requests.
+type clientKey struct{}
+
+// WithClient returns a context of a request of a client, such as an API key,
+// a user or an IP, whose reads see the writes of the client.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientOf returns the client of a context, "" if it has none.
+func ClientOf(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
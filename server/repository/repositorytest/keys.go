@@ -0,0 +1,67 @@
+package repositorytest
+
+import (
+	"context"
+	"testing"
+
+	"library/models"
+	"library/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunKeys runs the conformance tests against the key repositories returned
+// by newRepository, which must be empty.
+func RunKeys(t *testing.T, newRepository func(t *testing.T) repository.KeyRepository) {
+	ctx := context.Background()
+	keys := newRepository(t)
+
+	first := models.APIKey{Name: "catalogue", Hash: "hash-1", Hint: "lib_abcdef"}
+	second := models.APIKey{Name: "harvester", Role: "patron", Hash: "hash-2", Hint: "lib_ghijkl"}
+	require.NoError(t, keys.Create(ctx, &first))
+	require.NoError(t, keys.Create(ctx, &second))
+	assert.NotZero(t, first.ID)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.False(t, first.CreatedAt.IsZero())
+
+	found, err := keys.Find(ctx, "hash-2")
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, found.ID)
+	assert.Equal(t, "harvester", found.Name)
+	assert.Equal(t, "patron", found.Role)
+	_, err = keys.Find(ctx, "hash-3")
+	assert.ErrorIs(t, err, repository.ErrKeyNotFound)
+
+	// Revoked keys are listed, but not found
+	require.NoError(t, keys.Revoke(ctx, first.ID))
+	_, err = keys.Find(ctx, "hash-1")
+	assert.ErrorIs(t, err, repository.ErrKeyNotFound)
+	assert.ErrorIs(t, keys.Revoke(ctx, first.ID), repository.ErrKeyNotFound, "already revoked")
+	assert.ErrorIs(t, keys.Revoke(ctx, 1000), repository.ErrKeyNotFound)
+
+	list, err := keys.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, first.ID, list[0].ID)
+	assert.NotNil(t, list[0].RevokedAt)
+	assert.Nil(t, list[1].RevokedAt)
+
+	// The keys of a tenant are found by hash, but only listed and revoked by
+	// that tenant
+	other := repository.WithTenant(ctx, 2)
+	third := models.APIKey{Name: "branch", Role: "librarian", Hash: "hash-3", Hint: "lib_mnopqr"}
+	require.NoError(t, keys.Create(other, &third))
+	found, err = keys.Find(ctx, "hash-3")
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), found.TenantID)
+	assert.ErrorIs(t, keys.Revoke(ctx, third.ID), repository.ErrKeyNotFound)
+	assert.ErrorIs(t, keys.Revoke(other, second.ID), repository.ErrKeyNotFound)
+	list, err = keys.List(other)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, third.ID, list[0].ID)
+	list, err = keys.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+}
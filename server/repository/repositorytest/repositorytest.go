@@ -0,0 +1,253 @@
+// Package repositorytest checks that an implementation of the repositories
+// behaves like the others.
+package repositorytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"library/models"
+	"library/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Books returns sample books covering the criteria of a Filter.
+func Books() []models.Book {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	return []models.Book{
+		{Title: "The Hobbit", Author: "J.R.R. Tolkien", Published: date(1937, 9, 21), Edition: 1, GenreName: "Fantasy", Description: "There and back again"},
+		{Title: "Dune", Author: "Frank Herbert", Published: date(1965, 8, 1), Edition: 1, GenreName: "Science Fiction"},
+		{Title: "The Fellowship of the Ring", Author: "J.R.R. Tolkien", Published: date(1954, 7, 29), Edition: 2, GenreName: "Fantasy"},
+		{Title: "Foundation", Author: "Isaac Asimov", Published: date(1951, 6, 1), Edition: 1, GenreName: "Science Fiction"},
+		{Title: "Emma", Author: "Jane Austen", Published: date(1815, 12, 23), Edition: 1},
+	}
+}
+
+// Run runs the conformance tests against the repositories returned by
+// newRepository, which must be empty.
+func Run(t *testing.T, newRepository func(t *testing.T) repository.BookRepository) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (repository.BookRepository, []models.Book) {
+		repo := newRepository(t)
+		books := Books()
+		pointers := make([]*models.Book, len(books))
+		for i := range books {
+			pointers[i] = &books[i]
+		}
+		require.NoError(t, repo.Create(ctx, pointers...))
+		return repo, books
+	}
+
+	titles := func(books []models.Book) []string {
+		titles := []string{}
+		for _, book := range books {
+			titles = append(titles, book.Title)
+		}
+		return titles
+	}
+
+	t.Run("Create and Get", func(t *testing.T) {
+		repo, books := setup(t)
+		for _, book := range books {
+			assert.NotZero(t, book.ID)
+			assert.False(t, book.CreatedAt.IsZero())
+		}
+
+		book, err := repo.Get(ctx, books[1].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Dune", book.Title)
+		assert.True(t, books[1].Published.Equal(book.Published))
+
+		_, err = repo.Get(ctx, books[len(books)-1].ID+1)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		repo, books := setup(t)
+
+		testCases := []struct {
+			Description string
+			Filter      repository.Filter
+			Expected    []string
+		}{
+			{Description: "Everything", Filter: repository.Filter{}, Expected: titles(books)},
+			{Description: "Free Text", Filter: repository.Filter{Query: "Tolkien"}, Expected: []string{"The Hobbit", "The Fellowship of the Ring"}},
+			{Description: "Title Substring", Filter: repository.Filter{Title: "Ring"}, Expected: []string{"The Fellowship of the Ring"}},
+			{Description: "Genre Substring", Filter: repository.Filter{Genre: "Fiction"}, Expected: []string{"Dune", "Foundation"}},
+			{Description: "Description", Filter: repository.Filter{Description: "back"}, Expected: []string{"The Hobbit"}},
+			{Description: "Published Range", Filter: repository.Filter{From: "1950-01-01", To: "1960-01-01"}, Expected: []string{"The Fellowship of the Ring", "Foundation"}},
+			{Description: "Inclusive Bounds", Filter: repository.Filter{From: "1954-07-29", To: "1954-07-29"}, Expected: []string{"The Fellowship of the Ring"}},
+			{Description: "Case Sensitive", Filter: repository.Filter{Query: "tolkien"}, Expected: []string{}},
+			{Description: "Exact Authors", Filter: repository.Filter{Authors: []string{"Frank Herbert", "Jane Austen"}}, Expected: []string{"Dune", "Emma"}},
+			{Description: "Exact Genres", Filter: repository.Filter{Genres: []string{"Fantasy"}}, Expected: []string{"The Hobbit", "The Fellowship of the Ring"}},
+			{Description: "IDs", Filter: repository.Filter{IDs: []uint{books[0].ID, books[4].ID}}, Expected: []string{"The Hobbit", "Emma"}},
+			{Description: "After ID", Filter: repository.Filter{AfterID: books[2].ID}, Expected: []string{"Foundation", "Emma"}},
+			{Description: "No Match", Filter: repository.Filter{Author: "Nobody"}, Expected: []string{}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.Description, func(t *testing.T) {
+				found, err := repo.Search(ctx, tc.Filter, repository.ListOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Expected, titles(found))
+
+				count, err := repo.Count(ctx, tc.Filter)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(len(tc.Expected)), count)
+			})
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo, books := setup(t)
+
+		testCases := []struct {
+			Description string
+			Options     repository.ListOptions
+			Expected    []string
+		}{
+			{Description: "By ID", Options: repository.ListOptions{}, Expected: titles(books)},
+			{Description: "Newest", Options: repository.ListOptions{Order: repository.OrderByNewest, Limit: 2}, Expected: []string{"Emma", "Foundation"}},
+			{Description: "By Title", Options: repository.ListOptions{Order: repository.OrderByTitle, Limit: 2, Offset: 1}, Expected: []string{"Emma", "Foundation"}},
+			{Description: "By Publication", Options: repository.ListOptions{Order: repository.OrderByPublished, Limit: 1}, Expected: []string{"Emma"}},
+			{Description: "Past the End", Options: repository.ListOptions{Offset: 10}, Expected: []string{}},
+			{Description: "Per Genre", Options: repository.ListOptions{Order: repository.OrderByPublished, Limit: 1, Per: repository.FieldGenre}, Expected: []string{"Emma", "The Hobbit", "Foundation"}},
+			{Description: "Per Author Past the First", Options: repository.ListOptions{Limit: 1, Offset: 1, Per: repository.FieldAuthor}, Expected: []string{"The Fellowship of the Ring"}},
+			{Description: "Per Author Unlimited", Options: repository.ListOptions{Offset: 1, Per: repository.FieldAuthor}, Expected: []string{"The Fellowship of the Ring"}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.Description, func(t *testing.T) {
+				found, err := repo.List(ctx, tc.Options)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Expected, titles(found))
+			})
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo, books := setup(t)
+
+		book := books[1]
+		book.Edition = 3
+		book.GenreName = "Classics"
+		assert.NoError(t, repo.Update(ctx, &book))
+		assert.Equal(t, books[1].CreatedAt.Unix(), book.CreatedAt.Unix())
+
+		stored, err := repo.Get(ctx, book.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, stored.Edition)
+		assert.Equal(t, "Classics", stored.GenreName)
+
+		missing := models.Book{Title: "Missing", Author: "Nobody", Edition: 1}
+		missing.ID = books[len(books)-1].ID + 1
+		assert.ErrorIs(t, repo.Update(ctx, &missing), repository.ErrNotFound)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		repo, books := setup(t)
+
+		// Values as decoded from a JSON request
+		patched, err := repo.Patch(ctx, books[4].ID, map[string]interface{}{
+			"edition":   float64(2),
+			"published": "1816-01-01T00:00:00Z",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, patched.Edition)
+		assert.Equal(t, "Emma", patched.Title)
+
+		stored, err := repo.Get(ctx, books[4].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, stored.Edition)
+		assert.Equal(t, 1816, stored.Published.Year())
+
+		_, err = repo.Patch(ctx, books[len(books)-1].ID+1, map[string]interface{}{"edition": 2})
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo, books := setup(t)
+		before := time.Now().Add(-time.Second)
+
+		assert.NoError(t, repo.Delete(ctx, books[0].ID))
+		assert.ErrorIs(t, repo.Delete(ctx, books[0].ID), repository.ErrNotFound)
+
+		_, err := repo.Get(ctx, books[0].ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		count, err := repo.Count(ctx, repository.Filter{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(books)-1), count)
+
+		// Deleted books are kept for those asking for them
+		found, err := repo.Search(ctx, repository.Filter{Deleted: true, ChangedFrom: before}, repository.ListOptions{Order: repository.OrderByLastChanged, Limit: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"The Hobbit"}, titles(found))
+		assert.True(t, found[0].DeletedAt.Valid)
+	})
+
+	t.Run("Groups", func(t *testing.T) {
+		repo, _ := setup(t)
+
+		genres, err := repo.Groups(ctx, repository.FieldGenre, repository.Filter{})
+		assert.NoError(t, err)
+		assert.Equal(t, []repository.Group{{Name: "Fantasy", Count: 2}, {Name: "Science Fiction", Count: 2}}, genres)
+
+		authors, err := repo.Groups(ctx, repository.FieldAuthor, repository.Filter{Genre: "Fantasy"})
+		assert.NoError(t, err)
+		assert.Equal(t, []repository.Group{{Name: "J.R.R. Tolkien", Count: 2}}, authors)
+	})
+
+	t.Run("Tenants", func(t *testing.T) {
+		repo, books := setup(t)
+		other := repository.WithTenant(ctx, 2)
+		assert.Equal(t, repository.DefaultTenant, books[0].TenantID)
+
+		// The books of the other tenants are neither read nor written, even
+		// once their tenant read them
+		_, err := repo.Get(ctx, books[0].ID)
+		require.NoError(t, err)
+		_, err = repo.Count(ctx, repository.Filter{})
+		require.NoError(t, err)
+		_, err = repo.Get(other, books[0].ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		found, err := repo.Search(other, repository.Filter{Query: "Dune"}, repository.ListOptions{})
+		assert.NoError(t, err)
+		assert.Empty(t, found)
+		count, err := repo.Count(other, repository.Filter{})
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+		genres, err := repo.Groups(other, repository.FieldGenre, repository.Filter{})
+		assert.NoError(t, err)
+		assert.Empty(t, genres)
+		assert.ErrorIs(t, repo.Update(other, &models.Book{Model: books[0].Model, Title: "Taken", Author: "Nobody", Edition: 1}), repository.ErrNotFound)
+		_, err = repo.Patch(other, books[0].ID, map[string]interface{}{"title": "Taken"})
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(other, books[0].ID), repository.ErrNotFound)
+
+		// Nor moved to another tenant by a patch
+		_, err = repo.Patch(ctx, books[0].ID, map[string]interface{}{"edition": 3, "tenant_id": 2})
+		assert.NoError(t, err)
+
+		dune := models.Book{Title: "Dune", Author: "Frank Herbert", Edition: 2}
+		require.NoError(t, repo.Create(other, &dune))
+		assert.Equal(t, uint(2), dune.TenantID)
+		found, err = repo.Search(other, repository.Filter{}, repository.ListOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Dune"}, titles(found))
+		assert.Equal(t, 2, found[0].Edition)
+		stored, err := repo.Get(ctx, books[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "The Hobbit", stored.Title)
+		assert.Equal(t, 3, stored.Edition)
+		count, err = repo.Count(ctx, repository.Filter{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(books)), count)
+	})
+}
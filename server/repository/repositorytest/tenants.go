@@ -0,0 +1,66 @@
+package repositorytest
+
+import (
+	"context"
+	"testing"
+
+	"library/models"
+	"library/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunTenants runs the conformance tests against the tenant repositories
+// returned by newRepository, which must only hold the default tenant.
+func RunTenants(t *testing.T, newRepository func(t *testing.T) repository.TenantRepository) {
+	ctx := context.Background()
+	tenants := newRepository(t)
+
+	list, err := tenants.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, repository.DefaultTenant, list[0].ID)
+	assert.Equal(t, repository.DefaultTenantSlug, list[0].Slug)
+	assert.Equal(t, models.DefaultLoanDays, list[0].LoanDays)
+
+	springfield := models.Tenant{Slug: "springfield", Name: "Springfield Public Library", LoanDays: 21, Color: "#336699"}
+	shelbyville := models.Tenant{Slug: "shelbyville", Name: "Shelbyville Library", LoanDays: 14}
+	require.NoError(t, tenants.Create(ctx, &springfield))
+	require.NoError(t, tenants.Create(ctx, &shelbyville))
+	assert.NotZero(t, springfield.ID)
+	assert.NotEqual(t, repository.DefaultTenant, springfield.ID)
+	assert.NotEqual(t, springfield.ID, shelbyville.ID)
+	assert.False(t, springfield.CreatedAt.IsZero())
+	assert.ErrorIs(t, tenants.Create(ctx, &models.Tenant{Slug: "springfield", Name: "Other"}), repository.ErrTenantExists)
+
+	found, err := tenants.Get(ctx, springfield.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Springfield Public Library", found.Name)
+	assert.Equal(t, 21, found.LoanDays)
+	_, err = tenants.Get(ctx, 1000)
+	assert.ErrorIs(t, err, repository.ErrTenantNotFound)
+	found, err = tenants.FindBySlug(ctx, "shelbyville")
+	require.NoError(t, err)
+	assert.Equal(t, shelbyville.ID, found.ID)
+	_, err = tenants.FindBySlug(ctx, "ogdenville")
+	assert.ErrorIs(t, err, repository.ErrTenantNotFound)
+
+	// Updates change the settings, but not the slug
+	update := models.Tenant{ID: springfield.ID, Slug: "renamed", Name: "Springfield Library", LoanDays: 28, Tagline: "Read more", LogoURL: "https://springfield.example/logo.png"}
+	require.NoError(t, tenants.Update(ctx, &update))
+	assert.Equal(t, "springfield", update.Slug)
+	found, err = tenants.FindBySlug(ctx, "springfield")
+	require.NoError(t, err)
+	assert.Equal(t, "Springfield Library", found.Name)
+	assert.Equal(t, 28, found.LoanDays)
+	assert.Equal(t, "Read more", found.Tagline)
+	assert.Empty(t, found.Color)
+	assert.ErrorIs(t, tenants.Update(ctx, &models.Tenant{ID: 1000, Name: "Nowhere"}), repository.ErrTenantNotFound)
+
+	list, err = tenants.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.Equal(t, springfield.ID, list[1].ID)
+	assert.Equal(t, shelbyville.ID, list[2].ID)
+}
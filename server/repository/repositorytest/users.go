@@ -0,0 +1,180 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"library/models"
+	"library/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunUsers runs the conformance tests against the user repositories
+// returned by newRepository, which must be empty.
+func RunUsers(t *testing.T, newRepository func(t *testing.T) repository.UserRepository) {
+	ctx := context.Background()
+	users := newRepository(t)
+
+	alice := models.User{Username: "alice", PasswordHash: "hash-1", Role: "librarian"}
+	bob := models.User{Username: "bob", PasswordHash: "hash-2", Role: "patron"}
+	require.NoError(t, users.Create(ctx, &alice))
+	require.NoError(t, users.Create(ctx, &bob))
+	assert.NotZero(t, alice.ID)
+	assert.NotEqual(t, alice.ID, bob.ID)
+	assert.False(t, alice.CreatedAt.IsZero())
+	assert.ErrorIs(t, users.Create(ctx, &models.User{Username: "alice", PasswordHash: "hash-3", Role: "admin"}), repository.ErrUserExists)
+
+	found, err := users.Get(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", found.Username)
+	assert.Equal(t, "patron", found.Role)
+	_, err = users.Get(ctx, 1000)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	found, err = users.FindByUsername(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, found.ID)
+	_, err = users.FindByUsername(ctx, "carol")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	// The users of an identity provider are found by their subject
+	carol := models.User{Username: "carol", Subject: "f81d4fae", Role: "patron"}
+	require.NoError(t, users.Create(ctx, &carol))
+	found, err = users.FindBySubject(ctx, "f81d4fae")
+	require.NoError(t, err)
+	assert.Equal(t, carol.ID, found.ID)
+	_, err = users.FindBySubject(ctx, "")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound, "the users with a password")
+
+	// Updates see the latest version, and change nothing when they fail
+	for i := 0; i < 3; i++ {
+		_, err := users.Update(ctx, alice.ID, func(user *models.User) error {
+			user.FailedLogins++
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	failed := errors.New("failed")
+	_, err = users.Update(ctx, alice.ID, func(user *models.User) error {
+		user.FailedLogins = 0
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	expires := time.Now().Add(time.Hour).UTC()
+	updated, err := users.Update(ctx, alice.ID, func(user *models.User) error {
+		user.ResetHash, user.ResetExpiresAt = "reset-1", &expires
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, updated.FailedLogins)
+	assert.Equal(t, "alice", updated.Username)
+	_, err = users.Update(ctx, 1000, func(user *models.User) error { return nil })
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	// Only the unexpired reset tokens are found
+	found, err = users.FindByReset(ctx, "reset-1")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, found.ID)
+	assert.Equal(t, 3, found.FailedLogins)
+	_, err = users.FindByReset(ctx, "")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	expired := time.Now().Add(-time.Minute).UTC()
+	_, err = users.Update(ctx, bob.ID, func(user *models.User) error {
+		user.ResetHash, user.ResetExpiresAt = "reset-2", &expired
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = users.FindByReset(ctx, "reset-2")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	list, err := users.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.Equal(t, alice.ID, list[0].ID)
+	assert.Equal(t, bob.ID, list[1].ID)
+
+	// The usernames are unique within a tenant, whose users the others
+	// only get by ID
+	other := repository.WithTenant(ctx, 2)
+	otherAlice := models.User{Username: "alice", PasswordHash: "hash-4", Role: "admin"}
+	require.NoError(t, users.Create(other, &otherAlice))
+	assert.NotEqual(t, alice.ID, otherAlice.ID)
+	assert.Equal(t, uint(2), otherAlice.TenantID)
+	found, err = users.FindByUsername(other, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, otherAlice.ID, found.ID)
+	_, err = users.FindByUsername(other, "bob")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = users.FindBySubject(other, "f81d4fae")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = users.FindByReset(other, "reset-1")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = users.Update(other, bob.ID, func(user *models.User) error { return nil })
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	found, err = users.Get(ctx, otherAlice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), found.TenantID)
+	list, err = users.List(other)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, otherAlice.ID, list[0].ID)
+}
+
+// RunSessions runs the conformance tests against the session repositories
+// returned by newRepository, which must be empty, with the user repositories
+// of the same storage.
+func RunSessions(t *testing.T, newRepository func(t *testing.T) (repository.UserRepository, repository.SessionRepository)) {
+	ctx := context.Background()
+	users, sessions := newRepository(t)
+	alice := models.User{Username: "alice", PasswordHash: "hash-1", Role: "librarian"}
+	bob := models.User{Username: "bob", PasswordHash: "hash-2", Role: "patron"}
+	require.NoError(t, users.Create(ctx, &alice))
+	require.NoError(t, users.Create(ctx, &bob))
+
+	later := time.Now().Add(time.Hour).UTC()
+	first := models.Session{Hash: "hash-1", UserID: alice.ID, ExpiresAt: later}
+	second := models.Session{Hash: "hash-2", UserID: alice.ID, ExpiresAt: later}
+	third := models.Session{Hash: "hash-3", UserID: bob.ID, ExpiresAt: later}
+	expired := models.Session{Hash: "hash-4", UserID: bob.ID, ExpiresAt: time.Now().Add(-time.Minute).UTC()}
+	for _, session := range []*models.Session{&first, &second, &third, &expired} {
+		require.NoError(t, sessions.Create(ctx, session))
+	}
+	assert.NotZero(t, first.ID)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.False(t, first.CreatedAt.IsZero())
+
+	found, err := sessions.Find(ctx, "hash-2")
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, found.ID)
+	assert.Equal(t, alice.ID, found.UserID)
+	_, err = sessions.Find(ctx, "hash-4")
+	assert.ErrorIs(t, err, repository.ErrSessionNotFound, "expired")
+	_, err = sessions.Find(ctx, "hash-5")
+	assert.ErrorIs(t, err, repository.ErrSessionNotFound)
+
+	deleted, err := sessions.DeleteExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.ErrorIs(t, sessions.Delete(ctx, "hash-4"), repository.ErrSessionNotFound)
+
+	require.NoError(t, sessions.Delete(ctx, "hash-3"))
+	_, err = sessions.Find(ctx, "hash-3")
+	assert.ErrorIs(t, err, repository.ErrSessionNotFound)
+	assert.ErrorIs(t, sessions.Delete(ctx, "hash-3"), repository.ErrSessionNotFound)
+
+	// The sessions of a user are deleted but one
+	require.NoError(t, sessions.Create(ctx, &models.Session{Hash: "hash-5", UserID: bob.ID, ExpiresAt: later}))
+	require.NoError(t, sessions.DeleteUser(ctx, alice.ID, "hash-2"))
+	_, err = sessions.Find(ctx, "hash-1")
+	assert.ErrorIs(t, err, repository.ErrSessionNotFound)
+	_, err = sessions.Find(ctx, "hash-2")
+	assert.NoError(t, err)
+	_, err = sessions.Find(ctx, "hash-5")
+	assert.NoError(t, err, "of another user")
+	require.NoError(t, sessions.DeleteUser(ctx, alice.ID, ""))
+	_, err = sessions.Find(ctx, "hash-2")
+	assert.ErrorIs(t, err, repository.ErrSessionNotFound)
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"library/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTenant is the ID of the tenant created by the migrations, owning
+// the books, API keys and users of the deployments hosting a single library
+// and those of the contexts without a tenant.
+const DefaultTenant uint = 1
+
+// DefaultTenantSlug is the slug of the default tenant.
+const DefaultTenantSlug = "default"
+
+// ErrTenantNotFound is returned when a tenant does not exist.
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// ErrTenantExists is returned when creating a tenant whose slug is taken.
+var ErrTenantExists = errors.New("tenant slug already taken")
+
+// tenantKey holds the tenant of a context.
+type tenantKey struct{}
+
+// WithTenant returns a context whose reads and writes only see the books,
+// API keys and users of a tenant.
+func WithTenant(ctx context.Context, tenant uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantOf returns the tenant of a context, DefaultTenant if it has none.
+func TenantOf(ctx context.Context) uint {
+	if tenant, ok := ctx.Value(tenantKey{}).(uint); ok && tenant != 0 {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// TenantScope is the GORM scope restricting a query to the rows of the
+// tenant of a context, which every query of the tenanted tables goes
+// through.
+func TenantScope(ctx context.Context) func(db *gorm.DB) *gorm.DB {
+	tenant := TenantOf(ctx)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("tenant_id = ?", tenant)
+	}
+}
+
+// TenantRepository stores the tenants, the libraries the deployment hosts.
+// Unlike the other repositories, it sees all of them whatever the tenant of
+// the context.
+type TenantRepository interface {
+	// Create adds a tenant, setting its ID and timestamps, or returns
+	// ErrTenantExists.
+	Create(ctx context.Context, tenant *models.Tenant) error
+	// Get returns a tenant by ID, or ErrTenantNotFound.
+	Get(ctx context.Context, id uint) (models.Tenant, error)
+	// FindBySlug returns the tenant of a slug, or ErrTenantNotFound.
+	FindBySlug(ctx context.Context, slug string) (models.Tenant, error)
+	// List returns all the tenants by ID.
+	List(ctx context.Context) ([]models.Tenant, error)
+	// Update replaces the settings of an existing tenant, but its slug, or
+	// returns ErrTenantNotFound.
+	Update(ctx context.Context, tenant *models.Tenant) error
+}
+
+// MemoryTenants stores the tenants in memory, for tests and development.
+type MemoryTenants struct {
+	mu      sync.RWMutex
+	tenants map[uint]models.Tenant
+	lastID  uint
+	now     func() time.Time
+}
+
+// NewMemoryTenants returns an in-memory tenant repository holding the
+// default tenant, as the migrations create it.
+func NewMemoryTenants() *MemoryTenants {
+	now := time.Now()
+	return &MemoryTenants{
+		tenants: map[uint]models.Tenant{DefaultTenant: {
+			ID:        DefaultTenant,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Slug:      DefaultTenantSlug,
+			Name:      "Book Management API",
+			LoanDays:  models.DefaultLoanDays,
+		}},
+		lastID: DefaultTenant,
+		now:    time.Now,
+	}
+}
+
+func (m *MemoryTenants) Create(ctx context.Context, tenant *models.Tenant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.tenants {
+		if existing.Slug == tenant.Slug {
+			return ErrTenantExists
+		}
+	}
+	m.lastID++
+	tenant.ID = m.lastID
+	tenant.CreatedAt = m.now()
+	tenant.UpdatedAt = tenant.CreatedAt
+	m.tenants[tenant.ID] = *tenant
+	return nil
+}
+
+func (m *MemoryTenants) Get(ctx context.Context, id uint) (models.Tenant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tenant, ok := m.tenants[id]
+	if !ok {
+		return models.Tenant{}, ErrTenantNotFound
+	}
+	return tenant, nil
+}
+
+func (m *MemoryTenants) FindBySlug(ctx context.Context, slug string) (models.Tenant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, tenant := range m.tenants {
+		if tenant.Slug == slug {
+			return tenant, nil
+		}
+	}
+	return models.Tenant{}, ErrTenantNotFound
+}
+
+func (m *MemoryTenants) List(ctx context.Context) ([]models.Tenant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tenants := make([]models.Tenant, 0, len(m.tenants))
+	for _, tenant := range m.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants, nil
+}
+
+func (m *MemoryTenants) Update(ctx context.Context, tenant *models.Tenant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.tenants[tenant.ID]
+	if !ok {
+		return ErrTenantNotFound
+	}
+	updated := *tenant
+	updated.Slug = existing.Slug
+	updated.CreatedAt = existing.CreatedAt
+	updated.UpdatedAt = m.now()
+	m.tenants[tenant.ID] = updated
+	*tenant = updated
+	return nil
+}
+
+// GORMTenants stores the tenants in a SQL database through GORM.
+type GORMTenants struct {
+	db *gorm.DB
+}
+
+// NewGORMTenants returns a repository of the tenants of the database.
+func NewGORMTenants(db *gorm.DB) *GORMTenants {
+	return &GORMTenants{db: db}
+}
+
+func (r *GORMTenants) Create(ctx context.Context, tenant *models.Tenant) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&models.Tenant{}).Where("slug = ?", tenant.Slug).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrTenantExists
+		}
+		return tx.Create(tenant).Error
+	})
+}
+
+func (r *GORMTenants) Get(ctx context.Context, id uint) (models.Tenant, error) {
+	return r.first(r.db.WithContext(ctx).Where("id = ?", id))
+}
+
+func (r *GORMTenants) FindBySlug(ctx context.Context, slug string) (models.Tenant, error) {
+	return r.first(r.db.WithContext(ctx).Where("slug = ?", slug))
+}
+
+func (r *GORMTenants) first(query *gorm.DB) (models.Tenant, error) {
+	var tenant models.Tenant
+	err := query.First(&tenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tenant, ErrTenantNotFound
+	}
+	return tenant, err
+}
+
+func (r *GORMTenants) List(ctx context.Context) ([]models.Tenant, error) {
+	tenants := []models.Tenant{}
+	err := r.db.WithContext(ctx).Order("id").Find(&tenants).Error
+	return tenants, err
+}
+
+func (r *GORMTenants) Update(ctx context.Context, tenant *models.Tenant) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.Tenant
+		if err := tx.Where("id = ?", tenant.ID).First(&existing).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTenantNotFound
+		} else if err != nil {
+			return err
+		}
+		existing.Name = tenant.Name
+		existing.LoanDays = tenant.LoanDays
+		existing.Tagline = tenant.Tagline
+		existing.Color = tenant.Color
+		existing.LogoURL = tenant.LogoURL
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+		*tenant = existing
+		return nil
+	})
+}
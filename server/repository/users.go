@@ -0,0 +1,353 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"library/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrUserNotFound is returned when a user does not exist.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUserExists is returned when creating a user whose username is taken.
+var ErrUserExists = errors.New("username already taken")
+
+// ErrSessionNotFound is returned when a session does not exist or expired.
+var ErrSessionNotFound = errors.New("session not found")
+
+// UserRepository stores the users logging in with a password or an identity
+// provider, each a member of the tenant of the context it was created in.
+// Only Get finds the users of the other tenants.
+type UserRepository interface {
+	// Create adds a user to the tenant of the context, setting its ID and
+	// timestamps, or returns ErrUserExists if the tenant has a user of its
+	// username.
+	Create(ctx context.Context, user *models.User) error
+	// Get returns a user by ID, whatever its tenant, or ErrUserNotFound.
+	Get(ctx context.Context, id uint) (models.User, error)
+	// FindByUsername returns the user of a username, or ErrUserNotFound.
+	FindByUsername(ctx context.Context, username string) (models.User, error)
+	// FindBySubject returns the user of the subject of an identity provider,
+	// or ErrUserNotFound.
+	FindBySubject(ctx context.Context, subject string) (models.User, error)
+	// FindByReset returns the user of the hash of an unexpired reset token,
+	// or ErrUserNotFound.
+	FindByReset(ctx context.Context, hash string) (models.User, error)
+	// List returns all the users by ID.
+	List(ctx context.Context) ([]models.User, error)
+	// Update changes a user with update, which sees the latest version of
+	// the user and no concurrent update, and returns the updated user. An
+	// error of update is returned as is, and changes nothing.
+	Update(ctx context.Context, id uint, update func(user *models.User) error) (models.User, error)
+}
+
+// SessionRepository stores the sessions of the users by the hash of their
+// token.
+type SessionRepository interface {
+	// Create adds a session, setting its ID and creation time.
+	Create(ctx context.Context, session *models.Session) error
+	// Find returns the unexpired session of a hash, or ErrSessionNotFound.
+	Find(ctx context.Context, hash string) (models.Session, error)
+	// Delete removes the session of a hash, or returns ErrSessionNotFound.
+	Delete(ctx context.Context, hash string) error
+	// DeleteUser removes all the sessions of a user but that of the hash
+	// except, if any.
+	DeleteUser(ctx context.Context, userID uint, except string) error
+	// DeleteExpired removes the sessions expired at a time, and returns
+	// their number.
+	DeleteExpired(ctx context.Context, at time.Time) (int64, error)
+}
+
+// MemoryUsers stores the users in memory, for tests and development.
+type MemoryUsers struct {
+	mu    sync.RWMutex
+	users []models.User
+	now   func() time.Time
+}
+
+// NewMemoryUsers returns an empty in-memory user repository.
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{now: time.Now}
+}
+
+func (m *MemoryUsers) Create(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user.TenantID = TenantOf(ctx)
+	for _, existing := range m.users {
+		if existing.TenantID == user.TenantID && existing.Username == user.Username {
+			return ErrUserExists
+		}
+	}
+	user.ID = uint(len(m.users) + 1)
+	user.CreatedAt = m.now()
+	user.UpdatedAt = user.CreatedAt
+	m.users = append(m.users, *user)
+	return nil
+}
+
+func (m *MemoryUsers) Get(ctx context.Context, id uint) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id == 0 || int(id) > len(m.users) {
+		return models.User{}, ErrUserNotFound
+	}
+	return m.users[id-1], nil
+}
+
+func (m *MemoryUsers) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	return m.find(ctx, func(user models.User) bool { return user.Username == username })
+}
+
+func (m *MemoryUsers) FindBySubject(ctx context.Context, subject string) (models.User, error) {
+	return m.find(ctx, func(user models.User) bool { return subject != "" && user.Subject == subject })
+}
+
+func (m *MemoryUsers) FindByReset(ctx context.Context, hash string) (models.User, error) {
+	now := m.now()
+	return m.find(ctx, func(user models.User) bool {
+		return hash != "" && user.ResetHash == hash && user.ResetExpiresAt != nil && user.ResetExpiresAt.After(now)
+	})
+}
+
+// find returns the first user of the tenant of the context that matches.
+func (m *MemoryUsers) find(ctx context.Context, match func(models.User) bool) (models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, user := range m.users {
+		if user.TenantID == TenantOf(ctx) && match(user) {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrUserNotFound
+}
+
+func (m *MemoryUsers) List(ctx context.Context) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := []models.User{}
+	for _, user := range m.users {
+		if user.TenantID == TenantOf(ctx) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (m *MemoryUsers) Update(ctx context.Context, id uint, update func(user *models.User) error) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == 0 || int(id) > len(m.users) || m.users[id-1].TenantID != TenantOf(ctx) {
+		return models.User{}, ErrUserNotFound
+	}
+	user := m.users[id-1]
+	if err := update(&user); err != nil {
+		return models.User{}, err
+	}
+	user.ID = id
+	user.UpdatedAt = m.now()
+	m.users[id-1] = user
+	return user, nil
+}
+
+// MemorySessions stores the sessions in memory, for tests and development.
+type MemorySessions struct {
+	mu       sync.RWMutex
+	sessions map[string]models.Session
+	lastID   uint
+	now      func() time.Time
+}
+
+// NewMemorySessions returns an empty in-memory session repository.
+func NewMemorySessions() *MemorySessions {
+	return &MemorySessions{sessions: map[string]models.Session{}, now: time.Now}
+}
+
+func (m *MemorySessions) Create(ctx context.Context, session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	session.ID = m.lastID
+	session.CreatedAt = m.now()
+	m.sessions[session.Hash] = *session
+	return nil
+}
+
+func (m *MemorySessions) Find(ctx context.Context, hash string) (models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[hash]
+	if !ok || !session.ExpiresAt.After(m.now()) {
+		return models.Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (m *MemorySessions) Delete(ctx context.Context, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[hash]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(m.sessions, hash)
+	return nil
+}
+
+func (m *MemorySessions) DeleteUser(ctx context.Context, userID uint, except string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, session := range m.sessions {
+		if session.UserID == userID && hash != except {
+			delete(m.sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (m *MemorySessions) DeleteExpired(ctx context.Context, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for hash, session := range m.sessions {
+		if !session.ExpiresAt.After(at) {
+			delete(m.sessions, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// GORMUsers stores the users in a SQL database through GORM.
+type GORMUsers struct {
+	db *gorm.DB
+}
+
+// NewGORMUsers returns a repository of the users of the database.
+func NewGORMUsers(db *gorm.DB) *GORMUsers {
+	return &GORMUsers{db: db}
+}
+
+func (r *GORMUsers) Create(ctx context.Context, user *models.User) error {
+	user.TenantID = TenantOf(ctx)
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&models.User{}).Scopes(TenantScope(ctx)).Where("username = ?", user.Username).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrUserExists
+		}
+		return tx.Create(user).Error
+	})
+}
+
+func (r *GORMUsers) Get(ctx context.Context, id uint) (models.User, error) {
+	return r.first(r.db.WithContext(ctx).Where("id = ?", id))
+}
+
+func (r *GORMUsers) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	return r.first(r.db.WithContext(ctx).Scopes(TenantScope(ctx)).Where("username = ?", username))
+}
+
+func (r *GORMUsers) FindBySubject(ctx context.Context, subject string) (models.User, error) {
+	if subject == "" {
+		return models.User{}, ErrUserNotFound
+	}
+	return r.first(r.db.WithContext(ctx).Scopes(TenantScope(ctx)).Where("subject = ?", subject))
+}
+
+func (r *GORMUsers) FindByReset(ctx context.Context, hash string) (models.User, error) {
+	if hash == "" {
+		return models.User{}, ErrUserNotFound
+	}
+	return r.first(r.db.WithContext(ctx).Scopes(TenantScope(ctx)).Where("reset_hash = ? AND reset_expires_at > ?", hash, time.Now().UTC()))
+}
+
+func (r *GORMUsers) first(query *gorm.DB) (models.User, error) {
+	var user models.User
+	err := query.First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r *GORMUsers) List(ctx context.Context) ([]models.User, error) {
+	users := []models.User{}
+	err := r.db.WithContext(ctx).Scopes(TenantScope(ctx)).Order("id").Find(&users).Error
+	return users, err
+}
+
+func (r *GORMUsers) Update(ctx context.Context, id uint, update func(user *models.User) error) (models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// SQLite serializes the transactions writing, while Postgres locks the row
+		query := tx.Scopes(TenantScope(ctx)).Where("id = ?", id)
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := query.First(&user).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		} else if err != nil {
+			return err
+		}
+		if err := update(&user); err != nil {
+			return err
+		}
+		user.ID = id
+		return tx.Save(&user).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// GORMSessions stores the sessions in a SQL database through GORM.
+type GORMSessions struct {
+	db *gorm.DB
+}
+
+// NewGORMSessions returns a repository of the sessions of the database.
+func NewGORMSessions(db *gorm.DB) *GORMSessions {
+	return &GORMSessions{db: db}
+}
+
+func (r *GORMSessions) Create(ctx context.Context, session *models.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *GORMSessions) Find(ctx context.Context, hash string) (models.Session, error) {
+	var session models.Session
+	err := r.db.WithContext(ctx).Where("hash = ? AND expires_at > ?", hash, time.Now().UTC()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return session, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (r *GORMSessions) Delete(ctx context.Context, hash string) error {
+	result := r.db.WithContext(ctx).Where("hash = ?", hash).Delete(&models.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *GORMSessions) DeleteUser(ctx context.Context, userID uint, except string) error {
+	return r.db.WithContext(ctx).Where("user_id = ? AND hash <> ?", userID, except).Delete(&models.Session{}).Error
+}
+
+func (r *GORMSessions) DeleteExpired(ctx context.Context, at time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at <= ?", at.UTC()).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,172 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"library/models"
+	libraryv1 "library/proto/library/v1"
+	"library/repository"
+
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// listBatchSize is the number of books fetched at once while streaming the library.
+const listBatchSize = 100
+
+var validate = validator.New()
+
+// BookServer implements the BookService.
+type BookServer struct {
+	libraryv1.UnimplementedBookServiceServer
+	books repository.BookRepository
+}
+
+// GetBook returns a book by ID.
+func (s *BookServer) GetBook(ctx context.Context, request *libraryv1.GetBookRequest) (*libraryv1.GetBookResponse, error) {
+	book, err := s.find(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &libraryv1.GetBookResponse{Book: toProto(book)}, nil
+}
+
+// ListBooks streams every book of the library, in batches to bound memory use.
+func (s *BookServer) ListBooks(request *libraryv1.ListBooksRequest, stream libraryv1.BookService_ListBooksServer) error {
+	options := repository.ListOptions{Order: repository.OrderByID, Limit: listBatchSize}
+	for {
+		batch, err := s.books.List(stream.Context(), options)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Failed to retrieve books: %v", err)
+		}
+		for _, book := range batch {
+			if err := stream.Send(&libraryv1.ListBooksResponse{Book: toProto(book)}); err != nil {
+				return err
+			}
+		}
+		if len(batch) < listBatchSize {
+			return nil
+		}
+		options.Offset += listBatchSize
+	}
+}
+
+// SearchBooks returns the books matching all the criteria of the request.
+func (s *BookServer) SearchBooks(ctx context.Context, request *libraryv1.SearchBooksRequest) (*libraryv1.SearchBooksResponse, error) {
+	filter := repository.Filter{
+		Query:       request.GetQ(),
+		Title:       request.GetTitle(),
+		Author:      request.GetAuthor(),
+		From:        request.GetFrom(),
+		To:          request.GetTo(),
+		Description: request.GetDescription(),
+		Genre:       request.GetGenre(),
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid search criteria: %v", err)
+	}
+
+	books, err := s.books.Search(ctx, filter, repository.ListOptions{})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to fetch books: %v", err)
+	}
+
+	response := &libraryv1.SearchBooksResponse{Books: make([]*libraryv1.Book, 0, len(books))}
+	for _, book := range books {
+		response.Books = append(response.Books, toProto(book))
+	}
+	return response, nil
+}
+
+// AddBook adds a new book to the library.
+func (s *BookServer) AddBook(ctx context.Context, request *libraryv1.AddBookRequest) (*libraryv1.AddBookResponse, error) {
+	var book models.Book
+	fromProto(request.GetBook(), &book)
+	if err := validate.Struct(book); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid book: %v", err)
+	}
+
+	if err := s.books.Create(ctx, &book); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create book: %v", err)
+	}
+	return &libraryv1.AddBookResponse{Book: toProto(book)}, nil
+}
+
+// UpdateBook replaces the details of a book.
+func (s *BookServer) UpdateBook(ctx context.Context, request *libraryv1.UpdateBookRequest) (*libraryv1.UpdateBookResponse, error) {
+	book, err := s.find(ctx, request.GetBook().GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	fromProto(request.GetBook(), &book)
+	if err := validate.Struct(book); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid book: %v", err)
+	}
+
+	if err := s.books.Update(ctx, &book); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to update book: %v", err)
+	}
+	return &libraryv1.UpdateBookResponse{Book: toProto(book)}, nil
+}
+
+// PatchBook changes the details of a book listed in the update mask.
+func (s *BookServer) PatchBook(ctx context.Context, request *libraryv1.PatchBookRequest) (*libraryv1.PatchBookResponse, error) {
+	paths := request.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "The update mask is required")
+	}
+
+	book, err := s.find(ctx, request.GetBook().GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	updates, err := patch(request.GetBook(), paths, &book)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validate.Struct(book); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid book: %v", err)
+	}
+
+	book, err = s.books.Patch(ctx, book.ID, updates)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to update book: %v", err)
+	}
+	return &libraryv1.PatchBookResponse{Book: toProto(book)}, nil
+}
+
+// DeleteBook deletes a book by ID.
+func (s *BookServer) DeleteBook(ctx context.Context, request *libraryv1.DeleteBookRequest) (*libraryv1.DeleteBookResponse, error) {
+	err := s.books.Delete(ctx, uint(request.GetId()))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Book %d not found", request.GetId())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to delete book: %v", err)
+	}
+	return &libraryv1.DeleteBookResponse{}, nil
+}
+
+// CountBooks returns the number of books of the library.
+func (s *BookServer) CountBooks(ctx context.Context, request *libraryv1.CountBooksRequest) (*libraryv1.CountBooksResponse, error) {
+	count, err := s.books.Count(ctx, repository.Filter{})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to retrieve books count: %v", err)
+	}
+	return &libraryv1.CountBooksResponse{Count: count}, nil
+}
+
+// find returns a book by ID, or a NotFound status.
+func (s *BookServer) find(ctx context.Context, id uint64) (models.Book, error) {
+	book, err := s.books.Get(ctx, uint(id))
+	if errors.Is(err, repository.ErrNotFound) {
+		return book, status.Errorf(codes.NotFound, "Book %d not found", id)
+	}
+	if err != nil {
+		return book, status.Errorf(codes.Internal, "Failed to fetch book: %v", err)
+	}
+	return book, nil
+}
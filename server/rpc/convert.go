@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"fmt"
+	"library/models"
+	libraryv1 "library/proto/library/v1"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// toProto converts a book to its protobuf message.
+func toProto(book models.Book) *libraryv1.Book {
+	return &libraryv1.Book{
+		Id:          uint64(book.ID),
+		Title:       book.Title,
+		Author:      book.Author,
+		Published:   timestamppb.New(book.Published),
+		Edition:     int32(book.Edition),
+		Description: book.Description,
+		GenreName:   book.GenreName,
+		Isbn:        book.ISBN,
+		CreateTime:  timestamppb.New(book.CreatedAt),
+		UpdateTime:  timestamppb.New(book.UpdatedAt),
+	}
+}
+
+// fromProto copies the details of a protobuf book to book, leaving its ID
+// and timestamps untouched.
+func fromProto(message *libraryv1.Book, book *models.Book) {
+	book.Title = message.GetTitle()
+	book.Author = message.GetAuthor()
+	if message.GetPublished() != nil {
+		book.Published = message.GetPublished().AsTime()
+	}
+	book.Edition = int(message.GetEdition())
+	book.Description = message.GetDescription()
+	book.GenreName = message.GetGenreName()
+	book.ISBN = message.GetIsbn()
+}
+
+// patch applies the fields of message listed in the update mask paths to
+// book, returning the columns to update.
+func patch(message *libraryv1.Book, paths []string, book *models.Book) (map[string]interface{}, error) {
+	var patched models.Book
+	fromProto(message, &patched)
+
+	updates := map[string]interface{}{}
+	for _, path := range paths {
+		switch path {
+		case "title":
+			book.Title = patched.Title
+			updates["title"] = book.Title
+		case "author":
+			book.Author = patched.Author
+			updates["author"] = book.Author
+		case "published":
+			book.Published = patched.Published.UTC()
+			updates["published"] = book.Published
+		case "edition":
+			book.Edition = patched.Edition
+			updates["edition"] = book.Edition
+		case "description":
+			book.Description = patched.Description
+			updates["description"] = book.Description
+		case "genre_name":
+			book.GenreName = patched.GenreName
+			updates["genre_name"] = book.GenreName
+		case "isbn":
+			book.ISBN = patched.ISBN
+			updates["isbn"] = book.ISBN
+		default:
+			return nil, fmt.Errorf("unknown field %q in the update mask", path)
+		}
+	}
+	return updates, nil
+}
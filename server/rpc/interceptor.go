@@ -0,0 +1,228 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"library/auth"
+	libraryv1 "library/proto/library/v1"
+	"library/ratelimit"
+	"library/repository"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultRateGroup is the group of the methods missing from RateGroups, as
+// that of the routes of the API.
+const DefaultRateGroup = "default"
+
+// Policy maps every method of the server to the permission it requires, as
+// that of the matching route of the API, auth.Public for none. The methods
+// missing from it are forbidden to all.
+var Policy = map[string]auth.Permission{
+	libraryv1.BookService_GetBook_FullMethodName:     auth.PermBooksRead,
+	libraryv1.BookService_ListBooks_FullMethodName:   auth.PermBooksRead,
+	libraryv1.BookService_SearchBooks_FullMethodName: auth.PermBooksRead,
+	libraryv1.BookService_CountBooks_FullMethodName:  auth.PermBooksRead,
+	libraryv1.BookService_AddBook_FullMethodName:     auth.PermBooksWrite,
+	libraryv1.BookService_UpdateBook_FullMethodName:  auth.PermBooksWrite,
+	libraryv1.BookService_PatchBook_FullMethodName:   auth.PermBooksWrite,
+	libraryv1.BookService_DeleteBook_FullMethodName:  auth.PermBooksDelete,
+
+	// Health checks and reflection
+	healthpb.Health_Check_FullMethodName:                                   auth.Public,
+	healthpb.Health_Watch_FullMethodName:                                   auth.Public,
+	reflectionv1.ServerReflection_ServerReflectionInfo_FullMethodName:      auth.Public,
+	reflectionv1alpha.ServerReflection_ServerReflectionInfo_FullMethodName: auth.Public,
+}
+
+// RateGroups assigns the expensive methods to the groups of routes of the
+// API, sharing their rate limits and daily quotas.
+var RateGroups = map[string]string{
+	libraryv1.BookService_SearchBooks_FullMethodName: "search",
+	libraryv1.BookService_ListBooks_FullMethodName:   "export",
+}
+
+// Untenanted are the methods serving no tenant in particular, which resolve
+// none not to depend on the database.
+var Untenanted = map[string]bool{
+	healthpb.Health_Check_FullMethodName:                                   true,
+	healthpb.Health_Watch_FullMethodName:                                   true,
+	reflectionv1.ServerReflection_ServerReflectionInfo_FullMethodName:      true,
+	reflectionv1alpha.ServerReflection_ServerReflectionInfo_FullMethodName: true,
+}
+
+// interceptor guards the calls of the server as the middlewares of the
+// router guard its requests: it authenticates their principal, limits
+// their rate, authorizes them by the Policy and scopes them to their tenant.
+type interceptor struct {
+	options Options
+}
+
+func (i interceptor) unary(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := i.guard(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, request)
+}
+
+func (i interceptor) stream(server any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := i.guard(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(server, &guardedStream{ServerStream: stream, ctx: ctx})
+}
+
+// guardedStream is a stream whose context carries the principal and the
+// tenant of its call.
+type guardedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *guardedStream) Context() context.Context {
+	return s.ctx
+}
+
+// guard returns the context of a call to a method, carrying its principal
+// and its tenant, or the status rejecting it.
+func (i interceptor) guard(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	principal, err := i.authenticate(ctx, md)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = auth.WithPrincipal(ctx, principal)
+	ctx = repository.WithClient(ctx, client(ctx, principal))
+
+	if err := i.limit(ctx, method); err != nil {
+		return ctx, err
+	}
+
+	permission, ok := Policy[method]
+	if !ok {
+		slog.Error("No policy authorizes a method, it is forbidden.", "method", method)
+		return ctx, status.Error(codes.PermissionDenied, "No policy authorizes this method")
+	}
+	if err := auth.Check(ctx, permission); err != nil {
+		if !principal.Authenticated() {
+			return ctx, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return ctx, status.Error(codes.PermissionDenied, "Forbidden: "+err.Error())
+	}
+
+	if Untenanted[method] {
+		return ctx, nil
+	}
+	return i.scope(ctx, principal, md, method)
+}
+
+// authenticate returns the principal of the credentials of the metadata of
+// a call, sent as the headers of the API, or a guest without.
+func (i interceptor) authenticate(ctx context.Context, md metadata.MD) (auth.Principal, error) {
+	if i.options.Auth == nil {
+		return auth.Anonymous, nil
+	}
+	principal, ok, err := i.options.Auth.Credentials(ctx, first(md, auth.APIKeyHeader), first(md, "Authorization"))
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		slog.Warn("Rejected the credentials of a call.", "client", peerIP(ctx), "error", err)
+		return auth.Principal{}, status.Error(codes.Unauthenticated, err.Error())
+	} else if err != nil {
+		slog.Error("Cannot authenticate a call.", "error", err)
+		return auth.Principal{}, status.Error(codes.Internal, "Cannot authenticate the call")
+	}
+	if !ok {
+		return i.options.Auth.Guest(), nil
+	}
+	return principal, nil
+}
+
+// limit limits the calls of every client to each group of methods, counted
+// along with its requests to the API.
+func (i interceptor) limit(ctx context.Context, method string) error {
+	runtime := i.options.Live.Runtime()
+	group, ok := RateGroups[method]
+	if !ok {
+		group = DefaultRateGroup
+	}
+	rate, burst := runtime.Limit(group)
+	limit := ratelimit.Limit{Rate: rate, Burst: burst, Quota: runtime.Quota(group)}
+	if limit.Rate <= 0 && limit.Quota <= 0 {
+		return nil
+	}
+
+	client := repository.ClientOf(ctx)
+	result := i.options.Limiter.Allow(client, group, limit)
+	if result.Allowed {
+		return nil
+	}
+	slog.Debug("Limited the calls of a client.", "client", client, "group", group, "retry_after", result.RetryAfter)
+	// Tell the client when to retry, as the Retry-After header of the API
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds())))))
+	return status.Error(codes.ResourceExhausted, "Too many requests, retry later")
+}
+
+// client returns the client of a call, as that of a request to the API: the
+// API key, user or token subject of the call, or else its IP.
+func client(ctx context.Context, principal auth.Principal) string {
+	if principal.Method == auth.MethodNone || !principal.Authenticated() {
+		return "ip:" + peerIP(ctx)
+	}
+	return principal.String()
+}
+
+// scope returns the context of a call reading and writing the books of its
+// tenant, named by the tenancy header in its metadata or by its
+// credentials.
+func (i interceptor) scope(ctx context.Context, principal auth.Principal, md metadata.MD, method string) (context.Context, error) {
+	var slug, claim string
+	if i.options.Tenancy.Enabled {
+		slug, claim = strings.ToLower(strings.TrimSpace(first(md, i.options.Tenancy.Header))), i.options.Tenancy.Claim
+	}
+	tenant, err := auth.ResolveTenant(ctx, i.options.Tenants, principal, slug, claim)
+	if errors.Is(err, repository.ErrTenantNotFound) {
+		return ctx, status.Error(codes.NotFound, "Unknown tenant "+strconv.Quote(tenant.Slug))
+	} else if errors.Is(err, auth.ErrOtherTenant) {
+		slog.Warn("Rejected a call to another tenant.", "principal", principal.String(), "tenant", tenant.Slug, "method", method)
+		return ctx, status.Error(codes.PermissionDenied, "Forbidden: "+err.Error())
+	} else if err != nil {
+		slog.Error("Cannot resolve the tenant of a call.", "tenant", slug, "error", err)
+		return ctx, status.Error(codes.Internal, "Cannot resolve the tenant of the call")
+	}
+	return repository.WithTenant(ctx, tenant.ID), nil
+}
+
+// first returns the first value of a key of the metadata, "" if none.
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// peerIP returns the IP of the client of a call.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
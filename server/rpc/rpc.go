@@ -0,0 +1,119 @@
+// Package rpc serves the book API over gRPC, along with the standard health
+// checking and reflection services.
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"library/auth"
+	"library/config"
+	libraryv1 "library/proto/library/v1"
+	"library/ratelimit"
+	"library/repository"
+	"net"
+	"strconv"
+	"sync"
+
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+var (
+	server *grpc.Server
+	mutex  sync.Mutex
+)
+
+// Options are the dependencies of the server besides the books, replaced
+// by defaults when nil, as those of the router of the API.
+type Options struct {
+	// Live is the runtime configuration, the default one if nil
+	Live *config.Live
+	// Limiter counts the calls of the clients against their rate limits,
+	// shared with the API; a new one if nil
+	Limiter *ratelimit.Limiter
+	// Tenants stores the libraries the deployment hosts, in memory if nil
+	Tenants repository.TenantRepository
+	// Tenancy tells the tenant of the calls, by the metadata of its header
+	// or by their credentials, all served the default tenant unless enabled
+	Tenancy config.TenancyConfig
+	// Auth authenticates the clients by the X-API-Key or Authorization
+	// metadata, authorized by the permissions of their roles; if nil,
+	// anyone may do anything
+	Auth *auth.Authenticator
+}
+
+// NewServer returns a gRPC server of the book service backed by the
+// repository, guarding its calls as the API guards its requests.
+func NewServer(books repository.BookRepository, options Options) *grpc.Server {
+	if options.Live == nil {
+		options.Live = config.NewLive(config.Default())
+	}
+	if options.Limiter == nil {
+		options.Limiter = ratelimit.New()
+	}
+	if options.Tenants == nil {
+		options.Tenants = repository.NewMemoryTenants()
+	}
+	guard := interceptor{options: options}
+	s := grpc.NewServer(grpc.UnaryInterceptor(guard.unary), grpc.StreamInterceptor(guard.stream))
+	libraryv1.RegisterBookServiceServer(s, &BookServer{books: books})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(libraryv1.BookService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	reflection.Register(s)
+	return s
+}
+
+// StartServer serves gRPC requests on the given port until the server is shut down.
+func StartServer(ctx context.Context, port int, grpcServer *grpc.Server) error {
+	portSrt := strconv.Itoa(port)
+	addr := ":" + portSrt
+	slog.Info("Starting gRPC server on port.", "port", portSrt)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	mutex.Lock()
+	server = grpcServer
+	mutex.Unlock()
+
+	if err := grpcServer.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+		return fmt.Errorf("failed to start the gRPC server: %v", err)
+	}
+
+	return nil
+}
+
+// ShutdownServer stops the gRPC server gracefully, or forcefully once ctx is done.
+func ShutdownServer(ctx context.Context) error {
+	slog.Info("Shutting down gRPC server gracefully...")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if server == nil {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return fmt.Errorf("failed to stop the gRPC server gracefully: %v", ctx.Err())
+	}
+}
@@ -2,7 +2,9 @@
 name="api"
 
 kubectl apply -f ../library-configmap.yaml
+kubectl apply -f ../library-secret.yaml
 kubectl apply -f ./$name-k8s-deployment.yaml
 kubectl apply -f ./$name-k8s-service.yaml
 sleep 2
 kubectl port-forward service/$name-service $SERVER_PORT:$SERVER_PORT &
+kubectl port-forward service/$name-service $GRPC_PORT:$GRPC_PORT &
@@ -12,8 +12,8 @@ import (
 )
 
 func TestHealthCheckHandler(t *testing.T) {
-	ctx, router, db := tests.SetupMockServer()
-	defer tests.TearDownMockServer(ctx, db)
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
 
 	method := "GET"
 	url := "/health"
@@ -25,8 +25,8 @@ func TestHealthCheckHandler(t *testing.T) {
 }
 
 func TestVersionHandler(t *testing.T) {
-	ctx, router, db := tests.SetupMockServer()
-	defer tests.TearDownMockServer(ctx, db)
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
 
 	testCases := []struct {
 		Version     string
@@ -50,8 +50,8 @@ func TestVersionHandler(t *testing.T) {
 }
 
 func TestWelcomePageHandler(t *testing.T) {
-	ctx, router, db := tests.SetupMockServer()
-	defer tests.TearDownMockServer(ctx, db)
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
 
 	// Create a new HTTP request to the root path "/"
 	method := "GET"
@@ -0,0 +1,218 @@
+package api_test
+
+import (
+	"encoding/json"
+	libraryapi "library/api"
+	"library/api/handlers"
+	"library/auth"
+	"library/models"
+	"library/repository"
+	"library/tests/api"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const adminKey = "lib_the-admin-key-of-the-library"
+
+// setupAuthServer returns a router authenticating the clients by their API
+// keys, the admin key included, and their sessions, and the guests as
+// patrons. Three failed logins lock an account for a minute.
+func setupAuthServer(t *testing.T) *gin.Engine {
+	keys := repository.NewMemoryKeys()
+	accounts := auth.NewAccounts(repository.NewMemoryUsers(), repository.NewMemorySessions(), auth.AccountOptions{
+		LockoutThreshold: 3,
+		LockoutDuration:  time.Minute,
+	})
+	return libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{
+		Keys:     keys,
+		Accounts: accounts,
+		Auth:     auth.New(keys, auth.Options{AdminKey: adminKey, Accounts: accounts, GuestRole: auth.RolePatron}),
+	}, "../../")
+}
+
+// createKey creates an API key of a role with the admin key.
+func createKey(t *testing.T, router *gin.Engine, name, role string) handlers.CreatedKey {
+	body, err := json.Marshal(handlers.KeyRequest{Name: name, Role: role})
+	require.NoError(t, err)
+	response, err := api.SendRequestWithHeaders(router, http.MethodPost, "/admin/keys", body,
+		map[string]string{"Content-Type": "application/json", "Authorization": "Bearer " + adminKey})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	var created handlers.CreatedKey
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &created))
+	return created
+}
+
+func TestAuthentication(t *testing.T) {
+	router := setupAuthServer(t)
+	book, err := api.LoadSampleBook()
+	require.NoError(t, err)
+	body, err := json.Marshal(book)
+	require.NoError(t, err)
+	send := func(method, path string, body []byte, key string) int {
+		headers := map[string]string{"Content-Type": "application/json"}
+		if key != "" {
+			headers["X-API-Key"] = key
+		}
+		response, err := api.SendRequestWithHeaders(router, method, path, body, headers)
+		require.NoError(t, err)
+		return response.Code
+	}
+
+	// Reading needs no credentials, changing the books does
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/v1/books", nil, ""))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "/api/v1/books", body, ""))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodDelete, "/api/v1/books/1", nil, ""))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/admin/config", nil, ""))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/v1/books", nil, "lib_unknown"), "invalid credentials are rejected")
+
+	// The admin key creates an API key, shown once
+	created := createKey(t, router, "catalogue", auth.RoleLibrarian)
+	assert.Equal(t, "catalogue", created.Name)
+	assert.Equal(t, auth.RoleLibrarian, created.Role)
+	assert.Contains(t, created.Key, created.Hint)
+
+	assert.Equal(t, http.StatusCreated, send(http.MethodPost, "/api/v1/books", body, created.Key))
+
+	response, err := api.SendRequestWithHeaders(router, http.MethodGet, "/admin/keys", nil, map[string]string{"X-API-Key": adminKey})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	assert.NotContains(t, response.Body.String(), created.Key)
+	var keys []models.APIKey
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &keys))
+	assert.Len(t, keys, 1)
+
+	// A revoked key authenticates nobody
+	path := "/admin/keys/" + strconv.Itoa(int(created.ID))
+	assert.Equal(t, http.StatusOK, send(http.MethodDelete, path, nil, adminKey))
+	assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, path, nil, adminKey))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "/api/v1/books", body, created.Key))
+}
+
+func TestAuthenticationGraphQL(t *testing.T) {
+	router := setupAuthServer(t)
+	mutation := []byte(`{"query": "mutation { addBook(input: {title: \"Emma\", author: \"Jane Austen\", edition: 1}) { id } }"}`)
+	deletion := []byte(`{"query": "mutation { deleteBook(id: 1) }"}`)
+	librarian := createKey(t, router, "catalogue", auth.RoleLibrarian)
+
+	response, err := api.SendRequestWithHeaders(router, http.MethodPost, "/graphql", mutation, map[string]string{"Content-Type": "application/json"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "Unexpected status code")
+	assert.Contains(t, response.Body.String(), "authentication required: guests lack the books:write permission")
+
+	response, err = api.SendRequestWithHeaders(router, http.MethodPost, "/graphql", mutation, map[string]string{"Content-Type": "application/json", "X-API-Key": librarian.Key})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	assert.NotContains(t, response.Body.String(), "errors")
+
+	response, err = api.SendRequestWithHeaders(router, http.MethodPost, "/graphql", deletion, map[string]string{"Content-Type": "application/json", "X-API-Key": librarian.Key})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "Unexpected status code")
+	assert.Contains(t, response.Body.String(), "lacks the books:delete permission")
+
+	response, err = api.SendRequestWithHeaders(router, http.MethodPost, "/graphql", deletion, map[string]string{"Content-Type": "application/json", "X-API-Key": adminKey})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	assert.NotContains(t, response.Body.String(), "errors")
+}
+
+func TestAuthorization(t *testing.T) {
+	router := setupAuthServer(t)
+	patron := createKey(t, router, "reader", auth.RolePatron)
+	librarian := createKey(t, router, "catalogue", auth.RoleLibrarian)
+	book, err := api.LoadSampleBook()
+	require.NoError(t, err)
+	body, err := json.Marshal(book)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Description string
+		Method      string
+		Path        string
+		Body        []byte
+		Key         string
+		Status      int
+		Permission  auth.Permission
+	}{
+		{Description: "Guest reads", Method: http.MethodGet, Path: "/api/v1/books", Status: http.StatusOK},
+		{Description: "Guest writes", Method: http.MethodPost, Path: "/api/v1/books", Body: body, Status: http.StatusUnauthorized},
+		{Description: "Patron reads", Method: http.MethodGet, Path: "/opds", Key: patron.Key, Status: http.StatusOK},
+		{Description: "Patron writes", Method: http.MethodPost, Path: "/api/v1/books", Body: body, Key: patron.Key, Status: http.StatusForbidden, Permission: auth.PermBooksWrite},
+		{Description: "Librarian writes", Method: http.MethodPost, Path: "/api/v1/books", Body: body, Key: librarian.Key, Status: http.StatusCreated},
+		{Description: "Librarian deletes", Method: http.MethodDelete, Path: "/api/v1/books/1", Key: librarian.Key, Status: http.StatusForbidden, Permission: auth.PermBooksDelete},
+		{Description: "Librarian manages keys", Method: http.MethodGet, Path: "/admin/keys", Key: librarian.Key, Status: http.StatusForbidden, Permission: auth.PermKeysManage},
+		{Description: "Librarian inspects", Method: http.MethodGet, Path: "/admin/config", Key: librarian.Key, Status: http.StatusForbidden, Permission: auth.PermServerInspect},
+		{Description: "Admin deletes", Method: http.MethodDelete, Path: "/api/v1/books/1", Key: adminKey, Status: http.StatusOK},
+		{Description: "Unknown route", Method: http.MethodGet, Path: "/unknown", Key: patron.Key, Status: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			headers := map[string]string{"Content-Type": "application/json"}
+			if tc.Key != "" {
+				headers["X-API-Key"] = tc.Key
+			}
+			response, err := api.SendRequestWithHeaders(router, tc.Method, tc.Path, tc.Body, headers)
+			require.NoError(t, err)
+			require.Equal(t, tc.Status, response.Code, response.Body.String())
+			if tc.Status == http.StatusForbidden {
+				var forbidden handlers.ForbiddenResponse
+				require.NoError(t, json.Unmarshal(response.Body.Bytes(), &forbidden))
+				assert.Equal(t, tc.Permission, forbidden.Permission)
+				assert.NotEmpty(t, forbidden.Principal)
+				assert.Len(t, forbidden.Roles, 1)
+				assert.Contains(t, forbidden.Error, "lacks the "+string(tc.Permission)+" permission")
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	router := setupAuthServer(t)
+	for _, route := range router.Routes() {
+		_, ok := libraryapi.Policy[libraryapi.Route{Method: route.Method, Path: route.Path}]
+		assert.True(t, ok, "No policy for %s %s", route.Method, route.Path)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	router := setupAuthServer(t)
+	librarian := createKey(t, router, "catalogue", auth.RoleLibrarian)
+
+	testCases := []struct {
+		Description   string
+		Key           string
+		Principal     string
+		Authenticated bool
+		Roles         []string
+		Permissions   []auth.Permission
+	}{
+		{Description: "Guest", Principal: "guest:guest", Roles: []string{auth.RolePatron}, Permissions: []auth.Permission{auth.PermBooksRead}},
+		{Description: "Librarian", Key: librarian.Key, Principal: "api_key:" + strconv.Itoa(int(librarian.ID)), Authenticated: true,
+			Roles: []string{auth.RoleLibrarian}, Permissions: []auth.Permission{auth.PermBooksRead, auth.PermBooksWrite}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			headers := map[string]string{}
+			if tc.Key != "" {
+				headers["X-API-Key"] = tc.Key
+			}
+			response, err := api.SendRequestWithHeaders(router, http.MethodGet, "/auth/permissions", nil, headers)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+			var permissions handlers.PermissionsResponse
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &permissions))
+			assert.Equal(t, tc.Principal, permissions.Principal)
+			assert.Equal(t, tc.Authenticated, permissions.Authenticated)
+			assert.Equal(t, tc.Roles, permissions.Roles)
+			assert.Equal(t, tc.Permissions, permissions.Permissions)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package api_test
+
+import (
+	"encoding/json"
+	libraryapi "library/api"
+	"library/cache"
+	"library/config"
+	"library/repository"
+	"library/tests/api"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheControl(t *testing.T) {
+	runtime := config.Default().Runtime
+	runtime.CacheMaxAge = 30 * time.Second
+	router, live := setupLiveServer(t, runtime)
+	book := api.CreateBookTemplate(t, router)
+
+	response, err := api.SendGetBookRequest(router, book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "private, max-age=30", response.Header().Get("Cache-Control"))
+	response, err = api.SendCountBooksRequest(router)
+	require.NoError(t, err)
+	assert.Equal(t, "private, max-age=30", response.Header().Get("Cache-Control"))
+
+	response, err = api.SendPatchBookRequest(router, &book)
+	require.NoError(t, err)
+	assert.Equal(t, "no-store", response.Header().Get("Cache-Control"))
+
+	// Without a max age, the clients revalidate
+	runtime.CacheMaxAge = 0
+	_, err = live.Apply(runtime)
+	require.NoError(t, err)
+	response, err = api.SendGetBookRequest(router, book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "private, no-cache", response.Header().Get("Cache-Control"))
+}
+
+func TestAdminCache(t *testing.T) {
+	books := repository.NewCached(repository.NewMemory(), cache.NewLRU(100), time.Minute)
+	router := libraryapi.SetupRouter(books, libraryapi.Options{}, "../../")
+	book := api.CreateBookTemplate(t, router)
+	for i := 0; i < 3; i++ {
+		response, err := api.SendGetBookRequest(router, book.ID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, response.Code)
+	}
+
+	response, err := api.SendRequest(router, http.MethodGet, "/admin/cache", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	var stats repository.CacheStats
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &stats))
+	assert.Equal(t, 1, *stats.Entries)
+	assert.Equal(t, int64(2), stats.Operations[repository.CachedGet].Hits)
+	assert.Equal(t, int64(1), stats.Operations[repository.CachedGet].Misses)
+
+	// Without a cache
+	router = libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{}, "../../")
+	response, err = api.SendRequest(router, http.MethodGet, "/admin/cache", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, response.Code, "Unexpected status code")
+}
@@ -0,0 +1,104 @@
+package api_test
+
+import (
+	"encoding/json"
+	"library/tests"
+	"library/tests/api"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCiteBookHandler(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	book := api.CreateBookTemplate(t, router)
+
+	testCases := []struct {
+		Description string
+		BookID      uint
+		Style       string
+		Expected    int
+		Citation    string
+	}{
+		{
+			Description: "Cite in APA",
+			BookID:      book.ID,
+			Style:       "apa",
+			Expected:    http.StatusOK,
+			Citation:    "NEHME, M.-J. (2023). How to implement a Library.",
+		},
+		{
+			Description: "Cite in MLA",
+			BookID:      book.ID,
+			Style:       "mla",
+			Expected:    http.StatusOK,
+			Citation:    "NEHME, Mohamad-Jaafar. How to implement a Library. 2023.",
+		},
+		{
+			Description: "Cite in Chicago",
+			BookID:      book.ID,
+			Style:       "chicago",
+			Expected:    http.StatusOK,
+			Citation:    "NEHME, Mohamad-Jaafar. How to implement a Library. 2023.",
+		},
+		{
+			Description: "Unknown Style",
+			BookID:      book.ID,
+			Style:       "harvard",
+			Expected:    http.StatusBadRequest,
+		},
+		{
+			Description: "Cite Non-Existent Book",
+			BookID:      book.ID + 1,
+			Style:       "apa",
+			Expected:    http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendCiteBookRequest(router, tc.BookID, tc.Style)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Expected, response.Code, "Expected status code %d, but got %d", tc.Expected, response.Code)
+
+			if tc.Expected == http.StatusOK {
+				var citation map[string]string
+				err = json.Unmarshal(response.Body.Bytes(), &citation)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Style, citation["style"], "Style mismatch")
+				assert.Equal(t, tc.Citation, citation["citation"], "Citation mismatch")
+			}
+		})
+	}
+}
+
+func TestListBooksCitationFormats(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	books := api.CreateListOfBookTemplates(t, router)
+
+	testCases := []struct {
+		Description string
+		Accept      string
+		Marker      string
+	}{
+		{Description: "BibTeX", Accept: "application/x-bibtex", Marker: "@book{"},
+		{Description: "RIS", Accept: "application/x-research-info-systems", Marker: "TY  - BOOK"},
+		{Description: "CSL-JSON", Accept: "application/vnd.citationstyles.csl+json", Marker: `"type":"book"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendListBooksWithAcceptRequest(router, tc.Accept)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+			assert.True(t, strings.HasPrefix(response.Header().Get("Content-Type"), tc.Accept), "Unexpected Content-Type")
+			assert.Equal(t, len(books), strings.Count(response.Body.String(), tc.Marker), "Unexpected number of entries")
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"encoding/xml"
+	"library/feeds"
+	"library/tests"
+	"library/tests/api"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewArrivalsFeeds(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	books := api.CreateListOfBookTemplates(t, router)
+	newest := books[len(books)-1]
+
+	t.Run("Atom", func(t *testing.T) {
+		response, err := api.SendFeedRequest(router, "/new.atom?limit=5", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+		assert.True(t, strings.HasPrefix(response.Header().Get("Content-Type"), "application/atom+xml"), "Unexpected Content-Type")
+
+		var feed feeds.AtomFeed
+		err = xml.Unmarshal(response.Body.Bytes(), &feed)
+		assert.NoError(t, err)
+		assert.Len(t, feed.Entries, 5)
+		assert.Equal(t, newest.Title, feed.Entries[0].Title, "Newest book should come first")
+	})
+
+	t.Run("RSS", func(t *testing.T) {
+		response, err := api.SendFeedRequest(router, "/new.rss", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+		assert.True(t, strings.HasPrefix(response.Header().Get("Content-Type"), "application/rss+xml"), "Unexpected Content-Type")
+		assert.Contains(t, response.Body.String(), "<title>"+newest.Title+"</title>")
+	})
+
+	t.Run("Filtered by Genre", func(t *testing.T) {
+		response, err := api.SendFeedRequest(router, "/new.atom?genre="+url.QueryEscape("Science Fiction"), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+
+		var feed feeds.AtomFeed
+		err = xml.Unmarshal(response.Body.Bytes(), &feed)
+		assert.NoError(t, err)
+		assert.Len(t, feed.Entries, 3)
+	})
+}
+
+func TestNewArrivalsConditionalGet(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	api.CreateListOfBookTemplates(t, router)
+
+	response, err := api.SendFeedRequest(router, "/new.atom", nil)
+	assert.NoError(t, err)
+	etag := response.Header().Get("ETag")
+	lastModified := response.Header().Get("Last-Modified")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, lastModified)
+	assert.Equal(t, "private, max-age=300", response.Header().Get("Cache-Control"))
+
+	testCases := []struct {
+		Description string
+		Headers     map[string]string
+		Status      int
+	}{
+		{Description: "Matching ETag", Headers: map[string]string{"If-None-Match": etag}, Status: http.StatusNotModified},
+		{Description: "Stale ETag", Headers: map[string]string{"If-None-Match": `W/"stale"`}, Status: http.StatusOK},
+		{Description: "Not Modified Since", Headers: map[string]string{"If-Modified-Since": lastModified}, Status: http.StatusNotModified},
+		{Description: "Modified Since", Headers: map[string]string{"If-Modified-Since": "Mon, 01 Jan 2001 00:00:00 GMT"}, Status: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendFeedRequest(router, "/new.atom", tc.Headers)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Status, response.Code, "Unexpected status code")
+		})
+	}
+
+	t.Run("Changed After a New Book", func(t *testing.T) {
+		api.CreateBookTemplate(t, router)
+
+		response, err := api.SendFeedRequest(router, "/new.atom", map[string]string{"If-None-Match": etag})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+		assert.NotEqual(t, etag, response.Header().Get("ETag"))
+	})
+}
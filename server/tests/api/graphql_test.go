@@ -0,0 +1,114 @@
+package api_test
+
+import (
+	"encoding/json"
+	"library/tests"
+	"library/tests/api"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type graphQLResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	books := api.CreateListOfBookTemplates(t, router)
+
+	testCases := []struct {
+		Description string
+		Query       string
+		Expected    int
+		Field       string
+		Error       bool
+	}{
+		{Description: "Get Book", Query: `{ book(id: "` + strconv.Itoa(int(books[0].ID)) + `") { title author genre { name bookCount } } }`, Expected: http.StatusOK, Field: "book"},
+		{Description: "Search Books", Query: `{ books(genre: "Science Fiction", limit: 2) { title byAuthor { title } } }`, Expected: http.StatusOK, Field: "books"},
+		{Description: "Count Books", Query: `{ count }`, Expected: http.StatusOK, Field: "count"},
+		{Description: "Invalid Date", Query: `{ books(from: "yesterday") { title } }`, Expected: http.StatusOK, Error: true},
+		{Description: "Syntax Error", Query: `{ books( }`, Expected: http.StatusBadRequest, Error: true},
+		{Description: "Too Deep", Query: `{ books { byAuthor { byAuthor { byAuthor { byAuthor { byAuthor { byAuthor { byAuthor { title } } } } } } } } }`, Expected: http.StatusBadRequest, Error: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendGraphQLRequest(router, tc.Query, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Expected, response.Code, "Unexpected status code")
+
+			var result graphQLResponse
+			err = json.Unmarshal(response.Body.Bytes(), &result)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Error, len(result.Errors) > 0, "Unexpected errors: %v", result.Errors)
+			if tc.Field != "" {
+				assert.NotEqual(t, "null", string(result.Data[tc.Field]))
+			}
+		})
+	}
+
+	t.Run("Count Matches REST", func(t *testing.T) {
+		response, err := api.SendGraphQLRequest(router, `{ count }`, nil)
+		assert.NoError(t, err)
+		var result struct{ Data struct{ Count int } }
+		err = json.Unmarshal(response.Body.Bytes(), &result)
+		assert.NoError(t, err)
+		assert.Equal(t, len(books), result.Data.Count)
+	})
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	var added struct {
+		Data struct {
+			AddBook struct {
+				ID    string
+				Title string
+			}
+		}
+	}
+	response, err := api.SendGraphQLRequest(router, `mutation($book: BookInput!) { addBook(input: $book) { id title } }`, map[string]interface{}{
+		"book": map[string]interface{}{"title": "Emma", "author": "Jane Austen", "edition": 1, "published": "1815-12-23T00:00:00Z"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	err = json.Unmarshal(response.Body.Bytes(), &added)
+	assert.NoError(t, err)
+	assert.Equal(t, "Emma", added.Data.AddBook.Title)
+	id := added.Data.AddBook.ID
+
+	testCases := []struct {
+		Description string
+		Query       string
+		Error       bool
+	}{
+		{Description: "Update Book", Query: `mutation { updateBook(id: "` + id + `", input: {title: "Emma", author: "Jane Austen", edition: 2}) { edition } }`},
+		{Description: "Patch Book", Query: `mutation { patchBook(id: "` + id + `", input: {genreName: "Romance"}) { genreName } }`},
+		{Description: "Invalid Patch", Query: `mutation { patchBook(id: "` + id + `", input: {edition: 0}) { edition } }`, Error: true},
+		{Description: "Delete Book", Query: `mutation { deleteBook(id: "` + id + `") }`},
+		{Description: "Delete Non-Existent Book", Query: `mutation { deleteBook(id: "` + id + `") }`, Error: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendGraphQLRequest(router, tc.Query, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+
+			var result graphQLResponse
+			err = json.Unmarshal(response.Body.Bytes(), &result)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Error, len(result.Errors) > 0, "Unexpected errors: %v", result.Errors)
+		})
+	}
+}
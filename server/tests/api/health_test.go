@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	libraryapi "library/api"
+	"library/health"
+	"library/repository"
+	"library/tests/api"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveness(t *testing.T) {
+	status := health.New(time.Second)
+	status.Register("database", func(ctx context.Context) (map[string]any, error) {
+		return nil, errors.New("connection refused")
+	})
+	router := libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{Health: status}, "../../")
+
+	// The server is alive even when its dependencies are down
+	response, err := api.SendRequest(router, http.MethodGet, "/livez", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+}
+
+func TestReadiness(t *testing.T) {
+	var databaseErr error
+	status := health.New(time.Second)
+	status.Register("database", func(ctx context.Context) (map[string]any, error) {
+		return map[string]any{"driver": "sqlite"}, databaseErr
+	})
+	router := libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{Health: status}, "../../")
+
+	testCases := []struct {
+		Description string
+		Query       string
+		DatabaseErr error
+		Drain       bool
+		Code        int
+		Report      health.Report
+	}{
+		{
+			Description: "Ready",
+			Code:        http.StatusOK,
+			Report:      health.Report{Status: health.StatusOK, Dependencies: map[string]health.Dependency{"database": {Status: health.StatusUp}}},
+		},
+		{
+			Description: "Ready Verbose",
+			Query:       "?verbose",
+			Code:        http.StatusOK,
+			Report:      health.Report{Status: health.StatusOK, Dependencies: map[string]health.Dependency{"database": {Status: health.StatusUp, Details: map[string]any{"driver": "sqlite"}}}},
+		},
+		{
+			Description: "Degraded",
+			DatabaseErr: health.Degraded(errors.New("slow")),
+			Code:        http.StatusOK,
+			Report:      health.Report{Status: health.StatusDegraded, Dependencies: map[string]health.Dependency{"database": {Status: health.StatusDegraded}}},
+		},
+		{
+			Description: "Database Down",
+			DatabaseErr: errors.New("connection refused"),
+			Code:        http.StatusServiceUnavailable,
+			Report:      health.Report{Status: health.StatusFailing, Dependencies: map[string]health.Dependency{"database": {Status: health.StatusDown}}},
+		},
+		{
+			Description: "Database Down Verbose",
+			Query:       "?verbose=true",
+			DatabaseErr: errors.New("connection refused"),
+			Code:        http.StatusServiceUnavailable,
+			Report:      health.Report{Status: health.StatusFailing, Dependencies: map[string]health.Dependency{"database": {Status: health.StatusDown, Error: "connection refused", Details: map[string]any{"driver": "sqlite"}}}},
+		},
+		{
+			Description: "Draining",
+			Drain:       true,
+			Code:        http.StatusServiceUnavailable,
+			Report:      health.Report{Status: health.StatusDraining},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			databaseErr = tc.DatabaseErr
+			if tc.Drain {
+				status.Drain()
+			}
+			response, err := api.SendRequest(router, http.MethodGet, "/readyz"+tc.Query, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Code, response.Code, "Unexpected status code")
+
+			var report health.Report
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &report))
+			for name, dependency := range report.Dependencies {
+				// The latency varies
+				dependency.LatencyMS = 0
+				report.Dependencies[name] = dependency
+			}
+			assert.Equal(t, tc.Report, report)
+
+			// The requests are still served while not ready
+			response, err = api.SendCountBooksRequest(router)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+		})
+	}
+}
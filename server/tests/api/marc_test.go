@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"library/marc"
+	"library/models"
+	"library/tests"
+	"library/tests/api"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBookMARCXMLHandler(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	book := api.CreateBookTemplate(t, router)
+
+	response, err := api.SendGetBookMARCXMLRequest(router, book.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	assert.Equal(t, "application/marc+xml", response.Header().Get("Content-Type"), "Unexpected Content-Type")
+
+	records, err := marc.ReadXML(response.Body)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	responseBook := marc.ToBook(records[0])
+	assert.Equal(t, book.Title, responseBook.Title, "Title mismatch")
+	assert.Equal(t, book.Author, responseBook.Author, "Author mismatch")
+	assert.Equal(t, book.Edition, responseBook.Edition, "Edition mismatch")
+	assert.Equal(t, book.GenreName, responseBook.GenreName, "Genre mismatch")
+}
+
+func TestExportImportMARCHandlers(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	books := api.CreateListOfBookTemplates(t, router)
+
+	testCases := []struct {
+		Description string
+		Format      string
+		ContentType string
+	}{
+		{Description: "MARCXML", Format: "marcxml", ContentType: "application/marc+xml"},
+		{Description: "ISO 2709", Format: "iso2709", ContentType: "application/marc"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendExportMARCRequest(router, tc.Format)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code for export")
+			assert.Equal(t, tc.ContentType, response.Header().Get("Content-Type"), "Unexpected Content-Type")
+
+			response, err = api.SendImportMARCRequest(router, tc.ContentType, response.Body.Bytes())
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, response.Code, "Unexpected status code for import")
+
+			var importedBooks []models.Book
+			err = json.Unmarshal(response.Body.Bytes(), &importedBooks)
+			assert.NoError(t, err)
+			assert.GreaterOrEqual(t, len(importedBooks), len(books))
+			for _, book := range importedBooks {
+				assert.NotZero(t, book.ID, "Imported book should have an ID")
+			}
+		})
+	}
+}
+
+func TestImportInvalidMARCHandler(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	var buffer bytes.Buffer
+	err := marc.WriteXML(&buffer, []marc.Record{marc.FromBook(models.Book{Edition: 1})})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		Description string
+		ContentType string
+		Body        []byte
+		Expected    int
+	}{
+		{Description: "Missing Title", ContentType: "application/marc+xml", Body: buffer.Bytes(), Expected: http.StatusBadRequest},
+		{Description: "Corrupted Record", ContentType: "application/marc", Body: []byte("not a marc record"), Expected: http.StatusBadRequest},
+		{Description: "Negative Offset", ContentType: "application/marc", Body: []byte("00042nam a2200037 i 4500" + "2450005-0001\x1e" + "abc\x1e\x1d"), Expected: http.StatusBadRequest},
+		{Description: "Too Large", ContentType: "application/marc+xml", Body: append([]byte("<collection>"), bytes.Repeat([]byte(" "), 32<<20)...), Expected: http.StatusRequestEntityTooLarge},
+		{Description: "Unsupported Type", ContentType: "text/plain", Body: []byte("title"), Expected: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendImportMARCRequest(router, tc.ContentType, tc.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Expected, response.Code, "Unexpected status code")
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package api_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	libraryapi "library/api"
+	"library/config"
+	"library/oai"
+	"library/repository"
+	"library/tests/api"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupOAIServer returns a router serving the OAI-PMH provider, behind the
+// trusted proxies.
+func setupOAIServer(proxies ...string) *gin.Engine {
+	return libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{
+		OAI:            config.OAIConfig{Enabled: true, AdminEmail: "librarian@library.example.org"},
+		TrustedProxies: proxies,
+	}, "../../")
+}
+
+func TestOAIPMHForwardedProto(t *testing.T) {
+	// identify returns the base URL of the provider, as it answers a request
+	// through a proxy forwarding the scheme of the client
+	identify := func(router *gin.Engine, proxy string) string {
+		request := httptest.NewRequest(http.MethodGet, "/oai?verb=Identify", nil)
+		request.RemoteAddr = proxy + ":41234"
+		request.Header.Set("X-Forwarded-Proto", "https")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		require.Equal(t, http.StatusOK, response.Code)
+		var identified struct {
+			BaseURL string `xml:"Identify>baseURL"`
+		}
+		require.NoError(t, xml.Unmarshal(response.Body.Bytes(), &identified))
+		return identified.BaseURL
+	}
+
+	// The clients cannot pick the scheme of the links, unless their proxy is trusted
+	assert.Equal(t, "http://example.com/oai", identify(setupOAIServer(), "198.51.100.4"))
+	router := setupOAIServer("192.0.2.0/24")
+	assert.Equal(t, "https://example.com/oai", identify(router, "192.0.2.10"))
+	assert.Equal(t, "http://example.com/oai", identify(router, "198.51.100.4"))
+}
+
+func TestOAIPMHDisabled(t *testing.T) {
+	router := libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{}, "../../")
+	response, err := api.SendOAIRequest(router, "verb=Identify")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestOAIPMHHandler(t *testing.T) {
+	router := setupOAIServer()
+
+	books := api.CreateListOfBookTemplates(t, router)
+	deletedBook := books[0]
+	response, err := api.SendDeleteBookRequest(router, deletedBook.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	testCases := []struct {
+		Description string
+		Query       string
+		Check       func(t *testing.T, response oai.Response, body string)
+	}{
+		{
+			Description: "Identify",
+			Query:       "verb=Identify",
+			Check: func(t *testing.T, response oai.Response, body string) {
+				assert.NotNil(t, response.Identify)
+				assert.Equal(t, "2.0", response.Identify.ProtocolVersion)
+				assert.Equal(t, "librarian@library.example.org", response.Identify.AdminEmail)
+			},
+		},
+		{
+			Description: "List Sets",
+			Query:       "verb=ListSets",
+			Check: func(t *testing.T, response oai.Response, body string) {
+				assert.NotNil(t, response.ListSets)
+				assert.NotEmpty(t, response.ListSets.Sets)
+			},
+		},
+		{
+			Description: "List Identifiers Includes Deleted Records",
+			Query:       "verb=ListIdentifiers&metadataPrefix=oai_dc",
+			Check: func(t *testing.T, response oai.Response, body string) {
+				assert.NotNil(t, response.ListIdentifiers)
+				assert.Len(t, response.ListIdentifiers.Headers, len(books))
+				assert.Equal(t, "deleted", response.ListIdentifiers.Headers[0].Status)
+			},
+		},
+		{
+			Description: "Get Record",
+			Query:       fmt.Sprintf("verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:library:%d", books[1].ID),
+			Check: func(t *testing.T, response oai.Response, body string) {
+				assert.NotNil(t, response.GetRecord)
+				assert.Equal(t, fmt.Sprintf("oai:library:%d", books[1].ID), response.GetRecord.Record.Header.Identifier)
+				assert.Contains(t, body, "<dc:title>"+books[1].Title+"</dc:title>")
+			},
+		},
+		{
+			Description: "Bad Verb",
+			Query:       "verb=Harvest",
+			Check: func(t *testing.T, response oai.Response, body string) {
+				assert.Len(t, response.Errors, 1)
+				assert.Equal(t, oai.BadVerb, response.Errors[0].Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendOAIRequest(router, tc.Query)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+
+			var oaiResponse oai.Response
+			err = xml.Unmarshal(response.Body.Bytes(), &oaiResponse)
+			assert.NoError(t, err)
+			tc.Check(t, oaiResponse, response.Body.String())
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	libraryapi "library/api"
+	"library/api/handlers"
+	"library/auth"
+	"library/auth/authtest"
+	"library/repository"
+	"library/tests/api"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupOIDCServer returns a router logging the users in with a stub OpenID
+// provider and accepting its bearer tokens, whose library-staff group maps to
+// the librarian role.
+func setupOIDCServer(t *testing.T) (*gin.Engine, *authtest.Provider) {
+	provider := authtest.NewProvider(t, "library", "a client secret")
+	provider.Claims = map[string]any{"sub": "f3a1c2", "preferred_username": "alice", "groups": []string{"library-staff"}}
+	roles := auth.RoleMapping{Claim: "groups", Roles: map[string]string{"library-staff": auth.RoleLibrarian}}
+	keys := repository.NewMemoryKeys()
+	accounts := auth.NewAccounts(repository.NewMemoryUsers(), repository.NewMemorySessions(), auth.AccountOptions{})
+	oidc, err := auth.NewOIDC(context.Background(), accounts, auth.OIDCOptions{
+		Issuer:       provider.Issuer(),
+		ClientID:     "library",
+		ClientSecret: "a client secret",
+		RedirectURL:  "http://localhost:8090/auth/oidc/callback",
+		Roles:        roles,
+	})
+	require.NoError(t, err)
+	tokens := oidc.Tokens(nil, "", "")
+	router := libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{
+		Keys:     keys,
+		Accounts: accounts,
+		OIDC:     oidc,
+		Auth:     auth.New(keys, auth.Options{Tokens: tokens, Accounts: accounts, GuestRole: auth.RolePatron, Roles: roles}),
+	}, "../../")
+	return router, provider
+}
+
+// startOIDCLogin starts a login with the provider, and returns the cookie of
+// its flow and the URL the provider redirects the browser back to.
+func startOIDCLogin(t *testing.T, router *gin.Engine, provider *authtest.Provider) (string, *url.URL) {
+	response, err := api.SendRequest(router, http.MethodGet, "/auth/oidc/login", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusFound, response.Code, response.Body.String())
+	location := response.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, provider.URL+"/authorize?"), location)
+	cookies := response.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "library_oidc", cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	callback, err := url.Parse(provider.Authorize(location))
+	require.NoError(t, err)
+	return cookies[0].Name + "=" + cookies[0].Value, callback
+}
+
+func TestOIDCLogin(t *testing.T) {
+	router, provider := setupOIDCServer(t)
+	response, err := api.SendRequest(router, http.MethodGet, "/login", nil)
+	require.NoError(t, err)
+	assert.Contains(t, response.Body.String(), `href="/auth/oidc/login"`)
+
+	// The browser is redirected to the welcome page, naming the user
+	cookie, callback := startOIDCLogin(t, router, provider)
+	response, err = api.SendRequestWithHeaders(router, http.MethodGet, callback.RequestURI(), nil, map[string]string{"Cookie": cookie})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSeeOther, response.Code, response.Body.String())
+	assert.Equal(t, "/", response.Header().Get("Location"))
+	var session *http.Cookie
+	for _, c := range response.Result().Cookies() {
+		if c.Name == auth.SessionCookie {
+			session = c
+		}
+	}
+	require.NotNil(t, session)
+	welcome, err := api.SendRequestWithHeaders(router, http.MethodGet, "/", nil, map[string]string{"Cookie": session.Name + "=" + session.Value})
+	require.NoError(t, err)
+	assert.Contains(t, welcome.Body.String(), "Logged in as alice")
+	permissions, err := api.SendRequestWithHeaders(router, http.MethodGet, "/auth/permissions", nil, map[string]string{"Cookie": session.Name + "=" + session.Value})
+	require.NoError(t, err)
+	var described handlers.PermissionsResponse
+	require.NoError(t, json.Unmarshal(permissions.Body.Bytes(), &described))
+	assert.Equal(t, []string{auth.RoleLibrarian}, described.Roles)
+
+	testCases := []struct {
+		Description string
+		Cookie      bool
+		Query       func(query url.Values)
+		Status      int
+		Message     string
+	}{
+		{Description: "No login state", Status: http.StatusBadRequest, Message: "The login expired"},
+		{Description: "Forged state", Cookie: true, Query: func(query url.Values) { query.Set("state", "forged") }, Status: http.StatusUnauthorized, Message: "did not vouch for the login"},
+		{Description: "Unknown code", Cookie: true, Query: func(query url.Values) { query.Set("code", "unknown") }, Status: http.StatusUnauthorized, Message: "did not vouch for the login"},
+		{Description: "Refused", Cookie: true, Query: func(query url.Values) { query.Set("error", "access_denied") }, Status: http.StatusUnauthorized, Message: "refused the login: access_denied"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			cookie, callback := startOIDCLogin(t, router, provider)
+			query := callback.Query()
+			if tc.Query != nil {
+				tc.Query(query)
+			}
+			headers := map[string]string{}
+			if tc.Cookie {
+				headers["Cookie"] = cookie
+			}
+			response, err := api.SendRequestWithHeaders(router, http.MethodGet, callback.Path+"?"+query.Encode(), nil, headers)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Status, response.Code)
+			assert.Contains(t, response.Body.String(), tc.Message)
+			for _, c := range response.Result().Cookies() {
+				assert.NotEqual(t, auth.SessionCookie, c.Name)
+			}
+		})
+	}
+}
+
+func TestOIDCBearer(t *testing.T) {
+	router, provider := setupOIDCServer(t)
+	other := authtest.NewProvider(t, "library", "")
+	book, err := api.LoadSampleBook()
+	require.NoError(t, err)
+	body, err := json.Marshal(book)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Description string
+		Token       string
+		Status      int
+	}{
+		{Description: "Librarian", Token: provider.Token(map[string]any{"sub": "f3a1c2", "aud": "library", "groups": []string{"library-staff"}}), Status: http.StatusCreated},
+		{Description: "Patron", Token: provider.Token(map[string]any{"sub": "b0b", "aud": "library", "groups": []string{"students"}}), Status: http.StatusForbidden},
+		{Description: "Another issuer", Token: other.Token(map[string]any{"sub": "f3a1c2", "aud": "library", "groups": []string{"library-staff"}}), Status: http.StatusUnauthorized},
+		{Description: "Another client", Token: provider.Token(map[string]any{"sub": "f3a1c2", "aud": "payroll", "groups": []string{"library-staff"}}), Status: http.StatusUnauthorized},
+		{Description: "Expired", Token: provider.Token(map[string]any{"sub": "f3a1c2", "aud": "library", "groups": []string{"library-staff"}, "exp": 1}), Status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendRequestWithHeaders(router, http.MethodPost, "/api/v1/books", body,
+				map[string]string{"Content-Type": "application/json", "Authorization": "Bearer " + tc.Token})
+			require.NoError(t, err)
+			assert.Equal(t, tc.Status, response.Code, response.Body.String())
+		})
+	}
+}
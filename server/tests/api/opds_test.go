@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"library/opds"
+	"library/tests"
+	"library/tests/api"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOPDSAtomFeeds(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	books := api.CreateListOfBookTemplates(t, router)
+
+	// The names holding slashes are escaped in the links
+	book, err := api.LoadSampleBook()
+	assert.NoError(t, err)
+	book.Author, book.GenreName = "Fulano/Mengano", "Poetry/Drama"
+	response, err := api.SendAddBookRequest(router, &book)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	testCases := []struct {
+		Description string
+		Path        string
+		ContentType string
+		Entries     int
+	}{
+		{Description: "Root", Path: "", ContentType: opds.MIMENavigation, Entries: 3},
+		{Description: "Newest Books", Path: "/new?limit=5", ContentType: opds.MIMEAcquisition, Entries: 5},
+		{Description: "Books of a Genre", Path: "/genres/" + url.PathEscape("Science Fiction"), ContentType: opds.MIMEAcquisition, Entries: 3},
+		{Description: "Books of an Author", Path: "/authors/" + url.PathEscape(books[0].Author), ContentType: opds.MIMEAcquisition, Entries: 1},
+		{Description: "Books of an Author With a Slash", Path: "/authors/" + url.PathEscape(book.Author), ContentType: opds.MIMEAcquisition, Entries: 1},
+		{Description: "Books of a Genre With a Slash", Path: "/genres/" + url.PathEscape(book.GenreName), ContentType: opds.MIMEAcquisition, Entries: 1},
+		// Whose offset, 25 books a page, would overflow to 9
+		{Description: "Page Beyond the Offsets", Path: "/new?page=737869762948382066", ContentType: opds.MIMEAcquisition, Entries: 0},
+		{Description: "Search", Path: "/search?q=Tolkien", ContentType: opds.MIMEAcquisition, Entries: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendOPDSRequest(router, tc.Path)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+			assert.True(t, strings.HasPrefix(response.Header().Get("Content-Type"), tc.ContentType), "Unexpected Content-Type")
+
+			var feed opds.Feed
+			err = xml.Unmarshal(response.Body.Bytes(), &feed)
+			assert.NoError(t, err)
+			assert.Len(t, feed.Entries, tc.Entries)
+		})
+	}
+}
+
+func TestOPDSJSONFeed(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	books := api.CreateListOfBookTemplates(t, router)
+
+	response, err := api.SendOPDSRequest(router, "/v2/new?limit=10")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	assert.Equal(t, opds.MIMEOPDS2, response.Header().Get("Content-Type"), "Unexpected Content-Type")
+
+	var feed opds.Feed2
+	err = json.Unmarshal(response.Body.Bytes(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(books)), feed.Metadata.NumberOfItems)
+	assert.Len(t, feed.Publications, 10)
+	assert.Equal(t, books[len(books)-1].Title, feed.Publications[0].Metadata.Title, "Newest book should come first")
+}
+
+func TestOPDSOpenSearchDescription(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	response, err := api.SendOPDSRequest(router, "/opensearch.xml")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+
+	var description opds.OpenSearchDescription
+	err = xml.Unmarshal(response.Body.Bytes(), &description)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, description.URLs)
+	for _, searchURL := range description.URLs {
+		assert.Contains(t, searchURL.Template, "{searchTerms}")
+	}
+}
@@ -0,0 +1,162 @@
+package api_test
+
+import (
+	"encoding/json"
+	libraryapi "library/api"
+	"library/auth"
+	"library/config"
+	"library/ratelimit"
+	"library/repository"
+	"library/tests/api"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupLimitedServer returns a router authenticating the clients by their API
+// keys, whose runtime configuration is live, behind the trusted proxies.
+func setupLimitedServer(t *testing.T, runtime config.RuntimeConfig, proxies ...string) *gin.Engine {
+	cfg := config.Default()
+	cfg.Runtime = runtime
+	keys := repository.NewMemoryKeys()
+	return libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{
+		Live:           config.NewLive(cfg),
+		Keys:           keys,
+		TrustedProxies: proxies,
+		Auth:           auth.New(keys, auth.Options{AdminKey: adminKey, GuestRole: auth.RolePatron}),
+	}, "../../")
+}
+
+func TestRateGroups(t *testing.T) {
+	// Along with the optional routes of the OAI-PMH provider
+	router := setupOAIServer()
+	routes := map[libraryapi.Route]bool{}
+	for _, route := range router.Routes() {
+		routes[libraryapi.Route{Method: route.Method, Path: route.Path}] = true
+	}
+	for route := range libraryapi.RateGroups {
+		assert.True(t, routes[route], "No route %s %s", route.Method, route.Path)
+	}
+}
+
+func TestRateLimitGroups(t *testing.T) {
+	runtime := config.Default().Runtime
+	runtime.RateLimit = 100
+	runtime.RateBurst = 100
+	runtime.RateLimits = []string{"search=1:2"}
+	router := setupLimitedServer(t, runtime)
+	librarian := createKey(t, router, "catalogue", auth.RoleLibrarian)
+	send := func(path, key string) int {
+		headers := map[string]string{}
+		if key != "" {
+			headers["X-API-Key"] = key
+		}
+		response, err := api.SendRequestWithHeaders(router, http.MethodGet, path, nil, headers)
+		require.NoError(t, err)
+		return response.Code
+	}
+
+	// The searches of a client are limited apart from its other requests,
+	// and from the searches of the other clients
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, send("/api/v1/books/search?title=go", ""))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, send("/api/v1/books/search?title=go", ""))
+	assert.Equal(t, http.StatusTooManyRequests, send("/opds/search?q=go", ""), "the same group")
+	assert.Equal(t, http.StatusOK, send("/api/v1/books/count", ""))
+	assert.Equal(t, http.StatusOK, send("/api/v1/books/search?title=go", librarian.Key))
+
+	response, err := api.SendRequestWithHeaders(router, http.MethodGet, "/admin/ratelimits?client=ip:", nil, map[string]string{"X-API-Key": adminKey})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var counters []ratelimit.Counter
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &counters))
+	assert.Equal(t, []ratelimit.Counter{
+		{Client: "ip:", Group: "default", Remaining: 99, Burst: 100},
+		{Client: "ip:", Group: "search", Remaining: 0, Burst: 2},
+	}, counters)
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	runtime := config.Default().Runtime
+	runtime.RateLimits = []string{"search=1:2"}
+	// search sends a search of an anonymous client through a proxy, which
+	// forwards the IP the client claims
+	search := func(router *gin.Engine, proxy, forwarded string) int {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/books/search?title=go", nil)
+		request.RemoteAddr = proxy + ":41234"
+		request.Header.Set("X-Forwarded-For", forwarded)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	// The clients cannot spoof their IP to escape their limits
+	router := setupLimitedServer(t, runtime)
+	assert.Equal(t, http.StatusOK, search(router, "198.51.100.4", "203.0.113.1"))
+	assert.Equal(t, http.StatusOK, search(router, "198.51.100.4", "203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, search(router, "198.51.100.4", "203.0.113.3"))
+
+	// Unless their proxy is trusted, telling their IP
+	router = setupLimitedServer(t, runtime, "192.0.2.0/24")
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, search(router, "192.0.2.10", "203.0.113.1"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, search(router, "192.0.2.10", "203.0.113.1"))
+	assert.Equal(t, http.StatusOK, search(router, "192.0.2.10", "203.0.113.2"), "another client")
+	assert.Equal(t, http.StatusOK, search(router, "198.51.100.4", "203.0.113.1"), "an untrusted proxy is the client")
+	assert.Equal(t, http.StatusOK, search(router, "198.51.100.4", "203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, search(router, "198.51.100.4", "203.0.113.3"))
+}
+
+func TestQuotas(t *testing.T) {
+	runtime := config.Default().Runtime
+	runtime.Quotas = []string{"export=2"}
+	router := setupLimitedServer(t, runtime)
+	librarian := createKey(t, router, "catalogue", auth.RoleLibrarian)
+	export := func(key string) *http.Response {
+		response, err := api.SendRequestWithHeaders(router, http.MethodGet, "/api/v1/books/export/marc", nil, map[string]string{"X-API-Key": key})
+		require.NoError(t, err)
+		return response.Result()
+	}
+
+	for i := 0; i < 2; i++ {
+		response := export(librarian.Key)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "2", response.Header.Get("RateLimit-Limit"))
+	}
+	response := export(librarian.Key)
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	assert.Equal(t, "0", response.Header.Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, response.Header.Get("Retry-After"))
+	assert.Equal(t, response.Header.Get("Retry-After"), response.Header.Get("RateLimit-Reset"), "the quota is renewed at midnight")
+	assert.Equal(t, http.StatusOK, export(adminKey).StatusCode, "another client")
+
+	testCases := []struct {
+		Description string
+		Method      string
+		Path        string
+		Key         string
+		Status      int
+		Body        string
+	}{
+		{Description: "Librarian resets", Method: http.MethodDelete, Path: "/admin/ratelimits", Key: librarian.Key, Status: http.StatusForbidden, Body: string(auth.PermLimitsManage)},
+		{Description: "Other group", Method: http.MethodDelete, Path: "/admin/ratelimits?client=api_key:1&group=search", Key: adminKey, Status: http.StatusOK, Body: `{"reset":0}`},
+		{Description: "Admin inspects", Method: http.MethodGet, Path: "/admin/ratelimits?client=api_key:1", Key: adminKey, Status: http.StatusOK, Body: `[{"client":"api_key:1","group":"export","remaining":0,"burst":0,"used_today":2}]`},
+		{Description: "Admin resets", Method: http.MethodDelete, Path: "/admin/ratelimits?client=api_key:1&group=export", Key: adminKey, Status: http.StatusOK, Body: `{"reset":1}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendRequestWithHeaders(router, tc.Method, tc.Path, nil, map[string]string{"X-API-Key": tc.Key})
+			require.NoError(t, err)
+			assert.Equal(t, tc.Status, response.Code)
+			assert.Contains(t, response.Body.String(), tc.Body)
+		})
+	}
+	assert.Equal(t, http.StatusOK, export(librarian.Key).StatusCode, "the quota starts over")
+}
@@ -85,3 +85,66 @@ func SendCountBooksRequest(router *gin.Engine) (*httptest.ResponseRecorder, erro
 	var body []byte = nil
 	return SendRequestV1(router, method, url, body)
 }
+
+func SendGetBookMARCXMLRequest(router *gin.Engine, ID uint) (*httptest.ResponseRecorder, error) {
+	url := v1Prefix + "/books/" + strconv.Itoa(int(ID))
+	headers := map[string]string{"Accept": "application/marc+xml"}
+	return SendRequestWithHeaders(router, "GET", url, nil, headers)
+}
+
+func SendImportMARCRequest(router *gin.Engine, contentType string, body []byte) (*httptest.ResponseRecorder, error) {
+	url := v1Prefix + "/books/import/marc"
+	headers := map[string]string{"Content-Type": contentType}
+	return SendRequestWithHeaders(router, "POST", url, body, headers)
+}
+
+func SendExportMARCRequest(router *gin.Engine, format string) (*httptest.ResponseRecorder, error) {
+	method := "GET"
+	url := "/books/export/marc?format=" + format
+	var body []byte = nil
+	return SendRequestV1(router, method, url, body)
+}
+
+func SendCiteBookRequest(router *gin.Engine, ID uint, style string) (*httptest.ResponseRecorder, error) {
+	method := "GET"
+	url := fmt.Sprintf("/books/%d/cite?style=%s", ID, style)
+	var body []byte = nil
+	return SendRequestV1(router, method, url, body)
+}
+
+func SendListBooksWithAcceptRequest(router *gin.Engine, accept string) (*httptest.ResponseRecorder, error) {
+	url := v1Prefix + "/books"
+	headers := map[string]string{"Accept": accept}
+	return SendRequestWithHeaders(router, "GET", url, nil, headers)
+}
+
+func SendOAIRequest(router *gin.Engine, query string) (*httptest.ResponseRecorder, error) {
+	method := "GET"
+	url := "/oai?" + query
+	var body []byte = nil
+	return SendRequest(router, method, url, body)
+}
+
+func SendOPDSRequest(router *gin.Engine, path string) (*httptest.ResponseRecorder, error) {
+	method := "GET"
+	url := "/opds" + path
+	var body []byte = nil
+	return SendRequest(router, method, url, body)
+}
+
+func SendFeedRequest(router *gin.Engine, path string, headers map[string]string) (*httptest.ResponseRecorder, error) {
+	method := "GET"
+	url := "/feeds" + path
+	var body []byte = nil
+	return SendRequestWithHeaders(router, method, url, body, headers)
+}
+
+func SendGraphQLRequest(router *gin.Engine, query string, variables map[string]interface{}) (*httptest.ResponseRecorder, error) {
+	method := "POST"
+	url := "/graphql"
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return nil, err
+	}
+	return SendRequest(router, method, url, body)
+}
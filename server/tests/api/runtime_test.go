@@ -0,0 +1,202 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	libraryapi "library/api"
+	"library/api/handlers"
+	"library/auth"
+	"library/config"
+	"library/opds"
+	"library/repository"
+	"library/tests/api"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupLiveServer returns a router whose runtime configuration is live.
+func setupLiveServer(t *testing.T, runtime config.RuntimeConfig) (*gin.Engine, *config.Live) {
+	cfg := config.Default()
+	cfg.Runtime = runtime
+	live := config.NewLive(cfg)
+	return libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{Live: live}, "../../"), live
+}
+
+func TestCORS(t *testing.T) {
+	runtime := config.Default().Runtime
+	runtime.CORSOrigins = []string{"https://catalogue.example.org"}
+	router, _ := setupLiveServer(t, runtime)
+
+	testCases := []struct {
+		Description string
+		Method      string
+		Headers     map[string]string
+		Status      int
+		AllowOrigin string
+		AllowMethod bool
+	}{
+		{
+			Description: "Allowed Origin",
+			Method:      http.MethodGet,
+			Headers:     map[string]string{"Origin": "https://catalogue.example.org"},
+			Status:      http.StatusOK,
+			AllowOrigin: "https://catalogue.example.org",
+		},
+		{
+			Description: "Other Origin",
+			Method:      http.MethodGet,
+			Headers:     map[string]string{"Origin": "https://elsewhere.example.org"},
+			Status:      http.StatusOK,
+		},
+		{
+			Description: "Preflight",
+			Method:      http.MethodOptions,
+			Headers:     map[string]string{"Origin": "https://catalogue.example.org", "Access-Control-Request-Method": "DELETE"},
+			Status:      http.StatusNoContent,
+			AllowOrigin: "https://catalogue.example.org",
+			AllowMethod: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response, err := api.SendRequestWithHeaders(router, tc.Method, "/api/v1/books/count", nil, tc.Headers)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Status, response.Code, "Unexpected status code")
+			assert.Equal(t, tc.AllowOrigin, response.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tc.AllowMethod, response.Header().Get("Access-Control-Allow-Methods") != "")
+			assert.Equal(t, "Origin", response.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	runtime := config.Default().Runtime
+	runtime.RateLimit = 1
+	runtime.RateBurst = 3
+	router, live := setupLiveServer(t, runtime)
+
+	for i := 0; i < runtime.RateBurst; i++ {
+		response, err := api.SendCountBooksRequest(router)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.Code, "Requests within the burst are served")
+		assert.Equal(t, "3", response.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(runtime.RateBurst-i-1), response.Header().Get("RateLimit-Remaining"))
+	}
+
+	response, err := api.SendCountBooksRequest(router)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, response.Code, "Unexpected status code")
+	assert.Equal(t, "1", response.Header().Get("Retry-After"))
+	assert.Equal(t, "0", response.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3", response.Header().Get("RateLimit-Reset"))
+
+	// Disabling the limit applies at once
+	runtime.RateLimit = 0
+	_, err = live.Apply(runtime)
+	require.NoError(t, err)
+	response, err = api.SendCountBooksRequest(router)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	assert.Empty(t, response.Header().Get("RateLimit-Limit"))
+}
+
+func TestAdminConfig(t *testing.T) {
+	runtime := config.Default().Runtime
+	router, live := setupLiveServer(t, runtime)
+
+	applied := func() config.Applied {
+		response, err := api.SendRequest(router, http.MethodGet, "/admin/config", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+		var applied config.Applied
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &applied))
+		return applied
+	}
+	assert.Equal(t, 1, applied().Version)
+
+	runtime.LogLevel = config.LogLevelDebug
+	_, err := live.Apply(runtime)
+	require.NoError(t, err)
+	current := applied()
+	assert.Equal(t, 2, current.Version)
+	assert.Equal(t, config.LogLevelDebug, current.Runtime.LogLevel)
+
+	// An invalid configuration is not applied
+	runtime.PageSize = runtime.MaxPageSize + 1
+	_, err = live.Apply(runtime)
+	assert.ErrorContains(t, err, "runtime.page_size (PAGE_SIZE): must not be greater than runtime.max_page_size")
+	assert.Equal(t, 2, applied().Version)
+}
+
+func TestLivePageSize(t *testing.T) {
+	runtime := config.Default().Runtime
+	router, live := setupLiveServer(t, runtime)
+	api.CreateListOfBookTemplates(t, router)
+
+	entries := func(path string) int {
+		response, err := api.SendOPDSRequest(router, path)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+		var feed opds.Feed
+		assert.NoError(t, xml.Unmarshal(response.Body.Bytes(), &feed))
+		return len(feed.Entries)
+	}
+
+	runtime.PageSize, runtime.MaxPageSize = 2, 4
+	_, err := live.Apply(runtime)
+	require.NoError(t, err)
+	assert.Equal(t, 2, entries("/new"), "the default page size follows the configuration")
+	assert.Equal(t, 4, entries("/new?limit=50"), "the page size is bounded by the configuration")
+}
+
+func TestQueryTimeout(t *testing.T) {
+	runtime := config.Default().Runtime
+	runtime.QueryTimeout = 10 * time.Millisecond
+	router, live := setupLiveServer(t, runtime)
+	// The routes of the test are public, as any route must be in the policy
+	for _, path := range []string{"/slow", "/deadline"} {
+		route := libraryapi.Route{Method: http.MethodGet, Path: path}
+		libraryapi.Policy[route] = auth.Public
+		t.Cleanup(func() { delete(libraryapi.Policy, route) })
+	}
+
+	// A handler querying with the context of its request, as the repository does
+	var deadline bool
+	router.GET("/slow", func(c *gin.Context) {
+		_, deadline = c.Request.Context().Deadline()
+		select {
+		case <-c.Request.Context().Done():
+			c.JSON(http.StatusGatewayTimeout, handlers.ErrorResponse{Error: c.Request.Context().Err().Error()})
+		case <-time.After(time.Second):
+			c.Status(http.StatusOK)
+		}
+	})
+
+	response, err := api.SendRequest(router, http.MethodGet, "/slow", nil)
+	assert.NoError(t, err)
+	assert.True(t, deadline)
+	assert.Equal(t, http.StatusGatewayTimeout, response.Code, "Unexpected status code")
+	assert.Contains(t, response.Body.String(), context.DeadlineExceeded.Error())
+
+	// No timeout when disabled
+	runtime.QueryTimeout = 0
+	_, err = live.Apply(runtime)
+	require.NoError(t, err)
+	response, err = api.SendCountBooksRequest(router)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	router.GET("/deadline", func(c *gin.Context) {
+		_, deadline = c.Request.Context().Deadline()
+	})
+	_, err = api.SendRequest(router, http.MethodGet, "/deadline", nil)
+	assert.NoError(t, err)
+	assert.False(t, deadline)
+}
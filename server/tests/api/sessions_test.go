@@ -0,0 +1,222 @@
+package api_test
+
+import (
+	"encoding/json"
+	"io"
+	"library/api/handlers"
+	"library/auth"
+	"library/models"
+	"library/tests/api"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const password = "correct horse battery staple"
+
+// createUser creates a user of a role with the admin key.
+func createUser(t *testing.T, router *gin.Engine, username, role string) models.User {
+	body, err := json.Marshal(handlers.UserRequest{Username: username, Password: password, Role: role})
+	require.NoError(t, err)
+	response, err := api.SendRequestWithHeaders(router, http.MethodPost, "/admin/users", body,
+		map[string]string{"Content-Type": "application/json", "X-API-Key": adminKey})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	var user models.User
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &user))
+	return user
+}
+
+// login logs a user in with a password, and returns the response.
+func login(t *testing.T, router *gin.Engine, username, password string) *http.Response {
+	body, err := json.Marshal(handlers.LoginRequest{Username: username, Password: password})
+	require.NoError(t, err)
+	response, err := api.SendRequestWithHeaders(router, http.MethodPost, "/auth/login", body, map[string]string{"Content-Type": "application/json"})
+	require.NoError(t, err)
+	return response.Result()
+}
+
+// sendWithSession sends a request with a session token as a bearer token, and returns
+// the status code of its response.
+func sendWithSession(t *testing.T, router *gin.Engine, method, path string, body []byte, token string) int {
+	response, err := api.SendRequestWithHeaders(router, method, path, body,
+		map[string]string{"Content-Type": "application/json", "Authorization": "Bearer " + token})
+	require.NoError(t, err)
+	return response.Code
+}
+
+func TestUsers(t *testing.T) {
+	router := setupAuthServer(t)
+	user := createUser(t, router, "alice", auth.RoleLibrarian)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, auth.RoleLibrarian, user.Role)
+
+	testCases := []struct {
+		Description string
+		Body        string
+		Key         string
+		Status      int
+	}{
+		{Description: "Taken username", Body: `{"username": "alice", "password": "` + password + `", "role": "patron"}`, Key: adminKey, Status: http.StatusConflict},
+		{Description: "Short password", Body: `{"username": "bob", "password": "secret", "role": "patron"}`, Key: adminKey, Status: http.StatusBadRequest},
+		{Description: "Unknown role", Body: `{"username": "bob", "password": "` + password + `", "role": "reader"}`, Key: adminKey, Status: http.StatusBadRequest},
+		{Description: "Guest", Body: `{"username": "bob", "password": "` + password + `", "role": "patron"}`, Status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			headers := map[string]string{"Content-Type": "application/json"}
+			if tc.Key != "" {
+				headers["X-API-Key"] = tc.Key
+			}
+			response, err := api.SendRequestWithHeaders(router, http.MethodPost, "/admin/users", []byte(tc.Body), headers)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Status, response.Code, response.Body.String())
+		})
+	}
+
+	response, err := api.SendRequestWithHeaders(router, http.MethodGet, "/admin/users", nil, map[string]string{"X-API-Key": adminKey})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code, "Unexpected status code")
+	assert.NotContains(t, response.Body.String(), "password")
+	var users []models.User
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &users))
+	assert.Len(t, users, 1)
+}
+
+func TestSessions(t *testing.T) {
+	router := setupAuthServer(t)
+	createUser(t, router, "alice", auth.RoleLibrarian)
+	book, err := api.LoadSampleBook()
+	require.NoError(t, err)
+	body, err := json.Marshal(book)
+	require.NoError(t, err)
+
+	response := login(t, router, "alice", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	response = login(t, router, "alice", password)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var session auth.Session
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&session))
+	assert.Equal(t, "alice", session.User.Username)
+	require.Len(t, response.Cookies(), 1)
+	cookie := response.Cookies()[0]
+	assert.Equal(t, auth.SessionCookie, cookie.Name)
+	assert.Equal(t, session.Token, cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+	// The session authenticates as a bearer token or a cookie
+	assert.Equal(t, http.StatusCreated, sendWithSession(t, router, http.MethodPost, "/api/v1/books", body, session.Token))
+	assert.Equal(t, http.StatusForbidden, sendWithSession(t, router, http.MethodDelete, "/api/v1/books/1", nil, session.Token))
+	permissionsResponse, err := api.SendRequestWithHeaders(router, http.MethodGet, "/auth/permissions", nil, map[string]string{"Cookie": cookie.String()})
+	require.NoError(t, err)
+	var permissions handlers.PermissionsResponse
+	require.NoError(t, json.Unmarshal(permissionsResponse.Body.Bytes(), &permissions))
+	assert.Equal(t, "session:1", permissions.Principal)
+	assert.Equal(t, []string{auth.RoleLibrarian}, permissions.Roles)
+
+	// A refreshed session replaces the previous one
+	refresh, err := api.SendRequestWithHeaders(router, http.MethodPost, "/auth/refresh", nil, map[string]string{"Authorization": "Bearer " + session.Token})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, refresh.Code, refresh.Body.String())
+	var refreshed auth.Session
+	require.NoError(t, json.Unmarshal(refresh.Body.Bytes(), &refreshed))
+	assert.NotEqual(t, session.Token, refreshed.Token)
+	assert.Equal(t, http.StatusUnauthorized, sendWithSession(t, router, http.MethodPost, "/auth/refresh", nil, session.Token))
+
+	// Changing the password keeps the session, logging out closes it
+	change := []byte(`{"current_password": "` + password + `", "new_password": "a new password of Alice"}`)
+	assert.Equal(t, http.StatusUnauthorized, sendWithSession(t, router, http.MethodPost, "/auth/password",
+		[]byte(`{"current_password": "wrong", "new_password": "a new password of Alice"}`), refreshed.Token))
+	assert.Equal(t, http.StatusOK, sendWithSession(t, router, http.MethodPost, "/auth/password", change, refreshed.Token))
+	assert.Equal(t, http.StatusUnauthorized, login(t, router, "alice", password).StatusCode)
+	assert.Equal(t, http.StatusOK, sendWithSession(t, router, http.MethodPost, "/auth/logout", nil, refreshed.Token))
+	assert.Equal(t, http.StatusUnauthorized, sendWithSession(t, router, http.MethodPost, "/api/v1/books", body, refreshed.Token))
+	assert.Equal(t, http.StatusUnauthorized, sendWithSession(t, router, http.MethodPost, "/auth/logout", nil, refreshed.Token))
+	assert.Equal(t, http.StatusOK, login(t, router, "alice", "a new password of Alice").StatusCode)
+}
+
+func TestLockoutAndReset(t *testing.T) {
+	router := setupAuthServer(t)
+	user := createUser(t, router, "alice", auth.RoleLibrarian)
+
+	assert.Equal(t, http.StatusUnauthorized, login(t, router, "alice", "wrong").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, login(t, router, "alice", "wrong").StatusCode)
+	response := login(t, router, "alice", "wrong")
+	assert.Equal(t, http.StatusLocked, response.StatusCode)
+	assert.Equal(t, "60", response.Header.Get("Retry-After"))
+	assert.Equal(t, http.StatusLocked, login(t, router, "alice", password).StatusCode, "even with the right password")
+
+	// A reset token issued by an admin unlocks the account, once
+	path := "/admin/users/" + strconv.Itoa(int(user.ID)) + "/reset"
+	issued, err := api.SendRequestWithHeaders(router, http.MethodPost, path, nil, map[string]string{"X-API-Key": adminKey})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, issued.Code, issued.Body.String())
+	var reset handlers.ResetResponse
+	require.NoError(t, json.Unmarshal(issued.Body.Bytes(), &reset))
+	body := []byte(`{"token": "` + reset.Token + `", "new_password": "a new password of Alice"}`)
+	resetResponse, err := api.SendRequestWithHeaders(router, http.MethodPost, "/auth/reset", body, map[string]string{"Content-Type": "application/json"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resetResponse.Code, resetResponse.Body.String())
+	assert.Equal(t, http.StatusOK, login(t, router, "alice", "a new password of Alice").StatusCode)
+	resetResponse, err = api.SendRequestWithHeaders(router, http.MethodPost, "/auth/reset", body, map[string]string{"Content-Type": "application/json"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resetResponse.Code, "the token was used")
+
+	resetResponse, err = api.SendRequestWithHeaders(router, http.MethodPost, "/admin/users/1000/reset", nil, map[string]string{"X-API-Key": adminKey})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resetResponse.Code)
+}
+
+func TestLoginPage(t *testing.T) {
+	router := setupAuthServer(t)
+	createUser(t, router, "alice", auth.RoleLibrarian)
+	form := func(password string) *http.Response {
+		values := url.Values{"username": {"alice"}, "password": {password}}
+		response, err := api.SendRequestWithHeaders(router, http.MethodPost, "/auth/login", []byte(values.Encode()),
+			map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+		require.NoError(t, err)
+		return response.Result()
+	}
+
+	response, err := api.SendRequest(router, http.MethodGet, "/login", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `action="/auth/login"`)
+	assert.NotContains(t, response.Body.String(), "/auth/oidc/login", "without an identity provider")
+	response, err = api.SendRequest(router, http.MethodGet, "/auth/oidc/login", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	failed := form("wrong")
+	assert.Equal(t, http.StatusUnauthorized, failed.StatusCode)
+	page, err := io.ReadAll(failed.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "Wrong username or password")
+	assert.Contains(t, string(page), `value="alice"`)
+
+	// The browser is redirected to the welcome page, naming the user
+	logged := form(password)
+	assert.Equal(t, http.StatusSeeOther, logged.StatusCode)
+	assert.Equal(t, "/", logged.Header.Get("Location"))
+	require.Len(t, logged.Cookies(), 1)
+	cookie := logged.Cookies()[0].String()
+	welcome, err := api.SendRequestWithHeaders(router, http.MethodGet, "/", nil, map[string]string{"Cookie": cookie})
+	require.NoError(t, err)
+	assert.Contains(t, welcome.Body.String(), "Logged in as alice")
+
+	logout, err := api.SendRequestWithHeaders(router, http.MethodPost, "/auth/logout", nil,
+		map[string]string{"Cookie": cookie, "Content-Type": "application/x-www-form-urlencoded"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSeeOther, logout.Code)
+	welcome, err = api.SendRequestWithHeaders(router, http.MethodGet, "/", nil, map[string]string{"Cookie": cookie})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, welcome.Code, "a stale cookie is ignored")
+	assert.Contains(t, welcome.Body.String(), "Staff login")
+}
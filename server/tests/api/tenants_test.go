@@ -0,0 +1,316 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	libraryapi "library/api"
+	"library/api/handlers"
+	"library/auth"
+	"library/auth/authtest"
+	"library/config"
+	"library/models"
+	"library/repository"
+	"library/tests/api"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantDomain is the domain whose subdomains name the tenants.
+const tenantDomain = "library.example.org"
+
+// setupTenantServer returns a router hosting several libraries, named by
+// their subdomain of tenantDomain, the X-Tenant header or the tenant claim
+// of the tokens of a stub provider, which the users log in with, with the
+// springfield and shelbyville tenants provisioned.
+func setupTenantServer(t *testing.T) (*gin.Engine, *authtest.Provider) {
+	provider := authtest.NewProvider(t, "library", "a client secret")
+	tokens := auth.NewVerifier(nil, auth.NewRemoteKeys(http.DefaultClient, provider.URL+"/jwks", time.Hour), provider.Issuer(), "")
+	keys := repository.NewMemoryKeys()
+	accounts := auth.NewAccounts(repository.NewMemoryUsers(), repository.NewMemorySessions(), auth.AccountOptions{})
+	tenancy := config.Default().Tenancy
+	tenancy.Enabled = true
+	tenancy.Domain = tenantDomain
+	oidc, err := auth.NewOIDC(context.Background(), accounts, auth.OIDCOptions{
+		Issuer:       provider.Issuer(),
+		ClientID:     "library",
+		ClientSecret: "a client secret",
+		RedirectURL:  "http://localhost:8090/auth/oidc/callback",
+		TenantClaim:  tenancy.Claim,
+	})
+	require.NoError(t, err)
+	router := libraryapi.SetupRouter(repository.NewMemory(), libraryapi.Options{
+		Keys:     keys,
+		Accounts: accounts,
+		OIDC:     oidc,
+		Tenants:  repository.NewMemoryTenants(),
+		Tenancy:  tenancy,
+		Auth:     auth.New(keys, auth.Options{AdminKey: adminKey, Tokens: tokens, Accounts: accounts, GuestRole: auth.RolePatron}),
+	}, "../../")
+
+	for _, request := range []handlers.TenantRequest{
+		{Slug: "springfield", TenantSettings: handlers.TenantSettings{Name: "Springfield Public Library", LoanDays: 21}},
+		{Slug: "shelbyville", TenantSettings: handlers.TenantSettings{Name: "Shelbyville Library"}},
+	} {
+		response := sendToTenant(t, router, http.MethodPost, "/admin/tenants", request, "", adminKey)
+		require.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	}
+	return router, provider
+}
+
+// sendToTenant sends a request to a tenant named by the X-Tenant header,
+// none if empty, with a JSON body unless nil and an API key, session or
+// token as a bearer token unless empty.
+func sendToTenant(t *testing.T, router *gin.Engine, method, path string, body any, tenant, token string) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	if tenant != "" {
+		headers["X-Tenant"] = tenant
+	}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	response, err := api.SendRequestWithHeaders(router, method, path, data, headers)
+	require.NoError(t, err)
+	return response
+}
+
+// createTenantKey creates an API key of a role for a tenant with the admin key.
+func createTenantKey(t *testing.T, router *gin.Engine, tenant, role string) handlers.CreatedKey {
+	response := sendToTenant(t, router, http.MethodPost, "/admin/keys", handlers.KeyRequest{Name: tenant, Role: role}, tenant, adminKey)
+	require.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	var created handlers.CreatedKey
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &created))
+	return created
+}
+
+func TestTenantProvisioning(t *testing.T) {
+	router, _ := setupTenantServer(t)
+	springfieldAdmin := createTenantKey(t, router, "springfield", auth.RoleAdmin)
+	librarian := createTenantKey(t, router, "springfield", auth.RoleLibrarian)
+
+	testCases := []struct {
+		Description string
+		Method      string
+		Path        string
+		Body        any
+		Key         string
+		Status      int
+		Contains    string
+	}{
+		{Description: "List", Method: http.MethodGet, Path: "/admin/tenants", Key: adminKey, Status: http.StatusOK, Contains: `"slug":"shelbyville"`},
+		{Description: "Create", Method: http.MethodPost, Path: "/admin/tenants", Key: adminKey,
+			Body: handlers.TenantRequest{Slug: "ogdenville", TenantSettings: handlers.TenantSettings{Name: "Ogdenville Library"}}, Status: http.StatusCreated, Contains: `"loan_days":14`},
+		{Description: "Taken slug", Method: http.MethodPost, Path: "/admin/tenants", Key: adminKey,
+			Body: handlers.TenantRequest{Slug: "springfield", TenantSettings: handlers.TenantSettings{Name: "Other"}}, Status: http.StatusConflict},
+		{Description: "Invalid slug", Method: http.MethodPost, Path: "/admin/tenants", Key: adminKey,
+			Body: handlers.TenantRequest{Slug: "North Haverbrook", TenantSettings: handlers.TenantSettings{Name: "North Haverbrook"}}, Status: http.StatusBadRequest, Contains: "Invalid slug"},
+		{Description: "Invalid color", Method: http.MethodPut, Path: "/admin/tenants/springfield", Key: adminKey,
+			Body: handlers.TenantSettings{Name: "Springfield", Color: "blue"}, Status: http.StatusBadRequest},
+		{Description: "Configure", Method: http.MethodPut, Path: "/admin/tenants/springfield", Key: adminKey,
+			Body: handlers.TenantSettings{Name: "Springfield Public Library", LoanDays: 28, Color: "#336699"}, Status: http.StatusOK, Contains: `"loan_days":28`},
+		{Description: "Unknown tenant", Method: http.MethodPut, Path: "/admin/tenants/capital-city", Key: adminKey,
+			Body: handlers.TenantSettings{Name: "Capital City"}, Status: http.StatusNotFound},
+		{Description: "Admin of a tenant", Method: http.MethodGet, Path: "/admin/tenants", Key: springfieldAdmin.Key, Status: http.StatusForbidden, Contains: "admin key of the deployment"},
+		{Description: "Admin of a tenant inspects the server", Method: http.MethodGet, Path: "/admin/config", Key: springfieldAdmin.Key, Status: http.StatusForbidden, Contains: "inspects the server"},
+		{Description: "Admin of a tenant inspects the cache", Method: http.MethodGet, Path: "/admin/cache", Key: springfieldAdmin.Key, Status: http.StatusForbidden, Contains: "inspects the server"},
+		{Description: "Admin of a tenant inspects the rate limits", Method: http.MethodGet, Path: "/admin/ratelimits", Key: springfieldAdmin.Key, Status: http.StatusForbidden, Contains: "manages the rate limits"},
+		{Description: "Admin of a tenant resets the rate limits", Method: http.MethodDelete, Path: "/admin/ratelimits", Key: springfieldAdmin.Key, Status: http.StatusForbidden, Contains: "manages the rate limits"},
+		{Description: "Operator inspects the server", Method: http.MethodGet, Path: "/admin/config", Key: adminKey, Status: http.StatusOK, Contains: `"version"`},
+		{Description: "Operator inspects the rate limits", Method: http.MethodGet, Path: "/admin/ratelimits", Key: adminKey, Status: http.StatusOK},
+		{Description: "Librarian", Method: http.MethodPost, Path: "/admin/tenants", Key: librarian.Key,
+			Body: handlers.TenantRequest{Slug: "brockway", TenantSettings: handlers.TenantSettings{Name: "Brockway"}}, Status: http.StatusForbidden, Contains: string(auth.PermTenantsManage)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response := sendToTenant(t, router, tc.Method, tc.Path, tc.Body, "", tc.Key)
+			assert.Equal(t, tc.Status, response.Code, response.Body.String())
+			assert.Contains(t, response.Body.String(), tc.Contains)
+		})
+	}
+
+	// The settings of the tenant of a request are public
+	response := sendToTenant(t, router, http.MethodGet, "/tenant", nil, "springfield", "")
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var tenant models.Tenant
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &tenant))
+	assert.Equal(t, "springfield", tenant.Slug)
+	assert.Equal(t, 28, tenant.LoanDays)
+	assert.Equal(t, "#336699", tenant.Color)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	router, _ := setupTenantServer(t)
+	springfield := createTenantKey(t, router, "springfield", auth.RoleAdmin)
+	shelbyville := createTenantKey(t, router, "shelbyville", auth.RoleAdmin)
+	book, err := api.LoadSampleBook()
+	require.NoError(t, err)
+
+	// A subdomain names the tenant the book is added to
+	body, err := json.Marshal(book)
+	require.NoError(t, err)
+	response, err := api.SendRequestWithHeaders(router, http.MethodPost, "http://springfield."+tenantDomain+"/api/v1/books", body,
+		map[string]string{"Content-Type": "application/json", "X-API-Key": springfield.Key})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	var added models.Book
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &added))
+	path := "/api/v1/books/" + strconv.Itoa(int(added.ID))
+
+	testCases := []struct {
+		Description string
+		Method      string
+		Path        string
+		Body        any
+		Tenant      string
+		Key         string
+		Status      int
+		Contains    string
+	}{
+		{Description: "Read by its tenant", Method: http.MethodGet, Path: path, Tenant: "springfield", Key: springfield.Key, Status: http.StatusOK, Contains: book.Title},
+		{Description: "Read by the tenant of the key", Method: http.MethodGet, Path: path, Key: springfield.Key, Status: http.StatusOK, Contains: book.Title},
+		{Description: "Read as a guest of its tenant", Method: http.MethodGet, Path: path, Tenant: "springfield", Status: http.StatusOK},
+		{Description: "Read by another tenant", Method: http.MethodGet, Path: path, Tenant: "shelbyville", Key: shelbyville.Key, Status: http.StatusNotFound},
+		{Description: "Read by the default tenant", Method: http.MethodGet, Path: path, Status: http.StatusNotFound},
+		{Description: "Searched by another tenant", Method: http.MethodGet, Path: "/api/v1/books/search?title=" + book.Title, Key: shelbyville.Key, Status: http.StatusOK, Contains: "[]"},
+		{Description: "Counted by another tenant", Method: http.MethodGet, Path: "/api/v1/books/count", Key: shelbyville.Key, Status: http.StatusOK, Contains: "0"},
+		{Description: "Updated by another tenant", Method: http.MethodPut, Path: path, Body: book, Key: shelbyville.Key, Status: http.StatusNotFound},
+		{Description: "Deleted by another tenant", Method: http.MethodDelete, Path: path, Key: shelbyville.Key, Status: http.StatusNotFound},
+		{Description: "Read with the key of another tenant", Method: http.MethodGet, Path: path, Tenant: "springfield", Key: shelbyville.Key, Status: http.StatusForbidden, Contains: "another tenant"},
+		{Description: "Deleted with the key of another tenant", Method: http.MethodDelete, Path: path, Tenant: "springfield", Key: shelbyville.Key, Status: http.StatusForbidden},
+		{Description: "Keys of another tenant", Method: http.MethodGet, Path: "/admin/keys", Key: shelbyville.Key, Status: http.StatusOK, Contains: `"name":"shelbyville"`},
+		{Description: "Unknown tenant", Method: http.MethodGet, Path: "/api/v1/books", Tenant: "capital-city", Status: http.StatusNotFound, Contains: "Unknown tenant"},
+		{Description: "Health of no tenant", Method: http.MethodGet, Path: "/livez", Tenant: "capital-city", Status: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response := sendToTenant(t, router, tc.Method, tc.Path, tc.Body, tc.Tenant, tc.Key)
+			assert.Equal(t, tc.Status, response.Code, response.Body.String())
+			assert.Contains(t, response.Body.String(), tc.Contains)
+			assert.NotContains(t, response.Body.String(), `"name":"springfield"`)
+		})
+	}
+
+	// The users log in to their tenant
+	user := handlers.UserRequest{Username: "alice", Password: password, Role: auth.RoleLibrarian}
+	response = sendToTenant(t, router, http.MethodPost, "/admin/users", user, "springfield", adminKey)
+	require.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	credentials := handlers.LoginRequest{Username: "alice", Password: password}
+	assert.Equal(t, http.StatusUnauthorized, sendToTenant(t, router, http.MethodPost, "/auth/login", credentials, "shelbyville", "").Code)
+	response = sendToTenant(t, router, http.MethodPost, "/auth/login", credentials, "springfield", "")
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	var session auth.Session
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &session))
+	assert.Equal(t, http.StatusOK, sendToTenant(t, router, http.MethodGet, path, nil, "", session.Token).Code)
+	assert.Equal(t, http.StatusForbidden, sendToTenant(t, router, http.MethodGet, path, nil, "shelbyville", session.Token).Code)
+}
+
+func TestTenantClaim(t *testing.T) {
+	router, provider := setupTenantServer(t)
+	springfield := provider.Token(map[string]any{"sub": "alice", "roles": []string{auth.RoleLibrarian}, "tenant": "springfield"})
+	unclaimed := provider.Token(map[string]any{"sub": "bob", "roles": []string{auth.RoleLibrarian}})
+
+	testCases := []struct {
+		Description string
+		Tenant      string
+		Token       string
+		Status      int
+		Served      string
+	}{
+		{Description: "Claimed tenant", Token: springfield, Status: http.StatusOK, Served: "springfield"},
+		{Description: "Named claimed tenant", Tenant: "springfield", Token: springfield, Status: http.StatusOK, Served: "springfield"},
+		{Description: "Another tenant", Tenant: "shelbyville", Token: springfield, Status: http.StatusForbidden},
+		{Description: "Without claim", Token: unclaimed, Status: http.StatusOK, Served: repository.DefaultTenantSlug},
+		{Description: "Without claim to another tenant", Tenant: "springfield", Token: unclaimed, Status: http.StatusForbidden},
+		{Description: "Guest", Tenant: "shelbyville", Status: http.StatusOK, Served: "shelbyville"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			response := sendToTenant(t, router, http.MethodGet, "/auth/permissions", nil, tc.Tenant, tc.Token)
+			require.Equal(t, tc.Status, response.Code, response.Body.String())
+			if tc.Status != http.StatusOK {
+				return
+			}
+			var permissions handlers.PermissionsResponse
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &permissions))
+			assert.Equal(t, tc.Served, permissions.Tenant)
+		})
+	}
+}
+
+func TestTenantOIDCLogin(t *testing.T) {
+	router, provider := setupTenantServer(t)
+
+	testCases := []struct {
+		Description string
+		Tenant      string
+		Claims      map[string]any
+		Status      int
+	}{
+		{Description: "Default tenant", Claims: map[string]any{"sub": "d3f4u1"}, Status: http.StatusSeeOther},
+		{Description: "Tenant claim", Tenant: "springfield", Claims: map[string]any{"sub": "5pr1n9", "tenant": "springfield"}, Status: http.StatusSeeOther},
+		{Description: "No tenant claim", Tenant: "springfield", Claims: map[string]any{"sub": "n0c1a1m", "roles": []string{auth.RoleAdmin}}, Status: http.StatusUnauthorized},
+		{Description: "Other tenant claim", Tenant: "springfield", Claims: map[string]any{"sub": "5he1by", "tenant": "shelbyville", "roles": []string{auth.RoleAdmin}}, Status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			provider.Claims = tc.Claims
+			cookie, callback := startOIDCLogin(t, router, provider)
+			headers := map[string]string{"Cookie": cookie}
+			if tc.Tenant != "" {
+				headers["X-Tenant"] = tc.Tenant
+			}
+			response, err := api.SendRequestWithHeaders(router, http.MethodGet, callback.RequestURI(), nil, headers)
+			require.NoError(t, err)
+			assert.Equal(t, tc.Status, response.Code, response.Body.String())
+		})
+	}
+
+	// The users refused are not created
+	response := sendToTenant(t, router, http.MethodGet, "/admin/users", nil, "springfield", createTenantKey(t, router, "springfield", auth.RoleAdmin).Key)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	assert.Contains(t, response.Body.String(), "5pr1n9")
+	assert.NotContains(t, response.Body.String(), "n0c1a1m")
+	assert.NotContains(t, response.Body.String(), "5he1by")
+}
+
+func TestTenantBranding(t *testing.T) {
+	router, _ := setupTenantServer(t)
+	settings := handlers.TenantSettings{Name: "Springfield Public Library", LoanDays: 21, Tagline: "Embiggen your mind", Color: "#336699", LogoURL: "https://springfield.example/logo.png"}
+	response := sendToTenant(t, router, http.MethodPut, "/admin/tenants/springfield", settings, "", adminKey)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	response, err := api.SendRequest(router, http.MethodGet, "http://springfield."+tenantDomain+"/", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Header().Values("Vary"), "X-Tenant")
+	page := response.Body.String()
+	for _, branding := range []string{"Welcome to the Springfield Public Library!", "Embiggen your mind", "lent for 21 days", "#336699", `src="https://springfield.example/logo.png"`} {
+		assert.Contains(t, page, branding)
+	}
+
+	response, err = api.SendRequest(router, http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	assert.Contains(t, response.Body.String(), "Welcome to the Book Management API!")
+
+	// Without tenancy, every request is served the default tenant
+	router = setupAuthServer(t)
+	response = sendToTenant(t, router, http.MethodGet, "/tenant", nil, "springfield", "")
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `"slug":"default"`)
+}
@@ -44,6 +44,28 @@ func SendRequest(router *gin.Engine, method string, path string, requestBody []b
 	return response, nil
 }
 
+// SendRequestWithHeaders sends a request with custom headers such as Accept
+func SendRequestWithHeaders(router *gin.Engine, method string, path string, requestBody []byte, headers map[string]string) (*httptest.ResponseRecorder, error) {
+	var body io.Reader
+	if requestBody != nil {
+		body = bytes.NewBuffer(requestBody)
+	}
+	request, err := http.NewRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept-Version", apiVersionV1)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response, nil
+}
+
 func SendRequestV1(router *gin.Engine, method string, path string, requestBody []byte) (*httptest.ResponseRecorder, error) {
 	url := v1Prefix + path
 
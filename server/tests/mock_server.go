@@ -5,8 +5,7 @@ import (
 	"fmt"
 	"library/api"
 	"library/config"
-	"library/db"
-	"library/models"
+	"library/repository"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -24,7 +23,6 @@ const (
 	healthCheckPath = "/health"
 	testPort        = 8088
 	contextTimeout  = 10
-	testDatabase    = "postgres"
 )
 
 var ServerAddress = ""
@@ -37,27 +35,21 @@ func UpdateHostAddress(host string, port int) {
 	ServerAddress = host + ":" + strconv.Itoa(port)
 }
 
-func SetupMockServer() (context.Context, *gin.Engine, db.Database) {
+// SetupMockServer starts the API server on an empty in-memory repository.
+func SetupMockServer() (context.Context, *gin.Engine, repository.BookRepository) {
 	// Load config
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(contextTimeout*time.Second))
+	ctx := context.Background()
+	loadCtx, cancel := context.WithDeadline(ctx, time.Now().Add(contextTimeout*time.Second))
 	defer cancel()
-	cfg, err := config.Load(ctx)
+	cfg, err := config.Load(loadCtx, config.Sources{})
 	if err != nil {
 		slog.Error("Error loading config file")
 	}
 	slog.Info("loaded configuration successfully.", "Configuration", cfg)
 
-	// Initialize the database connection
-	db := db.New()
-	cfg.Database.Name = testDatabase
-	err = db.Connect(&cfg.Database)
-	if err != nil {
-		slog.Error("Error connecting to Database")
-	}
-	time.Sleep(time.Second)
-
 	// Start the API server
-	router := api.SetupRouter(db, "../../")
+	store := repository.NewMemory()
+	router := api.SetupRouter(store, api.Options{}, "../../")
 
 	// Choose some arbitrary port for that consecutive tests
 	// might lead to ports in a CLOSE_WAIT status
@@ -76,7 +68,7 @@ func SetupMockServer() (context.Context, *gin.Engine, db.Database) {
 	select {
 	case err := <-errChan:
 		if err != nil {
-			slog.Error("Failed to start the server: %v", err)
+			slog.Error("Failed to start the server.", "error", err)
 		}
 	case <-time.After(time.Second * 5): // Timeout after 5 seconds
 		slog.Info("Server started successfully")
@@ -90,20 +82,15 @@ func SetupMockServer() (context.Context, *gin.Engine, db.Database) {
 		slog.Error(err.Error())
 	}
 
-	return ctx, router, db
+	return ctx, router, store
 }
 
-func TearDownMockServer(ctx context.Context, db db.Database) {
+func TearDownMockServer(ctx context.Context, store repository.BookRepository) {
 	// Shut down the server gracefully
 	err := api.ShutdownServer(ctx)
 	if err != nil {
 		slog.Error(err.Error())
 	}
-
-	err = db.DB.Migrator().DropTable(&models.Book{})
-	if err != nil {
-		slog.Error(err.Error())
-	}
 }
 
 func waitForServerReady(address string) error {
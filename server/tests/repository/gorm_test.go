@@ -0,0 +1,60 @@
+package repository_test
+
+import (
+	"library/db"
+	"library/repository"
+	"library/repository/repositorytest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGORM(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.BookRepository {
+		database := db.SetupTest(t)
+		t.Cleanup(func() {
+			assert.NoError(t, database.Teardown())
+		})
+		return repository.NewGORM(database.DB)
+	})
+}
+
+func TestGORMKeys(t *testing.T) {
+	repositorytest.RunKeys(t, func(t *testing.T) repository.KeyRepository {
+		database := db.SetupTest(t)
+		t.Cleanup(func() {
+			assert.NoError(t, database.Teardown())
+		})
+		return repository.NewGORMKeys(database.DB)
+	})
+}
+
+func TestGORMUsers(t *testing.T) {
+	repositorytest.RunUsers(t, func(t *testing.T) repository.UserRepository {
+		database := db.SetupTest(t)
+		t.Cleanup(func() {
+			assert.NoError(t, database.Teardown())
+		})
+		return repository.NewGORMUsers(database.DB)
+	})
+}
+
+func TestGORMSessions(t *testing.T) {
+	repositorytest.RunSessions(t, func(t *testing.T) (repository.UserRepository, repository.SessionRepository) {
+		database := db.SetupTest(t)
+		t.Cleanup(func() {
+			assert.NoError(t, database.Teardown())
+		})
+		return repository.NewGORMUsers(database.DB), repository.NewGORMSessions(database.DB)
+	})
+}
+
+func TestGORMTenants(t *testing.T) {
+	repositorytest.RunTenants(t, func(t *testing.T) repository.TenantRepository {
+		database := db.SetupTest(t)
+		t.Cleanup(func() {
+			assert.NoError(t, database.Teardown())
+		})
+		return repository.NewGORMTenants(database.DB)
+	})
+}
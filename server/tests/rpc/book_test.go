@@ -0,0 +1,269 @@
+package rpc_test
+
+import (
+	"context"
+	"io"
+	"library/auth"
+	"library/config"
+	"library/models"
+	libraryv1 "library/proto/library/v1"
+	"library/repository"
+	"library/rpc"
+	"library/tests"
+	"library/tests/api"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// dial serves the gRPC server over an in-memory listener and connects to it.
+func dial(t *testing.T, books repository.BookRepository, options rpc.Options) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	server := rpc.NewServer(books, options)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestBookService(t *testing.T) {
+	ctx, router, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	books := api.CreateListOfBookTemplates(t, router)
+	client := libraryv1.NewBookServiceClient(dial(t, store, rpc.Options{}))
+
+	t.Run("Get Book", func(t *testing.T) {
+		response, err := client.GetBook(ctx, &libraryv1.GetBookRequest{Id: uint64(books[0].ID)})
+		assert.NoError(t, err)
+		assert.Equal(t, books[0].Title, response.GetBook().GetTitle())
+
+		_, err = client.GetBook(ctx, &libraryv1.GetBookRequest{Id: uint64(books[len(books)-1].ID) + 1})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("List Books", func(t *testing.T) {
+		stream, err := client.ListBooks(ctx, &libraryv1.ListBooksRequest{})
+		assert.NoError(t, err)
+
+		received := 0
+		for {
+			_, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			received++
+		}
+		assert.Equal(t, len(books), received)
+	})
+
+	t.Run("Search Books", func(t *testing.T) {
+		response, err := client.SearchBooks(ctx, &libraryv1.SearchBooksRequest{Genre: "Science Fiction"})
+		assert.NoError(t, err)
+		assert.Len(t, response.GetBooks(), 3)
+
+		_, err = client.SearchBooks(ctx, &libraryv1.SearchBooksRequest{From: "yesterday"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Count Books", func(t *testing.T) {
+		response, err := client.CountBooks(ctx, &libraryv1.CountBooksRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(books)), response.GetCount())
+	})
+}
+
+func TestBookServiceMutations(t *testing.T) {
+	ctx, _, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	client := libraryv1.NewBookServiceClient(dial(t, store, rpc.Options{}))
+
+	added, err := client.AddBook(ctx, &libraryv1.AddBookRequest{Book: &libraryv1.Book{
+		Title:     "Emma",
+		Author:    "Jane Austen",
+		Edition:   1,
+		Published: timestamppb.New(timestamppb.Now().AsTime().AddDate(-200, 0, 0)),
+	}})
+	assert.NoError(t, err)
+	id := added.GetBook().GetId()
+	assert.NotZero(t, id)
+
+	_, err = client.AddBook(ctx, &libraryv1.AddBookRequest{Book: &libraryv1.Book{Title: "Emma", Edition: 1}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "A book needs an author")
+
+	updated, err := client.UpdateBook(ctx, &libraryv1.UpdateBookRequest{Book: &libraryv1.Book{Id: id, Title: "Emma", Author: "Jane Austen", Edition: 2}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), updated.GetBook().GetEdition())
+
+	patched, err := client.PatchBook(ctx, &libraryv1.PatchBookRequest{
+		Book:       &libraryv1.Book{Id: id, GenreName: "Romance", Title: "Ignored"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"genre_name"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Romance", patched.GetBook().GetGenreName())
+	assert.Equal(t, "Emma", patched.GetBook().GetTitle())
+
+	_, err = client.PatchBook(ctx, &libraryv1.PatchBookRequest{
+		Book:       &libraryv1.Book{Id: id},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"shelf"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.DeleteBook(ctx, &libraryv1.DeleteBookRequest{Id: id})
+	assert.NoError(t, err)
+	_, err = client.DeleteBook(ctx, &libraryv1.DeleteBookRequest{Id: id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestHealthCheck(t *testing.T) {
+	ctx, _, store := tests.SetupMockServer()
+	defer tests.TearDownMockServer(ctx, store)
+
+	client := healthpb.NewHealthClient(dial(t, store, rpc.Options{}))
+	response, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: libraryv1.BookService_ServiceDesc.ServiceName})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, response.GetStatus())
+}
+
+// adminKey is the admin key of the guarded servers.
+const adminKey = "lib_the-admin-key-of-the-library"
+
+// createKey stores an API key of a role in a tenant, and returns it.
+func createKey(t *testing.T, keys repository.KeyRepository, tenant uint, role string) string {
+	key, hash, err := auth.NewKey()
+	require.NoError(t, err)
+	require.NoError(t, keys.Create(repository.WithTenant(context.Background(), tenant), &models.APIKey{Name: role, Role: role, Hash: hash, Hint: auth.Hint(key)}))
+	return key
+}
+
+// withKey returns a context calling with an API key, and the other metadata
+// pairs.
+func withKey(key string, pairs ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), append([]string{"x-api-key", key}, pairs...)...)
+}
+
+func TestAuthorization(t *testing.T) {
+	store := repository.NewMemory()
+	keys := repository.NewMemoryKeys()
+	librarian := createKey(t, keys, repository.DefaultTenant, auth.RoleLibrarian)
+	client := libraryv1.NewBookServiceClient(dial(t, store, rpc.Options{
+		Auth: auth.New(keys, auth.Options{AdminKey: adminKey, GuestRole: auth.RolePatron}),
+	}))
+	book := &libraryv1.Book{Title: "Emma", Author: "Jane Austen", Edition: 1}
+
+	// The guests only read the books
+	_, err := client.CountBooks(context.Background(), &libraryv1.CountBooksRequest{})
+	assert.NoError(t, err)
+	_, err = client.AddBook(context.Background(), &libraryv1.AddBookRequest{Book: book})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.AddBook(withKey("lib_unknown-key-of-nobody"), &libraryv1.AddBookRequest{Book: book})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The librarians change them, but only the admins delete them
+	added, err := client.AddBook(withKey(librarian), &libraryv1.AddBookRequest{Book: book})
+	require.NoError(t, err)
+	_, err = client.DeleteBook(withKey(librarian), &libraryv1.DeleteBookRequest{Id: added.GetBook().GetId()})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+adminKey)
+	_, err = client.DeleteBook(ctx, &libraryv1.DeleteBookRequest{Id: added.GetBook().GetId()})
+	assert.NoError(t, err)
+
+	// The streams are guarded too
+	stream, err := libraryv1.NewBookServiceClient(dial(t, store, rpc.Options{
+		Auth: auth.New(keys, auth.Options{}),
+	})).ListBooks(context.Background(), &libraryv1.ListBooksRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Whatever the credentials, the health checks answer
+	health := healthpb.NewHealthClient(dial(t, store, rpc.Options{Auth: auth.New(keys, auth.Options{})}))
+	_, err = health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.Runtime.RateLimits = []string{"search=1:1"}
+	client := libraryv1.NewBookServiceClient(dial(t, repository.NewMemory(), rpc.Options{Live: config.NewLive(cfg)}))
+
+	_, err := client.SearchBooks(context.Background(), &libraryv1.SearchBooksRequest{Q: "Emma"})
+	assert.NoError(t, err)
+	var header metadata.MD
+	_, err = client.SearchBooks(context.Background(), &libraryv1.SearchBooksRequest{Q: "Emma"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"1"}, header.Get("retry-after"))
+
+	// The other groups are not limited
+	_, err = client.CountBooks(context.Background(), &libraryv1.CountBooksRequest{})
+	assert.NoError(t, err)
+}
+
+func TestTenancy(t *testing.T) {
+	store := repository.NewMemory()
+	keys := repository.NewMemoryKeys()
+	tenants := repository.NewMemoryTenants()
+	springfield := models.Tenant{Slug: "springfield", Name: "Springfield Public Library", LoanDays: 21}
+	require.NoError(t, tenants.Create(context.Background(), &springfield))
+	librarian := createKey(t, keys, springfield.ID, auth.RoleLibrarian)
+	require.NoError(t, store.Create(context.Background(), &models.Book{Title: "Dune", Author: "Frank Herbert", Edition: 1}))
+
+	client := libraryv1.NewBookServiceClient(dial(t, store, rpc.Options{
+		Tenants: tenants,
+		Tenancy: config.TenancyConfig{Enabled: true, Header: "X-Tenant", Claim: "tenant"},
+		Auth:    auth.New(keys, auth.Options{AdminKey: adminKey, GuestRole: auth.RolePatron}),
+	}))
+
+	// The key of a tenant only sees and changes its books
+	_, err := client.AddBook(withKey(librarian), &libraryv1.AddBookRequest{Book: &libraryv1.Book{Title: "Emma", Author: "Jane Austen", Edition: 1}})
+	require.NoError(t, err)
+	response, err := client.SearchBooks(withKey(librarian), &libraryv1.SearchBooksRequest{})
+	assert.NoError(t, err)
+	if assert.Len(t, response.GetBooks(), 1) {
+		assert.Equal(t, "Emma", response.GetBooks()[0].GetTitle())
+	}
+	count, err := client.CountBooks(withKey(adminKey), &libraryv1.CountBooksRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count.GetCount(), "The default tenant keeps its books")
+	count, err = client.CountBooks(withKey(adminKey, "x-tenant", "springfield"), &libraryv1.CountBooksRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count.GetCount())
+
+	// It may not reach the other tenants
+	_, err = client.CountBooks(withKey(librarian, "x-tenant", "default"), &libraryv1.CountBooksRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.CountBooks(withKey(librarian, "x-tenant", "shelbyville"), &libraryv1.CountBooksRequest{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestPolicy(t *testing.T) {
+	service := libraryv1.BookService_ServiceDesc
+	for _, method := range service.Methods {
+		_, ok := rpc.Policy["/"+service.ServiceName+"/"+method.MethodName]
+		assert.True(t, ok, "No policy for %s", method.MethodName)
+	}
+	for _, stream := range service.Streams {
+		_, ok := rpc.Policy["/"+service.ServiceName+"/"+stream.StreamName]
+		assert.True(t, ok, "No policy for %s", stream.StreamName)
+	}
+}
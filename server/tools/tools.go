@@ -37,7 +37,7 @@ func SearchRootDirectory() (string, error) {
 func GetCurrentDirectory() string {
 	cwd, err := os.Getwd()
 	if err != nil {
-		slog.Error("Error getting the current working directory:", err)
+		slog.Error("Error getting the current working directory.", "error", err)
 		return ""
 	}
 	return cwd